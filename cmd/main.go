@@ -6,11 +6,18 @@ import (
 	"time"
 
 	"github.com/Kyz7/cms/internal/config"
+	"github.com/Kyz7/cms/internal/cron"
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/feed"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/mail"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/role"
+	"github.com/Kyz7/cms/internal/search"
 	"github.com/Kyz7/cms/internal/server"
 	"github.com/Kyz7/cms/internal/utils"
+	"github.com/Kyz7/cms/internal/webhook"
+	"github.com/Kyz7/cms/internal/workflow"
 )
 
 func main() {
@@ -88,6 +95,12 @@ func main() {
 		utils.SetStorageMode(true)
 	}
 
+	// ========== MAIL SETUP ==========
+	if err := mail.Configure(cfg); err != nil {
+		log.Fatal("❌ Mail configuration failed: ", err)
+	}
+	log.Printf("✅ Mail configured (%s transport)", cfg.MailTransport)
+
 	// ========== SEED DEFAULT DATA ==========
 	if err := role.SeedDefaultRoles(); err != nil {
 		log.Println("⚠️  Failed to seed roles (may already exist):", err)
@@ -102,22 +115,96 @@ func main() {
 	}
 
 	// ========== BACKGROUND JOBS ==========
-	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			result := database.DB.Where("expires_at < ?", time.Now()).Delete(&models.ResetToken{})
-			if result.RowsAffected > 0 {
-				log.Printf("🧹 Cleaned up %d expired reset tokens", result.RowsAffected)
-			}
+	// Mail, exports and webhooks register their handlers themselves.
+	jobs.Register("tokens.cleanup", func(struct{}) error {
+		result := database.DB.Where("expires_at < ?", time.Now()).Delete(&models.ResetToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("🧹 Cleaned up %d expired reset tokens", result.RowsAffected)
+		}
 
-			result = database.DB.Where("expires_at < ?", time.Now()).Delete(&models.RefreshToken{})
-			if result.RowsAffected > 0 {
-				log.Printf("🧹 Cleaned up %d expired refresh tokens", result.RowsAffected)
-			}
+		result = database.DB.Where("expires_at < ?", time.Now()).Delete(&models.RefreshToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("🧹 Cleaned up %d expired refresh tokens", result.RowsAffected)
+		}
+		return nil
+	})
+	jobs.Register("workflow.schedule", func(struct{}) error {
+		now := time.Now()
+		applied, err := workflow.RunScheduledTransitions(now)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			log.Printf("📅 Applied %d scheduled workflow transitions", applied)
+		}
+
+		released, err := workflow.RunScheduledReleases(now)
+		if err != nil {
+			return err
+		}
+		if released > 0 {
+			log.Printf("📦 Ran %d scheduled releases", released)
+		}
+		return nil
+	})
+
+	assignmentPolicy := workflow.DefaultAssignmentPolicy
+	assignmentPolicy.EscalationRole = cfg.AssignmentEscalationRole
+	jobs.Register("workflow.assignments", func(struct{}) error {
+		result, err := workflow.RunAssignmentChecks(time.Now(), assignmentPolicy)
+		if err != nil {
+			return err
+		}
+		if result.Reminded+result.Overdue+result.Escalated > 0 {
+			log.Printf("⏰ Assignments: %d reminded, %d overdue, %d escalated",
+				result.Reminded, result.Overdue, result.Escalated)
+		}
+		return nil
+	})
+	jobs.Register("feed.cleanup", func(struct{}) error {
+		if _, err := feed.Prune(time.Now().Add(-24 * time.Hour)); err != nil {
+			return err
 		}
-	}()
+		_, err := feed.PruneTickets(time.Now())
+		return err
+	})
+
+	jobConfig := jobs.DefaultConfig
+	jobConfig.Queues = map[string]int{
+		jobs.DefaultQueue:  4,
+		mail.Queue:         2,
+		search.ExportQueue: 1,
+		webhook.Queue:      4,
+	}
+	jobs.Start(jobConfig)
+	log.Println("✅ Job workers started")
+
+	// Scheduled tasks only queue their job; the job workers do the work.
+	for _, task := range []struct{ name, spec string }{
+		{"tokens.cleanup", "@hourly"},
+		{"workflow.schedule", "* * * * *"},
+		{"workflow.assignments", "*/15 * * * *"},
+		{"feed.cleanup", "@hourly"},
+		{search.JobExportCleanup, "@hourly"},
+	} {
+		if err := cron.RegisterJob(task.name, task.spec, task.name, jobs.Options{}); err != nil {
+			log.Fatal("❌ Failed to register scheduled task: ", err)
+		}
+	}
+
+	cron.Start(30 * time.Second)
+	log.Println("✅ Scheduled tasks started")
+
+	// Unlike the tasks above this runs on every instance: it hands events to
+	// the streams connected to this one.
+	feed.StartPoller(time.Second)
+	log.Println("✅ Change feed poller started")
 
 	// ========== START SERVER ==========
 	app := server.New(db)
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func ListAuditLogsHandler(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	filter := Filter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+		RequestID:    c.Query("request_id"),
+	}
+
+	if actor := c.Query("actor_id"); actor != "" {
+		id, err := strconv.ParseUint(actor, 10, 32)
+		if err != nil {
+			return response.BadRequest(c, "Invalid actor_id", nil)
+		}
+		actorID := uint(id)
+		filter.ActorID = &actorID
+	}
+
+	var err error
+	if filter.From, err = parseTime(c.Query("from")); err != nil {
+		return response.BadRequest(c, "Invalid from date, use RFC3339 or YYYY-MM-DD", nil)
+	}
+	if filter.To, err = parseTime(c.Query("to")); err != nil {
+		return response.BadRequest(c, "Invalid to date, use RFC3339 or YYYY-MM-DD", nil)
+	}
+
+	logs, total, err := ListAuditLogs(filter, page, limit)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch audit logs")
+	}
+
+	meta := response.CalculateMeta(page, limit, total)
+	return response.SuccessWithMeta(c, logs, meta, "Audit logs retrieved successfully")
+}
+
+func GetAuditLogHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid audit log ID", nil)
+	}
+
+	var record models.AuditLog
+	if err := database.DB.First(&record, id).Error; err != nil {
+		return response.NotFound(c, "Audit log")
+	}
+	return response.Success(c, record, "Audit log retrieved successfully")
+}
+
+func VerifyChainHandler(c *fiber.Ctx) error {
+	result, err := VerifyChain()
+	if err != nil {
+		return response.InternalError(c, "Failed to verify audit log")
+	}
+	return response.Success(c, result, "Audit log verified")
+}
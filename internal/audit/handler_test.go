@@ -0,0 +1,148 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_audit@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_audit@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	resp, _ := testutils.MakeRequest(app, "POST", "/roles/", map[string]interface{}{
+		"name":        "reviewer",
+		"description": "Reviews entries",
+		"permissions": []map[string]interface{}{{"module": "ContentEntry", "action": "read"}},
+	}, adminToken)
+	assert.Equal(t, 201, resp.Code)
+	var created struct {
+		Data models.Role `json:"data"`
+	}
+	testutils.ParseResponse(t, resp, &created)
+	roleID := created.Data.ID
+
+	resp, _ = testutils.MakeRequestWithHeaders(app, "PUT", fmt.Sprintf("/roles/%d", roleID), map[string]interface{}{
+		"name":        "reviewer",
+		"description": "Reviews and approves entries",
+		"permissions": []map[string]interface{}{
+			{"module": "ContentEntry", "action": "read"},
+			{"module": "ContentEntry", "action": "approve"},
+		},
+	}, adminToken, map[string]string{"X-Request-ID": "req-role-update"})
+	assert.Equal(t, 200, resp.Code)
+
+	t.Run("Records actor, request and before/after", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/audit/logs?request_id=req-role-update", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		var result struct {
+			Data []models.AuditLog `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		if assert.Len(t, result.Data, 1) {
+			record := result.Data[0]
+			assert.Equal(t, "role.update", record.Action)
+			assert.Equal(t, "role", record.ResourceType)
+			assert.Equal(t, fmt.Sprint(roleID), record.ResourceID)
+			if assert.NotNil(t, record.ActorID) {
+				assert.Equal(t, admin.ID, *record.ActorID)
+			}
+
+			var before, after models.Role
+			json.Unmarshal(record.Before, &before)
+			json.Unmarshal(record.After, &after)
+			assert.Equal(t, "Reviews entries", before.Description)
+			assert.Len(t, before.Permissions, 1)
+			assert.Equal(t, "Reviews and approves entries", after.Description)
+			assert.Len(t, after.Permissions, 2)
+		}
+	})
+
+	t.Run("Filters by resource and actor", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET",
+			fmt.Sprintf("/audit/logs?resource_type=role&resource_id=%d&actor_id=%d", roleID, admin.ID), nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		var result struct {
+			Data []models.AuditLog `json:"data"`
+			Meta testutils.Meta    `json:"meta"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, int64(2), result.Meta.Total)
+		if assert.Len(t, result.Data, 2) {
+			assert.Equal(t, "role.update", result.Data[0].Action)
+			assert.Equal(t, "role.create", result.Data[1].Action)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/audit/logs?actor_id=abc", nil, adminToken)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Login failures are recorded without the password", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", "/auth/login", map[string]string{
+			"email":    "editor_audit@test.com",
+			"password": "wrong-password",
+		}, "")
+		assert.Equal(t, 401, resp.Code)
+
+		var record models.AuditLog
+		err := database.DB.Where("action = ?", "auth.login_failed").Last(&record).Error
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(editor.ID), record.ResourceID)
+		assert.NotContains(t, string(record.After), "wrong-password")
+	})
+
+	t.Run("Only admins can read the audit log", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/audit/logs", nil, editorToken)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Records cannot be changed through the ORM", func(t *testing.T) {
+		var record models.AuditLog
+		database.DB.First(&record)
+
+		err := database.DB.Model(&record).Update("action", "role.read").Error
+		assert.ErrorIs(t, err, models.ErrAuditLogImmutable)
+
+		err = database.DB.Delete(&record).Error
+		assert.ErrorIs(t, err, models.ErrAuditLogImmutable)
+	})
+
+	t.Run("Verify detects tampering", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/audit/verify", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		var result struct {
+			Data struct {
+				Valid    bool  `json:"valid"`
+				Checked  int   `json:"checked"`
+				BrokenAt *uint `json:"broken_at"`
+			} `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		assert.True(t, result.Data.Valid)
+		assert.GreaterOrEqual(t, result.Data.Checked, 3)
+
+		var record models.AuditLog
+		database.DB.Where("action = ?", "role.create").First(&record)
+		database.DB.Exec("UPDATE audit_logs SET actor_id = ? WHERE id = ?", editor.ID, record.ID)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/audit/verify", nil, adminToken)
+		testutils.ParseResponse(t, resp, &result)
+		assert.False(t, result.Data.Valid)
+		if assert.NotNil(t, result.Data.BrokenAt) {
+			assert.Equal(t, record.ID, *result.Data.BrokenAt)
+		}
+	})
+}
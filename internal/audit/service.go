@@ -0,0 +1,276 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Entry describes one mutation to record. Before and After are encoded as
+// JSON; either may be nil.
+type Entry struct {
+	ActorID      *uint
+	IP           string
+	UserAgent    string
+	RequestID    string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Before       interface{}
+	After        interface{}
+}
+
+type Filter struct {
+	ActorID      *uint
+	Action       string
+	ResourceType string
+	ResourceID   string
+	RequestID    string
+	From         *time.Time
+	To           *time.Time
+}
+
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt *uint  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// appendMu serialises appends within this process; the unique index on
+// prev_hash keeps the chain linear across processes.
+var appendMu sync.Mutex
+
+const appendAttempts = 3
+
+// FromRequest fills in the actor, client and request ID of c.
+func FromRequest(c *fiber.Ctx) Entry {
+	entry := Entry{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+	if userID, ok := c.Locals("user_id").(uint); ok {
+		entry.ActorID = &userID
+	}
+	if requestID, ok := c.Locals("requestid").(string); ok {
+		entry.RequestID = requestID
+	}
+	return entry
+}
+
+// Record logs action on the resource as performed by c's user.
+func Record(c *fiber.Ctx, action, resourceType string, resourceID interface{}, before, after interface{}) {
+	entry := FromRequest(c)
+	entry.Action = action
+	entry.ResourceType = resourceType
+	entry.ResourceID = fmt.Sprint(resourceID)
+	entry.Before = before
+	entry.After = after
+	Log(entry)
+}
+
+// Log appends entry to the audit log. Failures are logged rather than
+// returned so auditing never fails the operation being audited.
+func Log(entry Entry) {
+	if _, err := Append(entry); err != nil {
+		log.Printf("⚠️  Failed to write audit log for %s: %v", entry.Action, err)
+	}
+}
+
+func encode(value interface{}) (datatypes.JSON, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+// Append writes entry as the newest link of the chain.
+func Append(entry Entry) (*models.AuditLog, error) {
+	before, err := encode(entry.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := encode(entry.After)
+	if err != nil {
+		return nil, err
+	}
+
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		var last models.AuditLog
+		if err := database.DB.Select("hash").Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+			return nil, err
+		}
+
+		record := models.AuditLog{
+			ActorID:      entry.ActorID,
+			IP:           entry.IP,
+			UserAgent:    entry.UserAgent,
+			Action:       entry.Action,
+			ResourceType: entry.ResourceType,
+			ResourceID:   entry.ResourceID,
+			Before:       before,
+			After:        after,
+			RequestID:    entry.RequestID,
+			PrevHash:     last.Hash,
+			CreatedAt:    time.Now().UTC().Truncate(time.Microsecond),
+		}
+		record.Hash = computeHash(&record)
+
+		err := database.DB.Create(&record).Error
+		if err == nil {
+			return &record, nil
+		}
+		if attempt == appendAttempts {
+			return nil, err
+		}
+	}
+}
+
+// computeHash is the SHA-256 of the previous hash and every recorded field.
+func computeHash(record *models.AuditLog) string {
+	actor := ""
+	if record.ActorID != nil {
+		actor = fmt.Sprint(*record.ActorID)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(strings.Join([]string{
+		record.PrevHash,
+		record.CreatedAt.UTC().Format(time.RFC3339Nano),
+		actor,
+		record.IP,
+		record.UserAgent,
+		record.Action,
+		record.ResourceType,
+		record.ResourceID,
+		string(record.Before),
+		string(record.After),
+		record.RequestID,
+	}, "\x1f")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyChain recomputes every hash in order and reports the first row that
+// was altered, removed or inserted out of band.
+func VerifyChain() (VerifyResult, error) {
+	result := VerifyResult{Valid: true}
+	prevHash := ""
+
+	lastID := uint(0)
+	for {
+		var batch []models.AuditLog
+		if err := database.DB.Where("id > ?", lastID).Order("id ASC").Limit(500).Find(&batch).Error; err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+
+		for i := range batch {
+			record := &batch[i]
+			result.Checked++
+
+			reason := ""
+			switch {
+			case record.PrevHash != prevHash:
+				reason = "previous hash does not match, a record was removed or inserted"
+			case computeHash(record) != record.Hash:
+				reason = "record contents do not match its hash"
+			}
+			if reason != "" {
+				id := record.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				result.Reason = reason
+				return result, nil
+			}
+
+			prevHash = record.Hash
+			lastID = record.ID
+		}
+	}
+}
+
+func applyFilter(filter Filter) *gorm.DB {
+	query := database.DB.Model(&models.AuditLog{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+	return query
+}
+
+func ListAuditLogs(filter Filter, page, limit int) ([]models.AuditLog, int64, error) {
+	var total int64
+	if err := applyFilter(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []models.AuditLog
+	err := applyFilter(filter).
+		Order("id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&logs).Error
+	return logs, total, err
+}
+
+var subscribeOnce sync.Once
+
+// Subscribe records workflow transitions, which happen from handlers, the
+// scheduler and releases alike. Other mutations are recorded by their handlers
+// so the request that caused them is known.
+func Subscribe() {
+	subscribeOnce.Do(func() {
+		events.After(func(e events.StatusChanged) {
+			entry := Entry{
+				Action:       "entry.status_change",
+				ResourceType: "entry",
+				ResourceID:   fmt.Sprint(e.Entry.ID),
+				Before:       map[string]interface{}{"status": e.From},
+				After:        map[string]interface{}{"status": e.To, "version": e.Entry.Version, "comment": e.Comment},
+			}
+			if e.UserID != 0 {
+				userID := e.UserID
+				entry.ActorID = &userID
+			}
+			Log(entry)
+		})
+	})
+}
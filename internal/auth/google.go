@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/utils"
 
@@ -121,6 +122,9 @@ func GoogleCallback(c *fiber.Ctx) error {
 	accessToken, _ := utils.GenerateJWT(u.ID, u.Role.Name)
 	refreshToken, _ := utils.GenerateRefreshToken(u.ID)
 
+	events.Publish(events.UserLoggedIn{User: u, Method: "google"})
+	recordAuth(c, "auth.login", u.ID, u.Email)
+
 	return c.JSON(fiber.Map{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
@@ -6,10 +6,11 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
-	"net/smtp"
 	"time"
 
+	"github.com/Kyz7/cms/internal/audit"
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/mail"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
 	"github.com/Kyz7/cms/internal/utils"
@@ -17,6 +18,22 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// recordAuth logs an authentication event. userID is zero when the request
+// did not resolve to an account, e.g. a failed login for an unknown email.
+func recordAuth(c *fiber.Ctx, action string, userID uint, email string) {
+	entry := audit.FromRequest(c)
+	entry.Action = action
+	entry.ResourceType = "user"
+	if userID != 0 {
+		entry.ActorID = &userID
+		entry.ResourceID = fmt.Sprint(userID)
+	}
+	if email != "" {
+		entry.After = fiber.Map{"email": email}
+	}
+	audit.Log(entry)
+}
+
 func RegisterHandler(c *fiber.Ctx) error {
 	var body struct {
 		Name     string `json:"name"`
@@ -61,6 +78,7 @@ func RegisterHandler(c *fiber.Ctx) error {
 	}
 
 	database.DB.Preload("Role").First(&u, u.ID)
+	recordAuth(c, "auth.register", u.ID, u.Email)
 
 	accessToken, _ := utils.GenerateJWT(u.ID, u.Role.Name)
 	refreshToken, _ := utils.GenerateRefreshToken(u.ID)
@@ -89,10 +107,15 @@ func LoginHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	var userID uint
+	database.DB.Model(&models.User{}).Select("id").Where("email = ?", body.Email).Scan(&userID)
+
 	accessToken, refreshToken, err := LoginUser(body.Email, body.Password)
 	if err != nil {
+		recordAuth(c, "auth.login_failed", userID, body.Email)
 		return response.Unauthorized(c, "Invalid email or password")
 	}
+	recordAuth(c, "auth.login", userID, body.Email)
 
 	return response.Success(c, fiber.Map{
 		"access_token":  accessToken,
@@ -158,6 +181,7 @@ func LogoutHandler(c *fiber.Ctx) error {
 		})
 	}
 	log.Printf("User %d logged out", userID)
+	recordAuth(c, "auth.logout", userID, "")
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
@@ -202,12 +226,16 @@ func ForgotPasswordHandler(c *fiber.Ctx) error {
 	if err := database.DB.Create(&reset).Error; err != nil {
 		return response.InternalError(c, "Failed to save reset token")
 	}
+	recordAuth(c, "auth.password_reset_request", user.ID, user.Email)
 
-	resetURL := fmt.Sprintf("http://localhost:3000/reset-password?token=%s", plainToken)
-	msg := fmt.Sprintf("Subject: Password Reset\n\nClick here to reset: %s", resetURL)
-	_ = smtp.SendMail("smtp.example.com:587",
-		smtp.PlainAuth("", "your@email.com", "password", "smtp.example.com"),
-		"your@email.com", []string{user.Email}, []byte(msg))
+	err = mail.Send(user.Email, mail.TemplatePasswordReset, map[string]interface{}{
+		"Name":      user.Name,
+		"ResetURL":  mail.Link("reset-password?token=" + plainToken),
+		"ExpiresIn": "1 hour",
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to send password reset email to %s: %v", user.Email, err)
+	}
 
 	return response.Success(c, nil, "If account exists, reset link has been sent")
 }
@@ -252,6 +280,7 @@ func ResetPasswordHandler(c *fiber.Ctx) error {
 	database.DB.Save(&user)
 
 	database.DB.Delete(&reset)
+	recordAuth(c, "auth.password_reset", user.ID, user.Email)
 
 	return response.Success(c, nil, "Password reset successful")
 }
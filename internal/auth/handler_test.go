@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/mail"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/testutils"
 	"github.com/Kyz7/cms/internal/utils"
@@ -219,6 +221,32 @@ func TestForgotPasswordHandler(t *testing.T) {
 		testutils.AssertSuccess(t, resp)
 	})
 
+	t.Run("Success - Reset link is emailed", func(t *testing.T) {
+		mailer := &mail.MemoryMailer{}
+		mail.SetMailer(mailer)
+
+		body := map[string]interface{}{
+			"email": "forgot@example.com",
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/auth/forgot-password", body, "")
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		assert.Empty(t, mailer.Messages(), "the reset mail is queued, not sent in the request")
+
+		ran, err := jobs.RunNext(mail.Queue, time.Now(), jobs.DefaultConfig)
+		assert.NoError(t, err)
+		assert.True(t, ran)
+
+		messages := mailer.Messages()
+		if assert.Len(t, messages, 1) {
+			assert.Equal(t, []string{"forgot@example.com"}, messages[0].To)
+			assert.Equal(t, "Reset your password", messages[0].Subject)
+			assert.Contains(t, messages[0].Text, "/reset-password?token=")
+			assert.Contains(t, messages[0].HTML, "/reset-password?token=")
+		}
+	})
+
 	t.Run("Success - Non-existent email (security)", func(t *testing.T) {
 		body := map[string]interface{}{
 			"email": "nonexistent@example.com",
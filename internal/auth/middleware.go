@@ -6,6 +6,7 @@ import (
 	"github.com/Kyz7/cms/internal/database"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
+	"github.com/Kyz7/cms/internal/space"
 	"github.com/Kyz7/cms/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -46,6 +47,10 @@ func JWTProtected() fiber.Handler {
 			})
 		}
 
+		if spaceID, ok := database.SpaceFromContext(c.UserContext()); ok && !space.CanEnter(spaceID, userID) {
+			return response.Forbidden(c, "You are not a member of this space")
+		}
+
 		c.Locals("user_id", userID)
 		return c.Next()
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/utils"
 )
@@ -48,5 +49,8 @@ func LoginUser(email, password string) (string, string, error) {
 		return "", "", err
 	}
 
+	user.Password = ""
+	events.Publish(events.UserLoggedIn{User: user, Method: "password"})
+
 	return accessToken, refreshToken, nil
 }
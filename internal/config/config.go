@@ -14,6 +14,20 @@ type Config struct {
 	DBUser     string
 	DBPassword string
 	DBName     string
+
+	AssignmentEscalationRole string
+
+	// AppURL is the frontend base URL used for links in emails.
+	AppURL string
+
+	MailTransport   string // smtp, file, memory
+	MailFrom        string
+	MailLogPath     string // file transport
+	MailTemplateDir string // overrides for the built-in templates
+	SMTPHost        string
+	SMTPPort        string
+	SMTPUsername    string
+	SMTPPassword    string
 }
 
 func Load() *Config {
@@ -26,6 +40,19 @@ func Load() *Config {
 		DBUser:     getEnv("DB_USER", "postgres"),
 		DBPassword: getEnv("DB_PASSWORD", ""),
 		DBName:     getEnv("DB_NAME", "starpi"),
+
+		AssignmentEscalationRole: getEnv("ASSIGNMENT_ESCALATION_ROLE", ""),
+
+		AppURL: getEnv("APP_URL", "http://localhost:3000"),
+
+		MailTransport:   getEnv("MAIL_TRANSPORT", "file"),
+		MailFrom:        getEnv("MAIL_FROM", "CMS <no-reply@localhost>"),
+		MailLogPath:     getEnv("MAIL_LOG_PATH", "./mail.log"),
+		MailTemplateDir: getEnv("MAIL_TEMPLATE_DIR", ""),
+		SMTPHost:        getEnv("SMTP_HOST", ""),
+		SMTPPort:        getEnv("SMTP_PORT", "587"),
+		SMTPUsername:    getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:    getEnv("SMTP_PASSWORD", ""),
 	}
 
 	log.Println("✅ Config loaded")
@@ -33,13 +33,14 @@ type APIReference struct {
 }
 
 func GenerateAPIReferenceHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid content_type_id"})
 	}
 
 	var ct models.ContentType
-	if err := database.DB.
+	if err := database.DB.WithContext(ctx).
 		Preload("Fields", "is_seo = ?", false).
 		Preload("SEOFields", "is_seo = ?", true).
 		First(&ct, contentTypeID).Error; err != nil {
@@ -125,7 +126,7 @@ func generateAPIReference(ct models.ContentType, baseURL string) APIReference {
 			Parameters: map[string]interface{}{
 				"page":       map[string]interface{}{"type": "integer", "default": 1, "description": "Page number"},
 				"limit":      map[string]interface{}{"type": "integer", "default": 10, "description": "Items per page"},
-				"status":     map[string]interface{}{"type": "string", "enum": []string{"draft", "in_review", "approved", "published"}, "description": "Filter by status"},
+				"status":     map[string]interface{}{"type": "string", "enum": []string{"draft", "in_review", "approved", "published", "archived"}, "description": "Filter by status"},
 				"created_by": map[string]interface{}{"type": "integer", "description": "Filter by creator user ID"},
 				"from":       map[string]interface{}{"type": "string", "format": "date", "description": "Filter from date (YYYY-MM-DD)"},
 				"to":         map[string]interface{}{"type": "string", "format": "date", "description": "Filter to date (YYYY-MM-DD)"},
@@ -312,13 +313,14 @@ func getFieldDescription(field models.ContentField) string {
 }
 
 func GenerateOpenAPISpecHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid content_type_id"})
 	}
 
 	var ct models.ContentType
-	if err := database.DB.
+	if err := database.DB.WithContext(ctx).
 		Preload("Fields", "is_seo = ?", false).
 		Preload("SEOFields", "is_seo = ?", true).
 		First(&ct, contentTypeID).Error; err != nil {
@@ -487,13 +489,14 @@ func mapFieldTypeToOpenAPI(fieldType string) string {
 }
 
 func GenerateMarkdownDocsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid content_type_id"})
 	}
 
 	var ct models.ContentType
-	if err := database.DB.
+	if err := database.DB.WithContext(ctx).
 		Preload("Fields", "is_seo = ?", false).
 		Preload("SEOFields", "is_seo = ?", true).
 		First(&ct, contentTypeID).Error; err != nil {
@@ -592,7 +595,7 @@ func generateMarkdownDocs(ct models.ContentType, baseURL string) string {
 	md.WriteString("**Query Parameters:**\n\n")
 	md.WriteString("- `page` (integer, default: 1) - Page number\n")
 	md.WriteString("- `limit` (integer, default: 10) - Items per page\n")
-	md.WriteString("- `status` (string) - Filter by status (draft, in_review, approved, published)\n")
+	md.WriteString("- `status` (string) - Filter by status (draft, in_review, approved, published, archived)\n")
 	md.WriteString("- `created_by` (integer) - Filter by creator user ID\n")
 	md.WriteString("- `from` (date) - Filter from date (YYYY-MM-DD)\n")
 	md.WriteString("- `to` (date) - Filter to date (YYYY-MM-DD)\n\n")
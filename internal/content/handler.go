@@ -2,21 +2,28 @@ package content
 
 import (
 	"encoding/json"
+	"errors"
 	"strconv"
 	"strings"
 
+	"github.com/Kyz7/cms/internal/audit"
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/media"
 	"github.com/Kyz7/cms/internal/middleware"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
 	"github.com/Kyz7/cms/internal/utils"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type CreateContentTypeRequest struct {
-	Name string `json:"name"`
-	Slug string `json:"slug"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	IsTree     bool   `json:"is_tree"`
+	IsSortable bool   `json:"is_sortable"`
 }
 
 type AddFieldRequest struct {
@@ -45,6 +52,7 @@ type CreateRelationRequest struct {
 }
 
 func CreateContentTypeHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var body CreateContentTypeRequest
 	if err := c.BodyParser(&body); err != nil {
 		return response.BadRequest(c, "Invalid request body", err.Error())
@@ -57,15 +65,17 @@ func CreateContentTypeHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	ct, err := CreateContentType(body.Name, body.Slug)
+	ct, err := CreateContentType(ctx, body.Name, body.Slug, body.IsTree, body.IsSortable)
 	if err != nil {
 		return response.InternalError(c, "Failed to create content type")
 	}
+	audit.Record(c, "content_type.create", "content_type", ct.ID, nil, ct)
 
 	return response.Created(c, ct, "Content type created successfully")
 }
 
 func AddFieldHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, err := c.ParamsInt("content_type_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid content type ID", nil)
@@ -83,26 +93,42 @@ func AddFieldHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	field, err := AddFieldToContentType(uint(contentTypeID), body.Name, body.Type, body.Required, body.IsSEO)
+	var ct models.ContentType
+	if err := database.DB.WithContext(ctx).First(&ct, contentTypeID).Error; err != nil {
+		return response.NotFound(c, "Content type")
+	}
+
+	field, err := AddFieldToContentType(ctx, uint(contentTypeID), body.Name, body.Type, body.Required, body.IsSEO)
 	if err != nil {
 		return response.InternalError(c, "Failed to add field")
 	}
+	audit.Record(c, "field.create", "field", field.ID, nil, field)
 
 	return response.Created(c, field, "Field added successfully")
 }
 
 func CreateEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, _ := c.ParamsInt("content_type_id")
 	userID := c.Locals("user_id").(uint)
 
 	var ct models.ContentType
-	if err := database.DB.Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
 		return response.NotFound(c, "Content type")
 	}
 
 	allFields := append(ct.Fields, ct.SEOFields...)
 	data := make(map[string]interface{})
 
+	// Files saved below are removed again unless the entry is created.
+	var uploads []*models.MediaFile
+	created := false
+	defer func() {
+		if !created {
+			media.DiscardUploads(ctx, uploads)
+		}
+	}()
+
 	contentType := c.Get("Content-Type", "")
 	if strings.Contains(contentType, "application/json") {
 
@@ -114,7 +140,7 @@ func CreateEntryHandler(c *fiber.Ctx) error {
 			if field.Type == "media" {
 				if mediaID, ok := payload[field.Name+"_media_id"].(float64); ok {
 					var mediaFile models.MediaFile
-					if err := database.DB.First(&mediaFile, uint(mediaID)).Error; err != nil {
+					if err := database.DB.WithContext(ctx).First(&mediaFile, uint(mediaID)).Error; err != nil {
 						return response.NotFound(c, "Media for field "+field.Name)
 					}
 					data[field.Name] = mediaFile.URL
@@ -142,7 +168,7 @@ func CreateEntryHandler(c *fiber.Ctx) error {
 					}
 
 					var mediaFile models.MediaFile
-					if err := database.DB.First(&mediaFile, uint(mediaID)).Error; err != nil {
+					if err := database.DB.WithContext(ctx).First(&mediaFile, uint(mediaID)).Error; err != nil {
 						return response.NotFound(c, "Media for field "+field.Name)
 					}
 					data[field.Name] = mediaFile.URL
@@ -150,23 +176,13 @@ func CreateEntryHandler(c *fiber.Ctx) error {
 				} else {
 					fileHeader, ok := form.File[field.Name]
 					if ok && len(fileHeader) > 0 {
-						url, err := utils.UploadFile(fileHeader[0])
+						mediaFile, err := media.SaveUpload(ctx, fileHeader[0], userID, models.MediaFile{})
 						if err != nil {
-							return response.BadRequest(c, "Failed to upload file", err.Error())
-						}
-						mediaFile := models.MediaFile{
-							FileName:   fileHeader[0].Filename,
-							URL:        url,
-							Type:       fileHeader[0].Header.Get("Content-Type"),
-							UploadedBy: userID,
-						}
-
-						if err := database.DB.Create(&mediaFile).Error; err != nil {
-							utils.DeleteFile(url)
-							return response.InternalError(c, "Failed to save media metadata")
+							return fieldUploadErrorResponse(c, err)
 						}
+						uploads = append(uploads, mediaFile)
 
-						data[field.Name] = url
+						data[field.Name] = mediaFile.URL
 						data[field.Name+"_media_id"] = mediaFile.ID
 					}
 				}
@@ -176,7 +192,7 @@ func CreateEntryHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	filteredData, err := middleware.FilterFieldsByPermission(userID, "create", data, uint(contentTypeID))
+	filteredData, err := middleware.FilterFieldsByPermission(ctx, userID, "create", data, uint(contentTypeID))
 	if err != nil {
 		return response.Forbidden(c, err.Error())
 	}
@@ -191,20 +207,33 @@ func CreateEntryHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	entry, err := CreateContentEntry(uint(contentTypeID), userID, filteredData)
+	entry, err := CreateContentEntry(ctx, uint(contentTypeID), userID, filteredData)
+	var veto *events.VetoError
+	if errors.As(err, &veto) {
+		return vetoedResponse(c, err)
+	}
+	var taken *PathTakenError
+	if errors.As(err, &taken) {
+		return response.Conflict(c, err.Error())
+	}
 	if err != nil {
 		return response.BadRequest(c, err.Error(), nil)
 	}
+	created = true
+
+	audit.Record(c, "entry.create", "entry", entry.ID, nil, entry)
 
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return response.Created(c, entry, "Entry created successfully")
 }
 
 func CreateEntryHandlerJSON(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, _ := c.ParamsInt("content_type_id")
 	userID := c.Locals("user_id").(uint)
 
 	var ct models.ContentType
-	if err := database.DB.Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "content type not found"})
 	}
 
@@ -220,7 +249,7 @@ func CreateEntryHandlerJSON(c *fiber.Ctx) error {
 		if field.Type == "media" {
 			if mediaID, ok := payload[field.Name+"_media_id"].(float64); ok {
 				var mediaFile models.MediaFile
-				if err := database.DB.First(&mediaFile, uint(mediaID)).Error; err != nil {
+				if err := database.DB.WithContext(ctx).First(&mediaFile, uint(mediaID)).Error; err != nil {
 					return c.Status(404).JSON(fiber.Map{"error": "Media not found for field " + field.Name})
 				}
 
@@ -234,7 +263,7 @@ func CreateEntryHandlerJSON(c *fiber.Ctx) error {
 		}
 	}
 
-	filteredData, err := middleware.FilterFieldsByPermission(userID, "create", data, uint(contentTypeID))
+	filteredData, err := middleware.FilterFieldsByPermission(ctx, userID, "create", data, uint(contentTypeID))
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -250,18 +279,30 @@ func CreateEntryHandlerJSON(c *fiber.Ctx) error {
 		}
 	}
 
-	entry, err := CreateContentEntry(uint(contentTypeID), userID, filteredData)
+	entry, err := CreateContentEntry(ctx, uint(contentTypeID), userID, filteredData)
+	var veto *events.VetoError
+	if errors.As(err, &veto) {
+		return vetoedResponse(c, err)
+	}
+	var taken *PathTakenError
+	if errors.As(err, &taken) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	audit.Record(c, "entry.create", "entry", entry.ID, nil, entry)
+
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return c.JSON(entry)
 }
 
 func ListEntriesHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, _ := c.ParamsInt("content_type_id")
 
-	query := database.DB.Where("content_type_id = ?", contentTypeID)
+	query := database.DB.WithContext(ctx).Model(&models.ContentEntry{}).Where("content_type_id = ?", contentTypeID)
 
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -278,6 +319,17 @@ func ListEntriesHandler(c *fiber.Ctx) error {
 		query = query.Where("created_at <= ?", to)
 	}
 
+	if c.Query("sort") == "manual" {
+		var ct models.ContentType
+		if err := database.DB.WithContext(ctx).First(&ct, contentTypeID).Error; err != nil {
+			return response.NotFound(c, "Content type")
+		}
+		if !ct.IsSortable {
+			return response.BadRequest(c, ErrNotSortable.Error(), nil)
+		}
+		query = query.Order(utils.RankColumn(query) + " ASC").Order("id ASC")
+	}
+
 	page := c.QueryInt("page", 1)
 	limit := c.QueryInt("limit", 10)
 	offset := (page - 1) * limit
@@ -293,6 +345,7 @@ func ListEntriesHandler(c *fiber.Ctx) error {
 }
 
 func CreateRelationHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	fromID, err := c.ParamsInt("from_content_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid from_content_id", nil)
@@ -315,7 +368,14 @@ func CreateRelationHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	relation, err := CreateContentRelation(uint(fromID), body.ToContentID, body.RelationType)
+	for _, id := range []uint{uint(fromID), body.ToContentID} {
+		var entry models.ContentEntry
+		if err := database.DB.WithContext(ctx).Select("id").First(&entry, id).Error; err != nil {
+			return response.NotFound(c, "Content entry")
+		}
+	}
+
+	relation, err := CreateContentRelation(ctx, uint(fromID), body.ToContentID, body.RelationType)
 	if err != nil {
 		return response.InternalError(c, "Failed to create relation")
 	}
@@ -324,12 +384,13 @@ func CreateRelationHandler(c *fiber.Ctx) error {
 }
 
 func ListRelationsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	fromID, err := c.ParamsInt("from_content_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid from_content_id", nil)
 	}
 
-	relations, err := ListContentRelations(uint(fromID))
+	relations, err := ListContentRelations(ctx, uint(fromID))
 	if err != nil {
 		return response.InternalError(c, "Failed to fetch relations")
 	}
@@ -338,12 +399,13 @@ func ListRelationsHandler(c *fiber.Ctx) error {
 }
 
 func SEOPreviewHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
 	}
 
-	seoData, err := GenerateSEOPreview(uint(entryID))
+	seoData, err := GenerateSEOPreview(ctx, uint(entryID))
 	if err != nil {
 		return response.InternalError(c, "Failed to generate SEO preview")
 	}
@@ -352,11 +414,12 @@ func SEOPreviewHandler(c *fiber.Ctx) error {
 }
 
 func UpdateEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, _ := c.ParamsInt("entry_id")
 	userID := c.Locals("user_id").(uint)
 
 	var entry models.ContentEntry
-	if err := database.DB.First(&entry, entryID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
 		return response.NotFound(c, "Entry")
 	}
 
@@ -364,14 +427,46 @@ func UpdateEntryHandler(c *fiber.Ctx) error {
 		return response.Conflict(c, "Cannot edit published content. Please unpublish first")
 	}
 
+	if entry.Status == models.StatusArchived {
+		return response.Conflict(c, "Cannot edit archived content. Please restore it first")
+	}
+
+	if err := checkEntryLock(ctx, entry.ID, userID); err != nil {
+		var held *LockHeldError
+		if errors.As(err, &held) {
+			return lockedResponse(c, held)
+		}
+		return response.InternalError(c, "Failed to check entry lock")
+	}
+
+	expectedVersion, err := utils.EntryVersionFromRequest(c)
+	if errors.Is(err, utils.ErrVersionRequired) {
+		return response.PreconditionRequired(c, err.Error())
+	}
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry version", err.Error())
+	}
+	if expectedVersion != entry.Version {
+		return staleEntryResponse(c, entry)
+	}
+
 	var ct models.ContentType
-	if err := database.DB.Preload("Fields").Preload("SEOFields").First(&ct, entry.ContentTypeID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Fields").Preload("SEOFields").First(&ct, entry.ContentTypeID).Error; err != nil {
 		return response.NotFound(c, "Content type")
 	}
 
 	allFields := append(ct.Fields, ct.SEOFields...)
 	data := make(map[string]interface{})
 
+	// Files saved below are removed again unless the update is stored.
+	var uploads []*models.MediaFile
+	stored := false
+	defer func() {
+		if !stored {
+			media.DiscardUploads(ctx, uploads)
+		}
+	}()
+
 	if form, err := c.MultipartForm(); err == nil {
 		for _, field := range allFields {
 			if field.Type == "media" {
@@ -384,31 +479,20 @@ func UpdateEntryHandler(c *fiber.Ctx) error {
 					}
 
 					var mediaFile models.MediaFile
-					if err := database.DB.First(&mediaFile, uint(mediaID)).Error; err != nil {
+					if err := database.DB.WithContext(ctx).First(&mediaFile, uint(mediaID)).Error; err != nil {
 						return response.NotFound(c, "Media for field "+field.Name)
 					}
 
 					data[field.Name] = mediaFile.URL
 					data[field.Name+"_media_id"] = mediaFile.ID
 				} else if fileHeaders, ok := form.File[field.Name]; ok && len(fileHeaders) > 0 {
-					url, err := utils.UploadFile(fileHeaders[0])
+					mediaFile, err := media.SaveUpload(ctx, fileHeaders[0], userID, models.MediaFile{})
 					if err != nil {
-						return response.BadRequest(c, "Failed to upload file", err.Error())
-					}
-
-					mediaFile := models.MediaFile{
-						FileName:   fileHeaders[0].Filename,
-						URL:        url,
-						Type:       fileHeaders[0].Header.Get("Content-Type"),
-						UploadedBy: userID,
-					}
-
-					if err := database.DB.Create(&mediaFile).Error; err != nil {
-						utils.DeleteFile(url)
-						return response.InternalError(c, "Failed to save media metadata")
+						return fieldUploadErrorResponse(c, err)
 					}
+					uploads = append(uploads, mediaFile)
 
-					data[field.Name] = url
+					data[field.Name] = mediaFile.URL
 					data[field.Name+"_media_id"] = mediaFile.ID
 				}
 			} else {
@@ -421,13 +505,14 @@ func UpdateEntryHandler(c *fiber.Ctx) error {
 		if err := c.BodyParser(&data); err != nil {
 			return response.BadRequest(c, "Invalid request body", err.Error())
 		}
+		delete(data, utils.VersionField)
 	}
 
 	if len(data) == 0 {
 		return response.BadRequest(c, "No data provided for update", nil)
 	}
 
-	filteredData, err := middleware.FilterFieldsByPermission(userID, "update", data, entry.ContentTypeID)
+	filteredData, err := middleware.FilterFieldsByPermission(ctx, userID, "update", data, entry.ContentTypeID)
 	if err != nil {
 		return response.Forbidden(c, err.Error())
 	}
@@ -442,7 +527,11 @@ func UpdateEntryHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	if err := ValidatePartialUpdate(ct, filteredData, uint(entryID)); err != nil {
+	if err := events.RunBefore(&events.BeforeEntryUpdate{Entry: &entry, UserID: userID, Changes: filteredData}); err != nil {
+		return vetoedResponse(c, err)
+	}
+
+	if err := ValidatePartialUpdate(ctx, ct, filteredData, uint(entryID)); err != nil {
 		return response.BadRequest(c, err.Error(), nil)
 	}
 
@@ -458,22 +547,72 @@ func UpdateEntryHandler(c *fiber.Ctx) error {
 		return response.InternalError(c, "Failed to serialize data")
 	}
 
-	entry.Data = datatypes.JSON(jsonData)
-	entry.Status = models.StatusDraft
-	entry.UpdatedBy = userID
+	updates := map[string]interface{}{
+		"data":       datatypes.JSON(jsonData),
+		"status":     models.StatusDraft,
+		"updated_by": userID,
+		"version":    gorm.Expr("version + 1"),
+	}
+	path := entry.Path
+	if ct.IsTree {
+		if path, err = treePath(ctx, entry, existingData); err != nil {
+			return treeErrorResponse(c, err)
+		}
+		updates["path"] = path
+	}
 
-	if err := database.DB.Save(&entry).Error; err != nil {
+	updated, err := storeEntryUpdate(ctx, entry, expectedVersion, updates, path)
+	var taken *PathTakenError
+	if errors.As(err, &taken) {
+		return response.Conflict(c, err.Error())
+	}
+	if err != nil {
 		return response.BadRequest(c, err.Error(), nil)
 	}
 
-	database.DB.Preload("Creator").Preload("Updater").First(&entry, entryID)
+	previous := entry
+	database.DB.WithContext(ctx).Preload("Creator").Preload("Updater").First(&entry, entryID)
+
+	if !updated {
+		return staleEntryResponse(c, entry)
+	}
+	stored = true
+
+	events.Publish(events.EntryUpdated{Entry: entry, Previous: previous, UserID: userID})
+	audit.Record(c, "entry.update", "entry", entry.ID, previous, entry)
 
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return response.Success(c, entry, "Entry updated successfully")
 }
 
+func vetoedResponse(c *fiber.Ctx, err error) error {
+	return response.Error(c, fiber.StatusUnprocessableEntity, "OPERATION_VETOED", err.Error(), nil)
+}
+
+func fieldUploadErrorResponse(c *fiber.Ctx, err error) error {
+	var veto *events.VetoError
+	switch {
+	case errors.As(err, &veto):
+		return vetoedResponse(c, err)
+	case errors.Is(err, media.ErrMetadataFailed):
+		return response.InternalError(c, "Failed to save media metadata")
+	default:
+		return response.BadRequest(c, "Failed to upload file", err.Error())
+	}
+}
+
+func staleEntryResponse(c *fiber.Ctx, current models.ContentEntry) error {
+	c.Set(fiber.HeaderETag, utils.FormatETag(current.Version))
+	return response.PreconditionFailed(c, "Entry was modified by someone else", fiber.Map{
+		"current_version": current.Version,
+		"entry":           current,
+	})
+}
+
 func ListContentTypesHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var cts []models.ContentType
-	if err := database.DB.
+	if err := database.DB.WithContext(ctx).
 		Preload("Fields", "is_seo = ?", false).
 		Preload("SEOFields", "is_seo = ?", true).
 		Find(&cts).Error; err != nil {
@@ -484,13 +623,14 @@ func ListContentTypesHandler(c *fiber.Ctx) error {
 }
 
 func GetContentTypeHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid content type ID", nil)
 	}
 
 	var ct models.ContentType
-	if err := database.DB.
+	if err := database.DB.WithContext(ctx).
 		Preload("Fields", "is_seo = ?", false).
 		Preload("SEOFields", "is_seo = ?", true).
 		First(&ct, id).Error; err != nil {
@@ -501,30 +641,33 @@ func GetContentTypeHandler(c *fiber.Ctx) error {
 }
 
 func GetEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
 	}
 
 	var entry models.ContentEntry
-	if err := database.DB.
+	if err := database.DB.WithContext(ctx).
 		Preload("Creator").
 		Preload("Updater").
 		First(&entry, entryID).Error; err != nil {
 		return response.NotFound(c, "Entry")
 	}
 
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return response.Success(c, entry, "Entry retrieved successfully")
 }
 
 func DeleteEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
 	}
 
 	var entry models.ContentEntry
-	if err := database.DB.First(&entry, entryID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
 		return response.NotFound(c, "Entry")
 	}
 
@@ -532,23 +675,38 @@ func DeleteEntryHandler(c *fiber.Ctx) error {
 		return response.Conflict(c, "Cannot delete published content. Please unpublish first")
 	}
 
-	if err := database.DB.Delete(&entry).Error; err != nil {
+	if hasChildren(ctx, entry.ID) {
+		return response.Conflict(c, ErrHasChildren.Error())
+	}
+
+	userID := c.Locals("user_id").(uint)
+	if err := events.RunBefore(&events.BeforeEntryDelete{Entry: &entry, UserID: userID}); err != nil {
+		return vetoedResponse(c, err)
+	}
+
+	if err := database.DB.WithContext(ctx).Delete(&entry).Error; err != nil {
 		return response.InternalError(c, "Failed to delete entry")
 	}
 
+	events.Publish(events.EntryDeleted{Entry: entry, UserID: userID})
+	audit.Record(c, "entry.delete", "entry", entry.ID, entry, nil)
+
 	return response.NoContent(c)
 }
 
 func UpdateContentTypeHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid content type ID", nil)
 	}
 
 	var body struct {
-		Name      string `json:"name"`
-		Slug      string `json:"slug"`
-		EnableSEO bool   `json:"enable_seo"`
+		Name       string `json:"name"`
+		Slug       string `json:"slug"`
+		EnableSEO  bool   `json:"enable_seo"`
+		IsTree     bool   `json:"is_tree"`
+		IsSortable bool   `json:"is_sortable"`
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -556,29 +714,52 @@ func UpdateContentTypeHandler(c *fiber.Ctx) error {
 	}
 
 	var ct models.ContentType
-	if err := database.DB.First(&ct, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&ct, id).Error; err != nil {
 		return response.NotFound(c, "Content type")
 	}
+	before := ct
 
 	ct.Name = body.Name
 	ct.Slug = body.Slug
 	ct.EnableSEO = body.EnableSEO
+	ct.IsTree = body.IsTree
+	ct.IsSortable = body.IsSortable
 
-	if err := database.DB.Save(&ct).Error; err != nil {
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&ct).Error; err != nil {
+			return err
+		}
+		if ct.IsTree && !before.IsTree {
+			if err := RebuildTreePaths(tx, ct.ID); err != nil {
+				return err
+			}
+		}
+		if ct.IsSortable && !before.IsSortable {
+			return AssignRanks(tx, ct.ID)
+		}
+		return nil
+	})
+	var taken *PathTakenError
+	if errors.As(err, &taken) {
+		return response.Conflict(c, err.Error())
+	}
+	if err != nil {
 		return response.InternalError(c, "Failed to update content type")
 	}
+	audit.Record(c, "content_type.update", "content_type", ct.ID, before, ct)
 
 	return response.Success(c, ct, "Content type updated successfully")
 }
 
 func DeleteContentTypeHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid content type ID", nil)
 	}
 
 	var entryCount int64
-	database.DB.Model(&models.ContentEntry{}).
+	database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
 		Where("content_type_id = ?", id).
 		Count(&entryCount)
 
@@ -587,20 +768,22 @@ func DeleteContentTypeHandler(c *fiber.Ctx) error {
 	}
 
 	var ct models.ContentType
-	if err := database.DB.First(&ct, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Fields").First(&ct, id).Error; err != nil {
 		return response.NotFound(c, "Content type")
 	}
 
-	database.DB.Where("content_type_id = ?", id).Delete(&models.ContentField{})
+	database.DB.WithContext(ctx).Where("content_type_id = ?", id).Delete(&models.ContentField{})
 
-	if err := database.DB.Delete(&ct).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Delete(&ct).Error; err != nil {
 		return response.InternalError(c, "Failed to delete content type")
 	}
+	audit.Record(c, "content_type.delete", "content_type", ct.ID, ct, nil)
 
 	return response.NoContent(c)
 }
 
 func UpdateFieldHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	fieldID, err := c.ParamsInt("field_id")
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid field_id"})
@@ -612,9 +795,10 @@ func UpdateFieldHandler(c *fiber.Ctx) error {
 	}
 
 	var field models.ContentField
-	if err := database.DB.First(&field, fieldID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&field, fieldID).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "field not found"})
 	}
+	before := field
 
 	field.Name = body.Name
 	field.Type = body.Type
@@ -630,9 +814,10 @@ func UpdateFieldHandler(c *fiber.Ctx) error {
 	field.Placeholder = body.Placeholder
 	field.HelpText = body.HelpText
 
-	if err := database.DB.Save(&field).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Save(&field).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	audit.Record(c, "field.update", "field", field.ID, before, field)
 
 	return c.JSON(fiber.Map{
 		"message":          "field updated successfully",
@@ -642,17 +827,18 @@ func UpdateFieldHandler(c *fiber.Ctx) error {
 }
 
 func DeleteRelationHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	relationID, err := c.ParamsInt("relation_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid relation ID", nil)
 	}
 
 	var relation models.ContentRelation
-	if err := database.DB.First(&relation, relationID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&relation, relationID).Error; err != nil {
 		return response.NotFound(c, "Relation")
 	}
 
-	if err := database.DB.Delete(&relation).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Delete(&relation).Error; err != nil {
 		return response.InternalError(c, "Failed to delete relation")
 	}
 
@@ -660,31 +846,34 @@ func DeleteRelationHandler(c *fiber.Ctx) error {
 }
 
 func DeleteFieldHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	fieldID, err := c.ParamsInt("field_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid field ID", nil)
 	}
 
 	var field models.ContentField
-	if err := database.DB.First(&field, fieldID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&field, fieldID).Error; err != nil {
 		return response.NotFound(c, "Field")
 	}
 
-	if err := database.DB.Delete(&field).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Delete(&field).Error; err != nil {
 		return response.InternalError(c, "Failed to delete field")
 	}
+	audit.Record(c, "field.delete", "field", field.ID, field, nil)
 
 	return response.NoContent(c)
 }
 
 func GetFieldValidationHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	fieldID, err := c.ParamsInt("field_id")
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid field_id"})
 	}
 
 	var field models.ContentField
-	if err := database.DB.First(&field, fieldID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&field, fieldID).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "field not found"})
 	}
 
@@ -1,16 +1,24 @@
 package content_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Kyz7/cms/internal/content"
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/testutils"
 	"github.com/Kyz7/cms/internal/utils"
+	"github.com/Kyz7/cms/internal/workflow"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // ============================================
@@ -504,7 +512,8 @@ func TestUpdateEntryHandler(t *testing.T) {
 
 	t.Run("Success - Update text only (JSON)", func(t *testing.T) {
 		body := map[string]interface{}{
-			"title": "Updated Title",
+			"title":    "Updated Title",
+			"_version": 1,
 		}
 
 		resp, err := testutils.MakeRequest(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID), body, token)
@@ -512,6 +521,52 @@ func TestUpdateEntryHandler(t *testing.T) {
 		assert.Equal(t, 200, resp.Code)
 
 		testutils.AssertSuccess(t, resp)
+		assert.Equal(t, `"2"`, resp.Header().Get("ETag"))
+	})
+
+	t.Run("Success - Update with If-Match header", func(t *testing.T) {
+		body := map[string]interface{}{
+			"title": "Updated Again",
+		}
+
+		resp, err := testutils.MakeRequestWithHeaders(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID), body, token,
+			map[string]string{"If-Match": `"2"`})
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, `"3"`, resp.Header().Get("ETag"))
+	})
+
+	t.Run("Error - Stale version", func(t *testing.T) {
+		body := map[string]interface{}{
+			"title":    "Lost Update",
+			"_version": 1,
+		}
+
+		resp, err := testutils.MakeRequest(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID), body, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 412, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, "PRECONDITION_FAILED", result.Error.Code)
+		details := result.Error.Details.(map[string]interface{})
+		assert.Equal(t, float64(3), details["current_version"])
+
+		var current models.ContentEntry
+		database.DB.First(&current, entry.ID)
+		assert.Contains(t, string(current.Data), "Updated Again")
+	})
+
+	t.Run("Error - Missing version", func(t *testing.T) {
+		body := map[string]interface{}{
+			"title": "No Version",
+		}
+
+		resp, err := testutils.MakeRequest(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID), body, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 428, resp.Code)
+
+		testutils.AssertError(t, resp, "PRECONDITION_REQUIRED")
 	})
 
 	t.Run("Error - Cannot update published entry", func(t *testing.T) {
@@ -533,332 +588,637 @@ func TestUpdateEntryHandler(t *testing.T) {
 
 		testutils.AssertError(t, resp, "CONFLICT")
 	})
-}
-
-func TestDeleteEntryHandler(t *testing.T) {
-	app := testutils.SetupTestApp(t)
-
-	admin := testutils.CreateTestUser(t, database.DB, "admin@test.com", "password", "admin")
-	token := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
-
-	ct := &models.ContentType{Name: "Blog", Slug: "blog"}
-	database.DB.Create(ct)
-
-	t.Run("Success - Delete draft entry", func(t *testing.T) {
-		entry := &models.ContentEntry{
-			ContentTypeID: ct.ID,
-			CreatedBy:     admin.ID,
-			Status:        models.StatusDraft,
-		}
-		database.DB.Create(entry)
 
-		resp, err := testutils.MakeRequest(app, "DELETE", "/content/entries/"+fmt.Sprint(entry.ID), nil, token)
-		assert.NoError(t, err)
-		assert.Equal(t, 204, resp.Code)
-	})
+	t.Run("Success - Field named version is stored", func(t *testing.T) {
+		database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "version", Type: "string"})
 
-	t.Run("Error - Cannot delete published entry", func(t *testing.T) {
-		publishedEntry := &models.ContentEntry{
-			ContentTypeID: ct.ID,
-			CreatedBy:     admin.ID,
-			Status:        models.StatusPublished,
+		body := map[string]interface{}{
+			"version":  "2.1.0",
+			"_version": 3,
 		}
-		database.DB.Create(publishedEntry)
 
-		resp, err := testutils.MakeRequest(app, "DELETE", "/content/entries/"+fmt.Sprint(publishedEntry.ID), nil, token)
+		resp, err := testutils.MakeRequest(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID), body, token)
 		assert.NoError(t, err)
-		assert.Equal(t, 409, resp.Code)
+		assert.Equal(t, 200, resp.Code)
 
-		testutils.AssertError(t, resp, "CONFLICT")
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Contains(t, string(updated.Data), `"version":"2.1.0"`)
+		assert.NotContains(t, string(updated.Data), "_version")
 	})
 }
 
-// ============================================
-// WORKFLOW TESTS
-// ============================================
-
-func TestWorkflowChangeStatus(t *testing.T) {
+func TestEntryLockHandlers(t *testing.T) {
 	app := testutils.SetupTestApp(t)
 
 	editor := testutils.CreateTestUser(t, database.DB, "editor@test.com", "password", "editor")
-	admin := testutils.CreateTestUser(t, database.DB, "admin_wf@test.com", "password", "admin")
 	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	other := testutils.CreateTestUser(t, database.DB, "other@test.com", "password", "editor")
+	otherToken := testutils.GetAuthToken(t, other.ID, other.Role.Name)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin@test.com", "password", "admin")
 	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
 
 	ct := &models.ContentType{Name: "Blog", Slug: "blog"}
 	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "title", Type: "string"})
 
 	entry := &models.ContentEntry{
 		ContentTypeID: ct.ID,
 		CreatedBy:     editor.ID,
 		Status:        models.StatusDraft,
-		Data:          datatypes.JSON([]byte(`{"title":"Test"}`)),
+		Data:          datatypes.JSON([]byte(`{"title":"Locked"}`)),
 	}
 	database.DB.Create(entry)
 
-	t.Run("Success - Editor requests review", func(t *testing.T) {
-		body := map[string]interface{}{
-			"status":  "in_review",
-			"comment": "Ready for review",
-		}
+	lockURL := "/content/entries/" + fmt.Sprint(entry.ID) + "/lock"
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, editorToken)
+	t.Run("Success - Acquire lock", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", lockURL, nil, editorToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
 
 		var result testutils.StandardResponse
 		testutils.ParseResponse(t, resp, &result)
-		assert.True(t, result.Success)
+		data := result.Data.(map[string]interface{})
+		assert.Equal(t, float64(editor.ID), data["user_id"])
 	})
 
-	t.Run("Success - Editor marks ready for approval", func(t *testing.T) {
-		body := map[string]interface{}{
-			"status":  "ready_for_approval",
-			"comment": "Ready for approval",
-		}
-
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, editorToken)
+	t.Run("Success - Re-acquire own lock", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", lockURL, nil, editorToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
 	})
 
-	t.Run("Success - Admin approves", func(t *testing.T) {
+	t.Run("Error - Lock held by another user", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", lockURL, nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 423, resp.Code)
+
+		testutils.AssertError(t, resp, "LOCKED")
+	})
+
+	t.Run("Error - Update rejected while locked", func(t *testing.T) {
 		body := map[string]interface{}{
-			"status":  "approved",
-			"comment": "Approved",
+			"title":    "Sneaky Edit",
+			"_version": 1,
 		}
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, adminToken)
+		resp, err := testutils.MakeRequest(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID), body, otherToken)
 		assert.NoError(t, err)
-		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, 423, resp.Code)
+
+		var current models.ContentEntry
+		database.DB.First(&current, entry.ID)
+		assert.Equal(t, uint(1), current.Version)
 	})
 
-	t.Run("Success - Admin publishes", func(t *testing.T) {
+	t.Run("Success - Lock holder can update", func(t *testing.T) {
 		body := map[string]interface{}{
-			"status":  "published",
-			"comment": "Publishing",
+			"title":    "Holder Edit",
+			"_version": 1,
 		}
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, adminToken)
+		resp, err := testutils.MakeRequest(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID), body, editorToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
+	})
 
-		var updated models.ContentEntry
-		database.DB.First(&updated, entry.ID)
-		assert.Equal(t, models.StatusPublished, updated.Status)
-		assert.NotNil(t, updated.PublishedAt)
+	t.Run("Success - Heartbeat extends lock", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", lockURL+"/heartbeat", nil, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
 	})
-}
 
-func TestWorkflowRejectFlow(t *testing.T) {
-	app := testutils.SetupTestApp(t)
+	t.Run("Error - Heartbeat without lock", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", lockURL+"/heartbeat", nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+	})
 
-	editor := testutils.CreateTestUser(t, database.DB, "editor2@test.com", "password", "editor")
-	admin := testutils.CreateTestUser(t, database.DB, "admin2@test.com", "password", "admin")
-	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
-	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+	t.Run("Success - Presence lists viewers and lock", func(t *testing.T) {
+		presenceURL := "/content/entries/" + fmt.Sprint(entry.ID) + "/presence"
 
-	ct := &models.ContentType{Name: "Article", Slug: "article"}
-	database.DB.Create(ct)
+		resp, err := testutils.MakeRequest(app, "POST", presenceURL, nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
 
-	entry := &models.ContentEntry{
-		ContentTypeID: ct.ID,
-		CreatedBy:     editor.ID,
-		Status:        models.StatusReadyForApproval,
-		Data:          datatypes.JSON([]byte(`{"title":"Test Article"}`)),
-	}
-	database.DB.Create(entry)
+		resp, err = testutils.MakeRequest(app, "GET", presenceURL, nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
 
-	t.Run("Success - Admin rejects entry", func(t *testing.T) {
-		body := map[string]interface{}{
-			"comment": "Needs more work",
-		}
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+		assert.Len(t, data["viewers"], 2)
+		assert.NotNil(t, data["lock"])
+	})
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/reject", body, adminToken)
+	t.Run("Error - Force unlock requires admin", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "DELETE", lockURL+"/force", nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Success - Admin force unlock", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "DELETE", lockURL+"/force", nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 204, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "POST", lockURL, nil, otherToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
+	})
 
-		var updated models.ContentEntry
-		database.DB.First(&updated, entry.ID)
-		assert.Equal(t, models.StatusRejected, updated.Status)
+	t.Run("Success - Release lock", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "DELETE", lockURL, nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 204, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "DELETE", lockURL, nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.Code)
 	})
 
-	t.Run("Success - Editor returns to draft", func(t *testing.T) {
-		body := map[string]interface{}{
-			"status":  "draft",
-			"comment": "Making revisions",
-		}
+	t.Run("Success - Expired lock can be taken over", func(t *testing.T) {
+		database.DB.Create(&models.EntryLock{
+			EntryID:   entry.ID,
+			UserID:    editor.ID,
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, editorToken)
+		resp, err := testutils.MakeRequest(app, "POST", lockURL, nil, otherToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
 	})
 }
 
-func TestWorkflowHistory(t *testing.T) {
+func TestDeleteEntryHandler(t *testing.T) {
 	app := testutils.SetupTestApp(t)
 
-	editor := testutils.CreateTestUser(t, database.DB, "editor3@test.com", "password", "editor")
-	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+	admin := testutils.CreateTestUser(t, database.DB, "admin@test.com", "password", "admin")
+	token := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
 
-	ct := &models.ContentType{Name: "News", Slug: "news"}
+	ct := &models.ContentType{Name: "Blog", Slug: "blog"}
 	database.DB.Create(ct)
 
-	entry := &models.ContentEntry{
-		ContentTypeID: ct.ID,
-		CreatedBy:     editor.ID,
-		Status:        models.StatusDraft,
-		Data:          datatypes.JSON([]byte(`{"title":"News"}`)),
-	}
-	database.DB.Create(entry)
+	t.Run("Success - Delete draft entry", func(t *testing.T) {
+		entry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     admin.ID,
+			Status:        models.StatusDraft,
+		}
+		database.DB.Create(entry)
 
-	database.DB.Create(&models.WorkflowHistory{
-		EntryID:    entry.ID,
-		FromStatus: models.StatusDraft,
-		ToStatus:   models.StatusInReview,
-		ChangedBy:  editor.ID,
-		Comment:    "Requesting review",
+		resp, err := testutils.MakeRequest(app, "DELETE", "/content/entries/"+fmt.Sprint(entry.ID), nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 204, resp.Code)
 	})
 
-	t.Run("Success - Get workflow history", func(t *testing.T) {
-		resp, err := testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/history", nil, token)
-		assert.NoError(t, err)
-		assert.Equal(t, 200, resp.Code)
+	t.Run("Error - Cannot delete published entry", func(t *testing.T) {
+		publishedEntry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     admin.ID,
+			Status:        models.StatusPublished,
+		}
+		database.DB.Create(publishedEntry)
 
-		var result testutils.StandardResponse
-		testutils.ParseResponse(t, resp, &result)
-		assert.True(t, result.Success)
+		resp, err := testutils.MakeRequest(app, "DELETE", "/content/entries/"+fmt.Sprint(publishedEntry.ID), nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
 
-		history := result.Data.([]interface{})
-		assert.GreaterOrEqual(t, len(history), 1)
+		testutils.AssertError(t, resp, "CONFLICT")
 	})
 }
 
-func TestWorkflowComments(t *testing.T) {
+func TestEntryTrees(t *testing.T) {
 	app := testutils.SetupTestApp(t)
 
-	editor := testutils.CreateTestUser(t, database.DB, "editor4@test.com", "password", "editor")
-	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+	admin := testutils.CreateTestUser(t, database.DB, "admin@test.com", "password", "admin")
+	token := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
 
-	ct := &models.ContentType{Name: "Post", Slug: "post"}
-	database.DB.Create(ct)
+	resp, _ := testutils.MakeRequest(app, "POST", "/content/types", map[string]interface{}{
+		"name": "Page", "slug": "page", "is_tree": true,
+	}, token)
+	assert.Equal(t, 201, resp.Code)
+	var created struct {
+		Data models.ContentType `json:"data"`
+	}
+	testutils.ParseResponse(t, resp, &created)
+	page := created.Data
+	assert.True(t, page.IsTree)
+	database.DB.Create(&models.ContentField{ContentTypeID: page.ID, Name: "slug", Type: "string"})
 
-	entry := &models.ContentEntry{
-		ContentTypeID: ct.ID,
-		CreatedBy:     editor.ID,
-		Status:        models.StatusInReview,
-		Data:          datatypes.JSON([]byte(`{"title":"Post"}`)),
+	ctx := context.Background()
+	pages := make(map[string]*models.ContentEntry)
+	for _, slug := range []string{"about", "team", "engineering", "contact"} {
+		entry, err := content.CreateContentEntry(ctx, page.ID, admin.ID, map[string]interface{}{"slug": slug})
+		assert.NoError(t, err)
+		pages[slug] = entry
 	}
-	database.DB.Create(entry)
+	assert.Equal(t, "/about", pages["about"].Path)
+	assert.Equal(t, 3, pages["contact"].Position)
 
-	t.Run("Success - Add public comment", func(t *testing.T) {
-		body := map[string]interface{}{
-			"comment":    "This looks good",
-			"is_private": false,
-		}
+	move := func(slug string, body map[string]interface{}) *httptest.ResponseRecorder {
+		resp, _ := testutils.MakeRequest(app, "POST", fmt.Sprintf("/content/entries/%d/move", pages[slug].ID), body, token)
+		return resp
+	}
+	pathOf := func(slug string) string {
+		var entry models.ContentEntry
+		database.DB.First(&entry, pages[slug].ID)
+		return entry.Path
+	}
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments", body, token)
+	t.Run("Error - Sibling paths are unique", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", fmt.Sprintf("/content/%d/entries/json", page.ID),
+			map[string]interface{}{"slug": "about"}, token)
+		assert.Equal(t, 409, resp.Code)
+
+		duplicate := models.ContentEntry{ContentTypeID: page.ID, Path: "/about", Data: datatypes.JSON(`{}`)}
+		assert.Error(t, database.DB.Create(&duplicate).Error, "the unique index backs up the check")
+
+		resp, _ = testutils.MakeRequest(app, "POST", fmt.Sprintf("/content/%d/entries/json", page.ID),
+			map[string]interface{}{"slug": "about/team"}, token)
+		assert.Equal(t, 400, resp.Code, "a slug is a single path segment")
+
+		// An entry without a slug is filed under its ID, which a slug can
+		// already have taken.
+		var last models.ContentEntry
+		database.DB.Unscoped().Order("id DESC").First(&last)
+		squatter, err := content.CreateContentEntry(ctx, page.ID, admin.ID, map[string]interface{}{"slug": fmt.Sprint(last.ID + 2)})
 		assert.NoError(t, err)
-		assert.Equal(t, 201, resp.Code)
+		var before int64
+		database.DB.Model(&models.ContentEntry{}).Count(&before)
 
-		testutils.AssertSuccess(t, resp)
+		_, err = content.CreateContentEntry(ctx, page.ID, admin.ID, map[string]interface{}{})
+		var taken *content.PathTakenError
+		assert.ErrorAs(t, err, &taken)
+		var after int64
+		database.DB.Model(&models.ContentEntry{}).Count(&after)
+		assert.Equal(t, before, after, "the entry is not left behind without a path")
+		database.DB.Unscoped().Delete(squatter)
 	})
 
-	t.Run("Success - Add private comment", func(t *testing.T) {
-		body := map[string]interface{}{
-			"comment":    "Internal note",
-			"is_private": true,
+	t.Run("Success - Move entries under a parent", func(t *testing.T) {
+		assert.Equal(t, 200, move("team", map[string]interface{}{"parent_id": pages["about"].ID}).Code)
+		assert.Equal(t, 200, move("engineering", map[string]interface{}{"parent_id": pages["team"].ID}).Code)
+		assert.Equal(t, "/about/team/engineering", pathOf("engineering"))
+
+		var roots []models.ContentEntry
+		database.DB.Where("content_type_id = ? AND parent_id IS NULL", page.ID).Order("position ASC").Find(&roots)
+		if assert.Len(t, roots, 2) {
+			assert.Equal(t, pages["contact"].ID, roots[1].ID)
 		}
+	})
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments", body, token)
-		assert.NoError(t, err)
-		assert.Equal(t, 201, resp.Code)
+	t.Run("Error - Moves cannot create cycles", func(t *testing.T) {
+		resp := move("about", map[string]interface{}{"parent_id": pages["engineering"].ID})
+		assert.Equal(t, 400, resp.Code)
+		resp = move("about", map[string]interface{}{"parent_id": pages["about"].ID})
+		assert.Equal(t, 400, resp.Code)
+		resp = move("about", map[string]interface{}{"parent_id": 99999})
+		assert.Equal(t, 404, resp.Code)
 	})
 
-	t.Run("Success - Get all comments", func(t *testing.T) {
-		resp, err := testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments?include_private=true", nil, token)
-		assert.NoError(t, err)
+	t.Run("Success - Look entries up by path", func(t *testing.T) {
+		var result struct {
+			Data models.ContentEntry `json:"data"`
+		}
+		resp, _ := testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/%d/tree/lookup?path=/about/team/engineering/", page.ID), nil, token)
 		assert.Equal(t, 200, resp.Code)
-
-		var result testutils.StandardResponse
 		testutils.ParseResponse(t, resp, &result)
-		assert.True(t, result.Success)
+		assert.Equal(t, pages["engineering"].ID, result.Data.ID)
 
-		comments := result.Data.([]interface{})
-		assert.GreaterOrEqual(t, len(comments), 2)
+		resp, _ = testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/%d/tree/lookup?path=/engineering", page.ID), nil, token)
+		assert.Equal(t, 404, resp.Code)
 	})
 
-	t.Run("Error - Missing comment text", func(t *testing.T) {
-		body := map[string]interface{}{
-			"is_private": false,
-		}
+	t.Run("Success - Slug changes update descendant paths", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "PUT", fmt.Sprintf("/content/entries/%d", pages["about"].ID),
+			map[string]interface{}{"slug": "company", "_version": 1}, token)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, "/company", pathOf("about"))
+		assert.Equal(t, "/company/team/engineering", pathOf("engineering"))
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments", body, token)
+		resp, _ = testutils.MakeRequest(app, "PUT", fmt.Sprintf("/content/entries/%d", pages["contact"].ID),
+			map[string]interface{}{"slug": "company", "_version": 1}, token)
+		assert.Equal(t, 409, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "PUT", fmt.Sprintf("/content/entries/%d", pages["contact"].ID),
+			map[string]interface{}{"slug": "company/contact", "_version": 1}, token)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Success - Reorder siblings", func(t *testing.T) {
+		history, err := content.CreateContentEntry(ctx, page.ID, admin.ID, map[string]interface{}{"slug": "history"})
 		assert.NoError(t, err)
-		assert.Equal(t, 422, resp.Code)
+		pages["history"] = history
+		assert.Equal(t, 200, move("history", map[string]interface{}{"parent_id": pages["about"].ID, "position": 0}).Code)
+		assert.Equal(t, "/company/history", pathOf("history"))
+
+		url := fmt.Sprintf("/content/%d/tree/reorder", page.ID)
+		resp, _ := testutils.MakeRequest(app, "POST", url, map[string]interface{}{
+			"parent_id": pages["about"].ID, "order": []uint{pages["team"].ID},
+		}, token)
+		assert.Equal(t, 400, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "POST", url, map[string]interface{}{
+			"parent_id": pages["about"].ID, "order": []uint{pages["team"].ID, history.ID},
+		}, token)
+		assert.Equal(t, 200, resp.Code)
+		var result struct {
+			Data []models.ContentEntry `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		if assert.Len(t, result.Data, 2) {
+			assert.Equal(t, pages["team"].ID, result.Data[0].ID)
+			assert.Equal(t, 1, result.Data[1].Position)
+		}
+	})
+
+	t.Run("Success - Fetch subtrees with depth", func(t *testing.T) {
+		var result struct {
+			Data []content.TreeNode `json:"data"`
+		}
+		resp, _ := testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/%d/tree", page.ID), nil, token)
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &result)
+		if assert.Len(t, result.Data, 2) && assert.Len(t, result.Data[0].Children, 2) {
+			team := result.Data[0].Children[0]
+			assert.Equal(t, "/company/team", team.Path)
+			assert.Len(t, team.Children, 1)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/%d/tree?depth=2", page.ID), nil, token)
+		testutils.ParseResponse(t, resp, &result)
+		if assert.Len(t, result.Data[0].Children, 2) {
+			assert.Empty(t, result.Data[0].Children[0].Children)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/%d/tree?root=%d", page.ID, pages["team"].ID), nil, token)
+		testutils.ParseResponse(t, resp, &result)
+		if assert.Len(t, result.Data, 1) && assert.Len(t, result.Data[0].Children, 1) {
+			assert.Equal(t, pages["engineering"].ID, result.Data[0].Children[0].ID)
+		}
+	})
+
+	t.Run("Error - Entries with children cannot be deleted", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "DELETE", fmt.Sprintf("/content/entries/%d", pages["about"].ID), nil, token)
+		assert.Equal(t, 409, resp.Code)
+	})
+
+	t.Run("Error - Flat content types have no tree", func(t *testing.T) {
+		blog := &models.ContentType{Name: "Blog", Slug: "blog"}
+		database.DB.Create(blog)
+		resp, _ := testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/%d/tree", blog.ID), nil, token)
+		assert.Equal(t, 400, resp.Code)
 	})
 }
 
-func TestWorkflowAssignments(t *testing.T) {
+func TestManualOrdering(t *testing.T) {
 	app := testutils.SetupTestApp(t)
 
-	admin := testutils.CreateTestUser(t, database.DB, "admin_assign@test.com", "password", "admin")
-	reviewer := testutils.CreateTestUser(t, database.DB, "reviewer@test.com", "password", "editor")
-	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
-	reviewerToken := testutils.GetAuthToken(t, reviewer.ID, reviewer.Role.Name)
+	admin := testutils.CreateTestUser(t, database.DB, "admin@test.com", "password", "admin")
+	token := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
 
-	ct := &models.ContentType{Name: "Article", Slug: "article"}
-	database.DB.Create(ct)
+	resp, _ := testutils.MakeRequest(app, "POST", "/content/types", map[string]interface{}{
+		"name": "Team Member", "slug": "team-member", "is_sortable": true,
+	}, token)
+	assert.Equal(t, 201, resp.Code)
+	var created struct {
+		Data models.ContentType `json:"data"`
+	}
+	testutils.ParseResponse(t, resp, &created)
+	team := created.Data
+	assert.True(t, team.IsSortable)
 
-	entry := &models.ContentEntry{
-		ContentTypeID: ct.ID,
-		CreatedBy:     admin.ID,
-		Status:        models.StatusInReview,
-		Data:          datatypes.JSON([]byte(`{"title":"Article"}`)),
+	ctx := context.Background()
+	members := make(map[string]uint)
+	for _, name := range []string{"ada", "grace", "linus"} {
+		entry, err := content.CreateContentEntry(ctx, team.ID, admin.ID, map[string]interface{}{"name": name})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, entry.Rank)
+		members[name] = entry.ID
 	}
-	database.DB.Create(entry)
 
-	t.Run("Success - Assign entry", func(t *testing.T) {
-		body := map[string]interface{}{
-			"assigned_to": reviewer.ID,
+	listed := func(url string) []uint {
+		resp, _ := testutils.MakeRequest(app, "GET", url, nil, token)
+		assert.Equal(t, 200, resp.Code)
+		var result struct {
+			Data []models.ContentEntry `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		ids := make([]uint, 0, len(result.Data))
+		for _, entry := range result.Data {
+			ids = append(ids, entry.ID)
 		}
+		return ids
+	}
+	manual := fmt.Sprintf("/content/%d/entries?sort=manual", team.ID)
+	position := func(name string, body map[string]interface{}) int {
+		resp, _ := testutils.MakeRequest(app, "POST", fmt.Sprintf("/content/entries/%d/position", members[name]), body, token)
+		return resp.Code
+	}
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/assign", body, adminToken)
-		assert.NoError(t, err)
-		assert.Equal(t, 201, resp.Code)
+	t.Run("Success - New entries go last", func(t *testing.T) {
+		assert.Equal(t, []uint{members["ada"], members["grace"], members["linus"]}, listed(manual))
 
-		testutils.AssertSuccess(t, resp)
+		var ada models.ContentEntry
+		database.DB.First(&ada, members["ada"])
+		duplicate := models.ContentEntry{ContentTypeID: team.ID, Rank: ada.Rank, Data: datatypes.JSON(`{}`)}
+		assert.Error(t, database.DB.Create(&duplicate).Error, "ranks are unique within a content type")
 	})
 
-	t.Run("Success - Get my assignments", func(t *testing.T) {
-		resp, err := testutils.MakeRequest(app, "GET", "/workflow/assignments", nil, reviewerToken)
-		assert.NoError(t, err)
+	t.Run("Success - Move before and after", func(t *testing.T) {
+		assert.Equal(t, 200, position("linus", map[string]interface{}{"before": members["ada"]}))
+		assert.Equal(t, []uint{members["linus"], members["ada"], members["grace"]}, listed(manual))
+
+		assert.Equal(t, 200, position("grace", map[string]interface{}{"after": members["linus"]}))
+		assert.Equal(t, []uint{members["linus"], members["grace"], members["ada"]}, listed(manual))
+
+		assert.Equal(t, 200, position("linus", map[string]interface{}{"after": members["ada"]}))
+		assert.Equal(t, []uint{members["grace"], members["ada"], members["linus"]}, listed(manual))
+
+		var unchanged models.ContentEntry
+		database.DB.First(&unchanged, members["ada"])
+		assert.Equal(t, uint(1), unchanged.Version, "moving an entry is not an edit")
+	})
+
+	t.Run("Success - Search sorts manually", func(t *testing.T) {
+		ids := listed(fmt.Sprintf("/search/entries?content_type_ids=%d&sort_by=manual", team.ID))
+		assert.Equal(t, []uint{members["grace"], members["ada"], members["linus"]}, ids)
+	})
+
+	t.Run("Error - Invalid moves", func(t *testing.T) {
+		assert.Equal(t, 400, position("ada", map[string]interface{}{}))
+		assert.Equal(t, 400, position("ada", map[string]interface{}{"before": members["grace"], "after": members["linus"]}))
+		assert.Equal(t, 400, position("ada", map[string]interface{}{"before": members["ada"]}))
+		assert.Equal(t, 404, position("ada", map[string]interface{}{"before": 99999}))
+	})
+
+	t.Run("Success - Making a type sortable ranks its entries", func(t *testing.T) {
+		blog := &models.ContentType{Name: "Blog", Slug: "blog"}
+		database.DB.Create(blog)
+		first, _ := content.CreateContentEntry(ctx, blog.ID, admin.ID, map[string]interface{}{})
+		second, _ := content.CreateContentEntry(ctx, blog.ID, admin.ID, map[string]interface{}{})
+		assert.Empty(t, first.Rank)
+
+		resp, _ := testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/%d/entries?sort=manual", blog.ID), nil, token)
+		assert.Equal(t, 400, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "PUT", fmt.Sprintf("/content/types/%d", blog.ID), map[string]interface{}{
+			"name": "Blog", "slug": "blog", "is_sortable": true,
+		}, token)
+		assert.Equal(t, 200, resp.Code)
+
+		url := fmt.Sprintf("/content/%d/entries?sort=manual", blog.ID)
+		assert.Equal(t, []uint{first.ID, second.ID}, listed(url))
+
+		resp, _ = testutils.MakeRequest(app, "POST", fmt.Sprintf("/content/entries/%d/position", second.ID),
+			map[string]interface{}{"before": first.ID}, token)
 		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, []uint{second.ID, first.ID}, listed(url))
+	})
+}
+
+func TestEntryLifecycleHooks(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_hooks@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	utils.InitLocalStorage()
+
+	ct := &models.ContentType{Name: "Note", Slug: "note"}
+	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "title", Type: "string"})
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "cover", Type: "media"})
+
+	var created []events.EntryCreated
+	var changed []events.StatusChanged
+	unsubscribe := []func(){
+		events.Before(func(e *events.BeforeEntryCreate) error {
+			if e.Data["title"] == "forbidden" {
+				return fmt.Errorf("title is not allowed")
+			}
+			if title, ok := e.Data["title"].(string); ok {
+				e.Data["title"] = strings.TrimSpace(title)
+			}
+			return nil
+		}),
+		events.Before(func(e *events.BeforeEntryDelete) error {
+			return fmt.Errorf("entries are kept forever")
+		}),
+		events.Before(func(e *events.BeforeStatusChange) error {
+			if e.To == models.StatusRejected {
+				return fmt.Errorf("rejections are disabled")
+			}
+			e.Comment = "[hooked] " + e.Comment
+			return nil
+		}),
+		events.After(func(e events.EntryCreated) { created = append(created, e) }),
+		events.After(func(e events.StatusChanged) { changed = append(changed, e) }),
+	}
+	defer func() {
+		for _, fn := range unsubscribe {
+			fn()
+		}
+	}()
+
+	var entryID string
+
+	t.Run("Success - Before hook mutates and after hook observes", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/content/"+fmt.Sprint(ct.ID)+"/entries",
+			map[string]interface{}{"title": "  Hello  "}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
 
 		var result testutils.StandardResponse
 		testutils.ParseResponse(t, resp, &result)
-		assert.True(t, result.Success)
+		data := result.Data.(map[string]interface{})
+		entryID = fmt.Sprint(data["id"])
+		assert.Equal(t, "Hello", data["data"].(map[string]interface{})["title"])
 
-		if result.Data != nil {
-			assignments := result.Data.([]interface{})
-			assert.GreaterOrEqual(t, len(assignments), 1)
+		if assert.Len(t, created, 1) {
+			assert.Equal(t, admin.ID, created[0].UserID)
+			assert.Equal(t, fmt.Sprint(created[0].Entry.ID), entryID)
 		}
 	})
 
-	t.Run("Error - Missing assigned_to", func(t *testing.T) {
-		body := map[string]interface{}{}
+	t.Run("Error - Before hook vetoes create", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/content/"+fmt.Sprint(ct.ID)+"/entries",
+			map[string]interface{}{"title": "forbidden"}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+		testutils.AssertError(t, resp, "OPERATION_VETOED")
+		assert.Len(t, created, 1)
+	})
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/assign", body, adminToken)
+	t.Run("Error - Vetoed create discards its uploads", func(t *testing.T) {
+		resp, err := testutils.MakeMultipartRequestWithFile(app, "POST", "/content/"+fmt.Sprint(ct.ID)+"/entries",
+			map[string]string{"title": "forbidden"}, map[string][]byte{"cover": []byte("fake image content")}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+
+		var count int64
+		database.DB.Unscoped().Model(&models.MediaFile{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("Error - Before hook vetoes JSON create", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/content/"+fmt.Sprint(ct.ID)+"/entries/json",
+			map[string]interface{}{"title": "forbidden"}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+		testutils.AssertError(t, resp, "OPERATION_VETOED")
+	})
+
+	t.Run("Error - Before hook vetoes delete", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "DELETE", "/content/entries/"+entryID, nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+
+		var count int64
+		database.DB.Model(&models.ContentEntry{}).Where("id = ?", entryID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Success - Status change hooks", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+entryID+"/status",
+			map[string]interface{}{"status": "in_review", "comment": "ready", "_version": 1}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		if assert.Len(t, changed, 1) {
+			assert.Equal(t, models.StatusDraft, changed[0].From)
+			assert.Equal(t, models.StatusInReview, changed[0].To)
+		}
+
+		var history models.WorkflowHistory
+		database.DB.Where("entry_id = ?", entryID).Last(&history)
+		assert.Equal(t, "[hooked] ready", history.Comment)
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+entryID+"/status",
+			map[string]interface{}{"status": "rejected", "_version": 2}, adminToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 422, resp.Code)
+		testutils.AssertError(t, resp, "OPERATION_VETOED")
+		assert.Len(t, changed, 1)
 	})
 }
 
-func TestWorkflowRequestReview(t *testing.T) {
+// ============================================
+// WORKFLOW TESTS
+// ============================================
+
+func TestWorkflowChangeStatus(t *testing.T) {
 	app := testutils.SetupTestApp(t)
 
-	editor := testutils.CreateTestUser(t, database.DB, "editor6@test.com", "password", "editor")
-	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+	editor := testutils.CreateTestUser(t, database.DB, "editor@test.com", "password", "editor")
+	admin := testutils.CreateTestUser(t, database.DB, "admin_wf@test.com", "password", "admin")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
 
 	ct := &models.ContentType{Name: "Blog", Slug: "blog"}
 	database.DB.Create(ct)
@@ -867,88 +1227,430 @@ func TestWorkflowRequestReview(t *testing.T) {
 		ContentTypeID: ct.ID,
 		CreatedBy:     editor.ID,
 		Status:        models.StatusDraft,
-		Data:          datatypes.JSON([]byte(`{"title":"Blog Post"}`)),
+		Data:          datatypes.JSON([]byte(`{"title":"Test"}`)),
 	}
 	database.DB.Create(entry)
 
-	t.Run("Success - Request review", func(t *testing.T) {
+	t.Run("Success - Editor requests review", func(t *testing.T) {
 		body := map[string]interface{}{
-			"comment": "Please review this",
+			"status":   "in_review",
+			"_version": 1,
+			"comment":  "Ready for review",
 		}
 
-		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/request-review", body, token)
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.True(t, result.Success)
+	})
+
+	t.Run("Success - Editor marks ready for approval", func(t *testing.T) {
+		body := map[string]interface{}{
+			"status":   "ready_for_approval",
+			"_version": 2,
+			"comment":  "Ready for approval",
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("Success - Admin approves", func(t *testing.T) {
+		body := map[string]interface{}{
+			"status":   "approved",
+			"_version": 3,
+			"comment":  "Approved",
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("Success - Admin publishes", func(t *testing.T) {
+		body := map[string]interface{}{
+			"status":   "published",
+			"_version": 4,
+			"comment":  "Publishing",
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, adminToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
 
 		var updated models.ContentEntry
 		database.DB.First(&updated, entry.ID)
-		assert.Equal(t, models.StatusInReview, updated.Status)
+		assert.Equal(t, models.StatusPublished, updated.Status)
+		assert.NotNil(t, updated.PublishedAt)
+		assert.Equal(t, uint(5), updated.Version)
+	})
+
+	t.Run("Error - Stale version on status change", func(t *testing.T) {
+		body := map[string]interface{}{
+			"status":   "draft",
+			"_version": 4,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 412, resp.Code)
+		assert.Equal(t, `"5"`, resp.Header().Get("ETag"))
+	})
+
+	t.Run("Error - Missing version on status change", func(t *testing.T) {
+		body := map[string]interface{}{
+			"status": "draft",
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 428, resp.Code)
 	})
 }
 
-func TestWorkflowStatistics(t *testing.T) {
+func TestWorkflowRejectFlow(t *testing.T) {
 	app := testutils.SetupTestApp(t)
 
-	admin := testutils.CreateTestUser(t, database.DB, "admin_stats@test.com", "password", "admin")
-	token := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+	editor := testutils.CreateTestUser(t, database.DB, "editor2@test.com", "password", "editor")
+	admin := testutils.CreateTestUser(t, database.DB, "admin2@test.com", "password", "admin")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
 
-	ct := &models.ContentType{Name: "Product", Slug: "product"}
+	ct := &models.ContentType{Name: "Article", Slug: "article"}
 	database.DB.Create(ct)
 
-	statuses := []models.WorkflowStatus{
-		models.StatusDraft,
-		models.StatusInReview,
-		models.StatusApproved,
-		models.StatusPublished,
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     editor.ID,
+		Status:        models.StatusReadyForApproval,
+		Data:          datatypes.JSON([]byte(`{"title":"Test Article"}`)),
 	}
+	database.DB.Create(entry)
 
-	for _, status := range statuses {
-		database.DB.Create(&models.ContentEntry{
-			ContentTypeID: ct.ID,
-			CreatedBy:     admin.ID,
-			Status:        status,
-			Data:          datatypes.JSON([]byte(`{"name":"Product"}`)),
-		})
-	}
+	t.Run("Success - Admin rejects entry", func(t *testing.T) {
+		body := map[string]interface{}{
+			"comment":  "Needs more work",
+			"_version": 1,
+		}
 
-	t.Run("Success - Get workflow statistics", func(t *testing.T) {
-		resp, err := testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/stats", nil, token)
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/reject", body, adminToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
 
-		var result testutils.StandardResponse
-		testutils.ParseResponse(t, resp, &result)
-		assert.True(t, result.Success)
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusRejected, updated.Status)
+	})
 
-		if result.Data != nil {
-			stats := result.Data.(map[string]interface{})
-			assert.NotNil(t, stats["total"])
-			assert.NotNil(t, stats["draft"])
-			assert.NotNil(t, stats["published"])
+	t.Run("Success - Editor returns to draft", func(t *testing.T) {
+		body := map[string]interface{}{
+			"status":   "draft",
+			"_version": 2,
+			"comment":  "Making revisions",
 		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status", body, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
 	})
 }
 
-func TestWorkflowGetEntriesByStatus(t *testing.T) {
+func TestWorkflowHistory(t *testing.T) {
 	app := testutils.SetupTestApp(t)
 
-	editor := testutils.CreateTestUser(t, database.DB, "editor7@test.com", "password", "editor")
+	editor := testutils.CreateTestUser(t, database.DB, "editor3@test.com", "password", "editor")
 	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
 
 	ct := &models.ContentType{Name: "News", Slug: "news"}
 	database.DB.Create(ct)
 
-	for i := 0; i < 3; i++ {
-		database.DB.Create(&models.ContentEntry{
-			ContentTypeID: ct.ID,
-			CreatedBy:     editor.ID,
-			Status:        models.StatusInReview,
-			Data:          datatypes.JSON([]byte(`{"title":"News"}`)),
-		})
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     editor.ID,
+		Status:        models.StatusDraft,
+		Data:          datatypes.JSON([]byte(`{"title":"News"}`)),
 	}
+	database.DB.Create(entry)
 
-	t.Run("Success - Get entries by status", func(t *testing.T) {
-		resp, err := testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/entries?status=in_review", nil, token)
+	database.DB.Create(&models.WorkflowHistory{
+		EntryID:    entry.ID,
+		FromStatus: models.StatusDraft,
+		ToStatus:   models.StatusInReview,
+		ChangedBy:  editor.ID,
+		Comment:    "Requesting review",
+	})
+
+	t.Run("Success - Get workflow history", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/history", nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.True(t, result.Success)
+
+		history := result.Data.([]interface{})
+		assert.GreaterOrEqual(t, len(history), 1)
+	})
+}
+
+func TestWorkflowComments(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor4@test.com", "password", "editor")
+	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Post", Slug: "post"}
+	database.DB.Create(ct)
+
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     editor.ID,
+		Status:        models.StatusInReview,
+		Data:          datatypes.JSON([]byte(`{"title":"Post"}`)),
+	}
+	database.DB.Create(entry)
+
+	t.Run("Success - Add public comment", func(t *testing.T) {
+		body := map[string]interface{}{
+			"comment":    "This looks good",
+			"is_private": false,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments", body, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+
+		testutils.AssertSuccess(t, resp)
+	})
+
+	t.Run("Success - Add private comment", func(t *testing.T) {
+		body := map[string]interface{}{
+			"comment":    "Internal note",
+			"is_private": true,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments", body, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+	})
+
+	t.Run("Success - Get all comments", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments?include_private=true", nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.True(t, result.Success)
+
+		comments := result.Data.([]interface{})
+		assert.GreaterOrEqual(t, len(comments), 2)
+	})
+
+	t.Run("Error - Missing comment text", func(t *testing.T) {
+		body := map[string]interface{}{
+			"is_private": false,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/comments", body, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+	})
+}
+
+func TestWorkflowCommentThreads(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_threads@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_threads@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	reviewer := testutils.CreateTestUser(t, database.DB, "reviewer_threads@test.com", "password", "editor")
+	reviewerToken := testutils.GetAuthToken(t, reviewer.ID, reviewer.Role.Name)
+
+	ct := &models.ContentType{Name: "Guide", Slug: "guide"}
+	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "body", Type: "text"})
+
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     editor.ID,
+		Status:        models.StatusInReview,
+		Data:          datatypes.JSON([]byte(`{"body":"Step one. Step two."}`)),
+	}
+	database.DB.Create(entry)
+	commentsURL := "/workflow/entries/" + fmt.Sprint(entry.ID) + "/comments"
+
+	var mentioned []uint
+	workflow.SetMentionNotifier(func(comment *models.WorkflowComment, user *models.User) {
+		mentioned = append(mentioned, user.ID)
+	})
+
+	var threadID float64
+
+	t.Run("Success - Anchored comment with mention", func(t *testing.T) {
+		body := map[string]interface{}{
+			"comment":     "Can @editor_threads@test.com expand this step?",
+			"field_name":  "body",
+			"range_start": 0,
+			"range_end":   9,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", commentsURL, body, reviewerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+		threadID = data["id"].(float64)
+		assert.Equal(t, "body", data["field_name"])
+		assert.Len(t, data["mentions"], 1)
+		assert.Equal(t, []uint{editor.ID}, mentioned)
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/mentions", nil, editorToken)
+		assert.NoError(t, err)
+		testutils.ParseResponse(t, resp, &result)
+		assert.Len(t, result.Data, 1)
+	})
+
+	t.Run("Error - Unknown field anchor", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", commentsURL,
+			map[string]interface{}{"comment": "Typo", "field_name": "subtitle"}, reviewerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Success - Replies join the thread", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", commentsURL,
+			map[string]interface{}{"comment": "Done", "parent_id": threadID}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		replyID := result.Data.(map[string]interface{})["id"]
+
+		resp, err = testutils.MakeRequest(app, "POST", commentsURL,
+			map[string]interface{}{"comment": "Thanks", "parent_id": replyID}, reviewerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, threadID, result.Data.(map[string]interface{})["parent_id"])
+
+		resp, err = testutils.MakeRequest(app, "GET", commentsURL+"?field=body", nil, reviewerToken)
+		assert.NoError(t, err)
+		testutils.ParseResponse(t, resp, &result)
+		threads := result.Data.([]interface{})
+		assert.Len(t, threads, 1)
+		assert.Len(t, threads[0].(map[string]interface{})["replies"], 2)
+	})
+
+	t.Run("Success - Open threads block ready_for_approval", func(t *testing.T) {
+		definition := map[string]interface{}{
+			"name":   "threads-must-resolve",
+			"states": []string{"draft", "in_review", "ready_for_approval"},
+			"transitions": []map[string]interface{}{
+				{"from_status": "in_review", "to_status": "ready_for_approval", "required_role": "editor"},
+			},
+			"guards": []map[string]interface{}{
+				{"to_status": "ready_for_approval", "type": "threads_resolved"},
+			},
+		}
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", definition, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+
+		resp, err = testutils.MakeRequest(app, "PUT", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/workflow",
+			map[string]interface{}{"workflow_id": result.Data.(map[string]interface{})["id"]}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		statusURL := "/workflow/entries/" + fmt.Sprint(entry.ID) + "/status"
+		resp, err = testutils.MakeRequest(app, "POST", statusURL,
+			map[string]interface{}{"status": "ready_for_approval", "_version": 1}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "PUT", "/workflow/comments/"+fmt.Sprint(threadID)+"/resolve", nil, reviewerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, true, result.Data.(map[string]interface{})["resolved"])
+
+		resp, err = testutils.MakeRequest(app, "GET", commentsURL+"?resolved=false", nil, reviewerToken)
+		assert.NoError(t, err)
+		testutils.ParseResponse(t, resp, &result)
+		assert.Len(t, result.Data, 0)
+
+		resp, err = testutils.MakeRequest(app, "POST", statusURL,
+			map[string]interface{}{"status": "ready_for_approval", "_version": 1}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("Error - Read-only user cannot reopen thread", func(t *testing.T) {
+		viewer := testutils.CreateTestUser(t, database.DB, "viewer_threads@test.com", "password", "viewer")
+		viewerToken := testutils.GetAuthToken(t, viewer.ID, viewer.Role.Name)
+
+		resp, err := testutils.MakeRequest(app, "PUT", "/workflow/comments/"+fmt.Sprint(threadID)+"/reopen", nil, viewerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Success - Reopen thread", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "PUT", "/workflow/comments/"+fmt.Sprint(threadID)+"/reopen", nil, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var comment models.WorkflowComment
+		database.DB.First(&comment, uint(threadID))
+		assert.False(t, comment.Resolved)
+		assert.Nil(t, comment.ResolvedBy)
+	})
+}
+
+func TestWorkflowAssignments(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_assign@test.com", "password", "admin")
+	reviewer := testutils.CreateTestUser(t, database.DB, "reviewer@test.com", "password", "editor")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+	reviewerToken := testutils.GetAuthToken(t, reviewer.ID, reviewer.Role.Name)
+
+	ct := &models.ContentType{Name: "Article", Slug: "article"}
+	database.DB.Create(ct)
+
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     admin.ID,
+		Status:        models.StatusInReview,
+		Data:          datatypes.JSON([]byte(`{"title":"Article"}`)),
+	}
+	database.DB.Create(entry)
+
+	t.Run("Success - Assign entry", func(t *testing.T) {
+		body := map[string]interface{}{
+			"assigned_to": reviewer.ID,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/assign", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+
+		testutils.AssertSuccess(t, resp)
+	})
+
+	t.Run("Success - Get my assignments", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/assignments", nil, reviewerToken)
 		assert.NoError(t, err)
 		assert.Equal(t, 200, resp.Code)
 
@@ -957,9 +1659,1486 @@ func TestWorkflowGetEntriesByStatus(t *testing.T) {
 		assert.True(t, result.Success)
 
 		if result.Data != nil {
-			entries := result.Data.([]interface{})
-			assert.GreaterOrEqual(t, len(entries), 3)
+			assignments := result.Data.([]interface{})
+			assert.GreaterOrEqual(t, len(assignments), 1)
+		}
+	})
+
+	t.Run("Error - Missing assigned_to", func(t *testing.T) {
+		body := map[string]interface{}{}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/assign", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+	})
+}
+
+func TestWorkflowAssignmentDueDates(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	manager := testutils.CreateTestUser(t, database.DB, "manager_due@test.com", "password", "manager")
+	managerToken := testutils.GetAuthToken(t, manager.ID, manager.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_due@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	otherEditor := testutils.CreateTestUser(t, database.DB, "editor2_due@test.com", "password", "editor")
+	otherEditorToken := testutils.GetAuthToken(t, otherEditor.ID, otherEditor.Role.Name)
+
+	ct := &models.ContentType{Name: "Brief", Slug: "brief"}
+	database.DB.Create(ct)
+
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     manager.ID,
+		Status:        models.StatusInReview,
+		Data:          datatypes.JSON([]byte(`{"title":"Brief"}`)),
+	}
+	database.DB.Create(entry)
+
+	type notification struct {
+		event     string
+		recipient uint
+	}
+	var sent []notification
+	workflow.SetAssignmentNotifier(func(event string, assignment *models.WorkflowAssignment, recipient *models.User) {
+		sent = append(sent, notification{event, recipient.ID})
+	})
+
+	now := time.Now()
+	assign := func(to *models.User, due time.Time) *models.WorkflowAssignment {
+		assignment := &models.WorkflowAssignment{
+			EntryID:    entry.ID,
+			AssignedTo: &to.ID,
+			AssignedBy: manager.ID,
+			Status:     workflow.AssignmentPending,
+			DueDate:    &due,
 		}
+		database.DB.Create(assignment)
+		return assignment
+	}
+
+	t.Run("Success - Overdue and due soon filters", func(t *testing.T) {
+		overdue := assign(editor, now.Add(-2*time.Hour))
+		dueSoon := assign(editor, now.Add(3*time.Hour))
+		assign(editor, now.Add(72*time.Hour))
+
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/assignments?due=overdue", nil, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assignments := result.Data.([]interface{})
+		assert.Len(t, assignments, 1)
+		assert.Equal(t, float64(overdue.ID), assignments[0].(map[string]interface{})["id"])
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/assignments?due=due_soon&within=12h", nil, editorToken)
+		assert.NoError(t, err)
+		testutils.ParseResponse(t, resp, &result)
+		assignments = result.Data.([]interface{})
+		assert.Len(t, assignments, 1)
+		assert.Equal(t, float64(dueSoon.ID), assignments[0].(map[string]interface{})["id"])
+	})
+
+	t.Run("Success - Reminders, overdue marking and escalation", func(t *testing.T) {
+		database.DB.Where("entry_id = ?", entry.ID).Delete(&models.WorkflowAssignment{})
+		sent = nil
+
+		soon := assign(editor, now.Add(2*time.Hour))
+		late := assign(editor, now.Add(-time.Hour))
+
+		policy := workflow.AssignmentPolicy{ReminderLead: 24 * time.Hour, EscalateAfter: 0}
+		result, err := workflow.RunAssignmentChecks(now, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.Reminded)
+		assert.Equal(t, 1, result.Overdue)
+		assert.Equal(t, 1, result.Escalated)
+		assert.Contains(t, sent, notification{workflow.AssignmentEventReminder, editor.ID})
+		assert.Contains(t, sent, notification{workflow.AssignmentEventOverdue, editor.ID})
+		assert.Contains(t, sent, notification{workflow.AssignmentEventEscalated, manager.ID})
+
+		var reminded, escalated models.WorkflowAssignment
+		database.DB.First(&reminded, soon.ID)
+		assert.NotNil(t, reminded.ReminderSentAt)
+		database.DB.First(&escalated, late.ID)
+		assert.NotNil(t, escalated.OverdueAt)
+		assert.NotNil(t, escalated.EscalatedAt)
+
+		// A second run must not notify again.
+		result, err = workflow.RunAssignmentChecks(now, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, workflow.AssignmentCheckResult{}, result)
+	})
+
+	t.Run("Success - Claim pool assignment", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/assign",
+			map[string]interface{}{"assigned_role": "editor"}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assignmentURL := "/workflow/assignments/" + fmt.Sprint(result.Data.(map[string]interface{})["id"])
+
+		resp, err = testutils.MakeRequest(app, "PUT", assignmentURL+"/claim", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "PUT", assignmentURL+"/claim", nil, otherEditorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "PUT", assignmentURL+"/claim", nil, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+	})
+
+	t.Run("Success - Decline and reassign", func(t *testing.T) {
+		assignment := assign(editor, now.Add(48*time.Hour))
+		assignmentURL := "/workflow/assignments/" + fmt.Sprint(assignment.ID)
+		sent = nil
+
+		resp, err := testutils.MakeRequest(app, "PUT", assignmentURL+"/decline",
+			map[string]interface{}{"reason": "On leave"}, otherEditorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "PUT", assignmentURL+"/decline",
+			map[string]interface{}{"reason": "On leave"}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		assert.Contains(t, sent, notification{workflow.AssignmentEventDeclined, manager.ID})
+
+		resp, err = testutils.MakeRequest(app, "PUT", assignmentURL+"/reassign",
+			map[string]interface{}{"assigned_to": otherEditor.ID}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+
+		pending := assign(editor, now.Add(48*time.Hour))
+		resp, err = testutils.MakeRequest(app, "PUT", "/workflow/assignments/"+fmt.Sprint(pending.ID)+"/reassign",
+			map[string]interface{}{"assigned_to": otherEditor.ID}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var updated models.WorkflowAssignment
+		database.DB.First(&updated, pending.ID)
+		assert.Equal(t, otherEditor.ID, *updated.AssignedTo)
+		assert.Contains(t, sent, notification{workflow.AssignmentEventAssigned, otherEditor.ID})
+	})
+
+	t.Run("Success - Pool reminders go to the role's holders in the assignment's space", func(t *testing.T) {
+		acme := models.Space{Name: "Acme", Slug: "acme"}
+		database.DB.Create(&acme)
+		database.DB.Create(&models.SpaceMembership{SpaceID: acme.ID, UserID: manager.ID, RoleID: editor.RoleID})
+
+		due := now.Add(-time.Minute)
+		database.DB.Create(&models.WorkflowAssignment{
+			SpaceID:      acme.ID,
+			EntryID:      entry.ID,
+			AssignedRole: "editor",
+			AssignedBy:   manager.ID,
+			Status:       workflow.AssignmentPending,
+			DueDate:      &due,
+		})
+		sent = nil
+
+		_, err := workflow.RunAssignmentChecks(now, workflow.AssignmentPolicy{EscalateAfter: time.Hour})
+		assert.NoError(t, err)
+		assert.Equal(t, []notification{{workflow.AssignmentEventOverdue, manager.ID}}, sent,
+			"editors without an Acme membership are not notified")
+	})
+}
+
+func TestWorkflowRequestReview(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor6@test.com", "password", "editor")
+	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Blog", Slug: "blog"}
+	database.DB.Create(ct)
+
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     editor.ID,
+		Status:        models.StatusDraft,
+		Data:          datatypes.JSON([]byte(`{"title":"Blog Post"}`)),
+	}
+	database.DB.Create(entry)
+
+	t.Run("Success - Request review", func(t *testing.T) {
+		body := map[string]interface{}{
+			"comment":  "Please review this",
+			"_version": 1,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/request-review", body, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusInReview, updated.Status)
+	})
+}
+
+func TestWorkflowStatistics(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_stats@test.com", "password", "admin")
+	token := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	ct := &models.ContentType{Name: "Product", Slug: "product"}
+	database.DB.Create(ct)
+
+	statuses := []models.WorkflowStatus{
+		models.StatusDraft,
+		models.StatusInReview,
+		models.StatusApproved,
+		models.StatusPublished,
+	}
+
+	for _, status := range statuses {
+		database.DB.Create(&models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     admin.ID,
+			Status:        status,
+			Data:          datatypes.JSON([]byte(`{"name":"Product"}`)),
+		})
+	}
+
+	t.Run("Success - Get workflow statistics", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/stats", nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.True(t, result.Success)
+
+		if result.Data != nil {
+			stats := result.Data.(map[string]interface{})
+			assert.NotNil(t, stats["total"])
+			assert.NotNil(t, stats["draft"])
+			assert.NotNil(t, stats["published"])
+		}
+	})
+}
+
+func TestWorkflowAnalytics(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	manager := testutils.CreateTestUser(t, database.DB, "manager_analytics@test.com", "password", "manager")
+	managerToken := testutils.GetAuthToken(t, manager.ID, manager.Role.Name)
+
+	reviewer := testutils.CreateTestUser(t, database.DB, "reviewer_analytics@test.com", "password", "manager")
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_analytics@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Report", Slug: "report"}
+	database.DB.Create(ct)
+	otherCT := &models.ContentType{Name: "Memo", Slug: "memo"}
+	database.DB.Create(otherCT)
+
+	// Monday 7 September 2026
+	start := time.Date(2026, 9, 7, 9, 0, 0, 0, time.UTC)
+
+	newEntry := func(contentTypeID uint) *models.ContentEntry {
+		entry := &models.ContentEntry{
+			ContentTypeID: contentTypeID,
+			CreatedBy:     editor.ID,
+			Status:        models.StatusDraft,
+			CreatedAt:     start,
+		}
+		database.DB.Create(entry)
+		return entry
+	}
+
+	record := func(entry *models.ContentEntry, from, to models.WorkflowStatus, by uint, after time.Duration, version uint, decision string) {
+		database.DB.Create(&models.WorkflowHistory{
+			EntryID:      entry.ID,
+			FromStatus:   from,
+			ToStatus:     to,
+			ChangedBy:    by,
+			Decision:     decision,
+			EntryVersion: version,
+			CreatedAt:    start.Add(after),
+		})
+	}
+
+	published := newEntry(ct.ID)
+	record(published, models.StatusDraft, models.StatusInReview, editor.ID, 2*time.Hour, 1, "")
+	record(published, models.StatusInReview, models.StatusReadyForApproval, editor.ID, 6*time.Hour, 2, "")
+	record(published, models.StatusReadyForApproval, models.StatusApproved, manager.ID, 10*time.Hour, 3, "")
+	record(published, models.StatusApproved, models.StatusPublished, manager.ID, 12*time.Hour, 4, "")
+
+	rejected := newEntry(ct.ID)
+	record(rejected, models.StatusDraft, models.StatusInReview, editor.ID, time.Hour, 1, "")
+	record(rejected, models.StatusInReview, models.StatusRejected, manager.ID, 5*time.Hour, 2, "")
+
+	// Staged approval: the last voter's vote and transition count once.
+	staged := newEntry(ct.ID)
+	record(staged, models.StatusDraft, models.StatusReadyForApproval, editor.ID, 8*24*time.Hour, 1, "")
+	record(staged, models.StatusReadyForApproval, models.StatusReadyForApproval, reviewer.ID, 8*24*time.Hour+time.Hour, 2, workflow.DecisionApproved)
+	record(staged, models.StatusReadyForApproval, models.StatusApproved, reviewer.ID, 8*24*time.Hour+time.Hour, 2, "")
+
+	other := newEntry(otherCT.ID)
+	record(other, models.StatusDraft, models.StatusInReview, editor.ID, 48*time.Hour, 1, "")
+
+	url := fmt.Sprintf("/workflow/analytics?content_type_id=%d&from=2026-09-01&to=2026-09-30", ct.ID)
+
+	t.Run("Error - Editor cannot view analytics", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", url, nil, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Error - Invalid date range", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/analytics?from=2026-10-01&to=2026-09-01", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Success - Metrics for content type and range", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", url, nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+
+		byStatus := make(map[string]map[string]interface{})
+		for _, s := range data["time_in_status"].([]interface{}) {
+			stat := s.(map[string]interface{})
+			byStatus[stat["status"].(string)] = stat
+		}
+		assert.Equal(t, float64(3), byStatus["draft"]["count"])
+		assert.Equal(t, float64(192), byStatus["draft"]["p90_hours"])
+		assert.Equal(t, float64(4), byStatus["in_review"]["avg_hours"])
+		assert.Len(t, byStatus["draft"]["by_week"], 2)
+
+		cycle := data["cycle_time"].(map[string]interface{})
+		assert.Equal(t, float64(1), cycle["count"])
+		assert.Equal(t, float64(12), cycle["avg_hours"])
+		week := cycle["by_week"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "2026-09-07", week["week"])
+
+		rates := data["rejection_rate_by_author"].([]interface{})
+		assert.Len(t, rates, 1)
+		author := rates[0].(map[string]interface{})
+		assert.Equal(t, float64(editor.ID), author["user_id"])
+		assert.Equal(t, float64(2), author["approved"])
+		assert.Equal(t, float64(1), author["rejected"])
+
+		approvals := make(map[uint]float64)
+		for _, a := range data["approvals_by_reviewer"].([]interface{}) {
+			approver := a.(map[string]interface{})
+			approvals[uint(approver["user_id"].(float64))] = approver["approvals"].(float64)
+		}
+		assert.Equal(t, map[uint]float64{manager.ID: 1, reviewer.ID: 1}, approvals)
+	})
+
+	t.Run("Success - Range excludes later activity", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET",
+			fmt.Sprintf("/workflow/analytics?content_type_id=%d&from=2026-09-01&to=2026-09-10", ct.ID), nil, managerToken)
+		assert.NoError(t, err)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+		assert.Len(t, data["approvals_by_reviewer"], 1)
+	})
+}
+
+func TestWorkflowGetEntriesByStatus(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor7@test.com", "password", "editor")
+	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "News", Slug: "news"}
+	database.DB.Create(ct)
+
+	for i := 0; i < 3; i++ {
+		database.DB.Create(&models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     editor.ID,
+			Status:        models.StatusInReview,
+			Data:          datatypes.JSON([]byte(`{"title":"News"}`)),
+		})
+	}
+
+	t.Run("Success - Get entries by status", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/entries?status=in_review", nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.True(t, result.Success)
+
+		if result.Data != nil {
+			entries := result.Data.([]interface{})
+			assert.GreaterOrEqual(t, len(entries), 3)
+		}
+	})
+}
+
+func TestWorkflowScheduledPublishing(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_schedule@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_schedule@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Press Release", Slug: "press-release"}
+	database.DB.Create(ct)
+
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     editor.ID,
+		Status:        models.StatusApproved,
+		Data:          datatypes.JSON([]byte(`{"title":"Embargoed"}`)),
+	}
+	database.DB.Create(entry)
+
+	now := time.Now()
+	scheduleURL := "/workflow/entries/" + fmt.Sprint(entry.ID) + "/schedule"
+
+	t.Run("Error - Publish time in the past", func(t *testing.T) {
+		body := map[string]interface{}{
+			"publish_at": now.Add(-time.Hour),
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", scheduleURL, body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Error - Editor cannot schedule", func(t *testing.T) {
+		body := map[string]interface{}{
+			"publish_at": now.Add(time.Hour),
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", scheduleURL, body, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Error - Unpublish before publish", func(t *testing.T) {
+		body := map[string]interface{}{
+			"publish_at":   now.Add(2 * time.Hour),
+			"unpublish_at": now.Add(time.Hour),
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", scheduleURL, body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Success - Schedule publish and unpublish", func(t *testing.T) {
+		body := map[string]interface{}{
+			"publish_at":   now.Add(time.Hour),
+			"unpublish_at": now.Add(2 * time.Hour),
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", scheduleURL, body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/scheduled", nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.Len(t, result.Data, 1)
+	})
+
+	t.Run("Success - Nothing due yet", func(t *testing.T) {
+		applied, err := workflow.RunScheduledTransitions(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, applied)
+	})
+
+	t.Run("Success - Scheduled publish runs as scheduling user", func(t *testing.T) {
+		applied, err := workflow.RunScheduledTransitions(now.Add(90 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, applied)
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusPublished, updated.Status)
+		assert.Nil(t, updated.PublishAt)
+		assert.NotNil(t, updated.UnpublishAt)
+
+		var history models.WorkflowHistory
+		database.DB.Where("entry_id = ?", entry.ID).Last(&history)
+		assert.Equal(t, admin.ID, history.ChangedBy)
+		assert.Equal(t, models.StatusPublished, history.ToStatus)
+
+		applied, err = workflow.RunScheduledTransitions(now.Add(90 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, applied)
+	})
+
+	t.Run("Success - Scheduled unpublish", func(t *testing.T) {
+		applied, err := workflow.RunScheduledTransitions(now.Add(3 * time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, applied)
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusDraft, updated.Status)
+		assert.Nil(t, updated.UnpublishAt)
+	})
+
+	t.Run("Success - Impossible schedule is dropped", func(t *testing.T) {
+		publishAt := now.Add(time.Hour)
+		stuck := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     editor.ID,
+			Status:        models.StatusDraft,
+			Data:          datatypes.JSON([]byte(`{"title":"Edited after scheduling"}`)),
+			PublishAt:     &publishAt,
+			ScheduledBy:   &admin.ID,
+		}
+		database.DB.Create(stuck)
+
+		applied, err := workflow.RunScheduledTransitions(now.Add(90 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, applied)
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, stuck.ID)
+		assert.Equal(t, models.StatusDraft, updated.Status)
+		assert.Nil(t, updated.PublishAt)
+	})
+
+	t.Run("Success - Cancel schedule", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "DELETE", scheduleURL, nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+}
+
+func TestWorkflowUnpublishAndArchive(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	manager := testutils.CreateTestUser(t, database.DB, "manager_archive@test.com", "password", "manager")
+	managerToken := testutils.GetAuthToken(t, manager.ID, manager.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_archive@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Promo", Slug: "promo"}
+	database.DB.Create(ct)
+
+	newPublished := func() *models.ContentEntry {
+		entry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     editor.ID,
+			Status:        models.StatusPublished,
+			Data:          datatypes.JSON([]byte(`{"title":"Live"}`)),
+		}
+		database.DB.Create(entry)
+		return entry
+	}
+
+	t.Run("Success - Unpublish back to draft", func(t *testing.T) {
+		entry := newPublished()
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/unpublish",
+			map[string]interface{}{"comment": "Promo ended", "_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusDraft, updated.Status)
+	})
+
+	t.Run("Error - Unpublish requires published entry", func(t *testing.T) {
+		entry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     editor.ID,
+			Status:        models.StatusApproved,
+		}
+		database.DB.Create(entry)
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/unpublish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Error - Editor cannot unpublish", func(t *testing.T) {
+		entry := newPublished()
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/unpublish",
+			map[string]interface{}{"_version": 1}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Success - Archive and restore", func(t *testing.T) {
+		entry := newPublished()
+		entryURL := "/workflow/entries/" + fmt.Sprint(entry.ID)
+
+		resp, err := testutils.MakeRequest(app, "POST", entryURL+"/archive",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusArchived, updated.Status)
+
+		resp, err = testutils.MakeRequest(app, "PUT", "/content/entries/"+fmt.Sprint(entry.ID),
+			map[string]interface{}{"title": "Edit", "_version": 2}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/stats", nil, managerToken)
+		assert.NoError(t, err)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		stats := result.Data.(map[string]interface{})
+		assert.Equal(t, float64(1), stats["archived"])
+
+		resp, err = testutils.MakeRequest(app, "POST", entryURL+"/restore",
+			map[string]interface{}{"_version": 2}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusDraft, updated.Status)
+	})
+}
+
+func TestWorkflowDefinitions(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_wfdef@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_wfdef@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Snippet", Slug: "snippet"}
+	database.DB.Create(ct)
+
+	entry := &models.ContentEntry{
+		ContentTypeID: ct.ID,
+		CreatedBy:     editor.ID,
+		Status:        models.StatusDraft,
+		Data:          datatypes.JSON([]byte(`{"title":"Quick"}`)),
+	}
+	database.DB.Create(entry)
+
+	definition := map[string]interface{}{
+		"name":   "direct-publish",
+		"states": []string{"draft", "published"},
+		"transitions": []map[string]interface{}{
+			{"from_status": "draft", "to_status": "published", "required_permission": "ContentEntry:update"},
+			{"from_status": "published", "to_status": "draft", "required_role": "admin"},
+		},
+	}
+
+	var workflowID uint
+
+	t.Run("Error - Non-admin cannot create workflow", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", definition, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Error - Unknown state", func(t *testing.T) {
+		body := map[string]interface{}{
+			"name":   "broken",
+			"states": []string{"draft", "legal_review"},
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+	})
+
+	t.Run("Success - Create workflow", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", definition, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+		workflowID = uint(data["id"].(float64))
+		assert.Len(t, data["transitions"], 2)
+	})
+
+	t.Run("Error - Built-in flow applies before assignment", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status",
+			map[string]interface{}{"status": "published", "_version": 1}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Success - Assign workflow to content type", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "PUT", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/workflow",
+			map[string]interface{}{"workflow_id": workflowID}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/workflow", nil, editorToken)
+		assert.NoError(t, err)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, "direct-publish", result.Data.(map[string]interface{})["name"])
+	})
+
+	t.Run("Success - Assigned workflow drives transitions", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/request-review",
+			map[string]interface{}{"_version": 1}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status",
+			map[string]interface{}{"status": "published", "_version": 1}, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, entry.ID)
+		assert.Equal(t, models.StatusPublished, updated.Status)
+	})
+
+	t.Run("Error - Update would strand entries", func(t *testing.T) {
+		body := map[string]interface{}{
+			"name":   "direct-publish",
+			"states": []string{"draft"},
+		}
+
+		resp, err := testutils.MakeRequest(app, "PUT", "/workflow/definitions/"+fmt.Sprint(workflowID), body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+	})
+
+	t.Run("Error - Cannot delete assigned workflow", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "DELETE", "/workflow/definitions/"+fmt.Sprint(workflowID), nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+	})
+
+	t.Run("Success - Unassign falls back to built-in flow", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "PUT", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/workflow",
+			map[string]interface{}{"workflow_id": nil}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/workflow", nil, editorToken)
+		assert.NoError(t, err)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, "built-in", result.Data.(map[string]interface{})["name"])
+
+		resp, err = testutils.MakeRequest(app, "DELETE", "/workflow/definitions/"+fmt.Sprint(workflowID), nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 204, resp.Code)
+	})
+
+	t.Run("Error - Default workflow would strand entries", func(t *testing.T) {
+		body := map[string]interface{}{
+			"name":       "drafts-only",
+			"states":     []string{"draft"},
+			"is_default": true,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+	})
+
+	t.Run("Error - Rename to an existing name", func(t *testing.T) {
+		var ids []uint
+		for _, name := range []string{"alpha", "beta"} {
+			body := map[string]interface{}{"name": name, "states": []string{"draft", "published"}}
+			resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", body, adminToken)
+			assert.NoError(t, err)
+			assert.Equal(t, 201, resp.Code)
+
+			var result testutils.StandardResponse
+			testutils.ParseResponse(t, resp, &result)
+			ids = append(ids, uint(result.Data.(map[string]interface{})["id"].(float64)))
+		}
+
+		resp, err := testutils.MakeRequest(app, "PUT", "/workflow/definitions/"+fmt.Sprint(ids[1]),
+			map[string]interface{}{"name": "alpha", "states": []string{"draft", "published"}}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+	})
+
+	t.Run("Error - Cannot delete default workflow", func(t *testing.T) {
+		body := map[string]interface{}{
+			"name":       "house-style",
+			"states":     []string{"draft", "published"},
+			"is_default": true,
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		id := uint(result.Data.(map[string]interface{})["id"].(float64))
+
+		resp, err = testutils.MakeRequest(app, "DELETE", "/workflow/definitions/"+fmt.Sprint(id), nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+	})
+}
+
+func TestWorkflowPermissionBasedTransitions(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_wfperm@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	newsCT := &models.ContentType{Name: "News", Slug: "news"}
+	database.DB.Create(newsCT)
+	legalCT := &models.ContentType{Name: "Policy", Slug: "policy"}
+	database.DB.Create(legalCT)
+
+	resp, err := testutils.MakeRequest(app, "POST", "/roles", map[string]interface{}{
+		"name":        "news_desk",
+		"description": "Approves news only",
+		"permissions": []map[string]interface{}{
+			{"module": "ContentEntry", "action": "read", "field_scope": "all"},
+			{"module": "ContentEntry", "action": "approve", "content_type_ids": []uint{newsCT.ID}},
+		},
+	}, adminToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.Code)
+
+	desk := testutils.CreateTestUser(t, database.DB, "desk_wfperm@test.com", "password", "news_desk")
+	deskToken := testutils.GetAuthToken(t, desk.ID, desk.Role.Name)
+
+	newEntry := func(ct *models.ContentType) *models.ContentEntry {
+		entry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     admin.ID,
+			Status:        models.StatusReadyForApproval,
+			Data:          datatypes.JSON([]byte(`{"title":"Item"}`)),
+		}
+		database.DB.Create(entry)
+		return entry
+	}
+
+	t.Run("Success - Custom role approves in scoped content type", func(t *testing.T) {
+		entry := newEntry(newsCT)
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/approve",
+			map[string]interface{}{"_version": 1}, deskToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/publish",
+			map[string]interface{}{"_version": 2}, deskToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("Error - Permission scope excludes other content types", func(t *testing.T) {
+		entry := newEntry(legalCT)
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/approve",
+			map[string]interface{}{"_version": 1}, deskToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+
+		var unchanged models.ContentEntry
+		database.DB.First(&unchanged, entry.ID)
+		assert.Equal(t, models.StatusReadyForApproval, unchanged.Status)
+	})
+
+	t.Run("Success - Built-in flow lists permissions", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/content-types/"+fmt.Sprint(newsCT.ID)+"/workflow", nil, deskToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		transitions := result.Data.(map[string]interface{})["transitions"].([]interface{})
+		for _, tr := range transitions {
+			transition := tr.(map[string]interface{})
+			assert.NotEmpty(t, transition["required_permission"])
+			assert.Nil(t, transition["required_role"])
+		}
+	})
+}
+
+func TestWorkflowApprovalStages(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	for _, name := range []string{"legal", "brand"} {
+		role := models.Role{Name: name, Description: name + " sign-off"}
+		database.DB.Create(&role)
+		database.DB.Create(&models.Permission{RoleID: role.ID, Module: "ContentEntry", Action: "approve"})
+		database.DB.Create(&models.Permission{RoleID: role.ID, Module: "ContentEntry", Action: "read", FieldScope: "all"})
+	}
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_stage@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+	admin2 := testutils.CreateTestUser(t, database.DB, "admin_stage2@test.com", "password", "admin")
+	admin2Token := testutils.GetAuthToken(t, admin2.ID, admin2.Role.Name)
+	legal := testutils.CreateTestUser(t, database.DB, "legal@test.com", "password", "legal")
+	legalToken := testutils.GetAuthToken(t, legal.ID, legal.Role.Name)
+	brand := testutils.CreateTestUser(t, database.DB, "brand@test.com", "password", "brand")
+	brandToken := testutils.GetAuthToken(t, brand.ID, brand.Role.Name)
+
+	ct := &models.ContentType{Name: "Campaign", Slug: "campaign"}
+	database.DB.Create(ct)
+
+	definition := map[string]interface{}{
+		"name":   "legal-and-brand",
+		"states": []string{"draft", "in_review", "ready_for_approval", "approved", "rejected", "published"},
+		"transitions": []map[string]interface{}{
+			{"from_status": "draft", "to_status": "in_review", "required_role": "editor"},
+			{"from_status": "in_review", "to_status": "ready_for_approval", "required_role": "editor"},
+			{"from_status": "ready_for_approval", "to_status": "approved", "required_role": "admin"},
+			{"from_status": "ready_for_approval", "to_status": "rejected", "required_role": "admin"},
+			{"from_status": "rejected", "to_status": "draft", "required_role": "editor"},
+			{"from_status": "approved", "to_status": "published", "required_role": "admin"},
+		},
+		"stages": []map[string]interface{}{
+			{"name": "Sign-off", "from_status": "ready_for_approval", "to_status": "approved", "required_roles": []string{"legal", "brand"}},
+			{"name": "Final review", "from_status": "ready_for_approval", "to_status": "approved", "min_approvals": 2},
+		},
+	}
+
+	resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", definition, adminToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.Code)
+
+	var created testutils.StandardResponse
+	testutils.ParseResponse(t, resp, &created)
+	workflowID := created.Data.(map[string]interface{})["id"]
+	database.DB.Model(ct).Update("workflow_id", workflowID)
+
+	newEntry := func() *models.ContentEntry {
+		entry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     admin.ID,
+			Status:        models.StatusReadyForApproval,
+			Data:          datatypes.JSON([]byte(`{"title":"Launch"}`)),
+		}
+		database.DB.Create(entry)
+		return entry
+	}
+
+	approve := func(entry *models.ContentEntry, token string) int {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/approve",
+			map[string]interface{}{"comment": "ok", "_version": 1}, token)
+		assert.NoError(t, err)
+		return resp.Code
+	}
+
+	status := func(entry *models.ContentEntry) models.WorkflowStatus {
+		var current models.ContentEntry
+		database.DB.First(&current, entry.ID)
+		return current.Status
+	}
+
+	t.Run("Success - All stages must be satisfied in order", func(t *testing.T) {
+		entry := newEntry()
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/status",
+			map[string]interface{}{"status": "approved", "_version": 1}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+
+		assert.Equal(t, 400, approve(entry, adminToken), "admin is not a sign-off role")
+		assert.Equal(t, 200, approve(entry, legalToken))
+		assert.Equal(t, 400, approve(entry, legalToken), "duplicate approval")
+		assert.Equal(t, models.StatusReadyForApproval, status(entry))
+
+		assert.Equal(t, 200, approve(entry, brandToken))
+		assert.Equal(t, 200, approve(entry, adminToken))
+		assert.Equal(t, models.StatusReadyForApproval, status(entry))
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/approvals", nil, adminToken)
+		assert.NoError(t, err)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		stages := result.Data.([]interface{})
+		assert.Len(t, stages, 2)
+		assert.Equal(t, true, stages[0].(map[string]interface{})["satisfied"])
+		assert.Equal(t, false, stages[1].(map[string]interface{})["satisfied"])
+
+		assert.Equal(t, 200, approve(entry, admin2Token))
+		assert.Equal(t, models.StatusApproved, status(entry))
+
+		var votes int64
+		database.DB.Model(&models.WorkflowHistory{}).
+			Where("entry_id = ? AND decision = ?", entry.ID, "approved").
+			Count(&votes)
+		assert.Equal(t, int64(4), votes)
+	})
+
+	t.Run("Success - Stage rejection rejects the entry", func(t *testing.T) {
+		entry := newEntry()
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/reject",
+			map[string]interface{}{"comment": "Claims need substantiation", "_version": 1}, legalToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, models.StatusRejected, status(entry))
+
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/history", nil, adminToken)
+		assert.NoError(t, err)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		history := result.Data.([]interface{})
+		assert.Len(t, history, 2)
+
+		var decisions []interface{}
+		for _, h := range history {
+			decisions = append(decisions, h.(map[string]interface{})["decision"])
+		}
+		assert.Contains(t, decisions, "rejected")
+	})
+}
+
+func TestWorkflowTransitionGuards(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_guards@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	manager := testutils.CreateTestUser(t, database.DB, "manager_guards@test.com", "password", "manager")
+	managerToken := testutils.GetAuthToken(t, manager.ID, manager.Role.Name)
+
+	ct := &models.ContentType{Name: "Landing", Slug: "landing", EnableSEO: true}
+	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "title", Type: "string", Required: true})
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "meta_title", Type: "string", IsSEO: true})
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "hero", Type: "media"})
+
+	newApproved := func(data string) *models.ContentEntry {
+		entry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     manager.ID,
+			Status:        models.StatusApproved,
+			Data:          datatypes.JSON([]byte(data)),
+		}
+		database.DB.Create(entry)
+		return entry
+	}
+
+	failedChecks := func(t *testing.T, result testutils.StandardResponse) []string {
+		assert.NotNil(t, result.Error)
+		assert.Equal(t, "TRANSITION_CHECKS_FAILED", result.Error.Code)
+		var guards []string
+		details := result.Error.Details.(map[string]interface{})
+		for _, f := range details["failed_checks"].([]interface{}) {
+			guards = append(guards, f.(map[string]interface{})["guard"].(string))
+		}
+		return guards
+	}
+
+	t.Run("Success - Built-in flow leaves content checks opt-in", func(t *testing.T) {
+		entry := newApproved(`{"title":"Draft copy","meta_title":""}`)
+
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/checks?to=published", nil, managerToken)
+		assert.NoError(t, err)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, true, result.Data.(map[string]interface{})["passed"])
+	})
+
+	t.Run("Success - Opt in to content checks", func(t *testing.T) {
+		body := map[string]interface{}{
+			"name":   "launch-checks",
+			"states": []string{"draft", "in_review", "ready_for_approval", "approved", "published"},
+			"transitions": []map[string]interface{}{
+				{"from_status": "approved", "to_status": "published", "required_permission": "ContentEntry:approve"},
+			},
+			"guards": []map[string]interface{}{
+				{"to_status": "published", "type": "schema"},
+				{"to_status": "published", "type": "seo_fields"},
+				{"to_status": "published", "type": "media_exists"},
+				{"to_status": "published", "type": "relations_published"},
+			},
+		}
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+
+		resp, err = testutils.MakeRequest(app, "PUT", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/workflow",
+			map[string]interface{}{"workflow_id": result.Data.(map[string]interface{})["id"]}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("Error - Missing SEO field and deleted media block publish", func(t *testing.T) {
+		media := &models.MediaFile{FileName: "hero.png", URL: "/uploads/hero.png", UploadedBy: manager.ID}
+		database.DB.Create(media)
+		entry := newApproved(fmt.Sprintf(`{"title":"Launch","meta_title":"","hero_media_id":%d}`, media.ID))
+		database.DB.Delete(media)
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/publish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		guards := failedChecks(t, result)
+		assert.Contains(t, guards, "seo_fields")
+		assert.Contains(t, guards, "media_exists")
+
+		var unchanged models.ContentEntry
+		database.DB.First(&unchanged, entry.ID)
+		assert.Equal(t, models.StatusApproved, unchanged.Status)
+	})
+
+	t.Run("Error - Related entry must be published", func(t *testing.T) {
+		related := newApproved(`{"title":"Pricing","meta_title":"Pricing"}`)
+		entry := newApproved(`{"title":"Launch","meta_title":"Launch"}`)
+		database.DB.Create(&models.ContentRelation{FromContentID: entry.ID, ToContentID: related.ID, RelationType: "many-to-one"})
+
+		resp, err := testutils.MakeRequest(app, "GET", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/checks?to=published", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+		assert.Equal(t, false, data["passed"])
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(related.ID)+"/publish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/publish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("Success - Mutually related entries do not block each other", func(t *testing.T) {
+		first := newApproved(`{"title":"Part one","meta_title":"Part one"}`)
+		second := newApproved(`{"title":"Part two","meta_title":"Part two"}`)
+		database.DB.Create(&models.ContentRelation{FromContentID: first.ID, ToContentID: second.ID, RelationType: "one-to-one"})
+		database.DB.Create(&models.ContentRelation{FromContentID: second.ID, ToContentID: first.ID, RelationType: "one-to-one"})
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(first.ID)+"/publish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(second.ID)+"/publish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("Error - Unregistered custom guard is rejected", func(t *testing.T) {
+		body := map[string]interface{}{
+			"name":   "broken-guards",
+			"states": []string{"draft", "published"},
+			"guards": []map[string]interface{}{
+				{"to_status": "published", "type": "custom", "name": "does_not_exist"},
+			},
+		}
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+	})
+
+	t.Run("Success - Required fields and custom guard from workflow definition", func(t *testing.T) {
+		workflow.RegisterGuard("has_summary_length", func(entry *models.ContentEntry, toStatus models.WorkflowStatus) error {
+			var data map[string]interface{}
+			json.Unmarshal(entry.Data, &data)
+			if summary, _ := data["summary"].(string); len(summary) < 10 {
+				return fmt.Errorf("summary must be at least 10 characters")
+			}
+			return nil
+		})
+
+		body := map[string]interface{}{
+			"name":   "guarded-publish",
+			"states": []string{"draft", "published"},
+			"transitions": []map[string]interface{}{
+				{"from_status": "draft", "to_status": "published", "required_role": "manager"},
+			},
+			"guards": []map[string]interface{}{
+				{"to_status": "published", "type": "required_fields", "fields": []string{"summary"}},
+				{"from_status": "draft", "to_status": "published", "type": "custom", "name": "has_summary_length"},
+			},
+		}
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", body, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		workflowID := result.Data.(map[string]interface{})["id"]
+		assert.Len(t, result.Data.(map[string]interface{})["guards"], 2)
+
+		guarded := &models.ContentType{Name: "Note", Slug: "note"}
+		database.DB.Create(guarded)
+		resp, err = testutils.MakeRequest(app, "PUT", "/workflow/content-types/"+fmt.Sprint(guarded.ID)+"/workflow",
+			map[string]interface{}{"workflow_id": workflowID}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		entry := &models.ContentEntry{
+			ContentTypeID: guarded.ID,
+			CreatedBy:     manager.ID,
+			Status:        models.StatusDraft,
+			Data:          datatypes.JSON([]byte(`{"title":"Memo"}`)),
+		}
+		database.DB.Create(entry)
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/publish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+		testutils.ParseResponse(t, resp, &result)
+		assert.ElementsMatch(t, []string{"required_fields", "has_summary_length"}, failedChecks(t, result))
+
+		database.DB.Model(entry).Update("data", datatypes.JSON([]byte(`{"title":"Memo","summary":"Quarterly roadmap"}`)))
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entry.ID)+"/publish",
+			map[string]interface{}{"_version": 1}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+	})
+}
+
+func TestWorkflowReleases(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	manager := testutils.CreateTestUser(t, database.DB, "manager_releases@test.com", "password", "manager")
+	managerToken := testutils.GetAuthToken(t, manager.ID, manager.Role.Name)
+
+	ct := &models.ContentType{Name: "Campaign", Slug: "campaign"}
+	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "title", Type: "string", Required: true})
+
+	newEntry := func(status models.WorkflowStatus) *models.ContentEntry {
+		entry := &models.ContentEntry{
+			ContentTypeID: ct.ID,
+			CreatedBy:     manager.ID,
+			Status:        status,
+			Data:          datatypes.JSON([]byte(`{"title":"Spring sale"}`)),
+		}
+		database.DB.Create(entry)
+		return entry
+	}
+
+	newRelease := func(t *testing.T, items map[*models.ContentEntry]string) string {
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/releases",
+			map[string]interface{}{"name": "Spring campaign"}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		id := fmt.Sprint(result.Data.(map[string]interface{})["id"])
+
+		for entry, action := range items {
+			resp, err = testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/items",
+				map[string]interface{}{"entry_id": entry.ID, "action": action}, managerToken)
+			assert.NoError(t, err)
+			assert.Equal(t, 200, resp.Code)
+		}
+		return id
+	}
+
+	statusOf := func(entry *models.ContentEntry) models.WorkflowStatus {
+		var current models.ContentEntry
+		database.DB.First(&current, entry.ID)
+		return current.Status
+	}
+
+	t.Run("Error - Unapproved entry blocks the whole release", func(t *testing.T) {
+		approved := newEntry(models.StatusApproved)
+		inReview := newEntry(models.StatusInReview)
+		id := newRelease(t, map[*models.ContentEntry]string{approved: "publish", inReview: "publish"})
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/run", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, "RELEASE_INVALID", result.Error.Code)
+		problems := result.Error.Details.(map[string]interface{})["problems"].([]interface{})
+		assert.Len(t, problems, 1)
+		assert.Equal(t, float64(inReview.ID), problems[0].(map[string]interface{})["entry_id"])
+
+		assert.Equal(t, models.StatusApproved, statusOf(approved))
+		assert.Equal(t, models.StatusInReview, statusOf(inReview))
+
+		var release models.Release
+		database.DB.First(&release, id)
+		assert.Equal(t, models.ReleaseDraft, release.Status)
+	})
+
+	t.Run("Success - Run publishes everything and rollback unpublishes it", func(t *testing.T) {
+		first := newEntry(models.StatusApproved)
+		second := newEntry(models.StatusApproved)
+		retired := newEntry(models.StatusPublished)
+		id := newRelease(t, map[*models.ContentEntry]string{first: "publish", second: "publish", retired: "unpublish"})
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/run", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		assert.Equal(t, models.StatusPublished, statusOf(first))
+		assert.Equal(t, models.StatusPublished, statusOf(second))
+		assert.Equal(t, models.StatusDraft, statusOf(retired))
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/items",
+			map[string]interface{}{"entry_id": newEntry(models.StatusApproved).ID}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code)
+
+		// The built-in flow has no draft -> published transition, so the
+		// unpublished entry cannot be put back and nothing is rolled back.
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/rollback", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+		assert.Equal(t, models.StatusPublished, statusOf(first))
+
+		database.DB.Where("release_id = ? AND entry_id = ?", id, retired.ID).Delete(&models.ReleaseItem{})
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/rollback", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		for _, entry := range []*models.ContentEntry{first, second} {
+			var current models.ContentEntry
+			database.DB.First(&current, entry.ID)
+			assert.Equal(t, models.StatusDraft, current.Status)
+			assert.Nil(t, current.PublishedAt)
+		}
+
+		var release models.Release
+		database.DB.First(&release, id)
+		assert.Equal(t, models.ReleaseRolledBack, release.Status)
+		assert.NotNil(t, release.RolledBackAt)
+	})
+
+	t.Run("Success - Entries in the same release may relate to each other", func(t *testing.T) {
+		definition := map[string]interface{}{
+			"name":   "related-launch",
+			"states": models.WorkflowStatuses,
+			"transitions": []map[string]interface{}{
+				{"from_status": "approved", "to_status": "published", "required_permission": "ContentEntry:approve"},
+			},
+			"guards": []map[string]interface{}{
+				{"to_status": "published", "type": "relations_published"},
+			},
+		}
+		admin := testutils.CreateTestUser(t, database.DB, "admin_releases@test.com", "password", "admin")
+		adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/definitions", definition, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		resp, err = testutils.MakeRequest(app, "PUT", "/workflow/content-types/"+fmt.Sprint(ct.ID)+"/workflow",
+			map[string]interface{}{"workflow_id": result.Data.(map[string]interface{})["id"]}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		defer database.DB.Model(ct).Update("workflow_id", nil)
+
+		landing := newEntry(models.StatusApproved)
+		pricing := newEntry(models.StatusApproved)
+		database.DB.Create(&models.ContentRelation{FromContentID: landing.ID, ToContentID: pricing.ID, RelationType: "many-to-one"})
+
+		alone := newRelease(t, map[*models.ContentEntry]string{landing: "publish"})
+		resp, err = testutils.MakeRequest(app, "GET", "/workflow/releases/"+alone+"/validate", nil, managerToken)
+		assert.NoError(t, err)
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, false, result.Data.(map[string]interface{})["valid"])
+
+		id := newRelease(t, map[*models.ContentEntry]string{landing: "publish", pricing: "publish"})
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/run", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, models.StatusPublished, statusOf(landing))
+		assert.Equal(t, models.StatusPublished, statusOf(pricing))
+	})
+
+	t.Run("Error - Rollback refuses when an entry changed afterwards", func(t *testing.T) {
+		first := newEntry(models.StatusApproved)
+		second := newEntry(models.StatusApproved)
+		id := newRelease(t, map[*models.ContentEntry]string{first: "publish", second: "publish"})
+
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/run", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		database.DB.Model(&models.ContentEntry{}).Where("id = ?", second.ID).
+			Update("version", gorm.Expr("version + 1"))
+
+		resp, err = testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/rollback", nil, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 422, resp.Code)
+
+		assert.Equal(t, models.StatusPublished, statusOf(first))
+		assert.Equal(t, models.StatusPublished, statusOf(second))
+	})
+
+	t.Run("Success - Scheduled release runs when due", func(t *testing.T) {
+		entry := newEntry(models.StatusApproved)
+		id := newRelease(t, map[*models.ContentEntry]string{entry: "publish"})
+
+		at := time.Now().Add(time.Hour)
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/schedule",
+			map[string]interface{}{"scheduled_at": at}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		applied, err := workflow.RunScheduledReleases(time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, applied)
+		assert.Equal(t, models.StatusApproved, statusOf(entry))
+
+		applied, err = workflow.RunScheduledReleases(at.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, models.StatusPublished, statusOf(entry))
+	})
+
+	t.Run("Error - Scheduled release that cannot run is marked failed", func(t *testing.T) {
+		entry := newEntry(models.StatusApproved)
+		id := newRelease(t, map[*models.ContentEntry]string{entry: "publish"})
+
+		at := time.Now().Add(time.Hour)
+		resp, err := testutils.MakeRequest(app, "POST", "/workflow/releases/"+id+"/schedule",
+			map[string]interface{}{"scheduled_at": at}, managerToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		database.DB.Model(&models.ContentEntry{}).Where("id = ?", entry.ID).Update("status", models.StatusDraft)
+
+		applied, err := workflow.RunScheduledReleases(at.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, applied)
+
+		var release models.Release
+		database.DB.First(&release, id)
+		assert.Equal(t, models.ReleaseFailed, release.Status)
+		assert.Contains(t, release.FailureReason, fmt.Sprintf("entry %d", entry.ID))
 	})
 }
 
@@ -1178,7 +3357,8 @@ func TestCompleteWorkflow(t *testing.T) {
 
 	t.Run("Step 2 - Editor requests review", func(t *testing.T) {
 		body := map[string]interface{}{
-			"comment": "Please review",
+			"comment":  "Please review",
+			"_version": 1,
 		}
 
 		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entryID)+"/request-review", body, editorToken)
@@ -1209,8 +3389,9 @@ func TestCompleteWorkflow(t *testing.T) {
 
 	t.Run("Step 5 - Editor marks ready for approval", func(t *testing.T) {
 		body := map[string]interface{}{
-			"status":  "ready_for_approval",
-			"comment": "Ready for approval",
+			"status":   "ready_for_approval",
+			"_version": 2,
+			"comment":  "Ready for approval",
 		}
 
 		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entryID)+"/status", body, editorToken)
@@ -1220,7 +3401,8 @@ func TestCompleteWorkflow(t *testing.T) {
 
 	t.Run("Step 6 - Admin approves", func(t *testing.T) {
 		body := map[string]interface{}{
-			"comment": "Approved",
+			"comment":  "Approved",
+			"_version": 3,
 		}
 
 		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entryID)+"/approve", body, adminToken)
@@ -1230,7 +3412,8 @@ func TestCompleteWorkflow(t *testing.T) {
 
 	t.Run("Step 7 - Admin publishes", func(t *testing.T) {
 		body := map[string]interface{}{
-			"comment": "Publishing now",
+			"comment":  "Publishing now",
+			"_version": 4,
 		}
 
 		resp, err := testutils.MakeRequest(app, "POST", "/workflow/entries/"+fmt.Sprint(entryID)+"/publish", body, adminToken)
@@ -0,0 +1,324 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Clients are expected to heartbeat well inside these windows; a lock or
+// presence that is not refreshed simply lapses.
+const (
+	EntryLockTTL     = 2 * time.Minute
+	EntryPresenceTTL = 1 * time.Minute
+)
+
+var ErrLockNotHeld = errors.New("you do not hold the lock on this entry")
+
+type LockHeldError struct {
+	Lock models.EntryLock
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("entry is locked by user %d until %s", e.Lock.UserID, e.Lock.ExpiresAt.Format(time.RFC3339))
+}
+
+func GetActiveEntryLock(ctx context.Context, entryID uint) (*models.EntryLock, error) {
+	var lock models.EntryLock
+	err := database.DB.WithContext(ctx).
+		Preload("User").
+		Where("entry_id = ? AND expires_at > ?", entryID, time.Now()).
+		First(&lock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func AcquireEntryLock(ctx context.Context, entryID, userID uint) (*models.EntryLock, error) {
+	now := time.Now()
+
+	if err := database.DB.WithContext(ctx).
+		Where("entry_id = ? AND expires_at <= ?", entryID, now).
+		Delete(&models.EntryLock{}).Error; err != nil {
+		return nil, err
+	}
+
+	result := database.DB.WithContext(ctx).Model(&models.EntryLock{}).
+		Where("entry_id = ? AND user_id = ?", entryID, userID).
+		Update("expires_at", now.Add(EntryLockTTL))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		lock := models.EntryLock{
+			EntryID:   entryID,
+			UserID:    userID,
+			ExpiresAt: now.Add(EntryLockTTL),
+		}
+		if err := database.DB.WithContext(ctx).Create(&lock).Error; err != nil {
+			current, lookupErr := GetActiveEntryLock(ctx, entryID)
+			if lookupErr == nil && current != nil && current.UserID != userID {
+				return nil, &LockHeldError{Lock: *current}
+			}
+			return nil, err
+		}
+	}
+
+	if err := TouchEntryPresence(ctx, entryID, userID); err != nil {
+		return nil, err
+	}
+
+	return GetActiveEntryLock(ctx, entryID)
+}
+
+func HeartbeatEntryLock(ctx context.Context, entryID, userID uint) (*models.EntryLock, error) {
+	now := time.Now()
+
+	result := database.DB.WithContext(ctx).Model(&models.EntryLock{}).
+		Where("entry_id = ? AND user_id = ? AND expires_at > ?", entryID, userID, now).
+		Update("expires_at", now.Add(EntryLockTTL))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrLockNotHeld
+	}
+
+	if err := TouchEntryPresence(ctx, entryID, userID); err != nil {
+		return nil, err
+	}
+
+	return GetActiveEntryLock(ctx, entryID)
+}
+
+func ReleaseEntryLock(ctx context.Context, entryID, userID uint) error {
+	result := database.DB.WithContext(ctx).
+		Where("entry_id = ? AND user_id = ?", entryID, userID).
+		Delete(&models.EntryLock{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func ForceUnlockEntry(ctx context.Context, entryID uint) (bool, error) {
+	result := database.DB.WithContext(ctx).Where("entry_id = ?", entryID).Delete(&models.EntryLock{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// checkEntryLock returns a LockHeldError when someone other than userID
+// currently holds the lock on the entry.
+func checkEntryLock(ctx context.Context, entryID, userID uint) error {
+	lock, err := GetActiveEntryLock(ctx, entryID)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.UserID != userID {
+		return &LockHeldError{Lock: *lock}
+	}
+	return nil
+}
+
+func TouchEntryPresence(ctx context.Context, entryID, userID uint) error {
+	presence := models.EntryPresence{
+		EntryID:    entryID,
+		UserID:     userID,
+		LastSeenAt: time.Now(),
+	}
+
+	return database.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entry_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen_at", "updated_at"}),
+	}).Create(&presence).Error
+}
+
+func LeaveEntryPresence(ctx context.Context, entryID, userID uint) error {
+	return database.DB.WithContext(ctx).
+		Where("entry_id = ? AND user_id = ?", entryID, userID).
+		Delete(&models.EntryPresence{}).Error
+}
+
+func ListEntryPresence(ctx context.Context, entryID uint) ([]models.EntryPresence, error) {
+	var presences []models.EntryPresence
+	err := database.DB.WithContext(ctx).
+		Preload("User").
+		Where("entry_id = ? AND last_seen_at > ?", entryID, time.Now().Add(-EntryPresenceTTL)).
+		Order("last_seen_at DESC").
+		Find(&presences).Error
+	return presences, err
+}
+
+func lockedResponse(c *fiber.Ctx, err *LockHeldError) error {
+	return response.Locked(c, "Entry is being edited by another user", fiber.Map{
+		"lock": err.Lock,
+	})
+}
+
+func entryExists(ctx context.Context, entryID int) bool {
+	var count int64
+	database.DB.WithContext(ctx).Model(&models.ContentEntry{}).Where("id = ?", entryID).Count(&count)
+	return count > 0
+}
+
+func AcquireLockHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	if !entryExists(ctx, entryID) {
+		return response.NotFound(c, "Entry")
+	}
+
+	lock, err := AcquireEntryLock(ctx, uint(entryID), userID)
+	if err != nil {
+		var held *LockHeldError
+		if errors.As(err, &held) {
+			return lockedResponse(c, held)
+		}
+		return response.InternalError(c, "Failed to acquire lock")
+	}
+
+	return response.Success(c, lock, "Lock acquired successfully")
+}
+
+func HeartbeatLockHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	lock, err := HeartbeatEntryLock(ctx, uint(entryID), userID)
+	if errors.Is(err, ErrLockNotHeld) {
+		return response.Conflict(c, "Lock expired or held by another user. Please acquire it again")
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to extend lock")
+	}
+
+	return response.Success(c, lock, "Lock extended successfully")
+}
+
+func ReleaseLockHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	err = ReleaseEntryLock(ctx, uint(entryID), userID)
+	if errors.Is(err, ErrLockNotHeld) {
+		return response.NotFound(c, "Lock")
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to release lock")
+	}
+
+	return response.NoContent(c)
+}
+
+func ForceUnlockHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	removed, err := ForceUnlockEntry(ctx, uint(entryID))
+	if err != nil {
+		return response.InternalError(c, "Failed to unlock entry")
+	}
+	if !removed {
+		return response.NotFound(c, "Lock")
+	}
+
+	return response.NoContent(c)
+}
+
+func GetPresenceHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	presences, err := ListEntryPresence(ctx, uint(entryID))
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch presence")
+	}
+
+	lock, err := GetActiveEntryLock(ctx, uint(entryID))
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch lock")
+	}
+
+	return response.Success(c, fiber.Map{
+		"viewers": presences,
+		"lock":    lock,
+	}, "Presence retrieved successfully")
+}
+
+func TouchPresenceHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	if !entryExists(ctx, entryID) {
+		return response.NotFound(c, "Entry")
+	}
+
+	if err := TouchEntryPresence(ctx, uint(entryID), userID); err != nil {
+		return response.InternalError(c, "Failed to record presence")
+	}
+
+	presences, err := ListEntryPresence(ctx, uint(entryID))
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch presence")
+	}
+
+	return response.Success(c, presences, "Presence recorded successfully")
+}
+
+func LeavePresenceHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	if err := LeaveEntryPresence(ctx, uint(entryID), userID); err != nil {
+		return response.InternalError(c, "Failed to clear presence")
+	}
+
+	return response.NoContent(c)
+}
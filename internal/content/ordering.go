@@ -0,0 +1,243 @@
+package content
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kyz7/cms/internal/audit"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/Kyz7/cms/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entries of a sortable content type carry a rank, a fractional index, and
+// sort=manual lists them by it. Moving an entry only rewrites its own rank.
+// A unique index on (content_type_id, rank) keeps two requests from giving
+// entries the same rank; the one that loses works its rank out again.
+
+var (
+	ErrNotSortable = errors.New("content type is not sortable")
+	ErrSelfAnchor  = errors.New("an entry cannot be placed next to itself")
+)
+
+// rankAttempts is how often a rank is worked out again after another
+// request took it first.
+const rankAttempts = 3
+
+// rankTaken reports whether an entry other than entryID has rank.
+func rankTaken(db *gorm.DB, contentTypeID uint, rank string, entryID uint) bool {
+	var count int64
+	db.Model(&models.ContentEntry{}).
+		Where("content_type_id = ? AND rank = ? AND id <> ?", contentTypeID, rank, entryID).
+		Count(&count)
+	return count > 0
+}
+
+// FreeRank returns rank when no entry of the content type other than entryID
+// has it, or else the rank right after it, for copying ranks between
+// environments whose orders have drifted apart.
+func FreeRank(db *gorm.DB, contentTypeID uint, rank string, entryID uint) (string, error) {
+	if rank == "" || !rankTaken(db, contentTypeID, rank, entryID) {
+		return rank, nil
+	}
+
+	column := utils.RankColumn(db)
+	var next []string
+	if err := db.Model(&models.ContentEntry{}).
+		Where("content_type_id = ? AND "+column+" > ?", contentTypeID, rank).
+		Order(column+" ASC").
+		Limit(1).
+		Pluck("rank", &next).Error; err != nil {
+		return "", err
+	}
+	upper := ""
+	if len(next) > 0 {
+		upper = next[0]
+	}
+	return utils.RankBetween(rank, upper)
+}
+
+// lastRank returns the highest rank of a content type's entries, or "" when
+// none has one.
+func lastRank(db *gorm.DB, contentTypeID uint) (string, error) {
+	var ranks []string
+	err := db.Model(&models.ContentEntry{}).
+		Where("content_type_id = ? AND rank <> ''", contentTypeID).
+		Order(utils.RankColumn(db)+" DESC").
+		Limit(1).
+		Pluck("rank", &ranks).Error
+	if err != nil || len(ranks) == 0 {
+		return "", err
+	}
+	return ranks[0], nil
+}
+
+// createRanked stores a new entry of a sortable content type last, working
+// its rank out again if another request takes it first. Each attempt runs in
+// its own savepoint when db is a transaction, so a failed one leaves it usable.
+func createRanked(db *gorm.DB, entry *models.ContentEntry) error {
+	for attempt := 1; ; attempt++ {
+		last, err := lastRank(db, entry.ContentTypeID)
+		if err != nil {
+			return err
+		}
+		if entry.Rank, err = utils.RankBetween(last, ""); err != nil {
+			return err
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(entry).Error
+		})
+		if err == nil || attempt == rankAttempts || !rankTaken(db, entry.ContentTypeID, entry.Rank, 0) {
+			return err
+		}
+	}
+}
+
+// AssignRanks ranks the entries of a content type that have no rank yet,
+// oldest first, after those that do.
+func AssignRanks(db *gorm.DB, contentTypeID uint) error {
+	last, err := lastRank(db, contentTypeID)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint
+	if err := db.Model(&models.ContentEntry{}).
+		Where("content_type_id = ? AND (rank = '' OR rank IS NULL)", contentTypeID).
+		Order("id ASC").
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if last, err = utils.RankBetween(last, ""); err != nil {
+			return err
+		}
+		if err := db.Model(&models.ContentEntry{}).Where("id = ?", id).Update("rank", last).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveEntryNextTo ranks an entry directly after anchorID, or directly before
+// it when after is false.
+func MoveEntryNextTo(ctx context.Context, entryID, anchorID uint, after bool) (*models.ContentEntry, error) {
+	db := database.DB.WithContext(ctx)
+
+	var entry models.ContentEntry
+	if err := db.First(&entry, entryID).Error; err != nil {
+		return nil, err
+	}
+	var ct models.ContentType
+	if err := db.First(&ct, entry.ContentTypeID).Error; err != nil {
+		return nil, err
+	}
+	if !ct.IsSortable {
+		return nil, ErrNotSortable
+	}
+	if anchorID == entry.ID {
+		return nil, ErrSelfAnchor
+	}
+
+	for attempt := 1; ; attempt++ {
+		rank, err := rankNextTo(db, ct.ID, entry.ID, anchorID, after)
+		if err != nil {
+			return nil, err
+		}
+		err = db.Model(&entry).Update("rank", rank).Error
+		if err == nil {
+			return &entry, nil
+		}
+		if attempt == rankAttempts || !rankTaken(db, ct.ID, rank, entry.ID) {
+			return nil, err
+		}
+	}
+}
+
+// rankNextTo works out the rank that puts entryID directly after or before
+// anchorID.
+func rankNextTo(db *gorm.DB, contentTypeID, entryID, anchorID uint, after bool) (string, error) {
+	var anchor models.ContentEntry
+	if err := db.Where("content_type_id = ?", contentTypeID).First(&anchor, anchorID).Error; err != nil {
+		return "", err
+	}
+	if anchor.Rank == "" {
+		if err := AssignRanks(db, contentTypeID); err != nil {
+			return "", err
+		}
+		if err := db.First(&anchor, anchor.ID).Error; err != nil {
+			return "", err
+		}
+	}
+
+	column := utils.RankColumn(db)
+	neighbours := db.Model(&models.ContentEntry{}).
+		Where("content_type_id = ? AND id <> ? AND rank <> ''", contentTypeID, entryID)
+
+	var lower, upper string
+	var found []string
+	if after {
+		lower = anchor.Rank
+		if err := neighbours.Where(column+" > ?", anchor.Rank).Order(column+" ASC").Limit(1).Pluck("rank", &found).Error; err != nil {
+			return "", err
+		}
+		if len(found) > 0 {
+			upper = found[0]
+		}
+	} else {
+		upper = anchor.Rank
+		if err := neighbours.Where(column+" < ?", anchor.Rank).Order(column+" DESC").Limit(1).Pluck("rank", &found).Error; err != nil {
+			return "", err
+		}
+		if len(found) > 0 {
+			lower = found[0]
+		}
+	}
+
+	return utils.RankBetween(lower, upper)
+}
+
+func MoveEntryNextToHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	var body struct {
+		Before *uint `json:"before"`
+		After  *uint `json:"after"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+	if (body.Before == nil) == (body.After == nil) {
+		return response.BadRequest(c, "Provide exactly one of before and after", nil)
+	}
+
+	var before models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&before, entryID).Error; err != nil {
+		return response.NotFound(c, "Entry")
+	}
+
+	anchorID, after := body.Before, false
+	if body.After != nil {
+		anchorID, after = body.After, true
+	}
+
+	entry, err := MoveEntryNextTo(ctx, before.ID, *anchorID, after)
+	switch {
+	case errors.Is(err, ErrNotSortable), errors.Is(err, ErrSelfAnchor):
+		return response.BadRequest(c, err.Error(), nil)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return response.NotFound(c, "Entry")
+	case err != nil:
+		return response.InternalError(c, "Failed to move entry")
+	}
+	audit.Record(c, "entry.rank", "entry", entry.ID, before, entry)
+
+	return response.Success(c, entry, "Entry moved successfully")
+}
@@ -1,6 +1,7 @@
 package content
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -9,19 +10,21 @@ import (
 	"time"
 
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
 	"github.com/Kyz7/cms/internal/models"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
-func CreateContentType(name, slug string) (*models.ContentType, error) {
-	ct := models.ContentType{Name: name, Slug: slug}
-	if err := database.DB.Create(&ct).Error; err != nil {
+func CreateContentType(ctx context.Context, name, slug string, isTree, isSortable bool) (*models.ContentType, error) {
+	ct := models.ContentType{Name: name, Slug: slug, IsTree: isTree, IsSortable: isSortable}
+	if err := database.DB.WithContext(ctx).Create(&ct).Error; err != nil {
 		return nil, err
 	}
 	return &ct, nil
 }
 
-func AddFieldToContentType(contentTypeID uint, name, fieldType string, required bool, isSEO bool) (*models.ContentField, error) {
+func AddFieldToContentType(ctx context.Context, contentTypeID uint, name, fieldType string, required bool, isSEO bool) (*models.ContentField, error) {
 	field := models.ContentField{
 		ContentTypeID: contentTypeID,
 		Name:          name,
@@ -30,12 +33,12 @@ func AddFieldToContentType(contentTypeID uint, name, fieldType string, required
 		IsSEO:         isSEO,
 	}
 
-	if err := database.DB.Create(&field).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Create(&field).Error; err != nil {
 		return nil, err
 	}
 
 	if isSEO {
-		database.DB.Model(&models.ContentType{}).
+		database.DB.WithContext(ctx).Model(&models.ContentType{}).
 			Where("id = ?", contentTypeID).
 			Update("enable_seo", true)
 	}
@@ -43,35 +46,35 @@ func AddFieldToContentType(contentTypeID uint, name, fieldType string, required
 	return &field, nil
 }
 
-func ListContentEntries(contentTypeID uint) ([]models.ContentEntry, error) {
+func ListContentEntries(ctx context.Context, contentTypeID uint) ([]models.ContentEntry, error) {
 	var entries []models.ContentEntry
-	if err := database.DB.Where("content_type_id = ?", contentTypeID).Find(&entries).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Where("content_type_id = ?", contentTypeID).Find(&entries).Error; err != nil {
 		return nil, err
 	}
 	return entries, nil
 }
 
-func CreateContentRelation(fromID, toID uint, relationType string) (*models.ContentRelation, error) {
+func CreateContentRelation(ctx context.Context, fromID, toID uint, relationType string) (*models.ContentRelation, error) {
 	relation := models.ContentRelation{
 		FromContentID: fromID,
 		ToContentID:   toID,
 		RelationType:  relationType,
 	}
-	if err := database.DB.Create(&relation).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Create(&relation).Error; err != nil {
 		return nil, err
 	}
 	return &relation, nil
 }
 
-func ListContentRelations(fromID uint) ([]models.ContentRelation, error) {
+func ListContentRelations(ctx context.Context, fromID uint) ([]models.ContentRelation, error) {
 	var relations []models.ContentRelation
-	if err := database.DB.Where("from_content_id = ?", fromID).Find(&relations).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Where("from_content_id = ?", fromID).Find(&relations).Error; err != nil {
 		return nil, err
 	}
 	return relations, nil
 }
 
-func ValidateContentEntryEnhanced(ct models.ContentType, data map[string]interface{}) error {
+func ValidateContentEntryEnhanced(ctx context.Context, ct models.ContentType, data map[string]interface{}) error {
 	allFields := append(ct.Fields, ct.SEOFields...)
 
 	for _, field := range allFields {
@@ -125,7 +128,7 @@ func ValidateContentEntryEnhanced(ct models.ContentType, data map[string]interfa
 		}
 
 		if field.Unique {
-			if err := checkUniqueness(ct.ID, field.Name, value, nil); err != nil {
+			if err := checkUniqueness(ctx, ct.ID, field.Name, value, nil); err != nil {
 				return err
 			}
 		}
@@ -251,7 +254,7 @@ func validateMedia(field models.ContentField, value interface{}) error {
 	return nil
 }
 
-func ValidatePartialUpdate(ct models.ContentType, updatedFields map[string]interface{}, entryID uint) error {
+func ValidatePartialUpdate(ctx context.Context, ct models.ContentType, updatedFields map[string]interface{}, entryID uint) error {
 	allFields := append(ct.Fields, ct.SEOFields...)
 	fieldMap := make(map[string]models.ContentField)
 	for _, field := range allFields {
@@ -277,7 +280,7 @@ func ValidatePartialUpdate(ct models.ContentType, updatedFields map[string]inter
 			return err
 		}
 		if field.Unique {
-			if err := checkUniqueness(ct.ID, field.Name, value, &entryID); err != nil {
+			if err := checkUniqueness(ctx, ct.ID, field.Name, value, &entryID); err != nil {
 				return err
 			}
 		}
@@ -286,6 +289,36 @@ func ValidatePartialUpdate(ct models.ContentType, updatedFields map[string]inter
 	return nil
 }
 
+// ValidateEntrySchema checks a stored entry against every field rule of its
+// content type and returns all violations. Unlike ValidateContentEntryEnhanced
+// it does not count the entry itself when checking unique fields.
+func ValidateEntrySchema(ctx context.Context, ct models.ContentType, data map[string]interface{}, entryID uint) []string {
+	var violations []string
+
+	for _, field := range ct.Fields {
+		value, exists := data[field.Name]
+		if !exists || value == nil || value == "" {
+			if field.Required {
+				violations = append(violations, fmt.Sprintf("field '%s' is required", field.Name))
+			}
+			continue
+		}
+
+		if err := validateFieldByType(field, value); err != nil {
+			violations = append(violations, err.Error())
+			continue
+		}
+
+		if field.Unique {
+			if err := checkUniqueness(ctx, ct.ID, field.Name, value, &entryID); err != nil {
+				violations = append(violations, err.Error())
+			}
+		}
+	}
+
+	return violations
+}
+
 func validateFieldByType(field models.ContentField, value interface{}) error {
 	switch field.Type {
 	case "string", "text":
@@ -308,11 +341,11 @@ func validateFieldByType(field models.ContentField, value interface{}) error {
 	return nil
 }
 
-func checkUniqueness(contentTypeID uint, fieldName string, value interface{}, excludeEntryID *uint) error {
+func checkUniqueness(ctx context.Context, contentTypeID uint, fieldName string, value interface{}, excludeEntryID *uint) error {
 	var count int64
 	jsonValue, _ := json.Marshal(value)
 
-	query := database.DB.Model(&models.ContentEntry{}).
+	query := database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
 		Where("content_type_id = ?", contentTypeID).
 		Where("data->? = ?", fieldName, jsonValue)
 
@@ -369,13 +402,19 @@ func GetFieldValidationRules(field models.ContentField) map[string]interface{} {
 	return rules
 }
 
-func CreateContentEntry(contentTypeID, createdBy uint, data map[string]interface{}) (*models.ContentEntry, error) {
+func CreateContentEntry(ctx context.Context, contentTypeID, createdBy uint, data map[string]interface{}) (*models.ContentEntry, error) {
 	var ct models.ContentType
-	if err := database.DB.Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
 		return nil, err
 	}
 
-	if err := ValidateContentEntryEnhanced(ct, data); err != nil {
+	before := events.BeforeEntryCreate{ContentTypeID: contentTypeID, UserID: createdBy, Data: data}
+	if err := events.RunBefore(&before); err != nil {
+		return nil, err
+	}
+	data = before.Data
+
+	if err := ValidateContentEntryEnhanced(ctx, ct, data); err != nil {
 		return nil, err
 	}
 
@@ -388,20 +427,43 @@ func CreateContentEntry(contentTypeID, createdBy uint, data map[string]interface
 		ContentTypeID: contentTypeID,
 		Data:          datatypes.JSON(jsonData),
 		Status:        models.StatusDraft,
+		Version:       1,
 		CreatedBy:     createdBy,
 		UpdatedBy:     createdBy,
 	}
-
-	if err := database.DB.Create(&entry).Error; err != nil {
-		return nil, err
+	if ct.IsTree {
+		if err := placeNewEntry(ctx, &entry, data); err != nil {
+			return nil, err
+		}
+	}
+	db := database.DB.WithContext(ctx)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if ct.IsSortable {
+			err = createRanked(tx, &entry)
+		} else {
+			err = tx.Create(&entry).Error
+		}
+		if err != nil || !ct.IsTree || entry.Path != "" {
+			return err
+		}
+		// An entry without a slug is filed under its ID, so it gets its path
+		// in the same transaction that gives it the ID.
+		entry.Path = "/" + treeSegment(entry.ID, data)
+		return tx.Model(&entry).Update("path", entry.Path).Error
+	})
+	if err != nil {
+		return nil, pathConflict(db, ct.ID, entry.Path, 0, err)
 	}
 
+	events.Publish(events.EntryCreated{Entry: entry, UserID: createdBy})
+
 	return &entry, nil
 }
 
-func GenerateSEOPreview(entryID uint) (map[string]interface{}, error) {
+func GenerateSEOPreview(ctx context.Context, entryID uint) (map[string]interface{}, error) {
 	var entry models.ContentEntry
-	if err := database.DB.First(&entry, entryID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
 		return nil, err
 	}
 
@@ -420,9 +482,9 @@ func GenerateSEOPreview(entryID uint) (map[string]interface{}, error) {
 	return seoData, nil
 }
 
-func UpdateEntry(entryID, updatedBy uint, data map[string]interface{}) (*models.ContentEntry, error) {
+func UpdateEntry(ctx context.Context, entryID, updatedBy uint, data map[string]interface{}) (*models.ContentEntry, error) {
 	var entry models.ContentEntry
-	if err := database.DB.First(&entry, entryID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
 		return nil, err
 	}
 
@@ -430,12 +492,16 @@ func UpdateEntry(entryID, updatedBy uint, data map[string]interface{}) (*models.
 		return nil, fmt.Errorf("cannot edit published content directly, please create a new version or unpublish first")
 	}
 
+	if entry.Status == models.StatusArchived {
+		return nil, fmt.Errorf("cannot edit archived content, please restore it first")
+	}
+
 	var ct models.ContentType
-	if err := database.DB.Preload("Fields").Preload("SEOFields").First(&ct, entry.ContentTypeID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Fields").Preload("SEOFields").First(&ct, entry.ContentTypeID).Error; err != nil {
 		return nil, err
 	}
 
-	if err := ValidateContentEntryEnhanced(ct, data); err != nil {
+	if err := ValidateContentEntryEnhanced(ctx, ct, data); err != nil {
 		return nil, err
 	}
 
@@ -444,11 +510,29 @@ func UpdateEntry(entryID, updatedBy uint, data map[string]interface{}) (*models.
 		return nil, err
 	}
 
-	entry.Data = datatypes.JSON(jsonData)
-	entry.Status = models.StatusDraft
-	entry.UpdatedBy = updatedBy
+	updates := map[string]interface{}{
+		"data":       datatypes.JSON(jsonData),
+		"status":     models.StatusDraft,
+		"updated_by": updatedBy,
+		"version":    gorm.Expr("version + 1"),
+	}
+	path := entry.Path
+	if ct.IsTree {
+		if path, err = treePath(ctx, entry, data); err != nil {
+			return nil, err
+		}
+		updates["path"] = path
+	}
+
+	updated, err := storeEntryUpdate(ctx, entry, entry.Version, updates, path)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, fmt.Errorf("entry was modified concurrently, please reload and try again")
+	}
 
-	if err := database.DB.Save(&entry).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,589 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Kyz7/cms/internal/audit"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entries of a tree content type hang off an optional parent and are ordered
+// among their siblings by Position. Path joins the slugs from the root down,
+// e.g. /about/team/engineering, and is kept up to date whenever a slug
+// changes or a subtree moves, so it can be looked up directly. A unique
+// index on (content_type_id, path) keeps two live entries from sharing one.
+
+var (
+	ErrNotTree       = errors.New("content type is not a tree")
+	ErrTreeCycle     = errors.New("an entry cannot be moved under itself or one of its descendants")
+	ErrHasChildren   = errors.New("entry has child entries; move or delete them first")
+	ErrOrderMismatch = errors.New("order must list every child of the parent exactly once")
+	ErrSlugSegment   = errors.New("slug of a tree entry cannot contain /")
+)
+
+type PathTakenError struct {
+	Path string
+}
+
+func (e *PathTakenError) Error() string {
+	return fmt.Sprintf("another entry already has the path %s", e.Path)
+}
+
+type TreeNode struct {
+	models.ContentEntry
+	Children []*TreeNode `json:"children"`
+}
+
+// treeSegment is the entry's part of a path: its slug, or its ID when it
+// has none.
+func treeSegment(entryID uint, data map[string]interface{}) string {
+	if slug, ok := data["slug"].(string); ok && slug != "" {
+		return slug
+	}
+	return strconv.FormatUint(uint64(entryID), 10)
+}
+
+// checkSlug makes sure the slug in data is a single path segment, so it
+// cannot reach into another entry's part of the tree.
+func checkSlug(data map[string]interface{}) error {
+	if slug, ok := data["slug"].(string); ok && strings.Contains(slug, "/") {
+		return ErrSlugSegment
+	}
+	return nil
+}
+
+func entrySegment(entry models.ContentEntry) string {
+	var data map[string]interface{}
+	json.Unmarshal(entry.Data, &data)
+	return treeSegment(entry.ID, data)
+}
+
+// parentPath strips the last segment off a path; roots give "".
+func parentPath(path string) string {
+	if i := strings.LastIndex(path, "/"); i > 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+func siblingsOf(db *gorm.DB, contentTypeID uint, parentID *uint) *gorm.DB {
+	db = db.Model(&models.ContentEntry{}).Where("content_type_id = ?", contentTypeID)
+	if parentID == nil {
+		return db.Where("parent_id IS NULL")
+	}
+	return db.Where("parent_id = ?", *parentID)
+}
+
+func checkPathFree(db *gorm.DB, contentTypeID uint, path string, entryID uint) error {
+	var count int64
+	if err := db.Model(&models.ContentEntry{}).
+		Where("content_type_id = ? AND path = ? AND id <> ?", contentTypeID, path, entryID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return &PathTakenError{Path: path}
+	}
+	return nil
+}
+
+// pathConflict reports a write that failed on the unique path index as a
+// PathTakenError. The index catches what checkPathFree cannot, such as two
+// requests taking the same path at once. db must not be the failed
+// transaction.
+func pathConflict(db *gorm.DB, contentTypeID uint, path string, entryID uint, err error) error {
+	if path != "" {
+		if taken := checkPathFree(db, contentTypeID, path, entryID); taken != nil {
+			return taken
+		}
+	}
+	return err
+}
+
+// rewriteSubtreePaths moves the paths of every descendant of oldPath under
+// newPath.
+func rewriteSubtreePaths(db *gorm.DB, contentTypeID uint, oldPath, newPath string) error {
+	if oldPath == "" || oldPath == newPath {
+		return nil
+	}
+	prefix := oldPath + "/"
+	return db.Model(&models.ContentEntry{}).
+		Where("content_type_id = ? AND SUBSTR(path, 1, ?) = ?", contentTypeID, len(prefix), prefix).
+		Update("path", gorm.Expr("CAST(? AS TEXT) || SUBSTR(path, ?)", newPath, len(oldPath)+1)).Error
+}
+
+// placeNewEntry puts a new entry of a tree content type last among the
+// roots. Entries without a slug get their path once they have an ID.
+func placeNewEntry(ctx context.Context, entry *models.ContentEntry, data map[string]interface{}) error {
+	db := database.DB.WithContext(ctx)
+	if err := siblingsOf(db, entry.ContentTypeID, nil).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Scan(&entry.Position).Error; err != nil {
+		return err
+	}
+
+	if err := checkSlug(data); err != nil {
+		return err
+	}
+	if slug, ok := data["slug"].(string); ok && slug != "" {
+		entry.Path = "/" + slug
+		return checkPathFree(db, entry.ContentTypeID, entry.Path, 0)
+	}
+	return nil
+}
+
+// treePath works out the path entry has once its data is data, and checks
+// that no other entry has it.
+func treePath(ctx context.Context, entry models.ContentEntry, data map[string]interface{}) (string, error) {
+	if err := checkSlug(data); err != nil {
+		return "", err
+	}
+	path := parentPath(entry.Path) + "/" + treeSegment(entry.ID, data)
+	if path == entry.Path {
+		return path, nil
+	}
+	if err := checkPathFree(database.DB.WithContext(ctx), entry.ContentTypeID, path, entry.ID); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// storeEntryUpdate writes updates to entry if it is still at version, and
+// moves its descendants under path in the same transaction, so none of them
+// is left under a path its parent no longer has. It reports whether the
+// version still matched.
+func storeEntryUpdate(ctx context.Context, entry models.ContentEntry, version uint, updates map[string]interface{}, path string) (bool, error) {
+	db := database.DB.WithContext(ctx)
+	stored := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ContentEntry{}).
+			Where("id = ? AND version = ?", entry.ID, version).
+			Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		stored = true
+		return rewriteSubtreePaths(tx, entry.ContentTypeID, entry.Path, path)
+	})
+	if err != nil {
+		return false, pathConflict(db, entry.ContentTypeID, path, entry.ID, err)
+	}
+	return stored, nil
+}
+
+func hasChildren(ctx context.Context, entryID uint) bool {
+	var count int64
+	database.DB.WithContext(ctx).Model(&models.ContentEntry{}).Where("parent_id = ?", entryID).Count(&count)
+	return count > 0
+}
+
+func loadTreeType(ctx context.Context, contentTypeID uint) (*models.ContentType, error) {
+	var ct models.ContentType
+	if err := database.DB.WithContext(ctx).First(&ct, contentTypeID).Error; err != nil {
+		return nil, err
+	}
+	if !ct.IsTree {
+		return nil, ErrNotTree
+	}
+	return &ct, nil
+}
+
+// RebuildTreePaths recomputes every path of a content type from the parents
+// and slugs. Entries whose parent is gone, or whose parents loop back to
+// them, become roots.
+func RebuildTreePaths(db *gorm.DB, contentTypeID uint) error {
+	var entries []models.ContentEntry
+	if err := db.Where("content_type_id = ?", contentTypeID).Order("id ASC").Find(&entries).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[uint]*models.ContentEntry, len(entries))
+	for i := range entries {
+		byID[entries[i].ID] = &entries[i]
+	}
+
+	paths := make(map[uint]string, len(entries))
+	resolving := make(map[uint]bool)
+	detached := make(map[uint]bool)
+	var resolve func(entry *models.ContentEntry) string
+	resolve = func(entry *models.ContentEntry) string {
+		if path, ok := paths[entry.ID]; ok {
+			return path
+		}
+		resolving[entry.ID] = true
+
+		prefix := ""
+		if entry.ParentID != nil {
+			parent, ok := byID[*entry.ParentID]
+			if ok && !resolving[parent.ID] {
+				prefix = resolve(parent)
+			} else {
+				entry.ParentID = nil
+				detached[entry.ID] = true
+			}
+		}
+		paths[entry.ID] = prefix + "/" + entrySegment(*entry)
+		return paths[entry.ID]
+	}
+
+	taken := make(map[string]bool, len(entries))
+	for i := range entries {
+		path := resolve(&entries[i])
+		if taken[path] {
+			return &PathTakenError{Path: path}
+		}
+		taken[path] = true
+	}
+
+	var changed []models.ContentEntry
+	for _, entry := range entries {
+		if entry.Path != paths[entry.ID] || detached[entry.ID] {
+			changed = append(changed, entry)
+		}
+	}
+
+	// Clear the old paths first, so two entries trading paths do not trip
+	// the unique index halfway through.
+	for _, entry := range changed {
+		if err := db.Model(&models.ContentEntry{}).Where("id = ?", entry.ID).Update("path", "").Error; err != nil {
+			return err
+		}
+	}
+	for _, entry := range changed {
+		if err := db.Model(&models.ContentEntry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+			"parent_id": entry.ParentID,
+			"path":      paths[entry.ID],
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setPositions(tx *gorm.DB, ids []uint) error {
+	for position, id := range ids {
+		if err := tx.Model(&models.ContentEntry{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveEntry puts an entry, with its subtree, under parentID (nil for the
+// root) at the given position among its new siblings, or last when position
+// is nil or out of range.
+func MoveEntry(ctx context.Context, entryID uint, parentID *uint, position *int) (*models.ContentEntry, error) {
+	db := database.DB.WithContext(ctx)
+
+	var entry models.ContentEntry
+	if err := db.First(&entry, entryID).Error; err != nil {
+		return nil, err
+	}
+	ct, err := loadTreeType(ctx, entry.ContentTypeID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if parentID != nil {
+		var parent models.ContentEntry
+		if err := db.Where("content_type_id = ?", ct.ID).First(&parent, *parentID).Error; err != nil {
+			return nil, err
+		}
+		if parent.ID == entry.ID || strings.HasPrefix(parent.Path, entry.Path+"/") {
+			return nil, ErrTreeCycle
+		}
+		prefix = parent.Path
+	}
+
+	path := prefix + "/" + entrySegment(entry)
+	if err := checkPathFree(db, ct.ID, path, entry.ID); err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var siblings []uint
+		if err := siblingsOf(tx, ct.ID, parentID).
+			Where("id <> ?", entry.ID).
+			Order("position ASC, id ASC").
+			Pluck("id", &siblings).Error; err != nil {
+			return err
+		}
+
+		index := len(siblings)
+		if position != nil && *position >= 0 && *position < index {
+			index = *position
+		}
+		ordered := make([]uint, 0, len(siblings)+1)
+		ordered = append(ordered, siblings[:index]...)
+		ordered = append(ordered, entry.ID)
+		ordered = append(ordered, siblings[index:]...)
+
+		oldPath := entry.Path
+		if err := tx.Model(&entry).Updates(map[string]interface{}{
+			"parent_id": parentID,
+			"path":      path,
+		}).Error; err != nil {
+			return err
+		}
+		if err := rewriteSubtreePaths(tx, ct.ID, oldPath, path); err != nil {
+			return err
+		}
+		return setPositions(tx, ordered)
+	})
+	if err != nil {
+		return nil, pathConflict(db, ct.ID, path, entry.ID, err)
+	}
+
+	if err := db.First(&entry, entryID).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ReorderChildren sets the order of the children of parentID (nil for the
+// roots). order has to name each of them once.
+func ReorderChildren(ctx context.Context, contentTypeID uint, parentID *uint, order []uint) ([]models.ContentEntry, error) {
+	db := database.DB.WithContext(ctx)
+	if _, err := loadTreeType(ctx, contentTypeID); err != nil {
+		return nil, err
+	}
+
+	var children []uint
+	if err := siblingsOf(db, contentTypeID, parentID).Pluck("id", &children).Error; err != nil {
+		return nil, err
+	}
+	if len(order) != len(children) {
+		return nil, ErrOrderMismatch
+	}
+	remaining := make(map[uint]bool, len(children))
+	for _, id := range children {
+		remaining[id] = true
+	}
+	for _, id := range order {
+		if !remaining[id] {
+			return nil, ErrOrderMismatch
+		}
+		delete(remaining, id)
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return setPositions(tx, order)
+	}); err != nil {
+		return nil, err
+	}
+
+	var entries []models.ContentEntry
+	err := siblingsOf(db, contentTypeID, parentID).Order("position ASC, id ASC").Find(&entries).Error
+	return entries, err
+}
+
+// FindEntryByPath resolves a full path such as /about/team to an entry.
+func FindEntryByPath(ctx context.Context, contentTypeID uint, path string) (*models.ContentEntry, error) {
+	if _, err := loadTreeType(ctx, contentTypeID); err != nil {
+		return nil, err
+	}
+
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).
+		Where("content_type_id = ? AND path = ?", contentTypeID, "/"+strings.Trim(path, "/")).
+		First(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// EntryTree returns the subtree under rootID, or every root with its subtree
+// when rootID is nil. depth limits how many levels come back, counting the
+// top one; 0 means no limit.
+func EntryTree(ctx context.Context, contentTypeID uint, rootID *uint, depth int) ([]*TreeNode, error) {
+	db := database.DB.WithContext(ctx)
+	if _, err := loadTreeType(ctx, contentTypeID); err != nil {
+		return nil, err
+	}
+
+	query := db.Where("content_type_id = ?", contentTypeID)
+	if rootID != nil {
+		var root models.ContentEntry
+		if err := db.Where("content_type_id = ?", contentTypeID).First(&root, *rootID).Error; err != nil {
+			return nil, err
+		}
+		prefix := root.Path + "/"
+		query = query.Where("id = ? OR SUBSTR(path, 1, ?) = ?", root.ID, len(prefix), prefix)
+	}
+
+	var entries []models.ContentEntry
+	if err := query.Order("position ASC, id ASC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*TreeNode, len(entries))
+	for _, entry := range entries {
+		nodes[entry.ID] = &TreeNode{ContentEntry: entry, Children: []*TreeNode{}}
+	}
+
+	top := []*TreeNode{}
+	for _, entry := range entries {
+		node := nodes[entry.ID]
+		if (rootID == nil && entry.ParentID == nil) || (rootID != nil && entry.ID == *rootID) {
+			top = append(top, node)
+			continue
+		}
+		if entry.ParentID == nil {
+			continue
+		}
+		if parent, ok := nodes[*entry.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	if depth > 0 {
+		pruneTree(top, depth)
+	}
+	return top, nil
+}
+
+func pruneTree(nodes []*TreeNode, depth int) {
+	for _, node := range nodes {
+		if depth <= 1 {
+			node.Children = []*TreeNode{}
+			continue
+		}
+		pruneTree(node.Children, depth-1)
+	}
+}
+
+func treeErrorResponse(c *fiber.Ctx, err error) error {
+	var taken *PathTakenError
+	switch {
+	case errors.As(err, &taken):
+		return response.Conflict(c, err.Error())
+	case errors.Is(err, ErrNotTree), errors.Is(err, ErrTreeCycle), errors.Is(err, ErrOrderMismatch), errors.Is(err, ErrSlugSegment):
+		return response.BadRequest(c, err.Error(), nil)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return response.NotFound(c, "Entry")
+	default:
+		return response.InternalError(c, "Failed to update entry tree")
+	}
+}
+
+func MoveEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	var body struct {
+		ParentID *uint `json:"parent_id"`
+		Position *int  `json:"position"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	var before models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&before, entryID).Error; err != nil {
+		return response.NotFound(c, "Entry")
+	}
+
+	userID := c.Locals("user_id").(uint)
+	if err := checkEntryLock(ctx, before.ID, userID); err != nil {
+		var held *LockHeldError
+		if errors.As(err, &held) {
+			return lockedResponse(c, held)
+		}
+		return response.InternalError(c, "Failed to check entry lock")
+	}
+
+	entry, err := MoveEntry(ctx, before.ID, body.ParentID, body.Position)
+	if err != nil {
+		return treeErrorResponse(c, err)
+	}
+	audit.Record(c, "entry.move", "entry", entry.ID, before, entry)
+
+	return response.Success(c, entry, "Entry moved successfully")
+}
+
+func ReorderTreeHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	contentTypeID, err := c.ParamsInt("content_type_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid content type ID", nil)
+	}
+
+	var body struct {
+		ParentID *uint  `json:"parent_id"`
+		Order    []uint `json:"order"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	entries, err := ReorderChildren(ctx, uint(contentTypeID), body.ParentID, body.Order)
+	if err != nil {
+		return treeErrorResponse(c, err)
+	}
+	audit.Record(c, "entry.reorder", "content_type", uint(contentTypeID), nil, body)
+
+	return response.Success(c, entries, "Entries reordered successfully")
+}
+
+func GetEntryByPathHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	contentTypeID, err := c.ParamsInt("content_type_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid content type ID", nil)
+	}
+
+	path := c.Query("path")
+	if strings.Trim(path, "/") == "" {
+		return response.BadRequest(c, "path is required", nil)
+	}
+
+	entry, err := FindEntryByPath(ctx, uint(contentTypeID), path)
+	if err != nil {
+		return treeErrorResponse(c, err)
+	}
+
+	return response.Success(c, entry, "Entry retrieved successfully")
+}
+
+func GetEntryTreeHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	contentTypeID, err := c.ParamsInt("content_type_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid content type ID", nil)
+	}
+
+	depth := c.QueryInt("depth", 0)
+	if depth < 0 {
+		return response.BadRequest(c, "depth cannot be negative", nil)
+	}
+
+	var rootID *uint
+	if raw := c.Query("root"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return response.BadRequest(c, "Invalid root entry ID", nil)
+		}
+		root := uint(id)
+		rootID = &root
+	}
+
+	tree, err := EntryTree(ctx, uint(contentTypeID), rootID, depth)
+	if err != nil {
+		return treeErrorResponse(c, err)
+	}
+
+	return response.Success(c, tree, "Entry tree retrieved successfully")
+}
@@ -0,0 +1,267 @@
+// Package cron runs named tasks on cron schedules. Every instance registers
+// the same tasks, and each time a task is due only the instance that takes
+// its lease row in the database runs it, so three replicas still run it once.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskRunning  = errors.New("task is already running")
+)
+
+// Lease is how long a run holds its task. A run still going after this is
+// assumed dead, and another instance may start the task again.
+var Lease = 30 * time.Minute
+
+type task struct {
+	name     string
+	spec     string
+	schedule *Schedule
+	fn       func() error
+}
+
+var (
+	mu    sync.RWMutex
+	tasks = make(map[string]*task)
+)
+
+var instanceID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// Register adds a task that runs fn whenever spec matches. Registering a
+// name again replaces the task.
+func Register(name, spec string, fn func() error) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return fmt.Errorf("cron expression %q never matches", spec)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	tasks[name] = &task{name: name, spec: spec, schedule: schedule, fn: fn}
+	return nil
+}
+
+// RegisterJob adds a task that enqueues a job of jobType whenever spec
+// matches, so the work runs on a job worker with the queue's retries and
+// concurrency limit. While one run's job is pending or running, later ticks
+// do not queue another.
+func RegisterJob(name, spec, jobType string, opts jobs.Options) error {
+	if opts.UniqueKey == "" {
+		opts.UniqueKey = "cron:" + name
+	}
+	return Register(name, spec, func() error {
+		_, err := jobs.Enqueue(jobType, struct{}{}, opts)
+		return err
+	})
+}
+
+func registered() []*task {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]*task, 0, len(tasks))
+	for _, t := range tasks {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+func lookup(name string) (*task, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	t, ok := tasks[name]
+	return t, ok
+}
+
+// Start checks for due tasks every interval.
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			RunDue(time.Now())
+		}
+	}()
+}
+
+// RunDue runs every registered task that is due at now and not already held
+// by another instance. It returns how many tasks this instance ran.
+func RunDue(now time.Time) int {
+	ran := 0
+	for _, t := range registered() {
+		row, err := ensure(t, now)
+		if err != nil {
+			log.Printf("⚠️  Failed to load scheduled task %s: %v", t.name, err)
+			continue
+		}
+		if row.NextRunAt.After(now) {
+			continue
+		}
+
+		claimed, err := claim(t, now, true)
+		if err != nil {
+			log.Printf("⚠️  Failed to claim scheduled task %s: %v", t.name, err)
+			continue
+		}
+		if claimed {
+			run(t, now)
+			ran++
+		}
+	}
+	return ran
+}
+
+// Trigger runs the named task now on this instance, outside its schedule.
+func Trigger(name string) (*models.ScheduledTask, error) {
+	t, ok := lookup(name)
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+
+	now := time.Now()
+	if _, err := ensure(t, now); err != nil {
+		return nil, err
+	}
+	claimed, err := claim(t, now, false)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrTaskRunning
+	}
+	run(t, now)
+
+	var row models.ScheduledTask
+	err = database.DB.Where("name = ?", name).First(&row).Error
+	return &row, err
+}
+
+// ListTasks returns the state of every registered task.
+func ListTasks() ([]models.ScheduledTask, error) {
+	now := time.Now()
+	list := []models.ScheduledTask{}
+	for _, t := range registered() {
+		row, err := ensure(t, now)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *row)
+	}
+	return list, nil
+}
+
+// GetTask returns the state of the named task.
+func GetTask(name string) (*models.ScheduledTask, error) {
+	t, ok := lookup(name)
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return ensure(t, time.Now())
+}
+
+// ensure returns the task's row, creating it on first use and moving the
+// next run when the schedule has changed.
+func ensure(t *task, now time.Time) (*models.ScheduledTask, error) {
+	var row models.ScheduledTask
+	err := database.DB.Where("name = ?", t.name).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		row = models.ScheduledTask{Name: t.name, Schedule: t.spec, NextRunAt: t.schedule.Next(now)}
+		if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return nil, err
+		}
+		err = database.DB.Where("name = ?", t.name).First(&row).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if row.Schedule != t.spec {
+		next := t.schedule.Next(now)
+		if err := database.DB.Model(&models.ScheduledTask{}).
+			Where("name = ? AND schedule = ?", t.name, row.Schedule).
+			Updates(map[string]interface{}{"schedule": t.spec, "next_run_at": next}).Error; err != nil {
+			return nil, err
+		}
+		row.Schedule, row.NextRunAt = t.spec, next
+	}
+	return &row, nil
+}
+
+// claim takes the task's lease for this instance. A scheduled claim also
+// requires the task to be due and moves it to its next run, so however many
+// instances try for the same tick only one succeeds.
+func claim(t *task, now time.Time, scheduled bool) (bool, error) {
+	query := database.DB.Model(&models.ScheduledTask{}).
+		Where("name = ? AND (locked_until IS NULL OR locked_until < ?)", t.name, now)
+	updates := map[string]interface{}{
+		"locked_by":    instanceID,
+		"locked_until": now.Add(Lease),
+	}
+	if scheduled {
+		query = query.Where("next_run_at <= ?", now)
+		updates["next_run_at"] = t.schedule.Next(now)
+	}
+
+	result := query.Updates(updates)
+	return result.RowsAffected == 1, result.Error
+}
+
+func call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// run calls the task and records the outcome, releasing the lease.
+func run(t *task, startedAt time.Time) {
+	begin := time.Now()
+	err := call(t.fn)
+	duration := time.Since(begin)
+
+	updates := map[string]interface{}{
+		"last_run_at":      startedAt,
+		"last_duration_ms": duration.Milliseconds(),
+		"last_status":      models.TaskSucceeded,
+		"last_error":       "",
+		"last_run_by":      instanceID,
+		"locked_by":        "",
+		"locked_until":     nil,
+	}
+	if err != nil {
+		updates["last_status"] = models.TaskFailed
+		updates["last_error"] = err.Error()
+		log.Printf("❌ Scheduled task %s failed after %s: %v", t.name, duration, err)
+	}
+
+	if err := database.DB.Model(&models.ScheduledTask{}).
+		Where("name = ? AND locked_by = ?", t.name, instanceID).
+		Updates(updates).Error; err != nil {
+		log.Printf("⚠️  Failed to record run of scheduled task %s: %v", t.name, err)
+	}
+}
@@ -0,0 +1,42 @@
+package cron
+
+import (
+	"errors"
+
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func ListTasksHandler(c *fiber.Ctx) error {
+	list, err := ListTasks()
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch scheduled tasks")
+	}
+	return response.Success(c, list, "Scheduled tasks retrieved successfully")
+}
+
+func GetTaskHandler(c *fiber.Ctx) error {
+	task, err := GetTask(c.Params("name"))
+	if errors.Is(err, ErrTaskNotFound) {
+		return response.NotFound(c, "Scheduled task")
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch scheduled task")
+	}
+	return response.Success(c, task, "Scheduled task retrieved successfully")
+}
+
+// RunTaskHandler runs a task immediately and returns its recorded outcome.
+func RunTaskHandler(c *fiber.Ctx) error {
+	task, err := Trigger(c.Params("name"))
+	if errors.Is(err, ErrTaskNotFound) {
+		return response.NotFound(c, "Scheduled task")
+	}
+	if errors.Is(err, ErrTaskRunning) {
+		return response.Conflict(c, err.Error())
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to run scheduled task")
+	}
+	return response.Success(c, task, "Scheduled task ran")
+}
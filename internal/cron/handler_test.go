@@ -0,0 +1,221 @@
+package cron_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kyz7/cms/internal/cron"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func at(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func loadTask(t *testing.T, name string) models.ScheduledTask {
+	var row models.ScheduledTask
+	assert.NoError(t, database.DB.Where("name = ?", name).First(&row).Error)
+	return row
+}
+
+func TestSchedule(t *testing.T) {
+	cases := []struct {
+		spec, from, next string
+	}{
+		{"*/15 * * * *", "2026-03-10 10:07", "2026-03-10 10:15"},
+		{"0 * * * *", "2026-03-10 10:00", "2026-03-10 11:00"},
+		{"@daily", "2026-03-10 10:00", "2026-03-11 00:00"},
+		{"30 9 * * mon-fri", "2026-03-13 10:00", "2026-03-16 09:30"}, // Friday to Monday
+		{"0 0 1 jan,jul *", "2026-03-10 10:00", "2026-07-01 00:00"},
+		{"0 12 * * 7", "2026-03-10 10:00", "2026-03-15 12:00"},   // 7 is Sunday
+		{"0 0 13 * fri", "2026-03-10 10:00", "2026-03-13 00:00"}, // day 13 or any Friday
+		{"0 0 29 2 *", "2026-03-10 10:00", "2028-02-29 00:00"},
+		{"0 8-18/4 * * *", "2026-03-10 12:01", "2026-03-10 16:00"},
+	}
+	for _, tc := range cases {
+		schedule, err := cron.Parse(tc.spec)
+		if assert.NoError(t, err, tc.spec) {
+			assert.Equal(t, at(tc.next), schedule.Next(at(tc.from)), tc.spec)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "@often"} {
+		_, err := cron.Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestScheduledTasks(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_cron@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_cron@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	var cleanups int32
+	assert.NoError(t, cron.Register("cleanup", "0 * * * *", func() error {
+		atomic.AddInt32(&cleanups, 1)
+		return nil
+	}))
+	assert.NoError(t, cron.Register("report", "@daily", func() error {
+		return errors.New("smtp down")
+	}))
+	assert.Error(t, cron.Register("never", "0 0 30 2 *", func() error { return nil }))
+
+	start := at("2026-03-10 10:20")
+	cron.RunDue(start)
+
+	t.Run("Success - Runs when due, once per tick", func(t *testing.T) {
+		assert.Equal(t, 0, cron.RunDue(start.Add(10*time.Minute)), "not due before 11:00")
+		assert.Equal(t, int32(0), atomic.LoadInt32(&cleanups))
+
+		tick := at("2026-03-10 11:00")
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cron.RunDue(tick)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&cleanups), "concurrent schedulers run it once")
+
+		row := loadTask(t, "cleanup")
+		assert.Equal(t, models.TaskSucceeded, row.LastStatus)
+		assert.Equal(t, at("2026-03-10 12:00"), row.NextRunAt.UTC())
+		if assert.NotNil(t, row.LastRunAt) {
+			assert.Equal(t, tick, row.LastRunAt.UTC())
+		}
+		assert.Empty(t, row.LockedBy, "lease released")
+	})
+
+	t.Run("Success - Failures are recorded", func(t *testing.T) {
+		cron.RunDue(at("2026-03-11 00:00"))
+
+		row := loadTask(t, "report")
+		assert.Equal(t, models.TaskFailed, row.LastStatus)
+		assert.Equal(t, "smtp down", row.LastError)
+		assert.Equal(t, at("2026-03-12 00:00"), row.NextRunAt.UTC())
+	})
+
+	t.Run("Success - Task held by another instance is skipped", func(t *testing.T) {
+		tick := at("2026-03-11 12:00")
+		database.DB.Model(&models.ScheduledTask{}).Where("name = ?", "cleanup").Updates(map[string]interface{}{
+			"next_run_at": tick, "locked_by": "other-host", "locked_until": tick.Add(time.Minute),
+		})
+		before := atomic.LoadInt32(&cleanups)
+
+		cron.RunDue(tick)
+		assert.Equal(t, before, atomic.LoadInt32(&cleanups))
+
+		cron.RunDue(tick.Add(2 * time.Minute))
+		assert.Equal(t, before+1, atomic.LoadInt32(&cleanups), "runs once the lease expires")
+	})
+
+	t.Run("Admin - List and get tasks", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/tasks/", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		var list struct {
+			Data []models.ScheduledTask `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &list)
+		if assert.Len(t, list.Data, 2) {
+			assert.Equal(t, "cleanup", list.Data[0].Name)
+			assert.Equal(t, "0 * * * *", list.Data[0].Schedule)
+			assert.Equal(t, "report", list.Data[1].Name)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/tasks/report", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/tasks/missing", nil, adminToken)
+		assert.Equal(t, 404, resp.Code)
+	})
+
+	t.Run("Admin - Trigger a task by hand", func(t *testing.T) {
+		before := atomic.LoadInt32(&cleanups)
+		next := loadTask(t, "cleanup").NextRunAt
+
+		resp, _ := testutils.MakeRequest(app, "POST", "/tasks/cleanup/run", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, before+1, atomic.LoadInt32(&cleanups))
+
+		var result struct {
+			Data models.ScheduledTask `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		assert.Equal(t, models.TaskSucceeded, result.Data.LastStatus)
+		assert.True(t, next.Equal(result.Data.NextRunAt), "schedule is unchanged")
+
+		database.DB.Model(&models.ScheduledTask{}).Where("name = ?", "cleanup").Updates(map[string]interface{}{
+			"locked_by": "other-host", "locked_until": time.Now().Add(time.Minute),
+		})
+		resp, _ = testutils.MakeRequest(app, "POST", "/tasks/cleanup/run", nil, adminToken)
+		assert.Equal(t, 409, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/tasks/missing/run", nil, adminToken)
+		assert.Equal(t, 404, resp.Code)
+	})
+
+	t.Run("Error - Non-admin is forbidden", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", "/tasks/cleanup/run", nil, editorToken)
+		assert.Equal(t, 403, resp.Code)
+	})
+}
+
+func TestJobTasks(t *testing.T) {
+	testutils.SetupTestApp(t)
+
+	var purges int32
+	jobs.Register("purge", func(struct{}) error {
+		atomic.AddInt32(&purges, 1)
+		return nil
+	})
+	assert.NoError(t, cron.RegisterJob("purge", "0 * * * *", "purge", jobs.Options{Queue: "maintenance"}))
+
+	cron.RunDue(at("2026-03-10 10:20"))
+
+	t.Run("Success - Due task queues its job", func(t *testing.T) {
+		cron.RunDue(at("2026-03-10 11:00"))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&purges), "the task only queues the job")
+
+		var queued []models.Job
+		database.DB.Where("type = ?", "purge").Find(&queued)
+		if assert.Len(t, queued, 1) {
+			assert.Equal(t, "maintenance", queued[0].Queue)
+		}
+		assert.Equal(t, models.TaskSucceeded, loadTask(t, "purge").LastStatus)
+	})
+
+	t.Run("Success - A pending run is not queued twice", func(t *testing.T) {
+		cron.RunDue(at("2026-03-10 12:00"))
+
+		var count int64
+		database.DB.Model(&models.Job{}).Where("type = ?", "purge").Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		ran, err := jobs.RunNext("maintenance", time.Now(), jobs.DefaultConfig)
+		assert.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&purges))
+
+		cron.RunDue(at("2026-03-10 13:00"))
+		database.DB.Model(&models.Job{}).Where("type = ?", "purge").Count(&count)
+		assert.Equal(t, int64(2), count, "queued again once the last run finished")
+	})
+}
@@ -24,6 +24,10 @@ func Connect(cfg *config.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	if err := RegisterSpaceScope(db); err != nil {
+		return nil, err
+	}
+
 	DB = db
 
 	return db, nil
@@ -36,6 +40,9 @@ func Migrate(db *gorm.DB) error {
 	}
 	err := db.AutoMigrate(
 		&models.User{},
+		&models.Space{},
+		&models.SpaceMembership{},
+		&models.Environment{},
 		&models.Role{},
 		&models.Permission{},
 		&models.ContentType{},
@@ -45,16 +52,59 @@ func Migrate(db *gorm.DB) error {
 		&models.PasswordResetToken{},
 		&models.ResetToken{},
 		&models.RefreshToken{},
+		&models.WorkflowDefinition{},
 		&models.WorkflowTransition{},
+		&models.ApprovalStage{},
+		&models.TransitionGuard{},
 		&models.WorkflowHistory{},
 		&models.WorkflowComment{},
+		&models.CommentMention{},
 		&models.WorkflowAssignment{},
+		&models.Release{},
+		&models.ReleaseItem{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.AuditLog{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.FeedEvent{},
+		&models.StreamTicket{},
+		&models.Job{},
+		&models.Export{},
+		&models.ScheduledTask{},
 		&models.MediaFile{},
 		&models.MediaFolder{},
+		&models.EntryLock{},
+		&models.EntryPresence{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database: ", err)
 	}
+
+	// Names that were unique across the install are now only unique within
+	// their space, and content type names within their environment.
+	legacyIndexes := []struct {
+		model interface{}
+		name  string
+	}{
+		{&models.Role{}, "idx_roles_name"},
+		{&models.ContentType{}, "idx_content_types_name"},
+		{&models.ContentType{}, "idx_content_types_slug"},
+		{&models.ContentType{}, "idx_content_type_space_name"},
+		{&models.ContentType{}, "idx_content_type_space_slug"},
+		{&models.MediaFolder{}, "idx_media_folders_path"},
+		{&models.WorkflowDefinition{}, "idx_workflow_definitions_name"},
+	}
+	for _, idx := range legacyIndexes {
+		if db.Migrator().HasIndex(idx.model, idx.name) {
+			if err := db.Migrator().DropIndex(idx.model, idx.name); err != nil {
+				log.Fatal("Failed to drop index ", idx.name, ": ", err)
+			}
+		}
+	}
+	if err := EnsureDefaultSpace(db); err != nil {
+		log.Fatal("Failed to create default space: ", err)
+	}
 	log.Println("Database migrated successfully!")
 	return nil
 }
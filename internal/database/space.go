@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type spaceKey struct{}
+
+// WithSpace returns a copy of ctx bound to a space. Queries run with it, via
+// DB.WithContext, only see rows of models that have a SpaceID in that space,
+// and rows they create are put in it.
+func WithSpace(ctx context.Context, spaceID uint) context.Context {
+	return context.WithValue(ctx, spaceKey{}, spaceID)
+}
+
+// SpaceFromContext returns the space ctx is bound to.
+func SpaceFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	spaceID, ok := ctx.Value(spaceKey{}).(uint)
+	return spaceID, ok
+}
+
+type environmentKey struct{}
+
+// WithEnvironment returns a copy of ctx bound to an environment, the way
+// WithSpace binds it to a space. Environment 0 is the main environment.
+func WithEnvironment(ctx context.Context, environmentID uint) context.Context {
+	return context.WithValue(ctx, environmentKey{}, environmentID)
+}
+
+// EnvironmentFromContext returns the environment ctx is bound to.
+func EnvironmentFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	environmentID, ok := ctx.Value(environmentKey{}).(uint)
+	return environmentID, ok
+}
+
+// EnsureDefaultSpace creates the default space on a fresh install. It is the
+// first space, so it gets DefaultSpaceID.
+func EnsureDefaultSpace(db *gorm.DB) error {
+	var count int64
+	if err := db.Unscoped().Model(&models.Space{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Create(&models.Space{Name: "Default", Slug: "default"}).Error
+}
+
+// RegisterSpaceScope installs the callbacks behind WithSpace and
+// WithEnvironment on db. Queries without a space or environment in their
+// context, such as background work, see every one.
+func RegisterSpaceScope(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("space:scope", scopeToSpace); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:preload").Before("gorm:after_query").Register("space:member_role", applyMemberRole); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("space:scope", scopeToSpace); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("space:scope", scopeToSpace); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("space:scope", scopeToSpace); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("space:assign", assignSpace)
+}
+
+type scope struct {
+	field string
+	value func(context.Context) (uint, bool)
+}
+
+var scopes = []scope{
+	{"SpaceID", SpaceFromContext},
+	{"EnvironmentID", EnvironmentFromContext},
+}
+
+type scopedField struct {
+	field *schema.Field
+	value uint
+}
+
+// scopedFields returns the scoped columns of the statement's model that its
+// context pins to a value.
+func scopedFields(db *gorm.DB) []scopedField {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+	var fields []scopedField
+	for _, sc := range scopes {
+		value, ok := sc.value(db.Statement.Context)
+		if !ok {
+			continue
+		}
+		if field := db.Statement.Schema.LookUpField(sc.field); field != nil {
+			fields = append(fields, scopedField{field, value})
+		}
+	}
+	return fields
+}
+
+func scopeToSpace(db *gorm.DB) {
+	for _, sf := range scopedFields(db) {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: sf.field.DBName}, Value: sf.value},
+		}})
+	}
+}
+
+func assignSpace(db *gorm.DB) {
+	fields := scopedFields(db)
+	if len(fields) == 0 {
+		return
+	}
+	ctx := db.Statement.Context
+
+	set := func(rv reflect.Value) {
+		for _, sf := range fields {
+			if _, zero := sf.field.ValueOf(ctx, rv); zero {
+				db.AddError(sf.field.Set(ctx, rv, sf.value))
+			}
+		}
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
+
+// applyMemberRole replaces the preloaded role of users read within a space
+// with their role in that space. Users without a membership keep their own
+// role in the default space; elsewhere only admins keep theirs.
+func applyMemberRole(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.Table != "users" {
+		return
+	}
+	spaceID, ok := SpaceFromContext(db.Statement.Context)
+	if !ok || !preloadsRole(db.Statement) {
+		return
+	}
+
+	// Roles are looked up outside the space: a membership may use a role of
+	// the default space, and admins' roles live there.
+	plain := db.Session(&gorm.Session{NewDB: true, Context: context.Background()})
+
+	apply := func(u *models.User) {
+		var membership models.SpaceMembership
+		err := plain.Preload("Role.Permissions").
+			Where("space_id = ? AND user_id = ?", spaceID, u.ID).
+			First(&membership).Error
+		if err == nil {
+			u.Role = membership.Role
+			return
+		}
+		if spaceID == models.DefaultSpaceID {
+			return
+		}
+
+		var own models.Role
+		if plain.Preload("Permissions").First(&own, u.RoleID).Error == nil && own.Name == "admin" {
+			u.Role = &own
+			return
+		}
+		u.Role = nil
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if u, ok := reflect.Indirect(rv.Index(i)).Addr().Interface().(*models.User); ok {
+				apply(u)
+			}
+		}
+	case reflect.Struct:
+		if u, ok := rv.Addr().Interface().(*models.User); ok {
+			apply(u)
+		}
+	}
+}
+
+func preloadsRole(stmt *gorm.Statement) bool {
+	for name := range stmt.Preloads {
+		if name == "Role" || strings.HasPrefix(name, "Role.") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	KindContentType = "content_type"
+	KindField       = "field"
+	KindEntry       = "entry"
+
+	ActionAdded   = "added"
+	ActionChanged = "changed"
+	ActionRemoved = "removed"
+)
+
+// Change is one difference between two environments. ID names it when
+// selecting changes to promote. Added and removed content types carry their
+// fields with them.
+type Change struct {
+	ID          string   `json:"id"`
+	Kind        string   `json:"kind"`
+	Action      string   `json:"action"`
+	ContentType string   `json:"content_type"`
+	Field       string   `json:"field,omitempty"`
+	EntryKey    uint     `json:"entry_key,omitempty"`
+	Attributes  []string `json:"attributes,omitempty"`
+}
+
+// Diff lists what promoting From to To would change in To: added is what
+// only From has, removed is what only To has.
+type Diff struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Schema  []Change `json:"schema"`
+	Content []Change `json:"content"`
+}
+
+func (d *Diff) changes() []Change {
+	return append(append([]Change{}, d.Schema...), d.Content...)
+}
+
+type relationRef struct {
+	To   uint   `json:"to"`
+	Type string `json:"type"`
+}
+
+// snapshot is the content of one environment, keyed the way environments
+// are matched up: content types by slug, fields by name and entries by
+// origin key.
+type snapshot struct {
+	types     map[string]*models.ContentType
+	typeSlugs map[uint]string
+	entries   map[uint]*models.ContentEntry
+	keys      map[uint]uint
+	relations map[uint][]relationRef
+}
+
+func emptySnapshot() *snapshot {
+	return &snapshot{
+		types:     make(map[string]*models.ContentType),
+		typeSlugs: make(map[uint]string),
+		entries:   make(map[uint]*models.ContentEntry),
+		keys:      make(map[uint]uint),
+		relations: make(map[uint][]relationRef),
+	}
+}
+
+// loadSnapshot reads the environment db is scoped to.
+func loadSnapshot(db *gorm.DB) (*snapshot, error) {
+	snap := emptySnapshot()
+
+	var types []models.ContentType
+	if err := db.Preload("Fields", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Find(&types).Error; err != nil {
+		return nil, err
+	}
+	for i := range types {
+		snap.addType(&types[i])
+	}
+
+	var entries []models.ContentEntry
+	if err := db.Order("id ASC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		snap.entries[entries[i].OriginKey()] = &entries[i]
+		snap.keys[entries[i].ID] = entries[i].OriginKey()
+	}
+
+	var relations []models.ContentRelation
+	if err := db.Order("id ASC").Find(&relations).Error; err != nil {
+		return nil, err
+	}
+	for _, rel := range relations {
+		from, ok := snap.keys[rel.FromContentID]
+		if !ok {
+			continue
+		}
+		to, ok := snap.keys[rel.ToContentID]
+		if !ok {
+			continue
+		}
+		snap.relations[from] = append(snap.relations[from], relationRef{To: to, Type: rel.RelationType})
+	}
+	return snap, nil
+}
+
+func (s *snapshot) addType(ct *models.ContentType) {
+	s.types[ct.Slug] = ct
+	s.typeSlugs[ct.ID] = ct.Slug
+}
+
+func (s *snapshot) field(typeSlug, name string) *models.ContentField {
+	ct, ok := s.types[typeSlug]
+	if !ok {
+		return nil
+	}
+	for i := range ct.Fields {
+		if ct.Fields[i].Name == name {
+			return &ct.Fields[i]
+		}
+	}
+	return nil
+}
+
+func typeAttributes(ct *models.ContentType) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        ct.Name,
+		"enable_seo":  ct.EnableSEO,
+		"workflow_id": derefUint(ct.WorkflowID),
+		"is_tree":     ct.IsTree,
+		"is_sortable": ct.IsSortable,
+	}
+}
+
+func fieldAttributes(f *models.ContentField) map[string]interface{} {
+	return map[string]interface{}{
+		"type":          f.Type,
+		"required":      f.Required,
+		"is_seo":        f.IsSEO,
+		"unique":        f.Unique,
+		"max_length":    derefInt(f.MaxLength),
+		"min_length":    derefInt(f.MinLength),
+		"pattern":       f.Pattern,
+		"min_value":     derefFloat(f.MinValue),
+		"max_value":     derefFloat(f.MaxValue),
+		"default_value": f.DefaultValue,
+		"placeholder":   f.Placeholder,
+		"help_text":     f.HelpText,
+	}
+}
+
+func (s *snapshot) entryAttributes(entry *models.ContentEntry) map[string]interface{} {
+	var data interface{}
+	json.Unmarshal(entry.Data, &data)
+
+	relations := append([]relationRef{}, s.relations[entry.OriginKey()]...)
+	sort.Slice(relations, func(i, j int) bool {
+		if relations[i].To != relations[j].To {
+			return relations[i].To < relations[j].To
+		}
+		return relations[i].Type < relations[j].Type
+	})
+
+	var parent interface{}
+	if entry.ParentID != nil {
+		parent = s.keys[*entry.ParentID]
+	}
+
+	return map[string]interface{}{
+		"content_type": s.typeSlugs[entry.ContentTypeID],
+		"data":         data,
+		"status":       entry.Status,
+		"relations":    relations,
+		"parent":       parent,
+		"position":     entry.Position,
+		"rank":         entry.Rank,
+	}
+}
+
+// changedAttributes returns the sorted names of the attributes that differ.
+func changedAttributes(from, to map[string]interface{}) []string {
+	var changed []string
+	for name, value := range from {
+		if !reflect.DeepEqual(value, to[name]) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// compare works out the diff that would turn to into from.
+func compare(from, to *snapshot) *Diff {
+	diff := &Diff{Schema: []Change{}, Content: []Change{}}
+
+	for _, slug := range sortedKeys(from.types, to.types) {
+		source, target := from.types[slug], to.types[slug]
+		switch {
+		case target == nil:
+			diff.Schema = append(diff.Schema, typeChange(slug, ActionAdded, nil))
+		case source == nil:
+			diff.Schema = append(diff.Schema, typeChange(slug, ActionRemoved, nil))
+		default:
+			if attrs := changedAttributes(typeAttributes(source), typeAttributes(target)); len(attrs) > 0 {
+				diff.Schema = append(diff.Schema, typeChange(slug, ActionChanged, attrs))
+			}
+			diff.Schema = append(diff.Schema, compareFields(slug, source, target)...)
+		}
+	}
+
+	keys := make([]uint, 0, len(from.entries)+len(to.entries))
+	for key := range from.entries {
+		keys = append(keys, key)
+	}
+	for key := range to.entries {
+		if _, ok := from.entries[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, key := range keys {
+		source, target := from.entries[key], to.entries[key]
+		switch {
+		case target == nil:
+			diff.Content = append(diff.Content, entryChange(key, from.typeSlugs[source.ContentTypeID], ActionAdded, nil))
+		case source == nil:
+			diff.Content = append(diff.Content, entryChange(key, to.typeSlugs[target.ContentTypeID], ActionRemoved, nil))
+		default:
+			if attrs := changedAttributes(from.entryAttributes(source), to.entryAttributes(target)); len(attrs) > 0 {
+				diff.Content = append(diff.Content, entryChange(key, from.typeSlugs[source.ContentTypeID], ActionChanged, attrs))
+			}
+		}
+	}
+
+	return diff
+}
+
+func compareFields(slug string, source, target *models.ContentType) []Change {
+	fields := make(map[string]*models.ContentField)
+	var names []string
+	for i := range source.Fields {
+		fields[source.Fields[i].Name] = &source.Fields[i]
+		names = append(names, source.Fields[i].Name)
+	}
+	targetFields := make(map[string]*models.ContentField)
+	for i := range target.Fields {
+		targetFields[target.Fields[i].Name] = &target.Fields[i]
+		if _, ok := fields[target.Fields[i].Name]; !ok {
+			names = append(names, target.Fields[i].Name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []Change
+	for _, name := range names {
+		from, to := fields[name], targetFields[name]
+		switch {
+		case to == nil:
+			changes = append(changes, fieldChange(slug, name, ActionAdded, nil))
+		case from == nil:
+			changes = append(changes, fieldChange(slug, name, ActionRemoved, nil))
+		default:
+			if attrs := changedAttributes(fieldAttributes(from), fieldAttributes(to)); len(attrs) > 0 {
+				changes = append(changes, fieldChange(slug, name, ActionChanged, attrs))
+			}
+		}
+	}
+	return changes
+}
+
+func typeChange(slug, action string, attrs []string) Change {
+	return Change{
+		ID:          fmt.Sprintf("%s:%s", KindContentType, slug),
+		Kind:        KindContentType,
+		Action:      action,
+		ContentType: slug,
+		Attributes:  attrs,
+	}
+}
+
+func fieldChange(slug, name, action string, attrs []string) Change {
+	return Change{
+		ID:          fmt.Sprintf("%s:%s.%s", KindField, slug, name),
+		Kind:        KindField,
+		Action:      action,
+		ContentType: slug,
+		Field:       name,
+		Attributes:  attrs,
+	}
+}
+
+func entryChange(key uint, slug, action string, attrs []string) Change {
+	return Change{
+		ID:          fmt.Sprintf("%s:%d", KindEntry, key),
+		Kind:        KindEntry,
+		Action:      action,
+		ContentType: slug,
+		EntryKey:    key,
+		Attributes:  attrs,
+	}
+}
+
+func sortedKeys(a, b map[string]*models.ContentType) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func derefUint(v *uint) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func derefInt(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func derefFloat(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
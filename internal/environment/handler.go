@@ -0,0 +1,134 @@
+package environment
+
+import (
+	"errors"
+
+	"github.com/Kyz7/cms/internal/audit"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type promoteInput struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Changes []string `json:"changes"`
+}
+
+func ListEnvironmentsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	envs, err := ListEnvironments(ctx)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch environments")
+	}
+	return response.Success(c, envs, "Environments retrieved successfully")
+}
+
+func GetEnvironmentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	env, err := GetEnvironment(ctx, c.Params("slug"))
+	if err != nil {
+		return response.NotFound(c, "Environment")
+	}
+	return response.Success(c, env, "Environment retrieved successfully")
+}
+
+func CreateEnvironmentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	userID := c.Locals("user_id").(uint)
+
+	var body EnvironmentInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	env, err := CreateEnvironment(ctx, body, userID)
+	if errors.Is(err, ErrEnvironmentNotFound) {
+		return response.NotFound(c, "Source environment")
+	}
+	if errors.Is(err, ErrEnvironmentExists) {
+		return response.Conflict(c, err.Error())
+	}
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	audit.Record(c, "environment.create", "environment", env.ID, nil, env)
+
+	return response.Created(c, env, "Environment created successfully")
+}
+
+func DeleteEnvironmentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	if err := DeleteEnvironment(ctx, c.Params("slug")); err != nil {
+		switch {
+		case errors.Is(err, ErrEnvironmentNotFound):
+			return response.NotFound(c, "Environment")
+		case errors.Is(err, ErrMainEnvironment):
+			return response.Conflict(c, err.Error())
+		}
+		return response.InternalError(c, "Failed to delete environment")
+	}
+	audit.Record(c, "environment.delete", "environment", c.Params("slug"), nil, nil)
+
+	return response.NoContent(c)
+}
+
+func DiffHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	from := c.Query("from")
+	if from == "" {
+		return response.ValidationError(c, map[string]string{"from": "from is required"})
+	}
+
+	diff, err := DiffEnvironments(ctx, from, c.Query("to"))
+	if errors.Is(err, ErrEnvironmentNotFound) {
+		return response.NotFound(c, "Environment")
+	}
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	return response.Success(c, diff, "Environment diff retrieved successfully")
+}
+
+func PromoteHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	userID := c.Locals("user_id").(uint)
+
+	var body promoteInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+	if body.From == "" {
+		return response.ValidationError(c, map[string]string{"from": "from is required"})
+	}
+	if body.To == "" {
+		body.To = models.MainEnvironment
+	}
+
+	applied, writes, err := Promote(ctx, body.From, body.To, body.Changes, userID)
+	if errors.Is(err, ErrEnvironmentNotFound) {
+		return response.NotFound(c, "Environment")
+	}
+	var veto *events.VetoError
+	if errors.As(err, &veto) {
+		return response.Error(c, fiber.StatusUnprocessableEntity, "OPERATION_VETOED", err.Error(), nil)
+	}
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	for _, write := range writes {
+		audit.Record(c, write.Action, write.ResourceType, write.ResourceID, write.Before, write.After)
+	}
+	audit.Record(c, "environment.promote", "environment", body.To, nil, applied)
+
+	return response.Success(c, fiber.Map{
+		"from":    body.From,
+		"to":      body.To,
+		"applied": applied,
+	}, "Changes promoted successfully")
+}
@@ -0,0 +1,306 @@
+package environment_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/environment"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func inEnvironment(slug string) map[string]string {
+	return map[string]string{environment.Header: slug}
+}
+
+func loadDiff(t *testing.T, resp interface{ Bytes() []byte }) environment.Diff {
+	var result struct {
+		Data environment.Diff `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Bytes(), &result))
+	return result.Data
+}
+
+func changeIDs(changes []environment.Change) map[string]environment.Change {
+	ids := make(map[string]environment.Change, len(changes))
+	for _, change := range changes {
+		ids[change.ID] = change
+	}
+	return ids
+}
+
+func TestEnvironments(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_env@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_env@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	article := models.ContentType{Name: "Article", Slug: "article"}
+	database.DB.Create(&article)
+	database.DB.Create(&models.ContentField{ContentTypeID: article.ID, Name: "title", Type: "text"})
+
+	ctx := context.Background()
+	first, err := content.CreateContentEntry(ctx, article.ID, admin.ID, map[string]interface{}{"title": "First"})
+	assert.NoError(t, err)
+	second, err := content.CreateContentEntry(ctx, article.ID, admin.ID, map[string]interface{}{"title": "Second"})
+	assert.NoError(t, err)
+	_, err = content.CreateContentRelation(ctx, first.ID, second.ID, "related")
+	assert.NoError(t, err)
+
+	var dev models.Environment
+	var devArticle models.ContentType
+
+	t.Run("Success - Clone an environment", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", "/environments/", map[string]interface{}{
+			"name": "Development", "slug": "dev",
+		}, adminToken)
+		assert.Equal(t, 201, resp.Code)
+		var result struct {
+			Data models.Environment `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		dev = result.Data
+		assert.Equal(t, models.MainEnvironment, dev.Source)
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/environments/", map[string]interface{}{
+			"name": "Again", "slug": "dev",
+		}, adminToken)
+		assert.Equal(t, 409, resp.Code)
+
+		for _, slug := range []string{"main", "Not Valid"} {
+			resp, _ = testutils.MakeRequest(app, "POST", "/environments/", map[string]interface{}{
+				"name": "Again", "slug": slug,
+			}, adminToken)
+			assert.Equal(t, 400, resp.Code, slug)
+		}
+
+		var types struct {
+			Data []models.ContentType `json:"data"`
+		}
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/content/types", nil, adminToken, inEnvironment("dev"))
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &types)
+		if assert.Len(t, types.Data, 1) {
+			devArticle = types.Data[0]
+			assert.NotEqual(t, article.ID, devArticle.ID)
+			assert.Equal(t, dev.ID, devArticle.EnvironmentID)
+		}
+
+		var entries []models.ContentEntry
+		database.DB.Where("environment_id = ?", dev.ID).Order("id ASC").Find(&entries)
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, first.ID, entries[0].OriginID)
+			assert.Equal(t, devArticle.ID, entries[0].ContentTypeID)
+		}
+
+		var relations []models.ContentRelation
+		database.DB.Where("environment_id = ?", dev.ID).Find(&relations)
+		if assert.Len(t, relations, 1) {
+			assert.Equal(t, entries[0].ID, relations[0].FromContentID)
+			assert.Equal(t, entries[1].ID, relations[0].ToContentID)
+		}
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", fmt.Sprintf("/content/entries/%d", first.ID), nil, adminToken, inEnvironment("dev"))
+		assert.Equal(t, 404, resp.Code, "main's entries are not visible from dev")
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/environments/diff?from=dev", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+		diff := loadDiff(t, resp.Body)
+		assert.Empty(t, diff.Schema)
+		assert.Empty(t, diff.Content)
+	})
+
+	t.Run("Error - Unknown environment", func(t *testing.T) {
+		resp, _ := testutils.MakeRequestWithHeaders(app, "GET", "/content/types", nil, adminToken, inEnvironment("qa"))
+		assert.Equal(t, 404, resp.Code)
+	})
+
+	var pageEntry *models.ContentEntry
+	t.Run("Success - Diff lists schema and content changes", func(t *testing.T) {
+		resp, _ := testutils.MakeRequestWithHeaders(app, "POST", fmt.Sprintf("/content/types/%d/fields", devArticle.ID),
+			map[string]interface{}{"name": "summary", "type": "text"}, adminToken, inEnvironment("dev"))
+		assert.Equal(t, 201, resp.Code)
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "POST", "/content/types",
+			map[string]interface{}{"name": "Page", "slug": "page"}, adminToken, inEnvironment("dev"))
+		assert.Equal(t, 201, resp.Code)
+		var page struct {
+			Data models.ContentType `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &page)
+
+		devCtx := database.WithEnvironment(database.WithSpace(context.Background(), models.DefaultSpaceID), dev.ID)
+		pageEntry, err = content.CreateContentEntry(devCtx, page.Data.ID, admin.ID, map[string]interface{}{})
+		assert.NoError(t, err)
+
+		database.DB.WithContext(devCtx).Model(&models.ContentEntry{}).Where("origin_id = ?", first.ID).
+			Update("data", datatypes.JSON(`{"title":"First, rewritten"}`))
+		database.DB.WithContext(devCtx).Where("origin_id = ?", second.ID).Delete(&models.ContentEntry{})
+
+		var types struct {
+			Data []models.ContentType `json:"data"`
+		}
+		resp, _ = testutils.MakeRequest(app, "GET", "/content/types", nil, adminToken)
+		testutils.ParseResponse(t, resp, &types)
+		assert.Len(t, types.Data, 1, "main is untouched")
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/environments/diff?from=dev&to=main", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+		diff := loadDiff(t, resp.Body)
+
+		schema := changeIDs(diff.Schema)
+		assert.Len(t, schema, 2)
+		assert.Equal(t, environment.ActionAdded, schema["content_type:page"].Action)
+		assert.Equal(t, environment.ActionAdded, schema["field:article.summary"].Action)
+
+		changes := changeIDs(diff.Content)
+		assert.Len(t, changes, 3)
+		assert.Equal(t, environment.ActionChanged, changes[fmt.Sprintf("entry:%d", first.ID)].Action)
+		assert.Equal(t, []string{"data", "relations"}, changes[fmt.Sprintf("entry:%d", first.ID)].Attributes)
+		assert.Equal(t, environment.ActionRemoved, changes[fmt.Sprintf("entry:%d", second.ID)].Action)
+		assert.Equal(t, environment.ActionAdded, changes[fmt.Sprintf("entry:%d", pageEntry.ID)].Action)
+	})
+
+	t.Run("Success - Promote selected changes", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", "/environments/promote", map[string]interface{}{
+			"from": "dev", "changes": []string{fmt.Sprintf("entry:%d", pageEntry.ID)},
+		}, adminToken)
+		assert.Equal(t, 400, resp.Code, "the page type has to come along")
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/environments/promote", map[string]interface{}{
+			"from": "dev", "changes": []string{"field:article.nope"},
+		}, adminToken)
+		assert.Equal(t, 400, resp.Code)
+
+		selected := map[string]interface{}{
+			"from": "dev",
+			"to":   "main",
+			"changes": []string{
+				"content_type:page",
+				"field:article.summary",
+				fmt.Sprintf("entry:%d", pageEntry.ID),
+				fmt.Sprintf("entry:%d", first.ID),
+			},
+		}
+
+		database.DB.Model(&models.ContentEntry{}).Where("id = ?", pageEntry.ID).Update("status", models.StatusPublished)
+		resp, _ = testutils.MakeRequest(app, "POST", "/environments/promote", selected, adminToken)
+		assert.Equal(t, 400, resp.Code, "a new entry can't jump from draft to published")
+		assert.Contains(t, resp.Body.String(), "from draft to published")
+		var pages int64
+		database.DB.Model(&models.ContentType{}).Where("environment_id = 0 AND slug = ?", "page").Count(&pages)
+		assert.Equal(t, int64(0), pages, "nothing is promoted")
+
+		database.DB.Model(&models.ContentEntry{}).Where("id = ?", pageEntry.ID).Update("status", models.StatusInReview)
+		var updates []events.EntryUpdated
+		unsubscribe := events.After(func(e events.EntryUpdated) { updates = append(updates, e) })
+		defer unsubscribe()
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/environments/promote", selected, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		var fields []models.ContentField
+		database.DB.Where("content_type_id = ?", article.ID).Order("id ASC").Find(&fields)
+		if assert.Len(t, fields, 2) {
+			assert.Equal(t, "summary", fields[1].Name)
+			assert.Equal(t, uint(0), fields[1].EnvironmentID)
+		}
+
+		var updated models.ContentEntry
+		database.DB.First(&updated, first.ID)
+		assert.JSONEq(t, `{"title":"First, rewritten"}`, string(updated.Data))
+		assert.Equal(t, uint(2), updated.Version)
+		var relations int64
+		database.DB.Model(&models.ContentRelation{}).Where("from_content_id = ?", first.ID).Count(&relations)
+		assert.Equal(t, int64(0), relations, "relations follow the source")
+
+		if assert.Len(t, updates, 1) {
+			assert.Equal(t, first.ID, updates[0].Entry.ID)
+		}
+		var audited int64
+		database.DB.Model(&models.AuditLog{}).
+			Where("action = ? AND resource_id = ?", "entry.update", fmt.Sprint(first.ID)).Count(&audited)
+		assert.Equal(t, int64(1), audited)
+
+		var promoted models.ContentEntry
+		assert.NoError(t, database.DB.Where("environment_id = 0 AND origin_id = ?", pageEntry.ID).First(&promoted).Error)
+		assert.Equal(t, models.StatusInReview, promoted.Status)
+		var history models.WorkflowHistory
+		if assert.NoError(t, database.DB.Where("entry_id = ?", promoted.ID).First(&history).Error, "the status change is in the history") {
+			assert.Equal(t, models.StatusDraft, history.FromStatus)
+			assert.Equal(t, models.StatusInReview, history.ToStatus)
+			assert.Equal(t, "Promoted from dev", history.Comment)
+		}
+
+		var secondNow models.ContentEntry
+		assert.NoError(t, database.DB.First(&secondNow, second.ID).Error, "unselected removal is not applied")
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/environments/diff?from=dev", nil, adminToken)
+		diff := loadDiff(t, resp.Body)
+		assert.Empty(t, diff.Schema)
+		if assert.Len(t, diff.Content, 1) {
+			assert.Equal(t, environment.ActionRemoved, diff.Content[0].Action)
+		}
+	})
+
+	t.Run("Success - Promote everything back", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", "/environments/", map[string]interface{}{
+			"name": "Staging", "slug": "staging", "source": "dev",
+		}, adminToken)
+		assert.Equal(t, 201, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/environments/promote", map[string]interface{}{
+			"from": "main", "to": "staging",
+		}, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/environments/diff?from=main&to=staging", nil, adminToken)
+		diff := loadDiff(t, resp.Body)
+		assert.Empty(t, diff.Schema)
+		assert.Empty(t, diff.Content)
+	})
+
+	t.Run("Admin - List and delete environments", func(t *testing.T) {
+		var list struct {
+			Data []models.Environment `json:"data"`
+		}
+		resp, _ := testutils.MakeRequest(app, "GET", "/environments/", nil, adminToken)
+		testutils.ParseResponse(t, resp, &list)
+		if assert.Len(t, list.Data, 3) {
+			assert.Equal(t, models.MainEnvironment, list.Data[0].Slug)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "DELETE", "/environments/main", nil, adminToken)
+		assert.Equal(t, 409, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "DELETE", "/environments/dev", nil, adminToken)
+		assert.Equal(t, 204, resp.Code)
+
+		var count int64
+		database.DB.Model(&models.ContentType{}).Where("environment_id = ?", dev.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/environments/dev", nil, adminToken)
+		assert.Equal(t, 404, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/environments/", map[string]interface{}{
+			"name": "Development", "slug": "dev",
+		}, adminToken)
+		assert.Equal(t, 201, resp.Code, "a deleted environment's slug can be used again")
+	})
+
+	t.Run("Error - Non-admin is forbidden", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/environments/diff?from=staging", nil, editorToken)
+		assert.Equal(t, 403, resp.Code)
+	})
+}
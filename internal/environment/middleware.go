@@ -0,0 +1,27 @@
+package environment
+
+import (
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Header selects the environment a request works in, by slug. Requests
+// without it work in the main environment.
+const Header = "X-Environment"
+
+// Resolve binds the request's environment to its user context, the way
+// space.Resolve binds its space, so content queries only see that
+// environment. It must run after space.Resolve.
+func Resolve() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		env, err := GetEnvironment(c.UserContext(), c.Get(Header))
+		if err != nil {
+			return response.NotFound(c, "Environment")
+		}
+
+		c.Locals("environment_id", env.ID)
+		c.SetUserContext(database.WithEnvironment(c.UserContext(), env.ID))
+		return c.Next()
+	}
+}
@@ -0,0 +1,524 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/workflow"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Write is a content type, field or entry a promotion created, changed or
+// removed, for the caller to record in the audit log.
+type Write struct {
+	Action       string
+	ResourceType string
+	ResourceID   uint
+	Before       interface{}
+	After        interface{}
+}
+
+// promotion applies changes to the target environment inside one
+// transaction. to is kept up to date as changes apply, so later changes see
+// the types and entries earlier ones created.
+type promotion struct {
+	tx      *gorm.DB
+	envID   uint
+	envTag  string
+	fromTag string
+	from    *snapshot
+	to      *snapshot
+	userID  uint
+
+	// copying is set when filling a new environment, which copies its source
+	// as it is. A promotion instead changes content like an editor would:
+	// hooks run, statuses only make moves the workflow allows, and writes
+	// and announcements collect what to audit and publish once it commits.
+	copying       bool
+	writes        []Write
+	announcements []func()
+}
+
+func (p *promotion) record(action, resourceType string, id uint, before, after interface{}) {
+	p.writes = append(p.writes, Write{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   id,
+		Before:       before,
+		After:        after,
+	})
+}
+
+func (p *promotion) announce(fn func()) {
+	p.announcements = append(p.announcements, fn)
+}
+
+// phase orders changes so that what a change depends on already exists:
+// schema before content when adding, content before schema when removing.
+func phase(change Change) int {
+	removed := change.Action == ActionRemoved
+	switch {
+	case change.Kind == KindContentType && !removed:
+		return 0
+	case change.Kind == KindField && !removed:
+		return 1
+	case change.Kind == KindEntry && !removed:
+		return 2
+	case change.Kind == KindEntry:
+		return 3
+	case change.Kind == KindField:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func (p *promotion) apply(changes []Change) error {
+	ordered := append([]Change{}, changes...)
+	sort.SliceStable(ordered, func(i, j int) bool { return phase(ordered[i]) < phase(ordered[j]) })
+
+	var promoted []uint
+	for _, change := range ordered {
+		var err error
+		switch change.Kind {
+		case KindContentType:
+			err = p.applyType(change)
+		case KindField:
+			err = p.applyField(change)
+		case KindEntry:
+			err = p.applyEntry(change)
+			if change.Action != ActionRemoved {
+				promoted = append(promoted, change.EntryKey)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Relations and parents go last, once every promoted entry exists in
+	// the target.
+	for _, key := range promoted {
+		if err := p.copyRelations(key); err != nil {
+			return err
+		}
+		if err := p.copyParent(key); err != nil {
+			return err
+		}
+	}
+	return p.refreshTypes()
+}
+
+func (p *promotion) missingType(slug string) error {
+	return fmt.Errorf("content type %s does not exist in %s; promote it as well", slug, p.envTag)
+}
+
+func (p *promotion) applyType(change Change) error {
+	slug := change.ContentType
+	source, target := p.from.types[slug], p.to.types[slug]
+
+	switch change.Action {
+	case ActionAdded:
+		ct := models.ContentType{
+			EnvironmentID: p.envID,
+			Name:          source.Name,
+			Slug:          source.Slug,
+			EnableSEO:     source.EnableSEO,
+			WorkflowID:    source.WorkflowID,
+			IsTree:        source.IsTree,
+			IsSortable:    source.IsSortable,
+		}
+		if err := p.tx.Create(&ct).Error; err != nil {
+			return err
+		}
+		for _, field := range source.Fields {
+			created, err := p.createField(ct.ID, field)
+			if err != nil {
+				return err
+			}
+			ct.Fields = append(ct.Fields, *created)
+		}
+		p.to.addType(&ct)
+		p.record("content_type.create", "content_type", ct.ID, nil, ct)
+		return nil
+
+	case ActionChanged:
+		before := *target
+		if err := p.tx.Model(target).Updates(map[string]interface{}{
+			"name":        source.Name,
+			"enable_seo":  source.EnableSEO,
+			"workflow_id": source.WorkflowID,
+			"is_tree":     source.IsTree,
+			"is_sortable": source.IsSortable,
+		}).Error; err != nil {
+			return err
+		}
+		target.Name = source.Name
+		target.EnableSEO = source.EnableSEO
+		target.WorkflowID = source.WorkflowID
+		target.IsTree = source.IsTree
+		target.IsSortable = source.IsSortable
+		p.record("content_type.update", "content_type", target.ID, before, *target)
+		return nil
+
+	default:
+		var remaining int64
+		p.tx.Model(&models.ContentEntry{}).Where("content_type_id = ?", target.ID).Count(&remaining)
+		if remaining > 0 {
+			return fmt.Errorf("content type %s still has %d entries in %s; remove them as well", slug, remaining, p.envTag)
+		}
+		if err := p.tx.Where("content_type_id = ?", target.ID).Delete(&models.ContentField{}).Error; err != nil {
+			return err
+		}
+		if err := p.tx.Delete(target).Error; err != nil {
+			return err
+		}
+		delete(p.to.types, slug)
+		p.record("content_type.delete", "content_type", target.ID, *target, nil)
+		return nil
+	}
+}
+
+func (p *promotion) createField(contentTypeID uint, source models.ContentField) (*models.ContentField, error) {
+	field := source
+	field.ID = 0
+	field.SpaceID = 0
+	field.EnvironmentID = p.envID
+	field.ContentTypeID = contentTypeID
+	field.CreatedAt = time.Time{}
+	field.UpdatedAt = time.Time{}
+
+	if err := p.tx.Create(&field).Error; err != nil {
+		return nil, err
+	}
+	return &field, nil
+}
+
+func (p *promotion) applyField(change Change) error {
+	ct, ok := p.to.types[change.ContentType]
+	if !ok {
+		return p.missingType(change.ContentType)
+	}
+	source := p.from.field(change.ContentType, change.Field)
+	target := p.to.field(change.ContentType, change.Field)
+
+	switch change.Action {
+	case ActionAdded:
+		created, err := p.createField(ct.ID, *source)
+		if err != nil {
+			return err
+		}
+		ct.Fields = append(ct.Fields, *created)
+		p.record("field.create", "field", created.ID, nil, *created)
+		return nil
+
+	case ActionChanged:
+		updated := *source
+		updated.ID = target.ID
+		updated.SpaceID = target.SpaceID
+		updated.EnvironmentID = target.EnvironmentID
+		updated.ContentTypeID = target.ContentTypeID
+		updated.CreatedAt = target.CreatedAt
+		if err := p.tx.Save(&updated).Error; err != nil {
+			return err
+		}
+		p.record("field.update", "field", target.ID, *target, updated)
+		*target = updated
+		return nil
+
+	default:
+		if err := p.tx.Delete(target).Error; err != nil {
+			return err
+		}
+		p.record("field.delete", "field", target.ID, *target, nil)
+		return nil
+	}
+}
+
+func (p *promotion) applyEntry(change Change) error {
+	key := change.EntryKey
+	source, target := p.from.entries[key], p.to.entries[key]
+
+	if change.Action == ActionRemoved {
+		return p.removeEntry(key, target)
+	}
+
+	slug := p.from.typeSlugs[source.ContentTypeID]
+	ct, ok := p.to.types[slug]
+	if !ok {
+		return p.missingType(slug)
+	}
+
+	data, err := p.entryData(source, target)
+	if err != nil {
+		return err
+	}
+
+	// The target may have ordered its entries differently, so the source's
+	// rank can already be in use there.
+	var targetID uint
+	if target != nil {
+		targetID = target.ID
+	}
+	rank, err := content.FreeRank(p.tx, ct.ID, source.Rank, targetID)
+	if err != nil {
+		return err
+	}
+
+	if change.Action == ActionAdded {
+		entry := models.ContentEntry{
+			EnvironmentID: p.envID,
+			OriginID:      key,
+			ContentTypeID: ct.ID,
+			Position:      source.Position,
+			Rank:          rank,
+			Data:          data,
+			Status:        models.StatusDraft,
+			Version:       1,
+			CreatedBy:     source.CreatedBy,
+			UpdatedBy:     p.userID,
+		}
+		if p.copying {
+			entry.Status = source.Status
+			entry.PublishedAt = source.PublishedAt
+		}
+		if err := p.tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		p.to.entries[key] = &entry
+		if p.copying {
+			return nil
+		}
+
+		created := entry
+		p.announce(func() { events.Publish(events.EntryCreated{Entry: created, UserID: p.userID}) })
+		p.record("entry.create", "entry", entry.ID, nil, created)
+		return p.moveEntry(&entry, source.Status)
+	}
+
+	previous := *target
+	if err := p.tx.Model(target).Updates(map[string]interface{}{
+		"content_type_id": ct.ID,
+		"position":        source.Position,
+		"rank":            rank,
+		"data":            data,
+		"updated_by":      p.userID,
+		"version":         gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	if err := p.tx.First(target, target.ID).Error; err != nil {
+		return err
+	}
+
+	updated := *target
+	p.announce(func() {
+		events.Publish(events.EntryUpdated{Entry: updated, Previous: previous, UserID: p.userID})
+	})
+	p.record("entry.update", "entry", target.ID, previous, updated)
+	return p.moveEntry(target, source.Status)
+}
+
+// entryData runs the create or update hooks on the source entry's data, so a
+// hook can change or veto a promotion as it would an editor's change.
+func (p *promotion) entryData(source, target *models.ContentEntry) (datatypes.JSON, error) {
+	if p.copying {
+		return source.Data, nil
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(source.Data, &data); err != nil {
+		return nil, err
+	}
+
+	if target == nil {
+		before := events.BeforeEntryCreate{ContentTypeID: source.ContentTypeID, UserID: p.userID, Data: data}
+		if err := events.RunBefore(&before); err != nil {
+			return nil, err
+		}
+		data = before.Data
+	} else {
+		before := events.BeforeEntryUpdate{Entry: target, UserID: p.userID, Changes: data}
+		if err := events.RunBefore(&before); err != nil {
+			return nil, err
+		}
+		data = before.Changes
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(raw), nil
+}
+
+// checkStatuses makes sure every promoted entry can move from its status in
+// the target, or draft for an entry the target doesn't have yet, straight to
+// its status in the source, as an editor would have to with CheckTransition.
+// The moves happen inside the promotion's transaction, so they are checked
+// up front: with the source entry's data, under the workflow its content type
+// will have in the target once the changes apply.
+func checkStatuses(ctx context.Context, from, to *loadedEnvironment, changes []Change, userID uint) error {
+	promotedTypes := make(map[string]bool)
+	for _, change := range changes {
+		if change.Kind == KindContentType && change.Action != ActionRemoved {
+			promotedTypes[change.ContentType] = true
+		}
+	}
+
+	var problems []string
+	for _, change := range changes {
+		if change.Kind != KindEntry || change.Action == ActionRemoved {
+			continue
+		}
+		source, target := from.snapshot.entries[change.EntryKey], to.snapshot.entries[change.EntryKey]
+
+		candidate := *source
+		candidate.Status = models.StatusDraft
+		if target != nil {
+			candidate.Status = target.Status
+		}
+		if candidate.Status == source.Status {
+			continue
+		}
+
+		// A content type keeps its workflow unless the promotion changes
+		// the type as well, in which case it takes the source's.
+		checkCtx := database.WithEnvironment(ctx, from.env.ID)
+		slug := from.snapshot.typeSlugs[source.ContentTypeID]
+		if ct, ok := to.snapshot.types[slug]; ok && !promotedTypes[slug] {
+			checkCtx = database.WithEnvironment(ctx, to.env.ID)
+			candidate.ContentTypeID = ct.ID
+			candidate.ID = 0
+			if target != nil {
+				candidate.ID = target.ID
+			}
+		}
+
+		messages, err := workflow.CheckTransition(checkCtx, &candidate, userID, source.Status)
+		if err != nil {
+			return err
+		}
+		for _, message := range messages {
+			problems = append(problems, fmt.Sprintf("%s: %s", change.ID, message))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("status changes the target's workflow does not allow: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// moveEntry brings entry to status, a move checkStatuses allowed. It runs the
+// status change hooks and records the transition in the entry's history.
+func (p *promotion) moveEntry(entry *models.ContentEntry, status models.WorkflowStatus) error {
+	if entry.Status == status {
+		return nil
+	}
+
+	from := entry.Status
+	comment := "Promoted from " + p.fromTag
+	if err := workflow.TransitionTx(p.tx, entry, p.userID, status, comment); err != nil {
+		return err
+	}
+	if err := p.tx.First(entry, entry.ID).Error; err != nil {
+		return err
+	}
+
+	moved := *entry
+	p.announce(func() { workflow.StatusChanged(&moved, from, p.userID, comment) })
+	return nil
+}
+
+func (p *promotion) removeEntry(key uint, target *models.ContentEntry) error {
+	if !p.copying {
+		if err := events.RunBefore(&events.BeforeEntryDelete{Entry: target, UserID: p.userID}); err != nil {
+			return err
+		}
+	}
+
+	if err := p.tx.Where("from_content_id = ? OR to_content_id = ?", target.ID, target.ID).
+		Delete(&models.ContentRelation{}).Error; err != nil {
+		return err
+	}
+	if err := p.tx.Delete(target).Error; err != nil {
+		return err
+	}
+	delete(p.to.entries, key)
+
+	removed := *target
+	p.announce(func() { events.Publish(events.EntryDeleted{Entry: removed, UserID: p.userID}) })
+	p.record("entry.delete", "entry", target.ID, removed, nil)
+	return nil
+}
+
+// copyRelations makes the target entry's relations match the source's.
+// Relations to entries the target doesn't have are left out.
+func (p *promotion) copyRelations(key uint) error {
+	entry := p.to.entries[key]
+	if err := p.tx.Where("from_content_id = ?", entry.ID).Delete(&models.ContentRelation{}).Error; err != nil {
+		return err
+	}
+
+	for _, ref := range p.from.relations[key] {
+		to, ok := p.to.entries[ref.To]
+		if !ok {
+			continue
+		}
+		relation := models.ContentRelation{
+			EnvironmentID: p.envID,
+			FromContentID: entry.ID,
+			ToContentID:   to.ID,
+			RelationType:  ref.Type,
+		}
+		if err := p.tx.Create(&relation).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyParent points the target entry at the target's copy of the source
+// entry's parent. Without one, the entry becomes a root.
+func (p *promotion) copyParent(key uint) error {
+	source, entry := p.from.entries[key], p.to.entries[key]
+
+	var parentID *uint
+	if source.ParentID != nil {
+		if parent, ok := p.to.entries[p.from.keys[*source.ParentID]]; ok {
+			parentID = &parent.ID
+		}
+	}
+	entry.ParentID = parentID
+	return p.tx.Model(entry).Update("parent_id", parentID).Error
+}
+
+// refreshTypes recomputes the paths of the target's tree content types,
+// since promoted slugs and parents change them, and ranks entries of
+// sortable types that have none yet. Promoted entries start without a path,
+// so they cannot clash with a path another change is about to free.
+func (p *promotion) refreshTypes() error {
+	for _, slug := range sortedKeys(p.to.types, nil) {
+		ct := p.to.types[slug]
+		if ct.IsTree {
+			if err := content.RebuildTreePaths(p.tx, ct.ID); err != nil {
+				return err
+			}
+		}
+		if ct.IsSortable {
+			if err := content.AssignRanks(p.tx, ct.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
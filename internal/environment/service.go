@@ -0,0 +1,246 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+var (
+	ErrEnvironmentNotFound = errors.New("environment not found")
+	ErrMainEnvironment     = errors.New("the main environment cannot be deleted")
+	ErrEnvironmentExists   = errors.New("environment already exists")
+)
+
+type EnvironmentInput struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	// Source is the slug of the environment to copy, main when empty.
+	Source string `json:"source"`
+}
+
+func mainEnvironment(ctx context.Context) models.Environment {
+	spaceID, ok := database.SpaceFromContext(ctx)
+	if !ok {
+		spaceID = models.DefaultSpaceID
+	}
+	return models.Environment{SpaceID: spaceID, Name: "Main", Slug: models.MainEnvironment}
+}
+
+// GetEnvironment looks an environment of the current space up by slug. The
+// main environment has no row, so it comes back with ID 0.
+func GetEnvironment(ctx context.Context, slug string) (*models.Environment, error) {
+	if slug == "" || slug == models.MainEnvironment {
+		env := mainEnvironment(ctx)
+		return &env, nil
+	}
+
+	var env models.Environment
+	if err := database.DB.WithContext(ctx).Where("slug = ?", slug).First(&env).Error; err != nil {
+		return nil, ErrEnvironmentNotFound
+	}
+	return &env, nil
+}
+
+func ListEnvironments(ctx context.Context) ([]models.Environment, error) {
+	var envs []models.Environment
+	if err := database.DB.WithContext(ctx).Order("id ASC").Find(&envs).Error; err != nil {
+		return nil, err
+	}
+	return append([]models.Environment{mainEnvironment(ctx)}, envs...), nil
+}
+
+// CreateEnvironment adds an environment holding a copy of the source
+// environment's content types, entries and relations.
+func CreateEnvironment(ctx context.Context, input EnvironmentInput, userID uint) (*models.Environment, error) {
+	if input.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if !slugPattern.MatchString(input.Slug) || input.Slug == models.MainEnvironment {
+		return nil, fmt.Errorf("slug must be lowercase letters, numbers and hyphens, and not %s", models.MainEnvironment)
+	}
+	if environmentExists(ctx, input.Slug) {
+		return nil, fmt.Errorf("%w: %s", ErrEnvironmentExists, input.Slug)
+	}
+
+	source, err := GetEnvironment(ctx, input.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := loadSnapshot(database.DB.WithContext(database.WithEnvironment(ctx, source.ID)))
+	if err != nil {
+		return nil, err
+	}
+
+	env := models.Environment{
+		Name:        input.Name,
+		Slug:        input.Slug,
+		Description: input.Description,
+		Source:      source.Slug,
+		CreatedBy:   userID,
+	}
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&env).Error; err != nil {
+			return err
+		}
+
+		// A new environment is empty, so every change applies.
+		to := emptySnapshot()
+		p := promotion{
+			tx:      tx.WithContext(database.WithEnvironment(ctx, env.ID)),
+			envID:   env.ID,
+			envTag:  env.Slug,
+			from:    from,
+			to:      to,
+			userID:  userID,
+			copying: true,
+		}
+		return p.apply(compare(from, to).changes())
+	})
+	if err != nil {
+		// Another request created the slug since the check above.
+		if environmentExists(ctx, input.Slug) {
+			return nil, fmt.Errorf("%w: %s", ErrEnvironmentExists, input.Slug)
+		}
+		return nil, err
+	}
+	return &env, nil
+}
+
+func environmentExists(ctx context.Context, slug string) bool {
+	existing, err := GetEnvironment(ctx, slug)
+	return err == nil && existing.ID != 0
+}
+
+// DeleteEnvironment removes an environment with all of its content. Rows are
+// deleted outright rather than soft deleted, so the slug can be used again.
+func DeleteEnvironment(ctx context.Context, slug string) error {
+	env, err := GetEnvironment(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if env.ID == 0 {
+		return ErrMainEnvironment
+	}
+
+	envCtx := database.WithEnvironment(ctx, env.ID)
+	return database.DB.WithContext(envCtx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.ContentRelation{},
+			&models.ContentEntry{},
+			&models.ContentField{},
+			&models.ContentType{},
+		} {
+			if err := tx.Unscoped().Where("environment_id = ?", env.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(env).Error
+	})
+}
+
+// DiffEnvironments lists what promoting from one environment to another
+// would change in the target.
+func DiffEnvironments(ctx context.Context, fromSlug, toSlug string) (*Diff, error) {
+	from, to, err := loadPair(ctx, fromSlug, toSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := compare(from.snapshot, to.snapshot)
+	diff.From = from.env.Slug
+	diff.To = to.env.Slug
+	return diff, nil
+}
+
+// Promote applies the selected changes of the diff between two environments
+// to the target, or every change when none are selected, and returns what it
+// applied along with the writes it made. Either all of them apply or none do.
+// Entry changes run the same hooks and events as an editor's, so they reach
+// webhooks, the feed and the entry's history. A status change has to be one
+// move the target's workflow allows the user, without stage approvals, and
+// pass its guards; otherwise nothing is promoted.
+func Promote(ctx context.Context, fromSlug, toSlug string, selected []string, userID uint) ([]Change, []Write, error) {
+	from, to, err := loadPair(ctx, fromSlug, toSlug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := compare(from.snapshot, to.snapshot).changes()
+	if len(selected) > 0 {
+		byID := make(map[string]Change, len(changes))
+		for _, change := range changes {
+			byID[change.ID] = change
+		}
+
+		picked := make([]Change, 0, len(selected))
+		for _, id := range selected {
+			change, ok := byID[id]
+			if !ok {
+				return nil, nil, fmt.Errorf("no change %s between %s and %s", id, from.env.Slug, to.env.Slug)
+			}
+			picked = append(picked, change)
+		}
+		changes = picked
+	}
+
+	if err := checkStatuses(ctx, from, to, changes, userID); err != nil {
+		return nil, nil, err
+	}
+
+	p := promotion{
+		envID:   to.env.ID,
+		envTag:  to.env.Slug,
+		fromTag: from.env.Slug,
+		from:    from.snapshot,
+		to:      to.snapshot,
+		userID:  userID,
+	}
+	toCtx := database.WithEnvironment(ctx, to.env.ID)
+	err = database.DB.WithContext(toCtx).Transaction(func(tx *gorm.DB) error {
+		p.tx = tx
+		return p.apply(changes)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, announce := range p.announcements {
+		announce()
+	}
+	return changes, p.writes, nil
+}
+
+type loadedEnvironment struct {
+	env      *models.Environment
+	snapshot *snapshot
+}
+
+func loadPair(ctx context.Context, fromSlug, toSlug string) (*loadedEnvironment, *loadedEnvironment, error) {
+	var pair [2]*loadedEnvironment
+	for i, slug := range []string{fromSlug, toSlug} {
+		env, err := GetEnvironment(ctx, slug)
+		if err != nil {
+			return nil, nil, err
+		}
+		snap, err := loadSnapshot(database.DB.WithContext(database.WithEnvironment(ctx, env.ID)))
+		if err != nil {
+			return nil, nil, err
+		}
+		pair[i] = &loadedEnvironment{env: env, snapshot: snap}
+	}
+
+	if pair[0].env.ID == pair[1].env.ID {
+		return nil, nil, fmt.Errorf("source and target must be different environments")
+	}
+	return pair[0], pair[1], nil
+}
@@ -0,0 +1,107 @@
+// Package events is the in-process domain event bus. Code that changes
+// content announces it here, and side effects such as webhooks subscribe
+// here instead of being wired into handlers.
+//
+// Events are plain structs. Before hooks receive a pointer to the pending
+// operation and may change it, or veto it by returning an error. After hooks
+// receive the committed result and cannot fail the operation.
+package events
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+)
+
+// VetoError is returned by RunBefore when a hook rejects the operation.
+type VetoError struct {
+	Event string
+	Err   error
+}
+
+func (e *VetoError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *VetoError) Unwrap() error {
+	return e.Err
+}
+
+type subscription struct {
+	id uint64
+	fn any
+}
+
+var (
+	mu     sync.RWMutex
+	nextID uint64
+	before = make(map[reflect.Type][]subscription)
+	after  = make(map[reflect.Type][]subscription)
+)
+
+func subscribe(registry map[reflect.Type][]subscription, t reflect.Type, fn any) func() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nextID++
+	id := nextID
+	registry[t] = append(registry[t], subscription{id: id, fn: fn})
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		subs := registry[t]
+		for i, s := range subs {
+			if s.id == id {
+				registry[t] = append(subs[:i:i], subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func hooks(registry map[reflect.Type][]subscription, t reflect.Type) []subscription {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]subscription(nil), registry[t]...)
+}
+
+// Before registers fn to run before every operation of type E, in
+// registration order. It returns a function that removes the hook.
+func Before[E any](fn func(*E) error) func() {
+	return subscribe(before, reflect.TypeFor[E](), fn)
+}
+
+// After registers fn to run after every committed operation of type E. It
+// returns a function that removes the hook.
+func After[E any](fn func(E)) func() {
+	return subscribe(after, reflect.TypeFor[E](), fn)
+}
+
+// RunBefore runs the before hooks for e, stopping at the first that vetoes.
+func RunBefore[E any](e *E) error {
+	t := reflect.TypeFor[E]()
+	for _, s := range hooks(before, t) {
+		if err := s.fn.(func(*E) error)(e); err != nil {
+			return &VetoError{Event: t.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// Publish runs the after hooks for e. A panicking hook is logged and does not
+// stop the others.
+func Publish[E any](e E) {
+	t := reflect.TypeFor[E]()
+	for _, s := range hooks(after, t) {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("⚠️  %s hook panicked: %v", t.Name(), fmt.Sprint(r))
+				}
+			}()
+			s.fn.(func(E))(e)
+		}()
+	}
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"github.com/Kyz7/cms/internal/models"
+)
+
+// BeforeEntryCreate runs before an entry is validated and stored. Hooks may
+// change Data.
+type BeforeEntryCreate struct {
+	ContentTypeID uint
+	UserID        uint
+	Data          map[string]interface{}
+}
+
+// BeforeEntryUpdate runs before Changes are merged into Entry. Hooks may
+// change Changes.
+type BeforeEntryUpdate struct {
+	Entry   *models.ContentEntry
+	UserID  uint
+	Changes map[string]interface{}
+}
+
+type BeforeEntryDelete struct {
+	Entry  *models.ContentEntry
+	UserID uint
+}
+
+// BeforeStatusChange runs before a workflow transition is written. Hooks may
+// change Comment.
+type BeforeStatusChange struct {
+	Entry   *models.ContentEntry
+	From    models.WorkflowStatus
+	To      models.WorkflowStatus
+	UserID  uint
+	Comment string
+}
+
+// BeforeMediaUpload runs before an uploaded file is stored. Hooks may change
+// the descriptive fields of Media; its URL is only set once the file is saved.
+type BeforeMediaUpload struct {
+	Media  *models.MediaFile
+	UserID uint
+}
+
+type EntryCreated struct {
+	Entry  models.ContentEntry
+	UserID uint
+}
+
+type EntryUpdated struct {
+	Entry    models.ContentEntry
+	Previous models.ContentEntry
+	UserID   uint
+}
+
+type EntryDeleted struct {
+	Entry  models.ContentEntry
+	UserID uint
+}
+
+type StatusChanged struct {
+	Entry   models.ContentEntry
+	From    models.WorkflowStatus
+	To      models.WorkflowStatus
+	UserID  uint
+	Comment string
+}
+
+type CommentAdded struct {
+	Comment   models.WorkflowComment
+	Entry     models.ContentEntry
+	Mentioned []models.User
+}
+
+// AssignmentNotified is published once for every user told about an
+// assignment event.
+type AssignmentNotified struct {
+	Event      string // assigned, reminder, overdue, escalated, declined
+	Assignment models.WorkflowAssignment
+	Recipient  models.User
+}
+
+type NotificationCreated struct {
+	Notification models.Notification
+}
+
+type MediaUploaded struct {
+	Media  models.MediaFile
+	UserID uint
+}
+
+type UserLoggedIn struct {
+	User   models.User
+	Method string // password, google
+}
@@ -0,0 +1,129 @@
+package feed
+
+import (
+	"sync"
+
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+const (
+	EventEntryCreated       = "entry.created"
+	EventEntryUpdated       = "entry.updated"
+	EventEntryDeleted       = "entry.deleted"
+	EventEntryStatusChanged = "entry.status_changed"
+	EventCommentAdded       = "comment.added"
+	EventAssignment         = "assignment"
+	EventNotification       = "notification"
+	EventMediaUploaded      = "media.uploaded"
+
+	// EventReset tells a resuming client that events were missed and it
+	// should reload what it shows.
+	EventReset = "reset"
+)
+
+func entrySummary(entry models.ContentEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              entry.ID,
+		"content_type_id": entry.ContentTypeID,
+		"status":          entry.Status,
+		"version":         entry.Version,
+		"updated_by":      entry.UpdatedBy,
+		"updated_at":      entry.UpdatedAt,
+	}
+}
+
+func entryEvent(eventType string, entry models.ContentEntry, data interface{}) Event {
+	contentTypeID := entry.ContentTypeID
+	return Event{
+		Type:          eventType,
+		SpaceID:       entry.SpaceID,
+		ContentTypeID: &contentTypeID,
+		Data:          data,
+		module:        "ContentEntry",
+	}
+}
+
+// publishEntryChange publishes a change to entry, unless the entry is a copy
+// in another environment than main.
+func publishEntryChange(eventType string, entry models.ContentEntry, data interface{}) {
+	if !entry.InMainEnvironment() {
+		return
+	}
+	DefaultHub.Publish(entryEvent(eventType, entry, data))
+}
+
+var subscribeOnce sync.Once
+
+// Subscribe forwards domain events to DefaultHub. It is safe to call more
+// than once.
+func Subscribe() {
+	subscribeOnce.Do(func() {
+		events.After(func(e events.EntryCreated) {
+			publishEntryChange(EventEntryCreated, e.Entry, entrySummary(e.Entry))
+		})
+		events.After(func(e events.EntryUpdated) {
+			publishEntryChange(EventEntryUpdated, e.Entry, entrySummary(e.Entry))
+		})
+		events.After(func(e events.EntryDeleted) {
+			publishEntryChange(EventEntryDeleted, e.Entry, entrySummary(e.Entry))
+		})
+		events.After(func(e events.StatusChanged) {
+			publishEntryChange(EventEntryStatusChanged, e.Entry, map[string]interface{}{
+				"entry":       entrySummary(e.Entry),
+				"from_status": e.From,
+				"to_status":   e.To,
+				"changed_by":  e.UserID,
+			})
+		})
+		events.After(func(e events.CommentAdded) {
+			mentioned := make([]uint, 0, len(e.Mentioned))
+			for _, user := range e.Mentioned {
+				mentioned = append(mentioned, user.ID)
+			}
+			DefaultHub.Publish(entryEvent(EventCommentAdded, e.Entry, map[string]interface{}{
+				"id":         e.Comment.ID,
+				"entry_id":   e.Comment.EntryID,
+				"parent_id":  e.Comment.ParentID,
+				"user_id":    e.Comment.UserID,
+				"field_name": e.Comment.FieldName,
+				"is_private": e.Comment.IsPrivate,
+				"mentioned":  mentioned,
+			}))
+		})
+		events.After(func(e events.AssignmentNotified) {
+			DefaultHub.Publish(Event{
+				Type: EventAssignment,
+				Data: map[string]interface{}{
+					"event":         e.Event,
+					"assignment_id": e.Assignment.ID,
+					"entry_id":      e.Assignment.EntryID,
+					"status":        e.Assignment.Status,
+					"due_date":      e.Assignment.DueDate,
+				},
+				recipients: []uint{e.Recipient.ID},
+			})
+		})
+		events.After(func(e events.NotificationCreated) {
+			DefaultHub.Publish(Event{
+				Type:       EventNotification,
+				Data:       e.Notification,
+				recipients: []uint{e.Notification.UserID},
+			})
+		})
+		events.After(func(e events.MediaUploaded) {
+			DefaultHub.Publish(Event{
+				Type:    EventMediaUploaded,
+				SpaceID: e.Media.SpaceID,
+				Data: map[string]interface{}{
+					"id":          e.Media.ID,
+					"file_name":   e.Media.FileName,
+					"type":        e.Media.Type,
+					"folder":      e.Media.Folder,
+					"uploaded_by": e.Media.UploadedBy,
+				},
+				module: "Media",
+			})
+		})
+	})
+}
@@ -0,0 +1,168 @@
+package feed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	retryMillis       = 3000
+)
+
+// access is what one subscriber may see. It is reloaded with every heartbeat
+// so role changes apply to open streams.
+type access struct {
+	userID  uint
+	spaceID uint
+	admin   bool
+	perms   []models.Permission
+}
+
+// loadAccess reads the subscriber's role in the space ctx is bound to.
+func loadAccess(ctx context.Context, userID uint) (*access, error) {
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	spaceID, _ := database.SpaceFromContext(ctx)
+	a := &access{userID: userID, spaceID: spaceID}
+	if user.Role != nil {
+		a.admin = user.Role.Name == "admin"
+		a.perms = user.Role.Permissions
+	}
+	return a, nil
+}
+
+// allows reports whether the subscriber may receive event: it must be one of
+// the recipients, or hold read permission on the event's module covering its
+// content type. Events tied to a space only go to subscribers in that space.
+func (a *access) allows(event Event) bool {
+	if event.SpaceID != 0 && event.SpaceID != a.spaceID {
+		return false
+	}
+	if len(event.recipients) > 0 {
+		for _, id := range event.recipients {
+			if id == a.userID {
+				return true
+			}
+		}
+		return false
+	}
+
+	if a.admin {
+		return true
+	}
+	for _, perm := range a.perms {
+		if perm.Module != event.module || perm.Action != "read" {
+			continue
+		}
+		if event.ContentTypeID == nil || perm.AppliesToContentType(*event.ContentTypeID) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeEvent(w *bufio.Writer, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return w.Flush()
+}
+
+// StreamHandler serves the change feed as Server-Sent Events. Clients resume
+// with the Last-Event-ID header, which EventSource sends on reconnect, or the
+// last_event_id query parameter. EventSource reconnects with the same URL, so
+// a client authenticating with a ticket has to open a new stream with a fresh
+// one instead.
+func StreamHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	userID := c.Locals("user_id").(uint)
+
+	acc, err := loadAccess(ctx, userID)
+	if err != nil {
+		return response.Unauthorized(c, "User not found")
+	}
+
+	lastEventID := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	var lastID uint64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return response.BadRequest(c, "Invalid last event ID", nil)
+		}
+	}
+
+	sub, backlog, complete, err := DefaultHub.Subscribe(lastID, lastEventID != "")
+	if err != nil {
+		return response.InternalError(c, "Failed to open change feed")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer DefaultHub.Unsubscribe(sub)
+
+		fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+		if !complete {
+			fmt.Fprintf(w, "event: %s\ndata: {}\n\n", EventReset)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for _, event := range backlog {
+			if acc.allows(event) {
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			}
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.events:
+				if !ok {
+					return
+				}
+				if !acc.allows(event) {
+					continue
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				reloaded, err := loadAccess(ctx, userID)
+				if err != nil {
+					return
+				}
+				acc = reloaded
+				fmt.Fprint(w, ": ping\n\n")
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
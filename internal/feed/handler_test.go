@@ -0,0 +1,262 @@
+package feed_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/feed"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type streamEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+type stream struct {
+	resp   *http.Response
+	events chan streamEvent
+}
+
+// openStream connects to the feed and parses events in the background.
+func openStream(t *testing.T, url string, headers map[string]string) *stream {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+
+	s := &stream{resp: resp, events: make(chan streamEvent, 32)}
+	go func() {
+		defer close(s.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var current streamEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if current.Type != "" {
+					s.events <- current
+				}
+				current = streamEvent{}
+			case strings.HasPrefix(line, "id: "):
+				current.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				current.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				current.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return s
+}
+
+func (s *stream) next(t *testing.T) streamEvent {
+	select {
+	case event, ok := <-s.events:
+		if !ok {
+			t.Fatal("Stream closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	return streamEvent{}
+}
+
+func (s *stream) close() {
+	s.resp.Body.Close()
+}
+
+// issueTicket asks for a stream ticket the way a browser client would before
+// opening an EventSource.
+func issueTicket(t *testing.T, baseURL, token string) string {
+	req, _ := http.NewRequest("POST", baseURL+"/feed/tickets", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to issue ticket: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, 201, resp.StatusCode)
+
+	var body struct {
+		Data struct {
+			Ticket string `json:"ticket"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return body.Data.Ticket
+}
+
+func contentTypeOf(t *testing.T, event streamEvent) uint {
+	var payload struct {
+		ContentTypeID uint `json:"content_type_id"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(event.Data), &payload))
+	return payload.ContentTypeID
+}
+
+func TestChangeFeed(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	post := &models.ContentType{Name: "Post", Slug: "post"}
+	database.DB.Create(post)
+	database.DB.Create(&models.ContentField{ContentTypeID: post.ID, Name: "title", Type: "string"})
+
+	page := &models.ContentType{Name: "Page", Slug: "page"}
+	database.DB.Create(page)
+	database.DB.Create(&models.ContentField{ContentTypeID: page.ID, Name: "title", Type: "string"})
+
+	scopedIDs, _ := json.Marshal([]uint{post.ID})
+	database.DB.Create(&models.Role{
+		Name: "post_reader",
+		Permissions: []models.Permission{
+			{Module: "ContentEntry", Action: "read", ContentTypeIDs: scopedIDs},
+		},
+	})
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_feed@test.com", "password", "editor")
+	reader := testutils.CreateTestUser(t, database.DB, "reader_feed@test.com", "password", "post_reader")
+	readerToken := testutils.GetAuthToken(t, reader.ID, reader.Role.Name)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+	defer app.ShutdownWithTimeout(time.Second)
+
+	baseURL := fmt.Sprintf("http://%s", ln.Addr())
+	streamURL := baseURL + "/feed/stream"
+	auth := map[string]string{"Authorization": "Bearer " + readerToken}
+
+	t.Run("Error - Requires authentication", func(t *testing.T) {
+		resp, err := http.Get(streamURL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	var lastSeen string
+
+	t.Run("Success - Only events in the subscriber's scope", func(t *testing.T) {
+		s := openStream(t, streamURL, auth)
+		defer s.close()
+		assert.Equal(t, "text/event-stream", s.resp.Header.Get("Content-Type"))
+
+		_, err := content.CreateContentEntry(context.Background(), page.ID, editor.ID, map[string]interface{}{"title": "Hidden"})
+		assert.NoError(t, err)
+		events.Publish(events.MediaUploaded{Media: models.MediaFile{ID: 1, FileName: "a.png"}, UserID: editor.ID})
+		events.Publish(events.EntryCreated{Entry: models.ContentEntry{ID: 999, ContentTypeID: post.ID, SpaceID: models.DefaultSpaceID, EnvironmentID: 3}, UserID: editor.ID})
+		entry, err := content.CreateContentEntry(context.Background(), post.ID, editor.ID, map[string]interface{}{"title": "Visible"})
+		assert.NoError(t, err)
+
+		event := s.next(t)
+		assert.Equal(t, feed.EventEntryCreated, event.Type)
+		assert.Equal(t, post.ID, contentTypeOf(t, event))
+		assert.Contains(t, event.Data, fmt.Sprintf(`"id":%d`, entry.ID))
+		assert.NotContains(t, event.Data, "Visible", "entry data is not pushed")
+		lastSeen = event.ID
+	})
+
+	t.Run("Success - Assignment events reach only the assignee", func(t *testing.T) {
+		s := openStream(t, streamURL+"?ticket="+issueTicket(t, baseURL, readerToken), nil)
+		defer s.close()
+
+		events.Publish(events.AssignmentNotified{Event: "assigned", Assignment: models.WorkflowAssignment{ID: 7}, Recipient: *editor})
+		events.Publish(events.AssignmentNotified{Event: "assigned", Assignment: models.WorkflowAssignment{ID: 8}, Recipient: *reader})
+
+		event := s.next(t)
+		assert.Equal(t, feed.EventAssignment, event.Type)
+		assert.Contains(t, event.Data, `"assignment_id":8`)
+	})
+
+	t.Run("Success - Resume from last event ID", func(t *testing.T) {
+		_, err := content.CreateContentEntry(context.Background(), post.ID, editor.ID, map[string]interface{}{"title": "Missed"})
+		assert.NoError(t, err)
+
+		s := openStream(t, streamURL, map[string]string{
+			"Authorization": "Bearer " + readerToken,
+			"Last-Event-ID": lastSeen,
+		})
+		defer s.close()
+
+		event := s.next(t)
+		assert.Equal(t, feed.EventAssignment, event.Type, "stored events after the last ID are replayed")
+		event = s.next(t)
+		assert.Equal(t, feed.EventNotification, event.Type, "the assignment also landed in the inbox")
+		event = s.next(t)
+		assert.Equal(t, feed.EventEntryCreated, event.Type)
+		assert.Equal(t, post.ID, contentTypeOf(t, event))
+	})
+
+	t.Run("Error - Tickets are single use", func(t *testing.T) {
+		ticket := issueTicket(t, baseURL, readerToken)
+		s := openStream(t, streamURL+"?ticket="+ticket, nil)
+		s.close()
+
+		resp, err := http.Get(streamURL + "?ticket=" + ticket)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("Error - Access tokens are not accepted in the URL", func(t *testing.T) {
+		resp, err := http.Get(streamURL + "?access_token=" + readerToken)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("Success - Events stored by another instance are delivered", func(t *testing.T) {
+		s := openStream(t, streamURL, auth)
+		defer s.close()
+
+		contentTypeID := post.ID
+		row := models.FeedEvent{
+			Type:          feed.EventEntryUpdated,
+			ContentTypeID: &contentTypeID,
+			Module:        "ContentEntry",
+			Data:          []byte(`{"id":99}`),
+			CreatedAt:     time.Now(),
+		}
+		assert.NoError(t, database.DB.Create(&row).Error)
+		assert.NoError(t, feed.DefaultHub.Poll())
+
+		event := s.next(t)
+		assert.Equal(t, feed.EventEntryUpdated, event.Type)
+		assert.Equal(t, fmt.Sprint(row.ID), event.ID)
+		assert.Contains(t, event.Data, `"id":99`)
+	})
+
+	t.Run("Success - Reset when events are no longer stored", func(t *testing.T) {
+		_, err := feed.Prune(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+
+		s := openStream(t, streamURL, map[string]string{
+			"Authorization": "Bearer " + readerToken,
+			"Last-Event-ID": lastSeen,
+		})
+		defer s.close()
+
+		event := s.next(t)
+		assert.Equal(t, feed.EventReset, event.Type)
+	})
+}
@@ -0,0 +1,317 @@
+// Package feed streams entry, workflow and media changes to connected
+// clients as they happen, so editors do not have to poll.
+//
+// Events are stored in the feed_events table. Each instance polls the table
+// and hands new rows to the clients connected to it, so a client sees events
+// published by every instance and can resume on any of them from the events
+// still stored.
+package feed
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+)
+
+// Event is one change pushed to subscribers. Data carries identifiers and
+// status only; clients fetch the resource itself through the API, which
+// applies field level permissions.
+type Event struct {
+	ID            uint64      `json:"id"`
+	Type          string      `json:"type"`
+	SpaceID       uint        `json:"space_id,omitempty"`
+	ContentTypeID *uint       `json:"content_type_id,omitempty"`
+	Data          interface{} `json:"data"`
+	CreatedAt     time.Time   `json:"created_at"`
+
+	// module is the permission module a reader needs, e.g. ContentEntry.
+	module string
+	// recipients, when set, limits the event to these users.
+	recipients []uint
+}
+
+const (
+	// MaxBacklog is the most events replayed to a resuming client; one that
+	// missed more is told to reload instead.
+	MaxBacklog       = 1000
+	subscriberBuffer = 64
+
+	// gapTimeout is how long a poll keeps looking for an ID it skipped. IDs
+	// are handed out when a row is inserted but become visible when its
+	// transaction commits, so a lower ID can show up after a higher one.
+	gapTimeout = 10 * time.Second
+)
+
+type subscriber struct {
+	events chan Event
+}
+
+type Hub struct {
+	mu sync.Mutex
+	// db is the connection lastID was read from.
+	db          *gorm.DB
+	lastID      uint64
+	gaps        map[uint64]time.Time
+	subscribers map[*subscriber]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		gaps:        make(map[uint64]time.Time),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+var DefaultHub = NewHub()
+
+// sync starts the hub at the newest stored event the first time it is used
+// against a database, so it only delivers events published from then on.
+func (h *Hub) sync() error {
+	if h.db == database.DB {
+		return nil
+	}
+
+	var lastID uint64
+	if err := database.DB.Model(&models.FeedEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+		return err
+	}
+	h.db = database.DB
+	h.lastID = lastID
+	h.gaps = make(map[uint64]time.Time)
+	return nil
+}
+
+func eventRow(event Event) (models.FeedEvent, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return models.FeedEvent{}, err
+	}
+	row := models.FeedEvent{
+		Type:          event.Type,
+		SpaceID:       event.SpaceID,
+		ContentTypeID: event.ContentTypeID,
+		Module:        event.module,
+		Data:          data,
+		CreatedAt:     event.CreatedAt,
+	}
+	if len(event.recipients) > 0 {
+		if row.Recipients, err = json.Marshal(event.recipients); err != nil {
+			return models.FeedEvent{}, err
+		}
+	}
+	return row, nil
+}
+
+func rowEvent(row models.FeedEvent) Event {
+	event := Event{
+		ID:            row.ID,
+		Type:          row.Type,
+		SpaceID:       row.SpaceID,
+		ContentTypeID: row.ContentTypeID,
+		Data:          json.RawMessage(row.Data),
+		CreatedAt:     row.CreatedAt,
+		module:        row.Module,
+	}
+	if len(row.Recipients) > 0 {
+		json.Unmarshal(row.Recipients, &event.recipients)
+	}
+	return event
+}
+
+// Publish stores the event, which assigns its ID, and delivers it to this
+// instance's subscribers straight away. Other instances pick it up on their
+// next poll.
+func (h *Hub) Publish(event Event) Event {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.sync(); err != nil {
+		log.Printf("⚠️  Failed to read feed position: %v", err)
+		return event
+	}
+
+	row, err := eventRow(event)
+	if err == nil {
+		err = database.DB.Create(&row).Error
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to store %s feed event: %v", event.Type, err)
+		return event
+	}
+	event.ID = row.ID
+
+	if err := h.poll(); err != nil {
+		log.Printf("⚠️  Feed poll failed: %v", err)
+	}
+	return event
+}
+
+// Poll delivers stored events this instance has not seen yet.
+func (h *Hub) Poll() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.sync(); err != nil {
+		return err
+	}
+	return h.poll()
+}
+
+func (h *Hub) poll() error {
+	now := time.Now()
+	missing := make([]uint64, 0, len(h.gaps))
+	for id, deadline := range h.gaps {
+		if now.After(deadline) {
+			delete(h.gaps, id)
+			continue
+		}
+		missing = append(missing, id)
+	}
+
+	query := database.DB.Where("id > ?", h.lastID)
+	if len(missing) > 0 {
+		query = query.Or("id IN ?", missing)
+	}
+	var rows []models.FeedEvent
+	if err := query.Order("id ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if _, ok := h.gaps[row.ID]; ok {
+			delete(h.gaps, row.ID)
+		} else if row.ID > h.lastID {
+			if row.ID-h.lastID <= MaxBacklog {
+				for id := h.lastID + 1; id < row.ID; id++ {
+					h.gaps[id] = now.Add(gapTimeout)
+				}
+			}
+			h.lastID = row.ID
+		}
+		h.deliver(rowEvent(row))
+	}
+	return nil
+}
+
+// deliver hands event to every subscriber. A subscriber whose buffer is full
+// is disconnected rather than allowed to slow down publishers; it can
+// reconnect and resume from its last event ID.
+func (h *Hub) deliver(event Event) {
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe registers a subscriber. When resume is set it also returns the
+// stored events after lastID. complete is false when events after lastID are
+// no longer stored, or are too many to replay, in which case the backlog is
+// empty and the client has to reload its state.
+func (h *Hub) Subscribe(lastID uint64, resume bool) (sub *subscriber, backlog []Event, complete bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.sync(); err != nil {
+		return nil, nil, false, err
+	}
+	if resume {
+		// Catch up first: the client may have seen newer events from
+		// another instance.
+		if err := h.poll(); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	sub = &subscriber{events: make(chan Event, subscriberBuffer)}
+	h.subscribers[sub] = struct{}{}
+
+	if !resume {
+		return sub, nil, true, nil
+	}
+	if lastID > h.lastID {
+		return sub, nil, false, nil
+	}
+
+	var oldest uint64
+	if err := database.DB.Model(&models.FeedEvent{}).Select("COALESCE(MIN(id), 0)").Scan(&oldest).Error; err != nil {
+		h.unsubscribe(sub)
+		return nil, nil, false, err
+	}
+	if oldest == 0 {
+		oldest = h.lastID + 1
+	}
+	if lastID+1 < oldest {
+		return sub, nil, false, nil
+	}
+
+	query := database.DB.Where("id > ? AND id <= ?", lastID, h.lastID)
+	if len(h.gaps) > 0 {
+		// Still missing here; they are delivered live once they show up.
+		pending := make([]uint64, 0, len(h.gaps))
+		for id := range h.gaps {
+			pending = append(pending, id)
+		}
+		query = query.Where("id NOT IN ?", pending)
+	}
+	var rows []models.FeedEvent
+	if err := query.Order("id ASC").Limit(MaxBacklog + 1).Find(&rows).Error; err != nil {
+		h.unsubscribe(sub)
+		return nil, nil, false, err
+	}
+	if len(rows) > MaxBacklog {
+		return sub, nil, false, nil
+	}
+
+	for _, row := range rows {
+		backlog = append(backlog, rowEvent(row))
+	}
+	return sub, backlog, true, nil
+}
+
+func (h *Hub) Unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unsubscribe(sub)
+}
+
+func (h *Hub) unsubscribe(sub *subscriber) {
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Prune deletes events stored before the given time. Clients resuming from
+// an earlier event are told to reload.
+func Prune(before time.Time) (int64, error) {
+	result := database.DB.Where("created_at < ?", before).Delete(&models.FeedEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// StartPoller polls DefaultHub in the background for events published by
+// other instances.
+func StartPoller(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := DefaultHub.Poll(); err != nil {
+				log.Printf("⚠️  Feed poll failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package feed
+
+import (
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/Kyz7/cms/internal/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TicketTTL is how long a stream ticket can be redeemed for. The client asks
+// for one right before opening the stream.
+const TicketTTL = 30 * time.Second
+
+// IssueTicketHandler hands the caller a single-use ticket for opening the
+// stream as ?ticket=, bound to the space the request was made in.
+func IssueTicketHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	spaceID, _ := database.SpaceFromContext(c.UserContext())
+
+	raw := utils.RandomString(48)
+	ticket := models.StreamTicket{
+		UserID:    userID,
+		SpaceID:   spaceID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(TicketTTL),
+	}
+	if err := database.DB.Create(&ticket).Error; err != nil {
+		return response.InternalError(c, "Failed to issue stream ticket")
+	}
+
+	return response.Created(c, fiber.Map{
+		"ticket":     raw,
+		"expires_at": ticket.ExpiresAt,
+	}, "Stream ticket issued")
+}
+
+// redeemTicket consumes a ticket, so it cannot be replayed from a log or the
+// browser history.
+func redeemTicket(raw string) (*models.StreamTicket, bool) {
+	var ticket models.StreamTicket
+	if err := database.DB.Where("token_hash = ? AND expires_at > ?", utils.HashToken(raw), time.Now()).First(&ticket).Error; err != nil {
+		return nil, false
+	}
+	result := database.DB.Where("id = ?", ticket.ID).Delete(&models.StreamTicket{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		return nil, false
+	}
+	return &ticket, true
+}
+
+// TicketProtected authenticates the stream with a ?ticket= from
+// IssueTicketHandler, for clients that cannot set headers such as the
+// browser's EventSource. Requests without one go through next, which checks
+// the Authorization header.
+func TicketProtected(next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		raw := c.Query("ticket")
+		if raw == "" {
+			return next(c)
+		}
+
+		ticket, ok := redeemTicket(raw)
+		if !ok {
+			return response.Unauthorized(c, "Invalid or expired stream ticket")
+		}
+
+		c.Locals("user_id", ticket.UserID)
+		c.Locals("space_id", ticket.SpaceID)
+		c.SetUserContext(database.WithSpace(c.UserContext(), ticket.SpaceID))
+		return c.Next()
+	}
+}
+
+// PruneTickets deletes tickets that expired before now.
+func PruneTickets(now time.Time) (int64, error) {
+	result := database.DB.Where("expires_at <= ?", now).Delete(&models.StreamTicket{})
+	return result.RowsAffected, result.Error
+}
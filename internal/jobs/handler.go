@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"errors"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func ListJobsHandler(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	filter := Filter{
+		Queue:  c.Query("queue"),
+		Status: c.Query("status"),
+		Type:   c.Query("type"),
+	}
+
+	jobs, total, err := ListJobs(filter, page, limit)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch jobs")
+	}
+
+	meta := response.CalculateMeta(page, limit, total)
+	return response.SuccessWithMeta(c, jobs, meta, "Jobs retrieved successfully")
+}
+
+func StatsHandler(c *fiber.Ctx) error {
+	stats, err := Stats()
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch job stats")
+	}
+	return response.Success(c, stats, "Job stats retrieved successfully")
+}
+
+func GetJobHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid job ID", nil)
+	}
+
+	var job models.Job
+	if err := database.DB.First(&job, id).Error; err != nil {
+		return response.NotFound(c, "Job")
+	}
+	return response.Success(c, job, "Job retrieved successfully")
+}
+
+func RetryJobHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid job ID", nil)
+	}
+
+	job, err := Retry(uint(id))
+	if errors.Is(err, ErrJobNotFound) {
+		return response.NotFound(c, "Job")
+	}
+	if errors.Is(err, ErrJobNotFailed) {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to retry job")
+	}
+	return response.Success(c, job, "Job queued for retry")
+}
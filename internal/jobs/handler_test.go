@@ -0,0 +1,263 @@
+package jobs_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type resizePayload struct {
+	MediaID uint   `json:"media_id"`
+	Size    string `json:"size"`
+}
+
+func reload(t *testing.T, id uint) models.Job {
+	var job models.Job
+	assert.NoError(t, database.DB.First(&job, id).Error)
+	return job
+}
+
+func TestJobQueue(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_jobs@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_jobs@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	cfg := jobs.Config{
+		Lease: time.Minute,
+		Retry: jobs.RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second},
+	}
+
+	t.Run("Success - Handler receives the typed payload", func(t *testing.T) {
+		var got resizePayload
+		jobs.Register("media.resize", func(p resizePayload) error {
+			got = p
+			return nil
+		})
+
+		job, err := jobs.Enqueue("media.resize", resizePayload{MediaID: 7, Size: "thumb"}, jobs.Options{Queue: "media"})
+		assert.NoError(t, err)
+
+		ran, err := jobs.RunNext("media", time.Now(), cfg)
+		assert.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, resizePayload{MediaID: 7, Size: "thumb"}, got)
+
+		job2 := reload(t, job.ID)
+		assert.Equal(t, models.JobSucceeded, job2.Status)
+		assert.Equal(t, 1, job2.Attempts)
+		assert.NotNil(t, job2.CompletedAt)
+
+		ran, _ = jobs.RunNext("media", time.Now(), cfg)
+		assert.False(t, ran, "nothing left to run")
+	})
+
+	t.Run("Success - Failures are retried with backoff then dead-lettered", func(t *testing.T) {
+		calls := 0
+		jobs.Register("flaky", func(struct{}) error {
+			calls++
+			return errors.New("upstream unavailable")
+		})
+
+		job, err := jobs.Enqueue("flaky", struct{}{}, jobs.Options{Queue: "flaky", MaxAttempts: 3})
+		assert.NoError(t, err)
+
+		// The backoff counts from when the attempt ended.
+		retriedAfter := func(now time.Time, delay time.Duration) time.Time {
+			started := time.Now()
+			jobs.RunNext("flaky", now, cfg)
+			ended := time.Now()
+			runAt := reload(t, job.ID).RunAt
+			assert.False(t, runAt.Before(started.Add(delay)))
+			assert.False(t, runAt.After(ended.Add(delay)))
+			return runAt
+		}
+
+		now := time.Now()
+		runAt := retriedAfter(now, time.Second)
+		failed := reload(t, job.ID)
+		assert.Equal(t, models.JobPending, failed.Status)
+		assert.Equal(t, "upstream unavailable", failed.LastError)
+
+		ran, _ := jobs.RunNext("flaky", now, cfg)
+		assert.False(t, ran, "not due until the backoff has passed")
+
+		runAt = retriedAfter(runAt, 2*time.Second)
+
+		now = runAt
+		jobs.RunNext("flaky", now, cfg)
+		dead := reload(t, job.ID)
+		assert.Equal(t, models.JobDead, dead.Status)
+		assert.Equal(t, 3, dead.Attempts)
+		assert.Equal(t, 3, calls)
+
+		ran, _ = jobs.RunNext("flaky", now.Add(time.Hour), cfg)
+		assert.False(t, ran, "dead jobs are not run again")
+	})
+
+	t.Run("Success - Panics and unknown types fail the attempt", func(t *testing.T) {
+		jobs.Register("explodes", func(struct{}) error {
+			panic("boom")
+		})
+
+		panicking, _ := jobs.Enqueue("explodes", struct{}{}, jobs.Options{Queue: "panics", MaxAttempts: 1})
+		unknown, _ := jobs.Enqueue("never.registered", struct{}{}, jobs.Options{Queue: "panics", MaxAttempts: 1})
+
+		jobs.RunNext("panics", time.Now(), cfg)
+		jobs.RunNext("panics", time.Now(), cfg)
+
+		assert.Equal(t, models.JobDead, reload(t, panicking.ID).Status)
+		assert.Contains(t, reload(t, panicking.ID).LastError, "boom")
+		assert.Equal(t, models.JobDead, reload(t, unknown.ID).Status)
+		assert.Contains(t, reload(t, unknown.ID).LastError, "no handler")
+	})
+
+	t.Run("Success - Unique key keeps one job until it finishes", func(t *testing.T) {
+		jobs.Register("report", func(struct{}) error { return nil })
+
+		first, err := jobs.Enqueue("report", struct{}{}, jobs.Options{Queue: "reports", UniqueKey: "report:daily"})
+		assert.NoError(t, err)
+		second, err := jobs.Enqueue("report", struct{}{}, jobs.Options{Queue: "reports", UniqueKey: "report:daily"})
+		assert.NoError(t, err)
+		assert.Equal(t, first.ID, second.ID)
+
+		jobs.RunNext("reports", time.Now(), cfg)
+
+		third, err := jobs.Enqueue("report", struct{}{}, jobs.Options{Queue: "reports", UniqueKey: "report:daily"})
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.ID, third.ID, "key is released once the job is done")
+	})
+
+	t.Run("Success - Concurrent workers run each job once", func(t *testing.T) {
+		var mu sync.Mutex
+		seen := map[int]int{}
+		jobs.Register("count", func(p struct{ N int }) error {
+			mu.Lock()
+			seen[p.N]++
+			mu.Unlock()
+			return nil
+		})
+
+		for i := 0; i < 10; i++ {
+			jobs.Enqueue("count", struct{ N int }{i}, jobs.Options{Queue: "counting"})
+		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					ran, err := jobs.RunNext("counting", time.Now(), cfg)
+					if err != nil || !ran {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Len(t, seen, 10)
+		for n, count := range seen {
+			assert.Equal(t, 1, count, fmt.Sprintf("job %d", n))
+		}
+	})
+
+	t.Run("Success - Expired lease is taken over", func(t *testing.T) {
+		jobs.Register("recovered", func(struct{}) error { return nil })
+
+		job, _ := jobs.Enqueue("recovered", struct{}{}, jobs.Options{Queue: "leases"})
+		expired := time.Now().Add(-time.Minute)
+		database.DB.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status": models.JobRunning, "attempts": 1, "locked_by": "crashed-host", "locked_until": expired,
+		})
+
+		ran, _ := jobs.RunNext("leases", time.Now(), cfg)
+		assert.True(t, ran)
+
+		done := reload(t, job.ID)
+		assert.Equal(t, models.JobSucceeded, done.Status)
+		assert.Equal(t, 2, done.Attempts)
+	})
+
+	t.Run("Success - Queue limit counts jobs running on other instances", func(t *testing.T) {
+		jobs.Register("limited", func(struct{}) error { return nil })
+		limited := cfg
+		limited.Queues = map[string]int{"limited": 1}
+
+		elsewhere, _ := jobs.Enqueue("limited", struct{}{}, jobs.Options{Queue: "limited"})
+		until := time.Now().Add(time.Minute)
+		database.DB.Model(&models.Job{}).Where("id = ?", elsewhere.ID).Updates(map[string]interface{}{
+			"status": models.JobRunning, "attempts": 1, "locked_by": "other-host", "locked_until": until,
+		})
+		waiting, _ := jobs.Enqueue("limited", struct{}{}, jobs.Options{Queue: "limited"})
+
+		ran, err := jobs.RunNext("limited", time.Now(), limited)
+		assert.NoError(t, err)
+		assert.False(t, ran, "the other instance's job fills the queue")
+		assert.Equal(t, models.JobPending, reload(t, waiting.ID).Status)
+
+		database.DB.Model(&models.Job{}).Where("id = ?", elsewhere.ID).Updates(map[string]interface{}{
+			"status": models.JobSucceeded, "locked_until": nil,
+		})
+
+		ran, err = jobs.RunNext("limited", time.Now(), limited)
+		assert.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, models.JobSucceeded, reload(t, waiting.ID).Status)
+	})
+
+	t.Run("Admin - List, stats and retry", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/jobs/?status=dead&queue=flaky", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		var list struct {
+			Data []models.Job   `json:"data"`
+			Meta testutils.Meta `json:"meta"`
+		}
+		testutils.ParseResponse(t, resp, &list)
+		if !assert.Len(t, list.Data, 1) {
+			return
+		}
+		dead := list.Data[0]
+		assert.Equal(t, "flaky", dead.Type)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/jobs/stats", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+		var stats struct {
+			Data []jobs.QueueStats `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &stats)
+		assert.Contains(t, stats.Data, jobs.QueueStats{Queue: "flaky", Status: models.JobDead, Count: 1})
+
+		resp, _ = testutils.MakeRequest(app, "POST", fmt.Sprintf("/jobs/%d/retry", dead.ID), nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		retried := reload(t, dead.ID)
+		assert.Equal(t, models.JobPending, retried.Status)
+		assert.Equal(t, 0, retried.Attempts)
+		assert.Equal(t, "upstream unavailable", retried.LastError, "last error is kept for inspection")
+
+		resp, _ = testutils.MakeRequest(app, "POST", fmt.Sprintf("/jobs/%d/retry", dead.ID), nil, adminToken)
+		assert.Equal(t, 400, resp.Code, "only dead jobs can be retried")
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/jobs/99999", nil, adminToken)
+		assert.Equal(t, 404, resp.Code)
+	})
+
+	t.Run("Error - Non-admin is forbidden", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/jobs/", nil, editorToken)
+		assert.Equal(t, 403, resp.Code)
+	})
+}
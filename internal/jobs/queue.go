@@ -0,0 +1,194 @@
+// Package jobs is a database-backed background job queue. Jobs survive
+// restarts, are retried with backoff, and are dead-lettered once they run out
+// of attempts. Several instances can run workers against the same queue.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/datatypes"
+)
+
+const (
+	DefaultQueue       = "default"
+	DefaultMaxAttempts = 5
+)
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobNotFailed = errors.New("only dead jobs can be retried")
+)
+
+type handlerFunc func(payload []byte) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[string]handlerFunc)
+)
+
+// Register sets the handler for jobType. The stored payload is decoded into
+// P before fn is called; a returned error, or a panic, fails the attempt.
+func Register[P any](jobType string, fn func(P) error) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+
+	handlers[jobType] = func(raw []byte) error {
+		var payload P
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &payload); err != nil {
+				return fmt.Errorf("decode payload: %w", err)
+			}
+		}
+		return fn(payload)
+	}
+}
+
+func handlerFor(jobType string) (handlerFunc, bool) {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	fn, ok := handlers[jobType]
+	return fn, ok
+}
+
+type Options struct {
+	Queue       string    // DefaultQueue when empty
+	RunAt       time.Time // now when zero
+	MaxAttempts int       // DefaultMaxAttempts when zero
+	// UniqueKey, when set, makes Enqueue return the pending or running job
+	// with the same key instead of adding another.
+	UniqueKey string
+}
+
+// Enqueue stores a job of jobType for a worker to pick up.
+func Enqueue(jobType string, payload interface{}, opts Options) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.Job{
+		Queue:       opts.Queue,
+		Type:        jobType,
+		Payload:     datatypes.JSON(data),
+		Status:      models.JobPending,
+		RunAt:       opts.RunAt,
+		MaxAttempts: opts.MaxAttempts,
+	}
+	if job.Queue == "" {
+		job.Queue = DefaultQueue
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.UniqueKey != "" {
+		key := opts.UniqueKey
+		job.UniqueKey = &key
+
+		var existing models.Job
+		if err := database.DB.Where("unique_key = ?", key).First(&existing).Error; err == nil {
+			return &existing, nil
+		}
+	}
+
+	if err := database.DB.Create(&job).Error; err != nil {
+		// Another instance may have enqueued the same key in the meantime.
+		if job.UniqueKey != nil {
+			var existing models.Job
+			if database.DB.Where("unique_key = ?", *job.UniqueKey).First(&existing).Error == nil {
+				return &existing, nil
+			}
+		}
+		return nil, err
+	}
+
+	wakeQueue(job.Queue)
+	return &job, nil
+}
+
+// Retry puts a dead job back in its queue with a fresh set of attempts.
+func Retry(jobID uint) (*models.Job, error) {
+	var job models.Job
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != models.JobDead {
+		return nil, ErrJobNotFailed
+	}
+
+	result := database.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ?", job.ID, models.JobDead).
+		Updates(map[string]interface{}{
+			"status":       models.JobPending,
+			"attempts":     0,
+			"run_at":       time.Now(),
+			"completed_at": nil,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrJobNotFailed
+	}
+
+	database.DB.First(&job, job.ID)
+	wakeQueue(job.Queue)
+	return &job, nil
+}
+
+type Filter struct {
+	Queue  string
+	Status string
+	Type   string
+}
+
+func ListJobs(filter Filter, page, limit int) ([]models.Job, int64, error) {
+	query := database.DB.Model(&models.Job{})
+	if filter.Queue != "" {
+		query = query.Where("queue = ?", filter.Queue)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var jobs []models.Job
+	err := query.
+		Order("id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&jobs).Error
+	return jobs, total, err
+}
+
+type QueueStats struct {
+	Queue  string `json:"queue"`
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+// Stats counts jobs by queue and status.
+func Stats() ([]QueueStats, error) {
+	var stats []QueueStats
+	err := database.DB.Model(&models.Job{}).
+		Select("queue, status, COUNT(*) AS count").
+		Group("queue, status").
+		Order("queue, status").
+		Scan(&stats).Error
+	return stats, err
+}
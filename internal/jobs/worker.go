@@ -0,0 +1,299 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetryPolicy controls when a failed job runs again. The delay doubles after
+// every failed attempt, starting at BaseDelay and capped at MaxDelay.
+type RetryPolicy struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+type Config struct {
+	// Queues maps each queue this process works on to how many of its jobs
+	// may run at once. The limit holds across all instances: a worker only
+	// claims a job while fewer than that many are running, so each process
+	// starts that many workers but they may sit idle. A queue missing from
+	// the map has no limit.
+	Queues       map[string]int
+	PollInterval time.Duration
+	// Lease is how long a running job is hidden from other workers. It is
+	// renewed while the job runs, so a job is only taken over when its worker
+	// has died.
+	Lease time.Duration
+	Retry RetryPolicy
+}
+
+var DefaultConfig = Config{
+	Queues:       map[string]int{DefaultQueue: 4},
+	PollInterval: 5 * time.Second,
+	Lease:        5 * time.Minute,
+	Retry:        RetryPolicy{BaseDelay: 10 * time.Second, MaxDelay: time.Hour},
+}
+
+var workerID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+var (
+	wakeMu sync.Mutex
+	wakes  = make(map[string]chan struct{})
+)
+
+func wakeQueue(queue string) {
+	wakeMu.Lock()
+	wake := wakes[queue]
+	wakeMu.Unlock()
+
+	if wake != nil {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start runs workers for every queue in cfg. Each polls every PollInterval,
+// and straight away when a job is enqueued in this process.
+func Start(cfg Config) {
+	for queue, concurrency := range cfg.Queues {
+		wake := make(chan struct{}, concurrency)
+		wakeMu.Lock()
+		wakes[queue] = wake
+		wakeMu.Unlock()
+
+		for i := 0; i < concurrency; i++ {
+			go work(queue, wake, cfg)
+		}
+	}
+}
+
+func work(queue string, wake chan struct{}, cfg Config) {
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		ran, err := RunNext(queue, time.Now(), cfg)
+		if err != nil {
+			log.Printf("⚠️  Job worker for queue %s failed: %v", queue, err)
+		}
+		if ran {
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// RunNext claims the oldest job in queue that is due at now, or whose worker's
+// lease has expired, and runs it. It reports whether a job was run, which it
+// does not when the queue is already running as many jobs as cfg allows.
+func RunNext(queue string, now time.Time, cfg Config) (bool, error) {
+	job, err := claimNext(queue, now, cfg)
+	if err != nil || job == nil {
+		return false, err
+	}
+	execute(job, cfg)
+	return true, nil
+}
+
+// claimNext takes the next job in queue for this worker. Claims for a queue
+// with a limit are serialized across instances so the running count they
+// check cannot change underneath them; within a claim, rows other workers
+// are taking are skipped rather than waited for.
+func claimNext(queue string, now time.Time, cfg Config) (*models.Job, error) {
+	var claimed *models.Job
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if limit := cfg.Queues[queue]; limit > 0 {
+			if err := lockQueue(tx, queue); err != nil {
+				return err
+			}
+
+			var running int64
+			if err := tx.Model(&models.Job{}).
+				Where("queue = ? AND status = ? AND locked_until >= ?", queue, models.JobRunning, now).
+				Count(&running).Error; err != nil {
+				return err
+			}
+			if running >= int64(limit) {
+				return nil
+			}
+		}
+
+		for {
+			var due []models.Job
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("queue = ? AND ((status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?))",
+					queue, models.JobPending, now, models.JobRunning, now).
+				Order("run_at ASC, id ASC").
+				Limit(1).
+				Find(&due).Error; err != nil {
+				return err
+			}
+			if len(due) == 0 {
+				return nil
+			}
+
+			job := &due[0]
+			ok, err := claim(tx, job, now, cfg)
+			if err != nil {
+				return err
+			}
+			if ok {
+				claimed = job
+				return nil
+			}
+		}
+	})
+	return claimed, err
+}
+
+// lockQueue holds a transaction-scoped lock on queue until tx ends. SQLite
+// runs one write transaction at a time, so it needs none.
+func lockQueue(tx *gorm.DB, queue string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "jobs:"+queue).Error
+}
+
+// claim takes job for this worker. The update only matches while the job is
+// as it was read, so a worker that read it before it was locked cannot take
+// it too. It reports false, after dead-lettering it, for a job whose worker
+// died on its last attempt.
+func claim(tx *gorm.DB, job *models.Job, now time.Time, cfg Config) (bool, error) {
+	query := tx.Model(&models.Job{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, job.Status, job.Attempts)
+
+	// A job whose worker died on its last attempt is not run again.
+	if job.Status == models.JobRunning && job.Attempts >= job.MaxAttempts {
+		result := query.Updates(map[string]interface{}{
+			"status":       models.JobDead,
+			"last_error":   "worker stopped before the job finished",
+			"unique_key":   nil,
+			"locked_until": nil,
+			"completed_at": now,
+		})
+		return false, result.Error
+	}
+
+	until := now.Add(cfg.Lease)
+	result := query.Updates(map[string]interface{}{
+		"status":       models.JobRunning,
+		"attempts":     job.Attempts + 1,
+		"locked_by":    workerID,
+		"locked_until": until,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	job.Status = models.JobRunning
+	job.Attempts++
+	job.LockedBy = workerID
+	job.LockedUntil = &until
+	return true, nil
+}
+
+func execute(job *models.Job, cfg Config) {
+	stop := keepLease(job, cfg.Lease)
+	err := runHandler(job)
+	stop()
+
+	finish(job, err, time.Now(), cfg.Retry)
+}
+
+func runHandler(job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	fn, ok := handlerFor(job.Type)
+	if !ok {
+		return fmt.Errorf("no handler registered for job type %q", job.Type)
+	}
+	return fn(job.Payload)
+}
+
+// keepLease extends the job's lease while it runs. It returns a function that
+// stops renewing.
+func keepLease(job *models.Job, lease time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lease / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				database.DB.Model(&models.Job{}).
+					Where("id = ? AND locked_by = ? AND attempts = ?", job.ID, workerID, job.Attempts).
+					Update("locked_until", time.Now().Add(lease))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// finish records the outcome of the attempt: done, retried later, or dead.
+// now is when the attempt ended, so a retry's backoff starts from there.
+func finish(job *models.Job, runErr error, now time.Time, retry RetryPolicy) {
+	updates := map[string]interface{}{
+		"locked_until": nil,
+		"last_error":   "",
+	}
+
+	switch {
+	case runErr == nil:
+		updates["status"] = models.JobSucceeded
+		updates["unique_key"] = nil
+		updates["completed_at"] = now
+	case job.Attempts >= job.MaxAttempts:
+		updates["status"] = models.JobDead
+		updates["unique_key"] = nil
+		updates["completed_at"] = now
+		updates["last_error"] = runErr.Error()
+		log.Printf("❌ Job %d (%s) failed %d times and was dead-lettered: %v", job.ID, job.Type, job.Attempts, runErr)
+	default:
+		updates["status"] = models.JobPending
+		updates["run_at"] = now.Add(retry.backoff(job.Attempts))
+		updates["last_error"] = runErr.Error()
+	}
+
+	// Only the worker holding the job may record its outcome; if the lease was
+	// lost the new holder records its own.
+	if err := database.DB.Model(&models.Job{}).
+		Where("id = ? AND locked_by = ? AND attempts = ?", job.ID, workerID, job.Attempts).
+		Updates(updates).Error; err != nil {
+		log.Printf("⚠️  Failed to record outcome of job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,130 @@
+package mail_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kyz7/cms/internal/config"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/mail"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	sent     []mail.Message
+}
+
+func (m *flakyMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.attempts <= m.failures {
+		return errors.New("connection refused")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestMail(t *testing.T) {
+	templateDir := t.TempDir()
+	cfg := &config.Config{
+		AppURL:          "https://cms.example.com/",
+		MailTransport:   "memory",
+		MailTemplateDir: templateDir,
+	}
+	assert.NoError(t, mail.Configure(cfg))
+
+	t.Run("Success - Built-in templates render text and HTML", func(t *testing.T) {
+		msg, err := mail.Render(mail.TemplatePasswordReset, map[string]interface{}{
+			"Name":      "Ada <admin>",
+			"ResetURL":  mail.Link("/reset-password?token=abc"),
+			"ExpiresIn": "1 hour",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Reset your password", msg.Subject)
+		assert.Contains(t, msg.Text, "https://cms.example.com/reset-password?token=abc")
+		assert.Contains(t, msg.Text, "Hi Ada <admin>,")
+		assert.Contains(t, msg.HTML, "Hi Ada &lt;admin&gt;,", "HTML is escaped")
+
+		for _, name := range []string{mail.TemplateInvite, mail.TemplateNotification} {
+			_, err := mail.Render(name, map[string]interface{}{})
+			assert.NoError(t, err, name)
+		}
+	})
+
+	t.Run("Success - Operator templates override built-in ones", func(t *testing.T) {
+		os.WriteFile(filepath.Join(templateDir, "invite.subject.tmpl"), []byte("Welcome aboard, {{.Name}}"), 0o644)
+		defer os.Remove(filepath.Join(templateDir, "invite.subject.tmpl"))
+
+		msg, err := mail.Render(mail.TemplateInvite, map[string]interface{}{"Name": "Grace"})
+		assert.NoError(t, err)
+		assert.Equal(t, "Welcome aboard, Grace", msg.Subject)
+		assert.Contains(t, msg.Text, "created an account for you", "files not overridden stay built-in")
+	})
+
+	t.Run("Success - Mail is queued and failed sends are retried", func(t *testing.T) {
+		testutils.SetupTestApp(t)
+		flaky := &flakyMailer{failures: 2}
+		mail.SetMailer(flaky)
+		cfg := jobs.Config{
+			Lease: time.Minute,
+			Retry: jobs.RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Second},
+		}
+
+		assert.NoError(t, mail.Send("user@example.com", mail.TemplateInvite, map[string]interface{}{"Name": "Lin"}))
+		assert.Equal(t, 0, flaky.attempts, "sending does not wait for the mail server")
+
+		var job models.Job
+		assert.NoError(t, database.DB.Where("type = ?", mail.JobSend).First(&job).Error)
+		assert.Equal(t, mail.Queue, job.Queue)
+
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			ran, err := jobs.RunNext(mail.Queue, now.Add(time.Duration(i)*time.Minute), cfg)
+			assert.NoError(t, err)
+			assert.True(t, ran)
+		}
+
+		assert.Equal(t, 3, flaky.attempts)
+		if assert.Len(t, flaky.sent, 1) {
+			assert.Equal(t, []string{"user@example.com"}, flaky.sent[0].To)
+		}
+		assert.NoError(t, database.DB.First(&job, job.ID).Error)
+		assert.Equal(t, models.JobSucceeded, job.Status)
+	})
+
+	t.Run("Success - File transport writes MIME messages", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "mail.log")
+		mailer, err := mail.New(&config.Config{MailTransport: "file", MailLogPath: path, MailFrom: "CMS <no-reply@example.com>"})
+		assert.NoError(t, err)
+
+		err = mailer.Send(mail.Message{To: []string{"a@example.com"}, Subject: "Hello", Text: "plain", HTML: "<p>rich</p>"})
+		assert.NoError(t, err)
+
+		data, _ := os.ReadFile(path)
+		content := string(data)
+		assert.Contains(t, content, "From: CMS <no-reply@example.com>")
+		assert.Contains(t, content, "To: a@example.com")
+		assert.Contains(t, content, "multipart/alternative")
+		assert.True(t, strings.Index(content, "plain") < strings.Index(content, "<p>rich</p>"), "text comes before HTML")
+	})
+
+	t.Run("Error - SMTP needs a host", func(t *testing.T) {
+		_, err := mail.New(&config.Config{MailTransport: "smtp"})
+		assert.Error(t, err)
+
+		_, err = mail.New(&config.Config{MailTransport: "pigeon"})
+		assert.Error(t, err)
+	})
+}
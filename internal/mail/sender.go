@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Kyz7/cms/internal/config"
+	"github.com/Kyz7/cms/internal/jobs"
+)
+
+const (
+	// JobSend is the job type that sends one message.
+	JobSend = "mail.send"
+	// Queue is the job queue mail is sent from, so a slow mail server only
+	// holds up other mail.
+	Queue = "mail"
+	// MaxAttempts is how often a message is tried before its job is
+	// dead-lettered, where an admin can retry it.
+	MaxAttempts = 5
+)
+
+func init() {
+	jobs.Register(JobSend, func(msg Message) error {
+		return current().Send(msg)
+	})
+}
+
+var (
+	mu          sync.RWMutex
+	mailer      Mailer = logMailer{}
+	appURL             = "http://localhost:3000"
+	templateSrc string
+)
+
+// Configure selects the transport, template overrides and link base URL
+// from cfg.
+func Configure(cfg *config.Config) error {
+	m, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	mailer = m
+	appURL = strings.TrimRight(cfg.AppURL, "/")
+	templateSrc = cfg.MailTemplateDir
+	return nil
+}
+
+// SetMailer replaces the transport, e.g. with a MemoryMailer in tests.
+func SetMailer(m Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+	mailer = m
+}
+
+func current() Mailer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return mailer
+}
+
+func templateDir() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return templateSrc
+}
+
+// Link returns the frontend URL for path.
+func Link(path string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return appURL + "/" + strings.TrimLeft(path, "/")
+}
+
+// Deliver queues msg on the durable job queue and returns once it is stored;
+// a mail worker sends it, retrying failures with backoff.
+func Deliver(msg Message) error {
+	_, err := jobs.Enqueue(JobSend, msg, jobs.Options{Queue: Queue, MaxAttempts: MaxAttempts})
+	return err
+}
+
+// Send renders template name with data and delivers it to the recipient.
+func Send(to, name string, data interface{}) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{to}
+	return Deliver(msg)
+}
@@ -0,0 +1,94 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	TemplatePasswordReset = "password_reset"
+	TemplateInvite        = "invite"
+	TemplateNotification  = "notification"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// loadTemplate reads name from the override directory when the operator has
+// put a file of the same name there, and from the built-in set otherwise.
+func loadTemplate(file string) (string, error) {
+	if dir := templateDir(); dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	data, err := builtinTemplates.ReadFile("templates/" + file)
+	return string(data), err
+}
+
+func renderText(file string, data interface{}) (string, error) {
+	source, err := loadTemplate(file)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := texttemplate.New(file).Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func renderHTML(file string, data interface{}) (string, error) {
+	source, err := loadTemplate(file)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := htmltemplate.New(file).Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render builds the subject, text and HTML bodies of template name. Templates
+// are read on every call, so overrides take effect without a restart.
+func Render(name string, data interface{}) (Message, error) {
+	subject, err := renderText(name+".subject.tmpl", data)
+	if err != nil {
+		return Message{}, err
+	}
+	text, err := renderText(name+".txt.tmpl", data)
+	if err != nil {
+		return Message{}, err
+	}
+	html, err := renderHTML(name+".html.tmpl", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject),
+		Text:    text,
+		HTML:    html,
+	}, nil
+}
@@ -3,6 +3,7 @@ package media
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
@@ -12,7 +13,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Kyz7/cms/internal/audit"
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
 	"github.com/Kyz7/cms/internal/utils"
@@ -26,7 +29,20 @@ func sanitizeInput(input string) string {
 	return policy.Sanitize(input)
 }
 
+func uploadErrorResponse(c *fiber.Ctx, err error) error {
+	var veto *events.VetoError
+	switch {
+	case errors.As(err, &veto):
+		return response.Error(c, fiber.StatusUnprocessableEntity, "OPERATION_VETOED", err.Error(), nil)
+	case errors.Is(err, ErrMetadataFailed):
+		return response.InternalError(c, "Failed to save media metadata")
+	default:
+		return response.InternalError(c, "Failed to upload file: "+err.Error())
+	}
+}
+
 func UploadMediaHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	userID := c.Locals("user_id").(uint)
 
 	file, err := c.FormFile("file")
@@ -53,45 +69,29 @@ func UploadMediaHandler(c *fiber.Ctx) error {
 	var tags []string
 	json.Unmarshal([]byte(tagsStr), &tags)
 
-	url, err := utils.UploadFile(file)
-	if err != nil {
-		return response.InternalError(c, "Failed to upload file: "+err.Error())
-	}
-
-	mediaFile := models.MediaFile{
-		FileName:   file.Filename,
-		URL:        url,
-		Type:       file.Header.Get("Content-Type"),
-		Size:       file.Size,
-		Folder:     folder,
-		Alt:        alt,
-		Caption:    caption,
-		UploadedBy: userID,
+	meta := models.MediaFile{
+		Folder:  folder,
+		Alt:     alt,
+		Caption: caption,
 	}
-
-	if strings.HasPrefix(mediaFile.Type, "image/") {
-		if width, height, err := getImageDimensions(file); err == nil {
-			mediaFile.Width = &width
-			mediaFile.Height = &height
-		}
-	}
-
 	if len(tags) > 0 {
 		tagsJSON, _ := json.Marshal(tags)
-		mediaFile.Tags = tagsJSON
+		meta.Tags = tagsJSON
 	}
 
-	if err := database.DB.Create(&mediaFile).Error; err != nil {
-		utils.DeleteFile(url)
-		return response.InternalError(c, "Failed to save media metadata")
+	mediaFile, err := SaveUpload(ctx, file, userID, meta)
+	if err != nil {
+		return uploadErrorResponse(c, err)
 	}
 
-	database.DB.Preload("Uploader").First(&mediaFile, mediaFile.ID)
+	database.DB.WithContext(ctx).Preload("Uploader").First(mediaFile, mediaFile.ID)
+	audit.Record(c, "media.upload", "media", mediaFile.ID, nil, mediaFile)
 
 	return response.Created(c, mediaFile, "Media uploaded successfully")
 }
 
 func BulkUploadMediaHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	userID := c.Locals("user_id").(uint)
 	folder := c.FormValue("folder", "")
 
@@ -121,7 +121,7 @@ func BulkUploadMediaHandler(c *fiber.Ctx) error {
 			})
 			continue
 		}
-		url, err := utils.UploadFile(file)
+		mediaFile, err := SaveUpload(ctx, file, userID, models.MediaFile{Folder: folder})
 		if err != nil {
 			errors = append(errors, map[string]string{
 				"filename": file.Filename,
@@ -130,31 +130,8 @@ func BulkUploadMediaHandler(c *fiber.Ctx) error {
 			continue
 		}
 
-		mediaFile := models.MediaFile{
-			FileName:   file.Filename,
-			URL:        url,
-			Type:       file.Header.Get("Content-Type"),
-			Size:       file.Size,
-			Folder:     folder,
-			UploadedBy: userID,
-		}
-
-		if strings.HasPrefix(mediaFile.Type, "image/") {
-			if width, height, err := getImageDimensions(file); err == nil {
-				mediaFile.Width = &width
-				mediaFile.Height = &height
-			}
-		}
-
-		if err := database.DB.Create(&mediaFile).Error; err != nil {
-			errors = append(errors, map[string]string{
-				"filename": file.Filename,
-				"error":    "failed to save metadata",
-			})
-			continue
-		}
-
-		uploadedFiles = append(uploadedFiles, mediaFile)
+		audit.Record(c, "media.upload", "media", mediaFile.ID, nil, mediaFile)
+		uploadedFiles = append(uploadedFiles, *mediaFile)
 	}
 
 	result := fiber.Map{
@@ -171,6 +148,7 @@ func BulkUploadMediaHandler(c *fiber.Ctx) error {
 }
 
 func ListMediaHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 	mediaType := c.Query("type", "")
@@ -182,7 +160,7 @@ func ListMediaHandler(c *fiber.Ctx) error {
 	var mediaFiles []models.MediaFile
 	var total int64
 
-	query := database.DB.Model(&models.MediaFile{})
+	query := database.DB.WithContext(ctx).Model(&models.MediaFile{})
 
 	if mediaType != "" {
 		query = query.Where("type LIKE ?", mediaType+"%")
@@ -209,13 +187,14 @@ func ListMediaHandler(c *fiber.Ctx) error {
 }
 
 func GetMediaHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid media ID", nil)
 	}
 
 	var mediaFile models.MediaFile
-	if err := database.DB.Preload("Uploader").First(&mediaFile, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Uploader").First(&mediaFile, id).Error; err != nil {
 		return response.NotFound(c, "Media")
 	}
 
@@ -223,13 +202,14 @@ func GetMediaHandler(c *fiber.Ctx) error {
 }
 
 func UpdateMediaHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid media ID", nil)
 	}
 
 	var mediaFile models.MediaFile
-	if err := database.DB.First(&mediaFile, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&mediaFile, id).Error; err != nil {
 		return response.NotFound(c, "Media")
 	}
 
@@ -244,6 +224,7 @@ func UpdateMediaHandler(c *fiber.Ctx) error {
 		return response.BadRequest(c, "Invalid request body", err.Error())
 	}
 
+	before := mediaFile
 	mediaFile.Alt = body.Alt
 	mediaFile.Caption = sanitizeInput(body.Caption)
 	mediaFile.Folder = body.Folder
@@ -253,21 +234,23 @@ func UpdateMediaHandler(c *fiber.Ctx) error {
 		mediaFile.Tags = tagsJSON
 	}
 
-	if err := database.DB.Save(&mediaFile).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Save(&mediaFile).Error; err != nil {
 		return response.InternalError(c, "Failed to update media")
 	}
+	audit.Record(c, "media.update", "media", mediaFile.ID, before, mediaFile)
 
 	return response.Success(c, mediaFile, "Media updated successfully")
 }
 
 func DeleteMediaHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid media ID", nil)
 	}
 
 	var mediaFile models.MediaFile
-	if err := database.DB.First(&mediaFile, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&mediaFile, id).Error; err != nil {
 		return response.NotFound(c, "Media")
 	}
 
@@ -275,14 +258,16 @@ func DeleteMediaHandler(c *fiber.Ctx) error {
 		c.Append("X-Warning", "File deleted from database but may still exist in storage")
 	}
 
-	if err := database.DB.Delete(&mediaFile).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Delete(&mediaFile).Error; err != nil {
 		return response.InternalError(c, "Failed to delete media")
 	}
+	audit.Record(c, "media.delete", "media", mediaFile.ID, mediaFile, nil)
 
 	return c.Status(204).JSON(fiber.Map{})
 }
 
 func SearchMediaHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	query := c.Query("q", "")
 	if query == "" {
 		return response.BadRequest(c, "Search query is required", nil)
@@ -295,7 +280,7 @@ func SearchMediaHandler(c *fiber.Ctx) error {
 	var mediaFiles []models.MediaFile
 	var total int64
 
-	dbQuery := database.DB.Model(&models.MediaFile{}).
+	dbQuery := database.DB.WithContext(ctx).Model(&models.MediaFile{}).
 		Where("file_name LIKE ? OR alt LIKE ? OR caption LIKE ?",
 			"%"+query+"%", "%"+query+"%", "%"+query+"%")
 
@@ -311,6 +296,7 @@ func SearchMediaHandler(c *fiber.Ctx) error {
 }
 
 func GetMediaStatsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var stats struct {
 		TotalFiles    int64            `json:"total_files"`
 		TotalSize     int64            `json:"total_size_bytes"`
@@ -319,29 +305,29 @@ func GetMediaStatsHandler(c *fiber.Ctx) error {
 		StorageMode   string           `json:"storage_mode"`
 	}
 
-	database.DB.Model(&models.MediaFile{}).Count(&stats.TotalFiles)
+	database.DB.WithContext(ctx).Model(&models.MediaFile{}).Count(&stats.TotalFiles)
 
-	database.DB.Model(&models.MediaFile{}).
+	database.DB.WithContext(ctx).Model(&models.MediaFile{}).
 		Select("COALESCE(SUM(size), 0)").
 		Row().Scan(&stats.TotalSize)
 
 	stats.ByType = make(map[string]int64)
 
-	dbName := database.DB.Dialector.Name()
+	dbName := database.DB.WithContext(ctx).Dialector.Name()
 
 	var rows *sql.Rows
 	var err error
 
 	if dbName == "sqlite" {
 		var mediaFiles []models.MediaFile
-		database.DB.Model(&models.MediaFile{}).Select("type").Find(&mediaFiles)
+		database.DB.WithContext(ctx).Model(&models.MediaFile{}).Select("type").Find(&mediaFiles)
 
 		for _, media := range mediaFiles {
 			mediaType := strings.Split(media.Type, "/")[0]
 			stats.ByType[mediaType]++
 		}
 	} else {
-		rows, err = database.DB.Model(&models.MediaFile{}).
+		rows, err = database.DB.WithContext(ctx).Model(&models.MediaFile{}).
 			Select("split_part(type, '/', 1) as media_type, COUNT(*) as count").
 			Group("media_type").Rows()
 
@@ -356,7 +342,7 @@ func GetMediaStatsHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	database.DB.Model(&models.MediaFile{}).
+	database.DB.WithContext(ctx).Model(&models.MediaFile{}).
 		Where("created_at > ?", time.Now().Add(-24*time.Hour)).
 		Count(&stats.RecentUploads)
 
@@ -366,6 +352,7 @@ func GetMediaStatsHandler(c *fiber.Ctx) error {
 }
 
 func CreateFolderHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	userID := c.Locals("user_id").(uint)
 
 	var body struct {
@@ -386,7 +373,7 @@ func CreateFolderHandler(c *fiber.Ctx) error {
 	path := "/" + body.Name
 	if body.ParentID != nil {
 		var parent models.MediaFolder
-		if err := database.DB.First(&parent, *body.ParentID).Error; err != nil {
+		if err := database.DB.WithContext(ctx).First(&parent, *body.ParentID).Error; err != nil {
 			return response.NotFound(c, "Parent folder")
 		}
 		path = parent.Path + "/" + body.Name
@@ -399,7 +386,7 @@ func CreateFolderHandler(c *fiber.Ctx) error {
 		CreatedBy: userID,
 	}
 
-	if err := database.DB.Create(&folder).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Create(&folder).Error; err != nil {
 		return response.InternalError(c, "Failed to create folder")
 	}
 
@@ -407,8 +394,9 @@ func CreateFolderHandler(c *fiber.Ctx) error {
 }
 
 func ListFoldersHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var folders []models.MediaFolder
-	if err := database.DB.Preload("Parent").Order("path").Find(&folders).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Parent").Order("path").Find(&folders).Error; err != nil {
 		return response.InternalError(c, "Failed to fetch folders")
 	}
 
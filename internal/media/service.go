@@ -0,0 +1,63 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"strings"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/utils"
+)
+
+var (
+	ErrUploadFailed   = errors.New("failed to upload file")
+	ErrMetadataFailed = errors.New("failed to save media metadata")
+)
+
+// SaveUpload stores file and its MediaFile row for userID. media carries the
+// descriptive fields (folder, alt, caption, tags); before hooks may change
+// them or veto the upload.
+func SaveUpload(ctx context.Context, file *multipart.FileHeader, userID uint, media models.MediaFile) (*models.MediaFile, error) {
+	media.FileName = file.Filename
+	media.Type = file.Header.Get("Content-Type")
+	media.Size = file.Size
+	media.UploadedBy = userID
+
+	if err := events.RunBefore(&events.BeforeMediaUpload{Media: &media, UserID: userID}); err != nil {
+		return nil, err
+	}
+
+	url, err := utils.UploadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadFailed, err)
+	}
+	media.URL = url
+
+	if strings.HasPrefix(media.Type, "image/") {
+		if width, height, err := getImageDimensions(file); err == nil {
+			media.Width = &width
+			media.Height = &height
+		}
+	}
+
+	if err := database.DB.WithContext(ctx).Create(&media).Error; err != nil {
+		utils.DeleteFile(url)
+		return nil, ErrMetadataFailed
+	}
+
+	events.Publish(events.MediaUploaded{Media: media, UserID: userID})
+	return &media, nil
+}
+
+// DiscardUploads removes files stored by SaveUpload for a request that failed
+// afterwards, e.g. an entry vetoed by a hook, so they are not left orphaned.
+func DiscardUploads(ctx context.Context, uploads []*models.MediaFile) {
+	for _, media := range uploads {
+		utils.DeleteFile(media.URL)
+		database.DB.WithContext(ctx).Unscoped().Delete(media)
+	}
+}
@@ -1,6 +1,7 @@
 package middleware_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
@@ -625,7 +626,7 @@ func TestPermissionFieldFiltering(t *testing.T) {
 			"meta_description": "Meta Desc",
 		}
 
-		filtered, err := middleware.FilterFieldsByPermission(user.ID, "update", data, ct.ID)
+		filtered, err := middleware.FilterFieldsByPermission(context.Background(), user.ID, "update", data, ct.ID)
 		assert.NoError(t, err)
 		assert.NotContains(t, filtered, "title")
 		assert.NotContains(t, filtered, "content")
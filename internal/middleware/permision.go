@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/Kyz7/cms/internal/database"
@@ -14,7 +15,7 @@ func PermissionProtected(module string, action string) fiber.Handler {
 		userID := c.Locals("user_id").(uint)
 
 		var user models.User
-		if err := database.DB.Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		if err := database.DB.WithContext(c.UserContext()).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
 			return response.Unauthorized(c, "Unauthorized")
 		}
 
@@ -38,9 +39,28 @@ func PermissionProtected(module string, action string) fiber.Handler {
 	}
 }
 
-func HasPermission(userID uint, module, action string) bool {
+// AnyPermissionProtected lets the request through when the user's role grants
+// at least one of actions on module.
+func AnyPermissionProtected(module string, actions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(uint)
+
+		required := make([]struct{ Module, Action string }, 0, len(actions))
+		for _, action := range actions {
+			required = append(required, struct{ Module, Action string }{module, action})
+		}
+
+		if !HasAnyPermission(c.UserContext(), userID, required) {
+			return response.Forbidden(c, "You don't have permission to perform this action")
+		}
+
+		return c.Next()
+	}
+}
+
+func HasPermission(ctx context.Context, userID uint, module, action string) bool {
 	var user models.User
-	if err := database.DB.Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
 		return false
 	}
 
@@ -56,9 +76,9 @@ func HasPermission(userID uint, module, action string) bool {
 	return false
 }
 
-func HasAnyPermission(userID uint, permissions []struct{ Module, Action string }) bool {
+func HasAnyPermission(ctx context.Context, userID uint, permissions []struct{ Module, Action string }) bool {
 	var user models.User
-	if err := database.DB.Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
 		return false
 	}
 
@@ -110,9 +130,9 @@ func IsFullAccessRole(user *models.User) bool {
 	return true
 }
 
-func FilterFieldsByPermission(userID uint, action string, data map[string]interface{}, contentTypeID uint) (map[string]interface{}, error) {
+func FilterFieldsByPermission(ctx context.Context, userID uint, action string, data map[string]interface{}, contentTypeID uint) (map[string]interface{}, error) {
 	var user models.User
-	if err := database.DB.Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
 		return nil, fiber.NewError(401, "Unauthorized")
 	}
 
@@ -123,22 +143,8 @@ func FilterFieldsByPermission(userID uint, action string, data map[string]interf
 	var userPermission *models.Permission
 	for _, perm := range user.Role.Permissions {
 		if perm.Module == "ContentEntry" && perm.Action == action {
-			if perm.ContentTypeIDs != nil {
-				var contentTypeIDs []uint
-				json.Unmarshal(perm.ContentTypeIDs, &contentTypeIDs)
-
-				if len(contentTypeIDs) > 0 {
-					hasAccess := false
-					for _, id := range contentTypeIDs {
-						if id == contentTypeID {
-							hasAccess = true
-							break
-						}
-					}
-					if !hasAccess {
-						continue
-					}
-				}
+			if !perm.AppliesToContentType(contentTypeID) {
+				continue
 			}
 
 			userPermission = &perm
@@ -155,7 +161,7 @@ func FilterFieldsByPermission(userID uint, action string, data map[string]interf
 	}
 
 	var ct models.ContentType
-	if err := database.DB.Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID).Error; err != nil {
 		return nil, err
 	}
 
@@ -227,9 +233,9 @@ func FilterFieldsByPermission(userID uint, action string, data map[string]interf
 	return filteredData, nil
 }
 
-func CanAccessField(userID uint, fieldName string, contentTypeID uint) (bool, error) {
+func CanAccessField(ctx context.Context, userID uint, fieldName string, contentTypeID uint) (bool, error) {
 	var user models.User
-	if err := database.DB.Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
 		return false, err
 	}
 
@@ -242,7 +248,7 @@ func CanAccessField(userID uint, fieldName string, contentTypeID uint) (bool, er
 	}
 
 	var ct models.ContentType
-	database.DB.Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID)
+	database.DB.WithContext(ctx).Preload("Fields").Preload("SEOFields").First(&ct, contentTypeID)
 
 	var targetField *models.ContentField
 	allFields := append(ct.Fields, ct.SEOFields...)
@@ -258,28 +264,10 @@ func CanAccessField(userID uint, fieldName string, contentTypeID uint) (bool, er
 	}
 
 	for _, perm := range user.Role.Permissions {
-		if perm.Module != "ContentEntry" {
+		if perm.Module != "ContentEntry" || !perm.AppliesToContentType(contentTypeID) {
 			continue
 		}
 
-		if perm.ContentTypeIDs != nil {
-			var contentTypeIDs []uint
-			json.Unmarshal(perm.ContentTypeIDs, &contentTypeIDs)
-
-			if len(contentTypeIDs) > 0 {
-				hasAccess := false
-				for _, id := range contentTypeIDs {
-					if id == contentTypeID {
-						hasAccess = true
-						break
-					}
-				}
-				if !hasAccess {
-					continue
-				}
-			}
-		}
-
 		if perm.FieldScope == "custom" {
 			var allowedFields []string
 			var deniedFields []string
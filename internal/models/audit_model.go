@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var ErrAuditLogImmutable = errors.New("audit log entries cannot be changed or deleted")
+
+// AuditLog is one append-only record of a mutation. Each row stores the hash
+// of the row before it, so editing or removing any row breaks the chain.
+//
+// Before and After use the json column type rather than jsonb so the stored
+// text is exactly what was hashed.
+type AuditLog struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	ActorID      *uint          `gorm:"index" json:"actor_id,omitempty"`
+	IP           string         `gorm:"size:64" json:"ip,omitempty"`
+	UserAgent    string         `gorm:"size:500" json:"user_agent,omitempty"`
+	Action       string         `gorm:"size:100;index" json:"action"`
+	ResourceType string         `gorm:"size:50;index:idx_audit_resource" json:"resource_type"`
+	ResourceID   string         `gorm:"size:100;index:idx_audit_resource" json:"resource_id,omitempty"`
+	Before       datatypes.JSON `gorm:"type:json" json:"before,omitempty"`
+	After        datatypes.JSON `gorm:"type:json" json:"after,omitempty"`
+	RequestID    string         `gorm:"size:64;index" json:"request_id,omitempty"`
+	PrevHash     string         `gorm:"size:64;uniqueIndex" json:"prev_hash"`
+	Hash         string         `gorm:"size:64" json:"hash"`
+	CreatedAt    time.Time      `gorm:"index" json:"created_at"`
+}
+
+func (AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditLogImmutable
+}
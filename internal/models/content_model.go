@@ -8,19 +8,26 @@ import (
 )
 
 type ContentType struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `gorm:"size:100;uniqueIndex" json:"name"`
-	Slug      string         `gorm:"size:100;uniqueIndex" json:"slug"`
-	EnableSEO bool           `json:"enable_seo"`
-	Fields    []ContentField `gorm:"foreignKey:ContentTypeID" json:"fields"`
-	SEOFields []ContentField `gorm:"foreignKey:ContentTypeID" json:"seo_fields"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	SpaceID       uint           `gorm:"not null;default:1;uniqueIndex:idx_content_type_env_name;uniqueIndex:idx_content_type_env_slug" json:"space_id"`
+	EnvironmentID uint           `gorm:"not null;default:0;uniqueIndex:idx_content_type_env_name;uniqueIndex:idx_content_type_env_slug" json:"environment_id"`
+	Name          string         `gorm:"size:100;uniqueIndex:idx_content_type_env_name" json:"name"`
+	Slug          string         `gorm:"size:100;uniqueIndex:idx_content_type_env_slug" json:"slug"`
+	EnableSEO     bool           `json:"enable_seo"`
+	WorkflowID    *uint          `gorm:"index" json:"workflow_id,omitempty"`
+	IsTree        bool           `json:"is_tree"`
+	IsSortable    bool           `json:"is_sortable"`
+	Fields        []ContentField `gorm:"foreignKey:ContentTypeID" json:"fields"`
+	SEOFields     []ContentField `gorm:"foreignKey:ContentTypeID" json:"seo_fields"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type ContentField struct {
 	ID            uint   `gorm:"primaryKey" json:"id"`
+	SpaceID       uint   `gorm:"not null;default:1;index" json:"space_id"`
+	EnvironmentID uint   `gorm:"not null;default:0;index" json:"environment_id"`
 	ContentTypeID uint   `json:"content_type_id"`
 	Name          string `gorm:"size:100" json:"name"`
 	Type          string `gorm:"size:50" json:"type"` // string, number, boolean, date, media, text, email, url
@@ -45,9 +52,17 @@ type ContentField struct {
 
 type ContentEntry struct {
 	ID            uint           `gorm:"primaryKey" json:"id"`
-	ContentTypeID uint           `json:"content_type_id"`
+	SpaceID       uint           `gorm:"not null;default:1;index" json:"space_id"`
+	EnvironmentID uint           `gorm:"not null;default:0;index" json:"environment_id"`
+	OriginID      uint           `gorm:"index" json:"origin_id,omitempty"`
+	ContentTypeID uint           `gorm:"uniqueIndex:idx_entry_type_path,where:path <> '' AND deleted_at IS NULL;uniqueIndex:idx_entry_type_rank,where:rank <> '' AND deleted_at IS NULL" json:"content_type_id"`
+	ParentID      *uint          `gorm:"index" json:"parent_id,omitempty"`
+	Position      int            `gorm:"not null;default:0" json:"position"`
+	Path          string         `gorm:"size:1000;index;uniqueIndex:idx_entry_type_path" json:"path,omitempty"`
+	Rank          string         `gorm:"size:255;index;uniqueIndex:idx_entry_type_rank" json:"rank,omitempty"`
 	Data          datatypes.JSON `json:"data"`
 	Status        WorkflowStatus `gorm:"type:workflow_status;default:'draft';index" json:"status"`
+	Version       uint           `gorm:"not null;default:1" json:"version"`
 	CreatedBy     uint           `gorm:"index" json:"created_by,omitempty"`
 	UpdatedBy     uint           `gorm:"index" json:"updated_by,omitempty"`
 	Creator       *User          `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
@@ -55,11 +70,33 @@ type ContentEntry struct {
 	CreatedAt     time.Time      `json:"created_at"`
 	UpdatedAt     time.Time      `json:"updated_at"`
 	PublishedAt   *time.Time     `json:"published_at,omitempty"`
+	PublishAt     *time.Time     `gorm:"index" json:"publish_at,omitempty"`
+	UnpublishAt   *time.Time     `gorm:"index" json:"unpublish_at,omitempty"`
+	ScheduledBy   *uint          `json:"scheduled_by,omitempty"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// OriginKey identifies the entry across environments. OriginID is set on
+// copies made into another environment, so they share the key of the entry
+// they were made from.
+func (e ContentEntry) OriginKey() uint {
+	if e.OriginID != 0 {
+		return e.OriginID
+	}
+	return e.ID
+}
+
+// InMainEnvironment reports whether the entry is live content rather than a
+// copy in another environment. Changes to copies are not announced to
+// webhooks, the change feed or notifications.
+func (e ContentEntry) InMainEnvironment() bool {
+	return e.EnvironmentID == 0
+}
+
 type ContentRelation struct {
 	ID            uint           `gorm:"primaryKey" json:"id"`
+	SpaceID       uint           `gorm:"not null;default:1;index" json:"space_id"`
+	EnvironmentID uint           `gorm:"not null;default:0;index" json:"environment_id"`
 	FromContentID uint           `json:"from_content_id"`
 	ToContentID   uint           `json:"to_content_id"`
 	RelationType  string         `gorm:"size:50" json:"relation_type"`
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// MainEnvironment is the slug of the environment every space starts with.
+// It has no row of its own: its content has EnvironmentID 0.
+const MainEnvironment = "main"
+
+// Environment holds its own copy of a space's content types and entries, so
+// changes can be rehearsed there and promoted to another environment later.
+type Environment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SpaceID     uint      `gorm:"not null;default:1;uniqueIndex:idx_environment_space_slug" json:"space_id"`
+	Name        string    `gorm:"size:100" json:"name"`
+	Slug        string    `gorm:"size:100;uniqueIndex:idx_environment_space_slug" json:"slug"`
+	Description string    `gorm:"type:text" json:"description"`
+	Source      string    `gorm:"size:100" json:"source,omitempty"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// Export is an entry export requested by a user and written by a background
+// job. Params holds the search that selects the entries, so the job exports
+// what the user asked for even though it runs later and elsewhere.
+type Export struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	SpaceID       uint           `gorm:"not null;default:1;index" json:"space_id"`
+	EnvironmentID uint           `gorm:"not null;default:0;index" json:"environment_id"`
+	UserID        uint           `gorm:"index" json:"user_id"`
+	Name          string         `gorm:"size:100" json:"name"`
+	Format        string         `gorm:"size:10" json:"format"`
+	Params        datatypes.JSON `json:"params"`
+	Status        string         `gorm:"size:20;index" json:"status"`
+	FilePath      string         `gorm:"size:500" json:"-"`
+	Size          int64          `json:"size"`
+	Error         string         `gorm:"type:text" json:"error,omitempty"`
+	CompletedAt   *time.Time     `json:"completed_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
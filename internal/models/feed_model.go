@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// FeedEvent is one change-feed event. Every instance writes the events it
+// publishes here and delivers the rows it has not seen yet to its own
+// subscribers, so a client can connect to, and resume from, any instance.
+type FeedEvent struct {
+	ID            uint64         `gorm:"primaryKey" json:"id"`
+	Type          string         `gorm:"size:50" json:"type"`
+	SpaceID       uint           `gorm:"index" json:"space_id"`
+	ContentTypeID *uint          `json:"content_type_id,omitempty"`
+	Module        string         `gorm:"size:50" json:"module"`
+	Recipients    datatypes.JSON `json:"recipients,omitempty"`
+	Data          datatypes.JSON `json:"data"`
+	CreatedAt     time.Time      `gorm:"index" json:"created_at"`
+}
+
+// StreamTicket is a short-lived, single-use credential for opening the change
+// feed from clients that cannot send an Authorization header, such as the
+// browser's EventSource. It keeps access tokens out of URLs and logs.
+type StreamTicket struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	SpaceID   uint      `json:"space_id"`
+	TokenHash string    `gorm:"size:64;uniqueIndex" json:"-"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
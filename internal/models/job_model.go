@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Job is one unit of background work. A failed job goes back to pending with
+// a later RunAt until it runs out of attempts and is dead-lettered.
+//
+// UniqueKey is only held while the job is pending or running, so a second job
+// with the same key can be enqueued once the first has finished.
+type Job struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Queue       string         `gorm:"size:50;index:idx_job_claim" json:"queue"`
+	Type        string         `gorm:"size:100;index" json:"type"`
+	Payload     datatypes.JSON `json:"payload"`
+	Status      string         `gorm:"size:20;index:idx_job_claim" json:"status"`
+	RunAt       time.Time      `gorm:"index:idx_job_claim" json:"run_at"`
+	Attempts    int            `json:"attempts"`
+	MaxAttempts int            `json:"max_attempts"`
+	UniqueKey   *string        `gorm:"size:200;uniqueIndex" json:"unique_key,omitempty"`
+	LockedBy    string         `gorm:"size:100" json:"locked_by,omitempty"`
+	LockedUntil *time.Time     `json:"locked_until,omitempty"`
+	LastError   string         `gorm:"type:text" json:"last_error,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
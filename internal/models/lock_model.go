@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type EntryLock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	EntryID   uint      `gorm:"uniqueIndex" json:"entry_id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type EntryPresence struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	EntryID    uint      `gorm:"uniqueIndex:idx_entry_presence_user" json:"entry_id"`
+	UserID     uint      `gorm:"uniqueIndex:idx_entry_presence_user" json:"user_id"`
+	User       *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	LastSeenAt time.Time `gorm:"index" json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
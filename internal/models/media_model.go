@@ -9,6 +9,7 @@ import (
 
 type MediaFile struct {
 	ID         uint           `gorm:"primaryKey" json:"id"`
+	SpaceID    uint           `gorm:"not null;default:1;index" json:"space_id"`
 	FileName   string         `gorm:"size:255" json:"file_name"`
 	URL        string         `gorm:"size:500" json:"url"`
 	Type       string         `gorm:"size:100;index" json:"type"`
@@ -28,8 +29,9 @@ type MediaFile struct {
 
 type MediaFolder struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
+	SpaceID   uint           `gorm:"not null;default:1;uniqueIndex:idx_media_folder_space_path" json:"space_id"`
 	Name      string         `gorm:"size:100" json:"name"`
-	Path      string         `gorm:"size:255;uniqueIndex" json:"path"`
+	Path      string         `gorm:"size:255;uniqueIndex:idx_media_folder_space_path" json:"path"`
 	ParentID  *uint          `json:"parent_id,omitempty"`
 	Parent    *MediaFolder   `gorm:"foreignKey:ParentID" json:"parent,omitempty"`
 	CreatedBy uint           `json:"created_by"`
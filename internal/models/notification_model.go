@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Notification is one item in a user's inbox. It is unread while ReadAt is
+// empty.
+type Notification struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"index:idx_notification_user_read" json:"user_id"`
+	Type      string         `gorm:"size:50;index" json:"type"`
+	Title     string         `gorm:"size:255" json:"title"`
+	Body      string         `gorm:"type:text" json:"body,omitempty"`
+	EntryID   *uint          `gorm:"index" json:"entry_id,omitempty"`
+	ActorID   *uint          `json:"actor_id,omitempty"`
+	Actor     *User          `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+	Data      datatypes.JSON `json:"data,omitempty"`
+	ReadAt    *time.Time     `gorm:"index:idx_notification_user_read" json:"read_at,omitempty"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
+}
+
+// NotificationPreference overrides whether a user gets one type of
+// notification in the app and by email. Types without a row use the defaults.
+type NotificationPreference struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_notification_pref_user_type" json:"user_id"`
+	Type      string    `gorm:"size:50;uniqueIndex:idx_notification_pref_user_type" json:"type"`
+	InApp     bool      `json:"in_app"`
+	Email     bool      `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ReleaseDraft      = "draft"
+	ReleaseScheduled  = "scheduled"
+	ReleaseRunning    = "running"
+	ReleaseReleased   = "released"
+	ReleaseFailed     = "failed"
+	ReleaseRolledBack = "rolled_back"
+)
+
+const (
+	ReleaseActionPublish   = "publish"
+	ReleaseActionUnpublish = "unpublish"
+)
+
+// Release groups entry transitions that must go live together.
+type Release struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	SpaceID       uint           `gorm:"not null;default:1;index" json:"space_id"`
+	Name          string         `gorm:"size:200" json:"name"`
+	Description   string         `gorm:"type:text" json:"description"`
+	Status        string         `gorm:"size:20;default:'draft';index" json:"status"`
+	ScheduledAt   *time.Time     `gorm:"index" json:"scheduled_at,omitempty"`
+	ScheduledBy   *uint          `json:"scheduled_by,omitempty"`
+	ReleasedAt    *time.Time     `json:"released_at,omitempty"`
+	ReleasedBy    *uint          `json:"released_by,omitempty"`
+	RolledBackAt  *time.Time     `json:"rolled_back_at,omitempty"`
+	FailureReason string         `gorm:"type:text" json:"failure_reason,omitempty"`
+	CreatedBy     uint           `json:"created_by"`
+	Creator       *User          `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	Items         []ReleaseItem  `gorm:"foreignKey:ReleaseID" json:"items,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// ReleaseItem is one entry in a release. PreviousStatus and ResultVersion are
+// filled in when the release runs so it can be rolled back.
+type ReleaseItem struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	ReleaseID      uint           `gorm:"uniqueIndex:idx_release_entry" json:"release_id"`
+	EntryID        uint           `gorm:"uniqueIndex:idx_release_entry;index" json:"entry_id"`
+	Entry          *ContentEntry  `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
+	Action         string         `gorm:"size:20" json:"action"` // publish, unpublish
+	PreviousStatus WorkflowStatus `gorm:"size:50" json:"previous_status,omitempty"`
+	ResultVersion  uint           `json:"result_version,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
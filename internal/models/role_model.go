@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/datatypes"
@@ -9,7 +10,8 @@ import (
 
 type Role struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"size:100;uniqueIndex" json:"name"`
+	SpaceID     uint           `gorm:"not null;default:1;uniqueIndex:idx_role_space_name" json:"space_id"`
+	Name        string         `gorm:"size:100;uniqueIndex:idx_role_space_name" json:"name"`
 	Description string         `json:"description"`
 	Permissions []Permission   `gorm:"foreignKey:RoleID" json:"permissions"`
 	CreatedAt   time.Time      `json:"created_at"`
@@ -30,3 +32,24 @@ type Permission struct {
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
+
+// AppliesToContentType reports whether the permission covers the content
+// type. Permissions without ContentTypeIDs cover every content type.
+func (p Permission) AppliesToContentType(contentTypeID uint) bool {
+	if p.ContentTypeIDs == nil {
+		return true
+	}
+
+	var contentTypeIDs []uint
+	json.Unmarshal(p.ContentTypeIDs, &contentTypeIDs)
+	if len(contentTypeIDs) == 0 {
+		return true
+	}
+
+	for _, id := range contentTypeIDs {
+		if id == contentTypeID {
+			return true
+		}
+	}
+	return false
+}
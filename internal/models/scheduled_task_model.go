@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	TaskSucceeded = "succeeded"
+	TaskFailed    = "failed"
+)
+
+// ScheduledTask holds the shared state of a named cron task. Every instance
+// registers the same tasks; the row's lease decides which one runs each tick.
+type ScheduledTask struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Name           string     `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Schedule       string     `gorm:"size:100" json:"schedule"`
+	NextRunAt      time.Time  `json:"next_run_at"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastStatus     string     `gorm:"size:20" json:"last_status,omitempty"`
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	LastRunBy      string     `gorm:"size:100" json:"last_run_by,omitempty"`
+	LockedBy       string     `gorm:"size:100" json:"locked_by,omitempty"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultSpaceID is the space requests use when they don't pick one, and the
+// space data created before spaces existed belongs to.
+const DefaultSpaceID uint = 1
+
+// Space is a tenant. Content types, entries, media, roles and workflows each
+// belong to one space and are only visible from within it.
+type Space struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"size:100" json:"name"`
+	Slug        string         `gorm:"size:100;uniqueIndex" json:"slug"`
+	Description string         `gorm:"type:text" json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// SpaceMembership gives a user a role within a space. In that space it takes
+// the place of the role on the user's account.
+type SpaceMembership struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SpaceID   uint      `gorm:"uniqueIndex:idx_space_membership_user" json:"space_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_space_membership_user;index" json:"user_id"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	RoleID    uint      `json:"role_id"`
+	Role      *Role     `gorm:"foreignKey:RoleID" json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
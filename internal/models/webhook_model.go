@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+)
+
+// Webhook subscribes an external URL to the events of its space. An empty
+// ContentTypeID receives events for every content type.
+type Webhook struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	SpaceID       uint           `gorm:"not null;default:1;index" json:"space_id"`
+	Name          string         `gorm:"size:200" json:"name"`
+	URL           string         `gorm:"size:1000;not null" json:"url"`
+	Secret        string         `gorm:"size:128" json:"secret,omitempty"`
+	Events        datatypes.JSON `json:"events"` // event names, "*" for all
+	ContentTypeID *uint          `gorm:"index" json:"content_type_id,omitempty"`
+	Active        bool           `gorm:"index" json:"active"`
+	CreatedBy     uint           `json:"created_by"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// WebhookDelivery is one event sent to one webhook, with the outcome of its
+// latest attempt.
+type WebhookDelivery struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	WebhookID     uint           `gorm:"index" json:"webhook_id"`
+	Webhook       *Webhook       `gorm:"foreignKey:WebhookID" json:"webhook,omitempty"`
+	Event         string         `gorm:"size:100;index" json:"event"`
+	Payload       datatypes.JSON `json:"payload"`
+	Status        string         `gorm:"size:20;default:'pending';index" json:"status"`
+	Attempts      int            `gorm:"default:0" json:"attempts"`
+	LastAttemptAt *time.Time     `json:"last_attempt_at,omitempty"`
+	ResponseCode  int            `json:"response_code,omitempty"`
+	ResponseBody  string         `gorm:"type:text" json:"response_body,omitempty"`
+	Error         string         `gorm:"type:text" json:"error,omitempty"`
+	DurationMs    int64          `json:"duration_ms,omitempty"`
+	DeliveredAt   *time.Time     `json:"delivered_at,omitempty"`
+	RedeliveryOf  *uint          `json:"redelivery_of,omitempty"`
+	JobID         *uint          `gorm:"index" json:"job_id,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
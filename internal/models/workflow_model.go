@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -15,10 +16,30 @@ const (
 	StatusApproved         WorkflowStatus = "approved"
 	StatusPublished        WorkflowStatus = "published"
 	StatusRejected         WorkflowStatus = "rejected"
+	StatusArchived         WorkflowStatus = "archived"
 )
 
+var WorkflowStatuses = []WorkflowStatus{
+	StatusDraft,
+	StatusInReview,
+	StatusReadyForApproval,
+	StatusApproved,
+	StatusPublished,
+	StatusRejected,
+	StatusArchived,
+}
+
+func (s WorkflowStatus) IsValid() bool {
+	for _, status := range WorkflowStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
 func EnsureEnum(db *gorm.DB) error {
-	return db.Exec(`
+	if err := db.Exec(`
 		DO $$
 		BEGIN
 			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'workflow_status') THEN
@@ -28,62 +49,152 @@ func EnsureEnum(db *gorm.DB) error {
 					'ready_for_approval',
 					'approved',
 					'published',
-					'rejected'
+					'rejected',
+					'archived'
 				);
 			END IF;
 		END
 		$$;
-	`).Error
+	`).Error; err != nil {
+		return err
+	}
+
+	// Databases created before archiving existed need the value added in place.
+	return db.Exec(`ALTER TYPE workflow_status ADD VALUE IF NOT EXISTS 'archived'`).Error
+}
+
+type WorkflowDefinition struct {
+	ID          uint                 `gorm:"primaryKey" json:"id"`
+	SpaceID     uint                 `gorm:"not null;default:1;uniqueIndex:idx_workflow_space_name" json:"space_id"`
+	Name        string               `gorm:"size:100;uniqueIndex:idx_workflow_space_name" json:"name"`
+	Description string               `gorm:"type:text" json:"description"`
+	States      datatypes.JSON       `json:"states"` // ["draft", "in_review", "published"]
+	IsDefault   bool                 `gorm:"default:false" json:"is_default"`
+	Transitions []WorkflowTransition `gorm:"foreignKey:WorkflowID" json:"transitions"`
+	Stages      []ApprovalStage      `gorm:"foreignKey:WorkflowID" json:"stages"`
+	Guards      []TransitionGuard    `gorm:"foreignKey:WorkflowID" json:"guards"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt       `gorm:"index" json:"-"`
 }
 
 type WorkflowTransition struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	FromStatus   WorkflowStatus `gorm:"type:workflow_status" json:"from_status"`
-	ToStatus     WorkflowStatus `gorm:"type:workflow_status" json:"to_status"`
-	RequiredRole string         `gorm:"size:50" json:"required_role"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	WorkflowID         *uint          `gorm:"index" json:"workflow_id,omitempty"`
+	FromStatus         WorkflowStatus `gorm:"type:workflow_status" json:"from_status"`
+	ToStatus           WorkflowStatus `gorm:"type:workflow_status" json:"to_status"`
+	RequiredRole       string         `gorm:"size:50" json:"required_role,omitempty"`        // legacy; prefer RequiredPermission
+	RequiredPermission string         `gorm:"size:100" json:"required_permission,omitempty"` // "ContentEntry:approve"
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
-type WorkflowHistory struct {
+// ApprovalStage gates a transition until enough distinct users approve it.
+// Stages for the same transition are completed in Position order.
+type ApprovalStage struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	WorkflowID    uint           `gorm:"index" json:"workflow_id"`
+	FromStatus    WorkflowStatus `gorm:"type:workflow_status" json:"from_status"`
+	ToStatus      WorkflowStatus `gorm:"type:workflow_status" json:"to_status"`
+	Name          string         `gorm:"size:100" json:"name"`
+	Position      int            `json:"position"`
+	MinApprovals  int            `gorm:"default:1" json:"min_approvals"`
+	RequiredRoles datatypes.JSON `json:"required_roles,omitempty"` // ["legal", "brand"] - one approver from each
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TransitionGuard is a check that must pass before an entry may enter
+// ToStatus. An empty FromStatus applies the guard regardless of origin.
+type TransitionGuard struct {
 	ID         uint           `gorm:"primaryKey" json:"id"`
-	EntryID    uint           `json:"entry_id"`
-	Entry      *ContentEntry  `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
-	FromStatus WorkflowStatus `gorm:"type:workflow_status" json:"from_status"`
+	WorkflowID uint           `gorm:"index" json:"workflow_id"`
+	FromStatus string         `gorm:"size:50" json:"from_status,omitempty"`
 	ToStatus   WorkflowStatus `gorm:"type:workflow_status" json:"to_status"`
-	ChangedBy  uint           `json:"changed_by"`
-	User       *User          `gorm:"foreignKey:ChangedBy" json:"user,omitempty"`
-	Comment    string         `gorm:"type:text" json:"comment"`
+	Type       string         `gorm:"size:50" json:"type"`            // schema, required_fields, seo_fields, media_exists, relations_published, threads_resolved, custom
+	Fields     datatypes.JSON `json:"fields,omitempty"`               // required_fields: ["meta_title", "summary"]
+	Name       string         `gorm:"size:100" json:"name,omitempty"` // custom: name passed to workflow.RegisterGuard
 	CreatedAt  time.Time      `json:"created_at"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// WorkflowHistory also records approval stage votes; those rows carry a
+// StageID and Decision, leave the status unchanged and only count while the
+// entry is still at EntryVersion.
+type WorkflowHistory struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	EntryID      uint           `json:"entry_id"`
+	Entry        *ContentEntry  `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
+	FromStatus   WorkflowStatus `gorm:"type:workflow_status" json:"from_status"`
+	ToStatus     WorkflowStatus `gorm:"type:workflow_status" json:"to_status"`
+	ChangedBy    uint           `json:"changed_by"`
+	User         *User          `gorm:"foreignKey:ChangedBy" json:"user,omitempty"`
+	Comment      string         `gorm:"type:text" json:"comment"`
+	StageID      *uint          `gorm:"index" json:"stage_id,omitempty"`
+	Stage        *ApprovalStage `gorm:"foreignKey:StageID" json:"stage,omitempty"`
+	Decision     string         `gorm:"size:20" json:"decision,omitempty"` // "approved", "rejected"
+	EntryVersion uint           `json:"entry_version,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// WorkflowComment is either the root of a review thread or, with ParentID
+// set, a reply to one. The field anchor and resolved state live on the root.
 type WorkflowComment struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	EntryID   uint           `json:"entry_id"`
-	Entry     *ContentEntry  `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
-	UserID    uint           `json:"user_id"`
-	User      *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Comment   string         `gorm:"type:text" json:"comment"`
-	IsPrivate bool           `json:"is_private"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID         uint              `gorm:"primaryKey" json:"id"`
+	SpaceID    uint              `gorm:"not null;default:1;index" json:"space_id"`
+	EntryID    uint              `gorm:"index" json:"entry_id"`
+	Entry      *ContentEntry     `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
+	UserID     uint              `json:"user_id"`
+	User       *User             `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	ParentID   *uint             `gorm:"index" json:"parent_id,omitempty"`
+	Replies    []WorkflowComment `gorm:"foreignKey:ParentID" json:"replies,omitempty"`
+	Comment    string            `gorm:"type:text" json:"comment"`
+	IsPrivate  bool              `json:"is_private"`
+	FieldName  string            `gorm:"size:100;index" json:"field_name,omitempty"`
+	RangeStart *int              `json:"range_start,omitempty"`
+	RangeEnd   *int              `json:"range_end,omitempty"`
+	Resolved   bool              `gorm:"default:false;index" json:"resolved"`
+	ResolvedBy *uint             `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+	Mentions   []CommentMention  `gorm:"foreignKey:CommentID" json:"mentions,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt    `gorm:"index" json:"-"`
+}
+
+type CommentMention struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	CommentID uint             `gorm:"uniqueIndex:idx_comment_mention_user" json:"comment_id"`
+	Comment   *WorkflowComment `gorm:"foreignKey:CommentID" json:"comment,omitempty"`
+	UserID    uint             `gorm:"uniqueIndex:idx_comment_mention_user;index" json:"user_id"`
+	User      *User            `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
 }
 
+// WorkflowAssignment gives an entry to a user, or to every user of
+// AssignedRole until one of them claims it.
 type WorkflowAssignment struct {
-	ID         uint           `gorm:"primaryKey" json:"id"`
-	EntryID    uint           `json:"entry_id"`
-	Entry      *ContentEntry  `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
-	AssignedTo uint           `json:"assigned_to"`
-	User       *User          `gorm:"foreignKey:AssignedTo" json:"user,omitempty"`
-	AssignedBy uint           `json:"assigned_by"`
-	Assigner   *User          `gorm:"foreignKey:AssignedBy" json:"assigner,omitempty"`
-	Status     string         `gorm:"size:50;default:'pending'" json:"status"`
-	DueDate    *time.Time     `json:"due_date,omitempty"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	SpaceID        uint           `gorm:"not null;default:1;index" json:"space_id"`
+	EntryID        uint           `json:"entry_id"`
+	Entry          *ContentEntry  `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
+	AssignedTo     *uint          `gorm:"index" json:"assigned_to"`
+	User           *User          `gorm:"foreignKey:AssignedTo" json:"user,omitempty"`
+	AssignedRole   string         `gorm:"size:50;index" json:"assigned_role,omitempty"`
+	AssignedBy     uint           `json:"assigned_by"`
+	Assigner       *User          `gorm:"foreignKey:AssignedBy" json:"assigner,omitempty"`
+	Status         string         `gorm:"size:50;default:'pending'" json:"status"` // pending, completed, declined
+	DueDate        *time.Time     `gorm:"index" json:"due_date,omitempty"`
+	DeclineReason  string         `gorm:"type:text" json:"decline_reason,omitempty"`
+	ReminderSentAt *time.Time     `json:"reminder_sent_at,omitempty"`
+	OverdueAt      *time.Time     `json:"overdue_at,omitempty"`
+	EscalatedAt    *time.Time     `json:"escalated_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
@@ -0,0 +1,144 @@
+package notification
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+var assignmentTitles = map[string]string{
+	"assigned":  "Entry #%d was assigned to you",
+	"reminder":  "Entry #%d is due soon",
+	"overdue":   "Entry #%d is overdue",
+	"escalated": "Assignment on entry #%d was escalated",
+	"declined":  "Assignment on entry #%d was declined",
+}
+
+var statusTypes = map[models.WorkflowStatus]string{
+	models.StatusApproved:  TypeEntryApproved,
+	models.StatusRejected:  TypeEntryRejected,
+	models.StatusPublished: TypeEntryPublished,
+}
+
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func send(userID uint, msg Message) {
+	if _, err := Notify(userID, msg); err != nil {
+		log.Printf("⚠️  Failed to notify user %d of %s: %v", userID, msg.Type, err)
+	}
+}
+
+func onAssignment(e events.AssignmentNotified) {
+	title, ok := assignmentTitles[e.Event]
+	if !ok {
+		return
+	}
+
+	// Reminders and escalations come from the monitor, not from a user.
+	var actor *uint
+	switch e.Event {
+	case "assigned":
+		actor = optionalID(e.Assignment.AssignedBy)
+	case "declined":
+		if e.Assignment.AssignedTo != nil {
+			actor = optionalID(*e.Assignment.AssignedTo)
+		}
+	}
+
+	entryID := e.Assignment.EntryID
+	send(e.Recipient.ID, Message{
+		Type:    "assignment." + e.Event,
+		Title:   fmt.Sprintf(title, entryID),
+		Body:    e.Assignment.DeclineReason,
+		EntryID: &entryID,
+		ActorID: actor,
+		Data: map[string]interface{}{
+			"assignment_id": e.Assignment.ID,
+			"due_date":      e.Assignment.DueDate,
+		},
+	})
+}
+
+// onStatusChange tells the entry's author when it is approved, rejected or
+// published.
+func onStatusChange(e events.StatusChanged) {
+	notificationType, ok := statusTypes[e.To]
+	if !ok || e.Entry.CreatedBy == 0 || !e.Entry.InMainEnvironment() {
+		return
+	}
+
+	entryID := e.Entry.ID
+	send(e.Entry.CreatedBy, Message{
+		Type:    notificationType,
+		Title:   fmt.Sprintf("Entry #%d was %s", entryID, e.To),
+		Body:    e.Comment,
+		EntryID: &entryID,
+		ActorID: optionalID(e.UserID),
+		Data: map[string]interface{}{
+			"from_status": e.From,
+			"to_status":   e.To,
+			"version":     e.Entry.Version,
+		},
+	})
+}
+
+// onComment tells mentioned users, the author of the thread being replied to
+// and the entry's author, each at most once and by the most specific type.
+func onComment(e events.CommentAdded) {
+	comment := e.Comment
+	entryID := comment.EntryID
+	notified := map[uint]bool{}
+
+	notify := func(userID uint, notificationType, title string) {
+		if userID == 0 || notified[userID] {
+			return
+		}
+		notified[userID] = true
+		send(userID, Message{
+			Type:    notificationType,
+			Title:   title,
+			Body:    comment.Comment,
+			EntryID: &entryID,
+			ActorID: optionalID(comment.UserID),
+			Data: map[string]interface{}{
+				"comment_id": comment.ID,
+				"parent_id":  comment.ParentID,
+				"field_name": comment.FieldName,
+			},
+		})
+	}
+
+	for _, user := range e.Mentioned {
+		notify(user.ID, TypeCommentMention, fmt.Sprintf("You were mentioned on entry #%d", entryID))
+	}
+
+	if comment.ParentID != nil {
+		var root models.WorkflowComment
+		if err := database.DB.First(&root, *comment.ParentID).Error; err == nil {
+			notify(root.UserID, TypeCommentReply, fmt.Sprintf("New reply to your comment on entry #%d", entryID))
+		}
+	}
+
+	notify(e.Entry.CreatedBy, TypeCommentAdded, fmt.Sprintf("New comment on entry #%d", entryID))
+}
+
+var subscribeOnce sync.Once
+
+// Subscribe turns workflow events into notifications. It is safe to call
+// more than once.
+func Subscribe() {
+	subscribeOnce.Do(func() {
+		events.After(onAssignment)
+		events.After(onStatusChange)
+		events.After(onComment)
+	})
+}
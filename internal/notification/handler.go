@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"errors"
+
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func ListNotificationsHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	notifications, total, err := ListNotifications(userID, c.QueryBool("unread"), page, limit)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch notifications")
+	}
+
+	meta := response.CalculateMeta(page, limit, total)
+	return response.SuccessWithMeta(c, notifications, meta, "Notifications retrieved successfully")
+}
+
+func UnreadCountHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	count, err := UnreadCount(userID)
+	if err != nil {
+		return response.InternalError(c, "Failed to count notifications")
+	}
+
+	return response.Success(c, fiber.Map{"unread": count}, "Unread count retrieved successfully")
+}
+
+func MarkReadHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid notification ID", nil)
+	}
+
+	notification, err := MarkRead(userID, uint(id))
+	if err != nil {
+		if errors.Is(err, ErrNotificationNotFound) {
+			return response.NotFound(c, "Notification")
+		}
+		return response.InternalError(c, "Failed to mark notification read")
+	}
+
+	return response.Success(c, notification, "Notification marked read")
+}
+
+func MarkAllReadHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	updated, err := MarkAllRead(userID)
+	if err != nil {
+		return response.InternalError(c, "Failed to mark notifications read")
+	}
+
+	return response.Success(c, fiber.Map{"updated": updated}, "All notifications marked read")
+}
+
+func GetPreferencesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	prefs, err := GetPreferences(userID)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch notification preferences")
+	}
+
+	return response.Success(c, prefs, "Notification preferences retrieved successfully")
+}
+
+func UpdatePreferencesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var body struct {
+		Preferences []Preference `json:"preferences"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	prefs, err := UpdatePreferences(userID, body.Preferences)
+	if err != nil {
+		if errors.Is(err, ErrUnknownType) {
+			return response.ValidationError(c, map[string]string{"type": err.Error()})
+		}
+		return response.InternalError(c, "Failed to update notification preferences")
+	}
+
+	return response.Success(c, prefs, "Notification preferences updated successfully")
+}
@@ -0,0 +1,160 @@
+package notification_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/notification"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/Kyz7/cms/internal/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationInbox(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_inbox@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	manager := testutils.CreateTestUser(t, database.DB, "manager_inbox@test.com", "password", "manager")
+	managerToken := testutils.GetAuthToken(t, manager.ID, manager.Role.Name)
+
+	viewer := testutils.CreateTestUser(t, database.DB, "viewer_inbox@test.com", "password", "viewer")
+
+	var emailed []models.Notification
+	notification.SetEmailSender(func(user *models.User, n *models.Notification) error {
+		emailed = append(emailed, *n)
+		return nil
+	})
+	defer notification.SetEmailSender(func(*models.User, *models.Notification) error { return nil })
+
+	ct := &models.ContentType{Name: "Article", Slug: "article"}
+	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "title", Type: "string"})
+
+	entry, err := content.CreateContentEntry(context.Background(), ct.ID, editor.ID, map[string]interface{}{"title": "Draft"})
+	assert.NoError(t, err)
+
+	t.Run("Success - Update preferences", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "PUT", "/notifications/preferences", map[string]interface{}{
+			"preferences": []map[string]interface{}{
+				{"type": notification.TypeEntryRejected, "in_app": true, "email": true},
+				{"type": notification.TypeCommentAdded, "in_app": false, "email": false},
+			},
+		}, editorToken)
+		assert.Equal(t, 200, resp.Code)
+
+		var result struct {
+			Data []notification.Preference `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		assert.Len(t, result.Data, len(notification.Types))
+		for _, pref := range result.Data {
+			switch pref.Type {
+			case notification.TypeEntryRejected:
+				assert.True(t, pref.InApp)
+				assert.True(t, pref.Email)
+			case notification.TypeCommentAdded:
+				assert.False(t, pref.InApp)
+			default:
+				assert.True(t, pref.InApp)
+				assert.False(t, pref.Email)
+			}
+		}
+
+		resp, _ = testutils.MakeRequest(app, "PUT", "/notifications/preferences", map[string]interface{}{
+			"preferences": []map[string]interface{}{{"type": "entry.liked", "in_app": true}},
+		}, editorToken)
+		assert.Equal(t, 422, resp.Code)
+	})
+
+	t.Run("Success - Workflow events notify the right users", func(t *testing.T) {
+		_, err := workflow.AssignEntry(context.Background(), entry.ID, &editor.ID, "", manager.ID, nil)
+		assert.NoError(t, err)
+
+		_, err = workflow.AddWorkflowComment(context.Background(), entry.ID, manager.ID, workflow.CommentInput{
+			Comment: "@viewer_inbox@test.com please double check the title",
+		})
+		assert.NoError(t, err)
+
+		reviewed, err := workflow.RequestReview(context.Background(), entry.ID, editor.ID, "", entry.Version)
+		assert.NoError(t, err)
+		ready, err := workflow.ChangeWorkflowStatus(context.Background(), entry.ID, editor.ID, string(models.StatusReadyForApproval), "", reviewed.Version)
+		assert.NoError(t, err)
+		_, err = workflow.RejectEntry(context.Background(), entry.ID, manager.ID, "Needs a better title", ready.Version)
+		assert.NoError(t, err)
+
+		var editorTypes []string
+		database.DB.Model(&models.Notification{}).Where("user_id = ?", editor.ID).Order("id").Pluck("type", &editorTypes)
+		assert.Equal(t, []string{notification.TypeAssignmentAssigned, notification.TypeEntryRejected}, editorTypes,
+			"comment.added is turned off and own actions are skipped")
+
+		var viewerTypes []string
+		database.DB.Model(&models.Notification{}).Where("user_id = ?", viewer.ID).Pluck("type", &viewerTypes)
+		assert.Equal(t, []string{notification.TypeCommentMention}, viewerTypes)
+
+		if assert.Len(t, emailed, 1) {
+			assert.Equal(t, notification.TypeEntryRejected, emailed[0].Type)
+			assert.Equal(t, "Needs a better title", emailed[0].Body)
+		}
+
+		copied := *entry
+		copied.EnvironmentID = 3
+		events.Publish(events.StatusChanged{Entry: copied, From: models.StatusReadyForApproval, To: models.StatusRejected, UserID: manager.ID})
+		var count int64
+		database.DB.Model(&models.Notification{}).Where("user_id = ?", editor.ID).Count(&count)
+		assert.Equal(t, int64(2), count, "changes in other environments notify no one")
+	})
+
+	t.Run("Success - List, count and mark read", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "GET", "/notifications/unread-count", nil, editorToken)
+		assert.Equal(t, 200, resp.Code)
+		var count struct {
+			Data struct {
+				Unread int64 `json:"unread"`
+			} `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &count)
+		assert.Equal(t, int64(2), count.Data.Unread)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/notifications?unread=true", nil, editorToken)
+		assert.Equal(t, 200, resp.Code)
+		var list struct {
+			Data []models.Notification `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &list)
+		if !assert.Len(t, list.Data, 2) {
+			return
+		}
+		assert.Equal(t, notification.TypeEntryRejected, list.Data[0].Type, "newest first")
+		if assert.NotNil(t, list.Data[0].Actor) {
+			assert.Equal(t, manager.ID, list.Data[0].Actor.ID)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "POST", fmt.Sprintf("/notifications/%d/read", list.Data[0].ID), nil, managerToken)
+		assert.Equal(t, 404, resp.Code, "cannot read someone else's notification")
+
+		resp, _ = testutils.MakeRequest(app, "POST", fmt.Sprintf("/notifications/%d/read", list.Data[0].ID), nil, editorToken)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/notifications/unread-count", nil, editorToken)
+		testutils.ParseResponse(t, resp, &count)
+		assert.Equal(t, int64(1), count.Data.Unread)
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/notifications/read-all", nil, editorToken)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/notifications/unread-count", nil, editorToken)
+		testutils.ParseResponse(t, resp, &count)
+		assert.Equal(t, int64(0), count.Data.Unread)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/notifications", nil, editorToken)
+		testutils.ParseResponse(t, resp, &list)
+		assert.Len(t, list.Data, 2, "read notifications stay in the inbox")
+	})
+}
@@ -0,0 +1,274 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/mail"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TypeAssignmentAssigned  = "assignment.assigned"
+	TypeAssignmentReminder  = "assignment.reminder"
+	TypeAssignmentOverdue   = "assignment.overdue"
+	TypeAssignmentEscalated = "assignment.escalated"
+	TypeAssignmentDeclined  = "assignment.declined"
+	TypeEntryApproved       = "entry.approved"
+	TypeEntryRejected       = "entry.rejected"
+	TypeEntryPublished      = "entry.published"
+	TypeCommentAdded        = "comment.added"
+	TypeCommentReply        = "comment.reply"
+	TypeCommentMention      = "comment.mention"
+)
+
+// Types lists every notification type a user can set preferences for.
+var Types = []string{
+	TypeAssignmentAssigned,
+	TypeAssignmentReminder,
+	TypeAssignmentOverdue,
+	TypeAssignmentEscalated,
+	TypeAssignmentDeclined,
+	TypeEntryApproved,
+	TypeEntryRejected,
+	TypeEntryPublished,
+	TypeCommentAdded,
+	TypeCommentReply,
+	TypeCommentMention,
+}
+
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrUnknownType          = errors.New("unknown notification type")
+)
+
+// Preference is the effective setting for one type.
+type Preference struct {
+	Type  string `json:"type"`
+	InApp bool   `json:"in_app"`
+	Email bool   `json:"email"`
+}
+
+// defaultPreference applies to types the user has not configured: shown in
+// the app, not emailed.
+func defaultPreference(notificationType string) Preference {
+	return Preference{Type: notificationType, InApp: true}
+}
+
+func knownType(notificationType string) bool {
+	for _, t := range Types {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailSender emails a notification to its recipient.
+type EmailSender func(user *models.User, notification *models.Notification) error
+
+var emailSender EmailSender = sendEmail
+
+// SetEmailSender replaces how notification emails are sent. The default
+// renders the notification template and sends it through the mail package.
+func SetEmailSender(fn EmailSender) {
+	emailSender = fn
+}
+
+func sendEmail(user *models.User, notification *models.Notification) error {
+	return mail.Send(user.Email, mail.TemplateNotification, map[string]interface{}{
+		"Name":  user.Name,
+		"Title": notification.Title,
+		"Body":  notification.Body,
+		"URL":   mail.Link("notifications"),
+	})
+}
+
+// Message is a notification before it is addressed to a user.
+type Message struct {
+	Type    string
+	Title   string
+	Body    string
+	EntryID *uint
+	ActorID *uint
+	Data    map[string]interface{}
+}
+
+// Notify delivers msg to userID according to their preferences. Users are
+// never notified of their own actions.
+func Notify(userID uint, msg Message) (*models.Notification, error) {
+	if msg.ActorID != nil && *msg.ActorID == userID {
+		return nil, nil
+	}
+
+	pref, err := preferenceFor(userID, msg.Type)
+	if err != nil {
+		return nil, err
+	}
+	if !pref.InApp && !pref.Email {
+		return nil, nil
+	}
+
+	notification := models.Notification{
+		UserID:  userID,
+		Type:    msg.Type,
+		Title:   msg.Title,
+		Body:    msg.Body,
+		EntryID: msg.EntryID,
+		ActorID: msg.ActorID,
+	}
+	if msg.Data != nil {
+		data, _ := json.Marshal(msg.Data)
+		notification.Data = datatypes.JSON(data)
+	}
+
+	if pref.InApp {
+		if err := database.DB.Create(&notification).Error; err != nil {
+			return nil, err
+		}
+		events.Publish(events.NotificationCreated{Notification: notification})
+	}
+
+	if pref.Email {
+		var user models.User
+		if err := database.DB.First(&user, userID).Error; err == nil {
+			if err := emailSender(&user, &notification); err != nil {
+				log.Printf("⚠️  Failed to email notification to user %d: %v", userID, err)
+			}
+		}
+	}
+
+	return &notification, nil
+}
+
+func preferenceFor(userID uint, notificationType string) (Preference, error) {
+	var stored models.NotificationPreference
+	err := database.DB.Where("user_id = ? AND type = ?", userID, notificationType).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultPreference(notificationType), nil
+	}
+	if err != nil {
+		return Preference{}, err
+	}
+	return Preference{Type: stored.Type, InApp: stored.InApp, Email: stored.Email}, nil
+}
+
+// GetPreferences returns the effective setting for every type.
+func GetPreferences(userID uint) ([]Preference, error) {
+	var stored []models.NotificationPreference
+	if err := database.DB.Where("user_id = ?", userID).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string]models.NotificationPreference, len(stored))
+	for _, p := range stored {
+		byType[p.Type] = p
+	}
+
+	prefs := make([]Preference, 0, len(Types))
+	for _, t := range Types {
+		pref := defaultPreference(t)
+		if p, ok := byType[t]; ok {
+			pref.InApp = p.InApp
+			pref.Email = p.Email
+		}
+		prefs = append(prefs, pref)
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences stores the given settings; types not listed keep theirs.
+func UpdatePreferences(userID uint, prefs []Preference) ([]Preference, error) {
+	for _, p := range prefs {
+		if !knownType(p.Type) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownType, p.Type)
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, p := range prefs {
+			stored := models.NotificationPreference{
+				UserID: userID,
+				Type:   p.Type,
+				InApp:  p.InApp,
+				Email:  p.Email,
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+				DoUpdates: clause.AssignmentColumns([]string{"in_app", "email", "updated_at"}),
+			}).Create(&stored).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetPreferences(userID)
+}
+
+func ListNotifications(userID uint, unreadOnly bool, page, limit int) ([]models.Notification, int64, error) {
+	query := database.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []models.Notification
+	err := query.
+		Preload("Actor").
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, total, err
+}
+
+func UnreadCount(userID uint) (int64, error) {
+	var count int64
+	err := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkRead marks one of the user's notifications read. Marking it again keeps
+// the original read time.
+func MarkRead(userID, notificationID uint) (*models.Notification, error) {
+	var notification models.Notification
+	if err := database.DB.Where("user_id = ?", userID).First(&notification, notificationID).Error; err != nil {
+		return nil, ErrNotificationNotFound
+	}
+
+	if err := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND read_at IS NULL", notification.ID).
+		Update("read_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	database.DB.First(&notification, notification.ID)
+	return &notification, nil
+}
+
+// MarkAllRead marks every unread notification of the user read and returns
+// how many there were.
+func MarkAllRead(userID uint) (int64, error) {
+	result := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
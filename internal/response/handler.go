@@ -50,6 +50,14 @@ func Created(c *fiber.Ctx, data interface{}, message string) error {
 	})
 }
 
+func Accepted(c *fiber.Ctx, data interface{}, message string) error {
+	return c.Status(fiber.StatusAccepted).JSON(StandardResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
 func NoContent(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNoContent)
 }
@@ -85,6 +93,18 @@ func Conflict(c *fiber.Ctx, message string) error {
 	return Error(c, fiber.StatusConflict, "CONFLICT", message, nil)
 }
 
+func Locked(c *fiber.Ctx, message string, details interface{}) error {
+	return Error(c, fiber.StatusLocked, "LOCKED", message, details)
+}
+
+func PreconditionFailed(c *fiber.Ctx, message string, details interface{}) error {
+	return Error(c, fiber.StatusPreconditionFailed, "PRECONDITION_FAILED", message, details)
+}
+
+func PreconditionRequired(c *fiber.Ctx, message string) error {
+	return Error(c, fiber.StatusPreconditionRequired, "PRECONDITION_REQUIRED", message, nil)
+}
+
 func ValidationError(c *fiber.Ctx, errors interface{}) error {
 	return Error(c, fiber.StatusUnprocessableEntity, "VALIDATION_ERROR", "Validation failed", errors)
 }
@@ -3,14 +3,17 @@ package role
 import (
 	"encoding/json"
 
+	"github.com/Kyz7/cms/internal/audit"
 	"github.com/Kyz7/cms/internal/database"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
+	"github.com/Kyz7/cms/internal/space"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 func CreateRoleHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var body struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
@@ -35,12 +38,12 @@ func CreateRoleHandler(c *fiber.Ctx) error {
 	}
 
 	var existing models.Role
-	if err := database.DB.Where("name = ?", body.Name).First(&existing).Error; err == nil {
+	if err := database.DB.WithContext(ctx).Where("name = ?", body.Name).First(&existing).Error; err == nil {
 		return response.Conflict(c, "Role with this name already exists")
 	}
 
 	var role models.Role
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		role = models.Role{
 			Name:        body.Name,
 			Description: body.Description,
@@ -84,14 +87,16 @@ func CreateRoleHandler(c *fiber.Ctx) error {
 		return response.InternalError(c, "Failed to create role")
 	}
 
-	database.DB.Preload("Permissions").First(&role, role.ID)
+	database.DB.WithContext(ctx).Preload("Permissions").First(&role, role.ID)
+	audit.Record(c, "role.create", "role", role.ID, nil, role)
 
 	return response.Created(c, role, "Role created successfully")
 }
 
 func ListRolesHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var roles []models.Role
-	if err := database.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Permissions").Find(&roles).Error; err != nil {
 		return response.InternalError(c, "Failed to fetch roles")
 	}
 
@@ -99,13 +104,14 @@ func ListRolesHandler(c *fiber.Ctx) error {
 }
 
 func GetRoleHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid role ID", nil)
 	}
 
 	var role models.Role
-	if err := database.DB.Preload("Permissions").First(&role, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Permissions").First(&role, id).Error; err != nil {
 		return response.NotFound(c, "Role")
 	}
 
@@ -113,6 +119,7 @@ func GetRoleHandler(c *fiber.Ctx) error {
 }
 
 func UpdateRoleHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid role ID", nil)
@@ -136,11 +143,14 @@ func UpdateRoleHandler(c *fiber.Ctx) error {
 	}
 
 	var role models.Role
-	if err := database.DB.First(&role, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&role, id).Error; err != nil {
 		return response.NotFound(c, "Role")
 	}
 
-	err = database.DB.Transaction(func(tx *gorm.DB) error {
+	var before models.Role
+	database.DB.WithContext(ctx).Preload("Permissions").First(&before, id)
+
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		role.Name = body.Name
 		role.Description = body.Description
 		if err := tx.Save(&role).Error; err != nil {
@@ -186,24 +196,26 @@ func UpdateRoleHandler(c *fiber.Ctx) error {
 		return response.InternalError(c, "Failed to update role")
 	}
 
-	database.DB.Preload("Permissions").First(&role, role.ID)
+	database.DB.WithContext(ctx).Preload("Permissions").First(&role, role.ID)
+	audit.Record(c, "role.update", "role", role.ID, before, role)
 
 	return response.Success(c, role, "Role updated successfully")
 }
 
 func DeleteRoleHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid role ID", nil)
 	}
 
 	var role models.Role
-	if err := database.DB.First(&role, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Permissions").First(&role, id).Error; err != nil {
 		return response.NotFound(c, "Role")
 	}
 
 	var userCount int64
-	if err := database.DB.Model(&models.User{}).Where("role_id = ?", id).Count(&userCount).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Model(&models.User{}).Where("role_id = ?", id).Count(&userCount).Error; err != nil {
 		return response.InternalError(c, "Failed to check role usage")
 	}
 
@@ -211,18 +223,20 @@ func DeleteRoleHandler(c *fiber.Ctx) error {
 		return response.Conflict(c, "Cannot delete role that is assigned to users")
 	}
 
-	if err := database.DB.Where("role_id = ?", id).Delete(&models.Permission{}).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Where("role_id = ?", id).Delete(&models.Permission{}).Error; err != nil {
 		return response.InternalError(c, "Failed to delete role permissions")
 	}
 
-	if err := database.DB.Delete(&role).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Delete(&role).Error; err != nil {
 		return response.InternalError(c, "Failed to delete role")
 	}
+	audit.Record(c, "role.delete", "role", role.ID, role, nil)
 
 	return response.NoContent(c)
 }
 
 func AssignRoleToUserHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var body struct {
 		UserID uint `json:"user_id"`
 		RoleID uint `json:"role_id"`
@@ -239,27 +253,73 @@ func AssignRoleToUserHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	// Outside the default space the role goes on the user's membership, so
+	// their account role, which applies in the default space, is untouched.
+	spaceID, _ := database.SpaceFromContext(ctx)
+	if spaceID != 0 && spaceID != models.DefaultSpaceID {
+		return assignSpaceRole(c, spaceID, body.UserID, body.RoleID)
+	}
+
 	var role models.Role
-	if err := database.DB.First(&role, body.RoleID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&role, body.RoleID).Error; err != nil {
 		return response.NotFound(c, "Role")
 	}
 
 	var user models.User
-	if err := database.DB.First(&user, body.UserID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&user, body.UserID).Error; err != nil {
 		return response.NotFound(c, "User")
 	}
 
+	previousRoleID := user.RoleID
 	user.RoleID = body.RoleID
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Save(&user).Error; err != nil {
 		return response.InternalError(c, "Failed to assign role")
 	}
 
-	database.DB.Preload("Role.Permissions").First(&user, user.ID)
+	database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, user.ID)
+	audit.Record(c, "role.assign", "user", user.ID,
+		map[string]interface{}{"role_id": previousRoleID},
+		map[string]interface{}{"role_id": user.RoleID})
 
 	return response.Success(c, user, "Role assigned successfully")
 }
 
+// assignSpaceRole gives the user roleID in spaceID through their membership.
+// The role must belong to the space or to the default space.
+func assignSpaceRole(c *fiber.Ctx, spaceID, userID, roleID uint) error {
+	var role models.Role
+	if err := database.DB.First(&role, roleID).Error; err != nil {
+		return response.NotFound(c, "Role")
+	}
+	if role.SpaceID != spaceID && role.SpaceID != models.DefaultSpaceID {
+		return response.BadRequest(c, "Role belongs to another space", nil)
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return response.NotFound(c, "User")
+	}
+
+	var previousRoleID uint
+	var existing models.SpaceMembership
+	if database.DB.Where("space_id = ? AND user_id = ?", spaceID, userID).First(&existing).Error == nil {
+		previousRoleID = existing.RoleID
+	}
+
+	membership, err := space.SetMember(spaceID, userID, roleID)
+	if err != nil {
+		return response.InternalError(c, "Failed to assign role")
+	}
+
+	audit.Record(c, "role.assign", "space_membership", membership.ID,
+		map[string]interface{}{"space_id": spaceID, "user_id": userID, "role_id": previousRoleID},
+		map[string]interface{}{"space_id": spaceID, "user_id": userID, "role_id": roleID})
+
+	return response.Success(c, membership, "Role assigned successfully")
+}
+
 func DuplicateRoleHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid role ID", nil)
@@ -279,12 +339,12 @@ func DuplicateRoleHandler(c *fiber.Ctx) error {
 	}
 
 	var originalRole models.Role
-	if err := database.DB.Preload("Permissions").First(&originalRole, id).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Permissions").First(&originalRole, id).Error; err != nil {
 		return response.NotFound(c, "Role")
 	}
 
 	var newRole models.Role
-	err = database.DB.Transaction(func(tx *gorm.DB) error {
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		newRole = models.Role{
 			Name:        body.Name,
 			Description: originalRole.Description + " (Copy)",
@@ -312,7 +372,9 @@ func DuplicateRoleHandler(c *fiber.Ctx) error {
 		return response.InternalError(c, "Failed to duplicate role")
 	}
 
-	database.DB.Preload("Permissions").First(&newRole, newRole.ID)
+	database.DB.WithContext(ctx).Preload("Permissions").First(&newRole, newRole.ID)
+	audit.Record(c, "role.duplicate", "role", newRole.ID,
+		map[string]interface{}{"source_role_id": originalRole.ID}, newRole)
 
 	return response.Created(c, newRole, "Role duplicated successfully")
 }
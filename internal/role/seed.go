@@ -1,8 +1,11 @@
 package role
 
 import (
+	"encoding/json"
+
 	"github.com/Kyz7/cms/internal/database"
 	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -100,39 +103,89 @@ func SeedDefaultRoles() error {
 }
 
 func SeedWorkflowTransitions(db *gorm.DB) error {
+	// Transitions are granted by permission so custom roles can take part:
+	// ContentEntry:update to write and review, ContentEntry:approve to
+	// approve, publish and archive.
 	transitions := []models.WorkflowTransition{
 		// From Draft
-		{FromStatus: "draft", ToStatus: "in_review", RequiredRole: "editor"},
-		{FromStatus: "draft", ToStatus: "in_review", RequiredRole: "admin"},
+		{FromStatus: "draft", ToStatus: "in_review", RequiredPermission: "ContentEntry:update"},
 
 		// From In Review
-		{FromStatus: "in_review", ToStatus: "ready_for_approval", RequiredRole: "editor"},
-		{FromStatus: "in_review", ToStatus: "ready_for_approval", RequiredRole: "admin"},
-		{FromStatus: "in_review", ToStatus: "rejected", RequiredRole: "editor"},
-		{FromStatus: "in_review", ToStatus: "rejected", RequiredRole: "admin"},
-		{FromStatus: "in_review", ToStatus: "draft", RequiredRole: "editor"},
-		{FromStatus: "in_review", ToStatus: "draft", RequiredRole: "admin"},
+		{FromStatus: "in_review", ToStatus: "ready_for_approval", RequiredPermission: "ContentEntry:update"},
+		{FromStatus: "in_review", ToStatus: "rejected", RequiredPermission: "ContentEntry:update"},
+		{FromStatus: "in_review", ToStatus: "draft", RequiredPermission: "ContentEntry:update"},
 
 		// From Ready for Approval
-		{FromStatus: "ready_for_approval", ToStatus: "approved", RequiredRole: "manager"},
-		{FromStatus: "ready_for_approval", ToStatus: "approved", RequiredRole: "admin"},
-		{FromStatus: "ready_for_approval", ToStatus: "rejected", RequiredRole: "manager"},
-		{FromStatus: "ready_for_approval", ToStatus: "rejected", RequiredRole: "admin"},
+		{FromStatus: "ready_for_approval", ToStatus: "approved", RequiredPermission: "ContentEntry:approve"},
+		{FromStatus: "ready_for_approval", ToStatus: "rejected", RequiredPermission: "ContentEntry:approve"},
 
 		// From Approved
-		{FromStatus: "approved", ToStatus: "published", RequiredRole: "manager"},
-		{FromStatus: "approved", ToStatus: "published", RequiredRole: "admin"},
+		{FromStatus: "approved", ToStatus: "published", RequiredPermission: "ContentEntry:approve"},
+
+		// From Published
+		{FromStatus: "published", ToStatus: "draft", RequiredPermission: "ContentEntry:approve"},
+		{FromStatus: "published", ToStatus: "archived", RequiredPermission: "ContentEntry:approve"},
 
 		// From Rejected
-		{FromStatus: "rejected", ToStatus: "draft", RequiredRole: "editor"},
-		{FromStatus: "rejected", ToStatus: "draft", RequiredRole: "admin"},
+		{FromStatus: "rejected", ToStatus: "draft", RequiredPermission: "ContentEntry:update"},
+		{FromStatus: "rejected", ToStatus: "archived", RequiredPermission: "ContentEntry:approve"},
+
+		// From Archived
+		{FromStatus: "archived", ToStatus: "draft", RequiredPermission: "ContentEntry:approve"},
+	}
+
+	var definition models.WorkflowDefinition
+	result := db.Where("name = ?", "default").First(&definition)
+	if result.Error == gorm.ErrRecordNotFound {
+		states, _ := json.Marshal(models.WorkflowStatuses)
+		definition = models.WorkflowDefinition{
+			Name:        "default",
+			Description: "Draft, review, approval and publishing flow used by content types without their own workflow",
+			States:      datatypes.JSON(states),
+			IsDefault:   true,
+		}
+		if err := db.Create(&definition).Error; err != nil {
+			return err
+		}
+	} else if result.Error != nil {
+		return result.Error
+	}
+
+	// Transitions seeded before workflow definitions existed belong to the default flow
+	if err := db.Model(&models.WorkflowTransition{}).
+		Where("workflow_id IS NULL").
+		Update("workflow_id", definition.ID).Error; err != nil {
+		return err
+	}
+
+	// Guards are seeded once; an admin who later edits them away keeps their
+	// soft-deleted rows, so they are not brought back on the next start.
+	var guardCount int64
+	db.Unscoped().Model(&models.TransitionGuard{}).Where("workflow_id = ?", definition.ID).Count(&guardCount)
+	if guardCount == 0 {
+		guards := []models.TransitionGuard{
+			{WorkflowID: definition.ID, ToStatus: "published", Type: "schema"},
+		}
+		if err := db.Create(&guards).Error; err != nil {
+			return err
+		}
+	}
+
+	// Earlier versions seeded one row per built-in role; the permission rows
+	// below replace them.
+	if err := db.Where("workflow_id = ? AND required_role IN ? AND (required_permission = '' OR required_permission IS NULL)",
+		definition.ID, []string{"editor", "manager", "admin"}).
+		Delete(&models.WorkflowTransition{}).Error; err != nil {
+		return err
 	}
 
 	for _, transition := range transitions {
+		transition.WorkflowID = &definition.ID
+
 		// Check if transition already exists
 		var existing models.WorkflowTransition
-		result := db.Where("from_status = ? AND to_status = ? AND required_role = ?",
-			transition.FromStatus, transition.ToStatus, transition.RequiredRole).
+		result := db.Where("workflow_id = ? AND from_status = ? AND to_status = ? AND required_permission = ?",
+			definition.ID, transition.FromStatus, transition.ToStatus, transition.RequiredPermission).
 			First(&existing)
 
 		if result.Error == gorm.ErrRecordNotFound {
@@ -0,0 +1,247 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatJSON   = "json"
+	ExportFormatNDJSON = "ndjson"
+)
+
+// Entries are read in batches so an export of any size keeps a constant memory footprint.
+const exportBatchSize = 500
+
+var exportMetaColumns = []string{
+	"id",
+	"content_type_id",
+	"status",
+	"author_id",
+	"author_name",
+	"author_email",
+	"created_at",
+	"updated_at",
+	"published_at",
+}
+
+type ExportRecord struct {
+	ID            uint                  `json:"id"`
+	ContentTypeID uint                  `json:"content_type_id"`
+	Status        models.WorkflowStatus `json:"status"`
+	AuthorID      uint                  `json:"author_id"`
+	AuthorName    string                `json:"author_name"`
+	AuthorEmail   string                `json:"author_email"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+	PublishedAt   *time.Time            `json:"published_at"`
+	Data          datatypes.JSON        `json:"data"`
+}
+
+func isValidExportFormat(format string) bool {
+	switch format {
+	case ExportFormatCSV, ExportFormatJSON, ExportFormatNDJSON:
+		return true
+	}
+	return false
+}
+
+func exportMIMEType(format string) string {
+	switch format {
+	case ExportFormatCSV:
+		return "text/csv"
+	case ExportFormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+// ExportFieldNames returns the CSV data columns for the given content types,
+// or for every content type when none are given. Fields sharing a name are
+// emitted once, in the order they were first defined.
+func ExportFieldNames(ctx context.Context, contentTypeIDs []uint) ([]string, error) {
+	query := database.DB.WithContext(ctx).Model(&models.ContentField{})
+	if len(contentTypeIDs) > 0 {
+		query = query.Where("content_type_id IN ?", contentTypeIDs)
+	}
+
+	var fields []models.ContentField
+	if err := query.Order("content_type_id ASC, id ASC").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, field := range fields {
+		if seen[field.Name] {
+			continue
+		}
+		seen[field.Name] = true
+		names = append(names, field.Name)
+	}
+
+	return names, nil
+}
+
+// WriteExport streams every entry matched by query to w in the requested
+// format. Rows are written in ID order and flushed after each batch.
+func WriteExport(w *bufio.Writer, query *gorm.DB, format string, fields []string) error {
+	var csvWriter *csv.Writer
+	encoder := json.NewEncoder(w)
+	written := 0
+
+	switch format {
+	case ExportFormatCSV:
+		csvWriter = csv.NewWriter(w)
+		header := append(append([]string{}, exportMetaColumns...), fields...)
+		if err := csvWriter.Write(header); err != nil {
+			return err
+		}
+	case ExportFormatJSON:
+		if _, err := w.WriteString("["); err != nil {
+			return err
+		}
+	}
+
+	var batch []models.ContentEntry
+	result := query.Preload("Creator").FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			record := newExportRecord(entry)
+
+			switch format {
+			case ExportFormatCSV:
+				row, err := csvRow(record, fields)
+				if err != nil {
+					return err
+				}
+				if err := csvWriter.Write(row); err != nil {
+					return err
+				}
+			case ExportFormatJSON:
+				if written > 0 {
+					if _, err := w.WriteString(","); err != nil {
+						return err
+					}
+				}
+				raw, err := json.Marshal(record)
+				if err != nil {
+					return err
+				}
+				if _, err := w.Write(raw); err != nil {
+					return err
+				}
+			case ExportFormatNDJSON:
+				if err := encoder.Encode(record); err != nil {
+					return err
+				}
+			}
+			written++
+		}
+
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if format == ExportFormatJSON {
+		if _, err := w.WriteString("]"); err != nil {
+			return err
+		}
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func newExportRecord(entry models.ContentEntry) ExportRecord {
+	record := ExportRecord{
+		ID:            entry.ID,
+		ContentTypeID: entry.ContentTypeID,
+		Status:        entry.Status,
+		AuthorID:      entry.CreatedBy,
+		CreatedAt:     entry.CreatedAt,
+		UpdatedAt:     entry.UpdatedAt,
+		PublishedAt:   entry.PublishedAt,
+		Data:          entry.Data,
+	}
+
+	if entry.Creator != nil {
+		record.AuthorName = entry.Creator.Name
+		record.AuthorEmail = entry.Creator.Email
+	}
+	if len(record.Data) == 0 {
+		record.Data = datatypes.JSON("{}")
+	}
+
+	return record
+}
+
+func csvRow(record ExportRecord, fields []string) ([]string, error) {
+	publishedAt := ""
+	if record.PublishedAt != nil {
+		publishedAt = record.PublishedAt.Format(time.RFC3339)
+	}
+
+	row := []string{
+		strconv.FormatUint(uint64(record.ID), 10),
+		strconv.FormatUint(uint64(record.ContentTypeID), 10),
+		string(record.Status),
+		strconv.FormatUint(uint64(record.AuthorID), 10),
+		record.AuthorName,
+		record.AuthorEmail,
+		record.CreatedAt.Format(time.RFC3339),
+		record.UpdatedAt.Format(time.RFC3339),
+		publishedAt,
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(record.Data, &data); err != nil {
+		return nil, fmt.Errorf("entry %d has invalid data: %v", record.ID, err)
+	}
+
+	for _, field := range fields {
+		row = append(row, csvValue(data[field]))
+	}
+
+	return row, nil
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+}
@@ -0,0 +1,221 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/Kyz7/cms/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+)
+
+const (
+	// JobExport is the job type that writes one export.
+	JobExport = "search.export"
+	// JobExportCleanup is the job type that prunes old exports.
+	JobExportCleanup = "exports.cleanup"
+	// ExportQueue is the job queue exports run in, so a large export only
+	// holds up other exports.
+	ExportQueue = "export"
+)
+
+// ExportRetention is how long finished exports are kept for download.
+var ExportRetention = 7 * 24 * time.Hour
+
+type exportPayload struct {
+	ExportID uint `json:"export_id"`
+}
+
+func init() {
+	jobs.Register(JobExport, func(p exportPayload) error {
+		return RunExport(p.ExportID)
+	})
+	jobs.Register(JobExportCleanup, func(struct{}) error {
+		pruned, err := PruneExports(time.Now().Add(-ExportRetention))
+		if pruned > 0 {
+			log.Printf("🧹 Cleaned up %d old exports", pruned)
+		}
+		return err
+	})
+}
+
+// queueExport records the export and queues the job that writes it.
+func queueExport(c *fiber.Ctx, params SearchParams, format, name string) error {
+	ctx := c.UserContext()
+	userID := c.Locals("user_id").(uint)
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return response.InternalError(c, "Export failed")
+	}
+
+	export := models.Export{
+		UserID: userID,
+		Name:   name,
+		Format: format,
+		Params: datatypes.JSON(raw),
+		Status: models.ExportPending,
+	}
+	if err := database.DB.WithContext(ctx).Create(&export).Error; err != nil {
+		return response.InternalError(c, "Failed to queue export")
+	}
+	if _, err := jobs.Enqueue(JobExport, exportPayload{ExportID: export.ID}, jobs.Options{Queue: ExportQueue}); err != nil {
+		database.DB.Delete(&models.Export{}, export.ID)
+		return response.InternalError(c, "Failed to queue export")
+	}
+
+	c.Set(fiber.HeaderLocation, fmt.Sprintf("/search/exports/%d", export.ID))
+	return response.Accepted(c, export, "Export queued")
+}
+
+// RunExport writes export exportID to private storage, in the space and
+// environment it was requested in. A failed attempt is recorded on the export
+// and returned so the job is retried.
+func RunExport(exportID uint) error {
+	var export models.Export
+	if err := database.DB.First(&export, exportID).Error; err != nil {
+		return err
+	}
+	if export.Status == models.ExportCompleted {
+		return nil
+	}
+
+	database.DB.Model(&export).Update("status", models.ExportRunning)
+
+	path, size, err := writeExportFile(export)
+	if err != nil {
+		database.DB.Model(&export).Updates(map[string]interface{}{
+			"status": models.ExportFailed,
+			"error":  err.Error(),
+		})
+		return err
+	}
+
+	now := time.Now()
+	return database.DB.Model(&export).Updates(map[string]interface{}{
+		"status":       models.ExportCompleted,
+		"file_path":    path,
+		"size":         size,
+		"error":        "",
+		"completed_at": now,
+	}).Error
+}
+
+func writeExportFile(export models.Export) (string, int64, error) {
+	var params SearchParams
+	if err := json.Unmarshal(export.Params, &params); err != nil {
+		return "", 0, err
+	}
+
+	ctx := database.WithSpace(context.Background(), export.SpaceID)
+	ctx = database.WithEnvironment(ctx, export.EnvironmentID)
+
+	fields, err := ExportFieldNames(ctx, params.ContentTypeIDs)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Storage needs the whole file, so it is written to a temporary file first.
+	file, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := WriteExport(bufio.NewWriter(file), buildSearchQuery(ctx, params), export.Format, fields); err != nil {
+		return "", 0, err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	key := fmt.Sprintf("exports/export-%d.%s", export.ID, export.Format)
+	if err := utils.SavePrivateFile(key, file, exportMIMEType(export.Format)); err != nil {
+		return "", 0, err
+	}
+	return key, size, nil
+}
+
+// PruneExports deletes finished exports requested before the given time,
+// together with their files. An export whose file cannot be deleted is kept
+// so the next run tries again.
+func PruneExports(before time.Time) (int64, error) {
+	var exports []models.Export
+	if err := database.DB.
+		Where("created_at < ? AND status IN ?", before, []string{models.ExportCompleted, models.ExportFailed}).
+		Find(&exports).Error; err != nil {
+		return 0, err
+	}
+
+	var pruned int64
+	for _, export := range exports {
+		if export.FilePath != "" {
+			if err := utils.DeletePrivateFile(export.FilePath); err != nil {
+				log.Printf("⚠️  Failed to delete export file %s: %v", export.FilePath, err)
+				continue
+			}
+		}
+		if err := database.DB.Delete(&models.Export{}, export.ID).Error; err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// findExport loads one of the current user's exports.
+func findExport(c *fiber.Ctx) (*models.Export, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, err
+	}
+
+	var export models.Export
+	if err := database.DB.WithContext(c.UserContext()).
+		Where("user_id = ?", c.Locals("user_id").(uint)).
+		First(&export, id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func GetExportHandler(c *fiber.Ctx) error {
+	export, err := findExport(c)
+	if err != nil {
+		return response.NotFound(c, "Export")
+	}
+	return response.Success(c, export, "Export retrieved")
+}
+
+func DownloadExportHandler(c *fiber.Ctx) error {
+	export, err := findExport(c)
+	if err != nil {
+		return response.NotFound(c, "Export")
+	}
+	if export.Status != models.ExportCompleted {
+		return response.Conflict(c, "Export is not ready yet")
+	}
+
+	file, err := utils.OpenPrivateFile(export.FilePath)
+	if err != nil {
+		return response.NotFound(c, "Export file")
+	}
+	c.Set("Content-Type", exportMIMEType(export.Format))
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", export.Name, export.Format))
+	return c.SendStream(file, int(export.Size))
+}
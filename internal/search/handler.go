@@ -4,11 +4,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
 	"github.com/gofiber/fiber/v2"
 )
 
-func SearchEntriesHandler(c *fiber.Ctx) error {
+func searchParamsFromQuery(c *fiber.Ctx) SearchParams {
 	params := SearchParams{
 		Query:    c.Query("q", ""),
 		Status:   c.Query("status", ""),
@@ -41,11 +43,18 @@ func SearchEntriesHandler(c *fiber.Ctx) error {
 		params.CreatedBy = uint(createdBy)
 	}
 
+	return params
+}
+
+func SearchEntriesHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	params := searchParamsFromQuery(c)
+
 	if len(c.Context().QueryArgs().String()) == 0 {
 		return response.BadRequest(c, "At least one search parameter is required", nil)
 	}
 
-	result, err := FullTextSearch(params)
+	result, err := FullTextSearch(ctx, params)
 	if err != nil {
 		return response.InternalError(c, "Search failed: "+err.Error())
 	}
@@ -61,6 +70,7 @@ func SearchEntriesHandler(c *fiber.Ctx) error {
 }
 
 func AdvancedSearchHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var body struct {
 		Query          string                 `json:"query"`
 		ContentTypeIDs []uint                 `json:"content_type_ids"`
@@ -113,9 +123,9 @@ func AdvancedSearchHandler(c *fiber.Ctx) error {
 	var err error
 
 	if len(body.Filters) > 0 {
-		result, err = AdvancedFilter(body.Filters, params)
+		result, err = AdvancedFilter(ctx, body.Filters, params)
 	} else {
-		result, err = FullTextSearch(params)
+		result, err = FullTextSearch(ctx, params)
 	}
 
 	if err != nil {
@@ -133,6 +143,7 @@ func AdvancedSearchHandler(c *fiber.Ctx) error {
 }
 
 func GetSearchFacetsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	params := SearchParams{
 		Query: c.Query("q", ""),
 	}
@@ -146,7 +157,7 @@ func GetSearchFacetsHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	facets, err := GetSearchFacets(params)
+	facets, err := GetSearchFacets(ctx, params)
 	if err != nil {
 		return response.InternalError(c, "Failed to get facets")
 	}
@@ -155,6 +166,7 @@ func GetSearchFacetsHandler(c *fiber.Ctx) error {
 }
 
 func AutoCompleteHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	field := c.Query("field")
 	prefix := c.Query("prefix")
 	contentTypeID := c.QueryInt("content_type_id", 0)
@@ -168,7 +180,7 @@ func AutoCompleteHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	suggestions, err := AutoComplete(field, prefix, uint(contentTypeID), limit)
+	suggestions, err := AutoComplete(ctx, field, prefix, uint(contentTypeID), limit)
 	if err != nil {
 		return response.InternalError(c, "Autocomplete failed")
 	}
@@ -181,6 +193,7 @@ func AutoCompleteHandler(c *fiber.Ctx) error {
 }
 
 func SearchByRelationHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -193,7 +206,7 @@ func SearchByRelationHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	entries, err := SearchByRelation(uint(entryID), relationType)
+	entries, err := SearchByRelation(ctx, uint(entryID), relationType)
 	if err != nil {
 		return response.InternalError(c, "Failed to search relations")
 	}
@@ -220,6 +233,7 @@ func SearchSuggestionsHandler(c *fiber.Ctx) error {
 }
 
 func BulkSearchHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	var body struct {
 		Query          string `json:"query"`
 		ContentTypeIDs []uint `json:"content_type_ids"`
@@ -248,7 +262,7 @@ func BulkSearchHandler(c *fiber.Ctx) error {
 		Limit:          body.Limit * len(body.ContentTypeIDs),
 	}
 
-	result, err := FullTextSearch(params)
+	result, err := FullTextSearch(ctx, params)
 	if err != nil {
 		return response.InternalError(c, "Bulk search failed")
 	}
@@ -268,34 +282,42 @@ func BulkSearchHandler(c *fiber.Ctx) error {
 	return response.Success(c, result.Entries, "Bulk search completed")
 }
 
+// ExportSearchResultsHandler queues an export of every entry matching the
+// search; poll GetExportHandler until it completes, then download it.
 func ExportSearchResultsHandler(c *fiber.Ctx) error {
-	format := c.Query("format", "json")
-
-	params := SearchParams{
-		Query:   c.Query("q", ""),
-		Status:  c.Query("status", ""),
-		Page:    1,
-		Limit:   1000,
-		SortBy:  c.Query("sort_by", "created_at"),
-		OrderBy: c.Query("order_by", "desc"),
+	format := c.Query("format", ExportFormatJSON)
+	if !isValidExportFormat(format) {
+		return response.BadRequest(c, "Unsupported export format", map[string]string{
+			"format": "format must be one of csv, json, ndjson",
+		})
 	}
 
-	result, err := FullTextSearch(params)
+	return queueExport(c, searchParamsFromQuery(c), format, "search-results")
+}
+
+func ExportContentTypeHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	contentTypeID, err := c.ParamsInt("content_type_id")
 	if err != nil {
-		return response.InternalError(c, "Export failed")
+		return response.BadRequest(c, "Invalid content type ID", nil)
 	}
 
-	if format == "csv" {
-		c.Set("Content-Type", "text/csv")
-		c.Set("Content-Disposition", "attachment; filename=search-results.csv")
+	format := c.Query("format", ExportFormatCSV)
+	if !isValidExportFormat(format) {
+		return response.BadRequest(c, "Unsupported export format", map[string]string{
+			"format": "format must be one of csv, json, ndjson",
+		})
+	}
 
-		return c.SendString("CSV export not yet implemented")
+	var ct models.ContentType
+	if err := database.DB.WithContext(ctx).First(&ct, contentTypeID).Error; err != nil {
+		return response.NotFound(c, "Content type")
 	}
 
-	c.Set("Content-Type", "application/json")
-	c.Set("Content-Disposition", "attachment; filename=search-results.json")
+	params := searchParamsFromQuery(c)
+	params.ContentTypeIDs = []uint{ct.ID}
 
-	return c.JSON(result.Entries)
+	return queueExport(c, params, format, ct.Slug)
 }
 
 func SearchStatsHandler(c *fiber.Ctx) error {
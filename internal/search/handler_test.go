@@ -1,13 +1,22 @@
 package search_test
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
 	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/search"
 	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/Kyz7/cms/internal/utils"
+	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/datatypes"
 )
@@ -613,3 +622,145 @@ func TestComplexSearchScenarios(t *testing.T) {
 		assert.Equal(t, 1, len(data))
 	})
 }
+
+// runExport checks that the export was queued, runs its job and downloads
+// the file it wrote.
+func runExport(t *testing.T, app *fiber.App, queued *httptest.ResponseRecorder, token string) *httptest.ResponseRecorder {
+	assert.Equal(t, 202, queued.Code)
+
+	var export struct {
+		Data models.Export `json:"data"`
+	}
+	testutils.ParseResponse(t, queued, &export)
+	assert.Equal(t, models.ExportPending, export.Data.Status)
+
+	ran, err := jobs.RunNext(search.ExportQueue, time.Now(), jobs.DefaultConfig)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+
+	resp, err := testutils.MakeRequest(app, "GET", fmt.Sprintf("/search/exports/%d/download", export.Data.ID), nil, token)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.Code)
+	return resp
+}
+
+func TestExportHandlers(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+	utils.PrivateBasePath = t.TempDir()
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor@test.com", "password", "editor")
+	token := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Article", Slug: "article"}
+	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "title", Type: "string"})
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "views", Type: "number"})
+
+	for i := 0; i < 3; i++ {
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"title": fmt.Sprintf("Article, part %d", i),
+			"views": i * 10,
+		})
+		database.DB.Create(&models.ContentEntry{
+			ContentTypeID: ct.ID,
+			Data:          datatypes.JSON(jsonData),
+			Status:        models.StatusDraft,
+			CreatedBy:     editor.ID,
+		})
+	}
+
+	t.Run("Success - CSV export of a content type", func(t *testing.T) {
+		queued, err := testutils.MakeRequest(app, "POST", "/content/"+fmt.Sprint(ct.ID)+"/entries/export?format=csv", nil, token)
+		assert.NoError(t, err)
+		resp := runExport(t, app, queued, token)
+
+		rows, err := csv.NewReader(resp.Body).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(rows))
+		assert.Equal(t, []string{"id", "content_type_id", "status", "author_id", "author_name", "author_email",
+			"created_at", "updated_at", "published_at", "title", "views"}, rows[0])
+		assert.Equal(t, "draft", rows[1][2])
+		assert.Equal(t, "editor@test.com", rows[1][5])
+		assert.Equal(t, "Article, part 0", rows[1][9])
+		assert.Equal(t, "20", rows[3][10])
+	})
+
+	t.Run("Success - NDJSON export of search results", func(t *testing.T) {
+		queued, err := testutils.MakeRequest(app, "POST", "/search/export?format=ndjson&q=part", nil, token)
+		assert.NoError(t, err)
+		resp := runExport(t, app, queued, token)
+
+		lines := strings.Split(strings.TrimSpace(resp.Body.String()), "\n")
+		assert.Equal(t, 3, len(lines))
+
+		var record map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		assert.Equal(t, "draft", record["status"])
+		assert.Equal(t, "Test User", record["author_name"])
+	})
+
+	t.Run("Success - JSON export with GET", func(t *testing.T) {
+		queued, err := testutils.MakeRequest(app, "GET", "/search/export?format=json", nil, token)
+		assert.NoError(t, err)
+		resp := runExport(t, app, queued, token)
+
+		var records []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &records))
+		assert.Equal(t, 3, len(records))
+	})
+
+	t.Run("Error - Unsupported format", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/search/export?format=xml", nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Error - Unknown content type", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/content/999/entries/export", nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.Code)
+	})
+
+	t.Run("Success - Old exports are pruned with their files", func(t *testing.T) {
+		queued, err := testutils.MakeRequest(app, "POST", "/search/export?format=json", nil, token)
+		assert.NoError(t, err)
+		runExport(t, app, queued, token)
+
+		var export models.Export
+		database.DB.Order("id desc").First(&export)
+		file := filepath.Join(utils.PrivateBasePath, export.FilePath)
+		assert.FileExists(t, file)
+
+		pruned, err := search.PruneExports(time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), pruned, "still within retention")
+
+		pruned, err = search.PruneExports(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, pruned > 0)
+		assert.NoFileExists(t, file)
+
+		resp, err := testutils.MakeRequest(app, "GET", fmt.Sprintf("/search/exports/%d", export.ID), nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.Code)
+	})
+
+	t.Run("Error - Exports are private to their requester", func(t *testing.T) {
+		queued, err := testutils.MakeRequest(app, "POST", "/search/export?format=json", nil, token)
+		assert.NoError(t, err)
+		var export struct {
+			Data models.Export `json:"data"`
+		}
+		testutils.ParseResponse(t, queued, &export)
+
+		resp, err := testutils.MakeRequest(app, "GET", fmt.Sprintf("/search/exports/%d/download", export.Data.ID), nil, token)
+		assert.NoError(t, err)
+		assert.Equal(t, 409, resp.Code, "not written yet")
+
+		other := testutils.CreateTestUser(t, database.DB, "other_export@test.com", "password", "editor")
+		otherToken := testutils.GetAuthToken(t, other.ID, other.Role.Name)
+		resp, err = testutils.MakeRequest(app, "GET", fmt.Sprintf("/search/exports/%d", export.Data.ID), nil, otherToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.Code)
+	})
+}
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/Kyz7/cms/internal/database"
 	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/utils"
 	"gorm.io/gorm"
 )
 
@@ -47,7 +49,7 @@ type DateRangeFacet struct {
 	Newest time.Time `json:"newest"`
 }
 
-func FullTextSearch(params SearchParams) (*SearchResult, error) {
+func FullTextSearch(ctx context.Context, params SearchParams) (*SearchResult, error) {
 	if params.Page <= 0 {
 		params.Page = 1
 	}
@@ -64,7 +66,44 @@ func FullTextSearch(params SearchParams) (*SearchResult, error) {
 		params.OrderBy = "desc"
 	}
 
-	query := database.DB.Model(&models.ContentEntry{})
+	query := buildSearchQuery(ctx, params)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	query = applySorting(ctx, query, params)
+
+	offset := (params.Page - 1) * params.Limit
+	query = query.Offset(offset).Limit(params.Limit)
+
+	query = query.Preload("Creator").Preload("Updater")
+
+	var entries []models.ContentEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	totalPages := total / int64(params.Limit)
+	if total%int64(params.Limit) > 0 {
+		totalPages++
+	}
+
+	result := &SearchResult{
+		Entries:    entries,
+		Total:      total,
+		Page:       params.Page,
+		Limit:      params.Limit,
+		TotalPages: totalPages,
+		Query:      params.Query,
+	}
+
+	return result, nil
+}
+
+func buildSearchQuery(ctx context.Context, params SearchParams) *gorm.DB {
+	query := database.DB.WithContext(ctx).Model(&models.ContentEntry{})
 
 	if len(params.ContentTypeIDs) > 0 {
 		query = query.Where("content_type_id IN ?", params.ContentTypeIDs)
@@ -93,54 +132,23 @@ func FullTextSearch(params SearchParams) (*SearchResult, error) {
 	}
 
 	if params.Query != "" {
-		query = applyFullTextSearch(query, params)
+		query = applyFullTextSearch(ctx, query, params)
 	}
 
 	if len(params.Tags) > 0 {
-		query = applyTagFilter(query, params.Tags)
-	}
-
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		return nil, err
-	}
-
-	query = applySorting(query, params)
-
-	offset := (params.Page - 1) * params.Limit
-	query = query.Offset(offset).Limit(params.Limit)
-
-	query = query.Preload("Creator").Preload("Updater")
-
-	var entries []models.ContentEntry
-	if err := query.Find(&entries).Error; err != nil {
-		return nil, err
+		query = applyTagFilter(ctx, query, params.Tags)
 	}
 
-	totalPages := total / int64(params.Limit)
-	if total%int64(params.Limit) > 0 {
-		totalPages++
-	}
-
-	result := &SearchResult{
-		Entries:    entries,
-		Total:      total,
-		Page:       params.Page,
-		Limit:      params.Limit,
-		TotalPages: totalPages,
-		Query:      params.Query,
-	}
-
-	return result, nil
+	return query
 }
 
-func applyFullTextSearch(query *gorm.DB, params SearchParams) *gorm.DB {
+func applyFullTextSearch(ctx context.Context, query *gorm.DB, params SearchParams) *gorm.DB {
 	searchQuery := strings.TrimSpace(params.Query)
 	if searchQuery == "" {
 		return query
 	}
 
-	dbDialect := database.DB.Dialector.Name()
+	dbDialect := database.DB.WithContext(ctx).Dialector.Name()
 
 	if dbDialect == "postgres" {
 		if len(params.Fields) > 0 {
@@ -181,8 +189,8 @@ func applyFullTextSearch(query *gorm.DB, params SearchParams) *gorm.DB {
 	return query
 }
 
-func applyTagFilter(query *gorm.DB, tags []string) *gorm.DB {
-	dbDialect := database.DB.Dialector.Name()
+func applyTagFilter(ctx context.Context, query *gorm.DB, tags []string) *gorm.DB {
+	dbDialect := database.DB.WithContext(ctx).Dialector.Name()
 
 	if dbDialect == "postgres" {
 		for _, tag := range tags {
@@ -197,13 +205,13 @@ func applyTagFilter(query *gorm.DB, tags []string) *gorm.DB {
 	return query
 }
 
-func applySorting(query *gorm.DB, params SearchParams) *gorm.DB {
+func applySorting(ctx context.Context, query *gorm.DB, params SearchParams) *gorm.DB {
 	orderBy := strings.ToLower(params.OrderBy)
 	if orderBy != "asc" && orderBy != "desc" {
 		orderBy = "desc"
 	}
 
-	dbDialect := database.DB.Dialector.Name()
+	dbDialect := database.DB.WithContext(ctx).Dialector.Name()
 
 	switch params.SortBy {
 	case "created_at":
@@ -225,6 +233,9 @@ func applySorting(query *gorm.DB, params SearchParams) *gorm.DB {
 		} else {
 			query = query.Order("CAST(json_extract(data, '$.price') AS REAL) " + orderBy)
 		}
+	case "manual":
+		// The curated order is the order, so order_by does not apply.
+		query = query.Order(utils.RankColumn(query) + " ASC").Order("id ASC")
 	default:
 		query = query.Order("created_at " + orderBy)
 	}
@@ -232,31 +243,31 @@ func applySorting(query *gorm.DB, params SearchParams) *gorm.DB {
 	return query
 }
 
-func GetSearchFacets(params SearchParams) (*SearchFacets, error) {
+func GetSearchFacets(ctx context.Context, params SearchParams) (*SearchFacets, error) {
 	facets := &SearchFacets{
 		ContentTypes: make(map[string]int64),
 		Statuses:     make(map[string]int64),
 		DateRange:    &DateRangeFacet{},
 	}
 
-	query := database.DB.Model(&models.ContentEntry{})
+	query := database.DB.WithContext(ctx).Model(&models.ContentEntry{})
 
 	if params.Query != "" {
-		_ = applyFullTextSearch(query, params)
+		_ = applyFullTextSearch(ctx, query, params)
 	}
 
 	var contentTypeCounts []struct {
 		ContentTypeID uint
 		Count         int64
 	}
-	database.DB.Model(&models.ContentEntry{}).
+	database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
 		Select("content_type_id, count(*) as count").
 		Group("content_type_id").
 		Scan(&contentTypeCounts)
 
 	for _, ct := range contentTypeCounts {
 		var contentType models.ContentType
-		if err := database.DB.First(&contentType, ct.ContentTypeID).Error; err == nil {
+		if err := database.DB.WithContext(ctx).First(&contentType, ct.ContentTypeID).Error; err == nil {
 			facets.ContentTypes[contentType.Name] = ct.Count
 		}
 	}
@@ -265,7 +276,7 @@ func GetSearchFacets(params SearchParams) (*SearchFacets, error) {
 		Status string
 		Count  int64
 	}
-	database.DB.Model(&models.ContentEntry{}).
+	database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
 		Select("status, count(*) as count").
 		Group("status").
 		Scan(&statusCounts)
@@ -274,21 +285,21 @@ func GetSearchFacets(params SearchParams) (*SearchFacets, error) {
 		facets.Statuses[sc.Status] = sc.Count
 	}
 
-	database.DB.Model(&models.ContentEntry{}).
+	database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
 		Select("MIN(created_at) as oldest, MAX(created_at) as newest").
 		Scan(facets.DateRange)
 
 	return facets, nil
 }
 
-func AdvancedFilter(filters map[string]any, params SearchParams) (*SearchResult, error) {
-	query := database.DB.Model(&models.ContentEntry{})
+func AdvancedFilter(ctx context.Context, filters map[string]any, params SearchParams) (*SearchResult, error) {
+	query := database.DB.WithContext(ctx).Model(&models.ContentEntry{})
 
 	if len(params.ContentTypeIDs) > 0 {
 		query = query.Where("content_type_id IN ?", params.ContentTypeIDs)
 	}
 
-	dbDialect := database.DB.Dialector.Name()
+	dbDialect := database.DB.WithContext(ctx).Dialector.Name()
 
 	for fieldName, value := range filters {
 		switch v := value.(type) {
@@ -338,7 +349,7 @@ func AdvancedFilter(filters map[string]any, params SearchParams) (*SearchResult,
 		}
 	}
 
-	query = applySorting(query, params)
+	query = applySorting(ctx, query, params)
 
 	var total int64
 	query.Count(&total)
@@ -365,15 +376,15 @@ func AdvancedFilter(filters map[string]any, params SearchParams) (*SearchResult,
 	}, nil
 }
 
-func AutoComplete(field, prefix string, contentTypeID uint, limit int) ([]string, error) {
+func AutoComplete(ctx context.Context, field, prefix string, contentTypeID uint, limit int) ([]string, error) {
 	if limit <= 0 {
 		limit = 10
 	}
 
 	var suggestions []string
-	dbDialect := database.DB.Dialector.Name()
+	dbDialect := database.DB.WithContext(ctx).Dialector.Name()
 
-	query := database.DB.Model(&models.ContentEntry{}).
+	query := database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
 		Where("content_type_id = ?", contentTypeID)
 
 	if dbDialect == "postgres" {
@@ -393,9 +404,9 @@ func AutoComplete(field, prefix string, contentTypeID uint, limit int) ([]string
 	return suggestions, nil
 }
 
-func SearchByRelation(entryID uint, relationType string) ([]models.ContentEntry, error) {
+func SearchByRelation(ctx context.Context, entryID uint, relationType string) ([]models.ContentEntry, error) {
 	var relations []models.ContentRelation
-	if err := database.DB.Where("from_content_id = ? AND relation_type = ?", entryID, relationType).
+	if err := database.DB.WithContext(ctx).Where("from_content_id = ? AND relation_type = ?", entryID, relationType).
 		Find(&relations).Error; err != nil {
 		return nil, err
 	}
@@ -410,7 +421,7 @@ func SearchByRelation(entryID uint, relationType string) ([]models.ContentEntry,
 	}
 
 	var entries []models.ContentEntry
-	if err := database.DB.Where("id IN ?", toIDs).
+	if err := database.DB.WithContext(ctx).Where("id IN ?", toIDs).
 		Preload("Creator").
 		Preload("Updater").
 		Find(&entries).Error; err != nil {
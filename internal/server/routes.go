@@ -3,27 +3,39 @@ package server
 import (
 	"time"
 
+	"github.com/Kyz7/cms/internal/audit"
 	"github.com/Kyz7/cms/internal/auth"
 	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/cron"
+	"github.com/Kyz7/cms/internal/environment"
+	"github.com/Kyz7/cms/internal/feed"
+	"github.com/Kyz7/cms/internal/jobs"
 	"github.com/Kyz7/cms/internal/media"
 	"github.com/Kyz7/cms/internal/middleware"
+	"github.com/Kyz7/cms/internal/notification"
 	"github.com/Kyz7/cms/internal/role"
 	"github.com/Kyz7/cms/internal/search"
+	"github.com/Kyz7/cms/internal/space"
 	"github.com/Kyz7/cms/internal/user"
+	"github.com/Kyz7/cms/internal/webhook"
 	"github.com/Kyz7/cms/internal/workflow"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 func SetupRoutes(app *fiber.App) {
 	// Middleware
+	app.Use(requestid.New())
+	app.Use(space.Resolve())
+	app.Use(environment.Resolve())
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Space, X-Environment",
 		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS, PATCH",
 	}))
 
@@ -130,6 +142,12 @@ func SetupRoutes(app *fiber.App) {
 	contentGroup.Post("/:content_type_id/entries/json",
 		middleware.PermissionProtected("ContentEntry", "create"),
 		content.CreateEntryHandlerJSON)
+	contentGroup.Get("/:content_type_id/entries/export",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		search.ExportContentTypeHandler)
+	contentGroup.Post("/:content_type_id/entries/export",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		search.ExportContentTypeHandler)
 
 	// Content Entries - Single Entry Operations
 	contentGroup.Get("/entries/:entry_id",
@@ -142,6 +160,48 @@ func SetupRoutes(app *fiber.App) {
 		middleware.PermissionProtected("ContentEntry", "delete"),
 		content.DeleteEntryHandler)
 
+	// Manual Ordering
+	contentGroup.Post("/entries/:entry_id/position",
+		middleware.PermissionProtected("ContentEntry", "update"),
+		content.MoveEntryNextToHandler)
+
+	// Entry Trees
+	contentGroup.Post("/entries/:entry_id/move",
+		middleware.PermissionProtected("ContentEntry", "update"),
+		content.MoveEntryHandler)
+	contentGroup.Get("/:content_type_id/tree",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		content.GetEntryTreeHandler)
+	contentGroup.Get("/:content_type_id/tree/lookup",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		content.GetEntryByPathHandler)
+	contentGroup.Post("/:content_type_id/tree/reorder",
+		middleware.PermissionProtected("ContentEntry", "update"),
+		content.ReorderTreeHandler)
+
+	// Editing Locks & Presence
+	contentGroup.Post("/entries/:entry_id/lock",
+		middleware.PermissionProtected("ContentEntry", "update"),
+		content.AcquireLockHandler)
+	contentGroup.Post("/entries/:entry_id/lock/heartbeat",
+		middleware.PermissionProtected("ContentEntry", "update"),
+		content.HeartbeatLockHandler)
+	contentGroup.Delete("/entries/:entry_id/lock",
+		middleware.PermissionProtected("ContentEntry", "update"),
+		content.ReleaseLockHandler)
+	contentGroup.Delete("/entries/:entry_id/lock/force",
+		auth.RoleProtected("admin"),
+		content.ForceUnlockHandler)
+	contentGroup.Get("/entries/:entry_id/presence",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		content.GetPresenceHandler)
+	contentGroup.Post("/entries/:entry_id/presence",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		content.TouchPresenceHandler)
+	contentGroup.Delete("/entries/:entry_id/presence",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		content.LeavePresenceHandler)
+
 	// SEO
 	contentGroup.Get("/entries/:entry_id/seo-preview",
 		middleware.PermissionProtected("SEO", "read"),
@@ -234,9 +294,73 @@ func SetupRoutes(app *fiber.App) {
 	workflowGroup.Post("/entries/:entry_id/reject",
 		middleware.PermissionProtected("ContentEntry", "approve"),
 		workflow.RejectEntryHandler)
+	workflowGroup.Get("/entries/:entry_id/checks",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		workflow.CheckTransitionHandler)
+	workflowGroup.Get("/entries/:entry_id/approvals",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		workflow.GetApprovalProgressHandler)
 	workflowGroup.Post("/entries/:entry_id/publish",
 		middleware.PermissionProtected("ContentEntry", "approve"),
 		workflow.PublishEntryHandler)
+	workflowGroup.Post("/entries/:entry_id/unpublish",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.UnpublishEntryHandler)
+	workflowGroup.Post("/entries/:entry_id/archive",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.ArchiveEntryHandler)
+	workflowGroup.Post("/entries/:entry_id/restore",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.RestoreEntryHandler)
+
+	// Scheduling
+	workflowGroup.Post("/entries/:entry_id/schedule",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.ScheduleEntryHandler)
+	workflowGroup.Delete("/entries/:entry_id/schedule",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.CancelScheduleHandler)
+	workflowGroup.Get("/scheduled",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		workflow.GetScheduledEntriesHandler)
+
+	// Releases
+	workflowGroup.Get("/releases",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.ListReleasesHandler)
+	workflowGroup.Post("/releases",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.CreateReleaseHandler)
+	workflowGroup.Get("/releases/:release_id",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.GetReleaseHandler)
+	workflowGroup.Put("/releases/:release_id",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.UpdateReleaseHandler)
+	workflowGroup.Delete("/releases/:release_id",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.DeleteReleaseHandler)
+	workflowGroup.Post("/releases/:release_id/items",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.AddReleaseItemHandler)
+	workflowGroup.Delete("/releases/:release_id/items/:entry_id",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.RemoveReleaseItemHandler)
+	workflowGroup.Get("/releases/:release_id/validate",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.ValidateReleaseHandler)
+	workflowGroup.Post("/releases/:release_id/run",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.RunReleaseHandler)
+	workflowGroup.Post("/releases/:release_id/schedule",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.ScheduleReleaseHandler)
+	workflowGroup.Delete("/releases/:release_id/schedule",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.CancelReleaseScheduleHandler)
+	workflowGroup.Post("/releases/:release_id/rollback",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.RollbackReleaseHandler)
 
 	// History & Comments
 	workflowGroup.Get("/entries/:entry_id/history",
@@ -248,6 +372,15 @@ func SetupRoutes(app *fiber.App) {
 	workflowGroup.Get("/entries/:entry_id/comments",
 		middleware.PermissionProtected("ContentEntry", "read"),
 		workflow.GetCommentsHandler)
+	workflowGroup.Put("/comments/:comment_id/resolve",
+		middleware.AnyPermissionProtected("ContentEntry", "update", "approve"),
+		workflow.ResolveThreadHandler)
+	workflowGroup.Put("/comments/:comment_id/reopen",
+		middleware.AnyPermissionProtected("ContentEntry", "update", "approve"),
+		workflow.ReopenThreadHandler)
+	workflowGroup.Get("/mentions",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		workflow.GetMyMentionsHandler)
 
 	// Assignment
 	workflowGroup.Post("/entries/:entry_id/assign",
@@ -259,8 +392,43 @@ func SetupRoutes(app *fiber.App) {
 	workflowGroup.Put("/assignments/:assignment_id/complete",
 		middleware.PermissionProtected("ContentEntry", "update"),
 		workflow.CompleteAssignmentHandler)
+	workflowGroup.Put("/assignments/:assignment_id/reassign",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.ReassignAssignmentHandler)
+	workflowGroup.Put("/assignments/:assignment_id/claim",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		workflow.ClaimAssignmentHandler)
+	workflowGroup.Put("/assignments/:assignment_id/decline",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		workflow.DeclineAssignmentHandler)
+
+	// Workflow Definitions
+	workflowGroup.Get("/definitions",
+		auth.RoleProtected("admin"),
+		workflow.ListWorkflowDefinitionsHandler)
+	workflowGroup.Post("/definitions",
+		auth.RoleProtected("admin"),
+		workflow.CreateWorkflowDefinitionHandler)
+	workflowGroup.Get("/definitions/:workflow_id",
+		auth.RoleProtected("admin"),
+		workflow.GetWorkflowDefinitionHandler)
+	workflowGroup.Put("/definitions/:workflow_id",
+		auth.RoleProtected("admin"),
+		workflow.UpdateWorkflowDefinitionHandler)
+	workflowGroup.Delete("/definitions/:workflow_id",
+		auth.RoleProtected("admin"),
+		workflow.DeleteWorkflowDefinitionHandler)
+	workflowGroup.Put("/content-types/:content_type_id/workflow",
+		auth.RoleProtected("admin"),
+		workflow.AssignContentTypeWorkflowHandler)
+	workflowGroup.Get("/content-types/:content_type_id/workflow",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		workflow.GetContentTypeWorkflowHandler)
 
 	// Statistics & Filtering
+	workflowGroup.Get("/analytics",
+		middleware.PermissionProtected("ContentEntry", "approve"),
+		workflow.GetWorkflowAnalyticsHandler)
 	workflowGroup.Get("/content-types/:content_type_id/entries",
 		middleware.PermissionProtected("ContentEntry", "read"),
 		workflow.GetEntriesByStatusHandler)
@@ -308,6 +476,15 @@ func SetupRoutes(app *fiber.App) {
 	searchGroup.Get("/export",
 		middleware.PermissionProtected("ContentEntry", "read"),
 		search.ExportSearchResultsHandler)
+	searchGroup.Post("/export",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		search.ExportSearchResultsHandler)
+	searchGroup.Get("/exports/:id",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		search.GetExportHandler)
+	searchGroup.Get("/exports/:id/download",
+		middleware.PermissionProtected("ContentEntry", "read"),
+		search.DownloadExportHandler)
 
 	// Search statistics
 	searchGroup.Get("/stats",
@@ -318,4 +495,99 @@ func SetupRoutes(app *fiber.App) {
 	searchGroup.Get("/suggestions",
 		middleware.PermissionProtected("ContentEntry", "read"),
 		search.SearchSuggestionsHandler)
+
+	// ==========================================
+	// SPACES (Admin only, except listing your own)
+	// ==========================================
+	spaceGroup := app.Group("/spaces")
+	spaceGroup.Use(auth.JWTProtected())
+	spaceGroup.Get("/mine", space.MySpacesHandler)
+	spaceGroup.Use(auth.RoleProtected("admin"))
+	spaceGroup.Post("/", space.CreateSpaceHandler)
+	spaceGroup.Get("/", space.ListSpacesHandler)
+	spaceGroup.Get("/:id", space.GetSpaceHandler)
+	spaceGroup.Put("/:id", space.UpdateSpaceHandler)
+	spaceGroup.Delete("/:id", space.DeleteSpaceHandler)
+	spaceGroup.Get("/:id/members", space.ListMembersHandler)
+	spaceGroup.Put("/:id/members/:user_id", space.SetMemberHandler)
+	spaceGroup.Delete("/:id/members/:user_id", space.RemoveMemberHandler)
+
+	// ==========================================
+	// ENVIRONMENTS (Admin only)
+	// ==========================================
+	environmentGroup := app.Group("/environments")
+	environmentGroup.Use(auth.JWTProtected())
+	environmentGroup.Use(auth.RoleProtected("admin"))
+	environmentGroup.Get("/diff", environment.DiffHandler)
+	environmentGroup.Post("/promote", environment.PromoteHandler)
+	environmentGroup.Post("/", environment.CreateEnvironmentHandler)
+	environmentGroup.Get("/", environment.ListEnvironmentsHandler)
+	environmentGroup.Get("/:slug", environment.GetEnvironmentHandler)
+	environmentGroup.Delete("/:slug", environment.DeleteEnvironmentHandler)
+
+	// ==========================================
+	// WEBHOOKS (Admin only)
+	// ==========================================
+	webhookGroup := app.Group("/webhooks")
+	webhookGroup.Use(auth.JWTProtected())
+	webhookGroup.Use(auth.RoleProtected("admin"))
+	webhookGroup.Get("/events", webhook.ListEventsHandler)
+	webhookGroup.Get("/deliveries/:delivery_id", webhook.GetDeliveryHandler)
+	webhookGroup.Post("/deliveries/:delivery_id/redeliver", webhook.RedeliverHandler)
+	webhookGroup.Post("/", webhook.CreateWebhookHandler)
+	webhookGroup.Get("/", webhook.ListWebhooksHandler)
+	webhookGroup.Get("/:id", webhook.GetWebhookHandler)
+	webhookGroup.Put("/:id", webhook.UpdateWebhookHandler)
+	webhookGroup.Delete("/:id", webhook.DeleteWebhookHandler)
+	webhookGroup.Get("/:id/deliveries", webhook.ListDeliveriesHandler)
+
+	// ==========================================
+	// AUDIT LOG (Admin only)
+	// ==========================================
+	auditGroup := app.Group("/audit")
+	auditGroup.Use(auth.JWTProtected())
+	auditGroup.Use(auth.RoleProtected("admin"))
+	auditGroup.Get("/logs", audit.ListAuditLogsHandler)
+	auditGroup.Get("/logs/:id", audit.GetAuditLogHandler)
+	auditGroup.Get("/verify", audit.VerifyChainHandler)
+
+	// ==========================================
+	// CHANGE FEED (Server-Sent Events)
+	// ==========================================
+	feedGroup := app.Group("/feed")
+	feedGroup.Post("/tickets", auth.JWTProtected(), feed.IssueTicketHandler)
+	feedGroup.Get("/stream", feed.TicketProtected(auth.JWTProtected()), feed.StreamHandler)
+
+	// ==========================================
+	// NOTIFICATIONS (current user's inbox)
+	// ==========================================
+	notificationGroup := app.Group("/notifications")
+	notificationGroup.Use(auth.JWTProtected())
+	notificationGroup.Get("/", notification.ListNotificationsHandler)
+	notificationGroup.Get("/unread-count", notification.UnreadCountHandler)
+	notificationGroup.Post("/read-all", notification.MarkAllReadHandler)
+	notificationGroup.Get("/preferences", notification.GetPreferencesHandler)
+	notificationGroup.Put("/preferences", notification.UpdatePreferencesHandler)
+	notificationGroup.Post("/:id/read", notification.MarkReadHandler)
+
+	// ==========================================
+	// BACKGROUND JOBS (Admin only)
+	// ==========================================
+	jobGroup := app.Group("/jobs")
+	jobGroup.Use(auth.JWTProtected())
+	jobGroup.Use(auth.RoleProtected("admin"))
+	jobGroup.Get("/", jobs.ListJobsHandler)
+	jobGroup.Get("/stats", jobs.StatsHandler)
+	jobGroup.Get("/:id", jobs.GetJobHandler)
+	jobGroup.Post("/:id/retry", jobs.RetryJobHandler)
+
+	// ==========================================
+	// SCHEDULED TASKS (Admin only)
+	// ==========================================
+	taskGroup := app.Group("/tasks")
+	taskGroup.Use(auth.JWTProtected())
+	taskGroup.Use(auth.RoleProtected("admin"))
+	taskGroup.Get("/", cron.ListTasksHandler)
+	taskGroup.Get("/:name", cron.GetTaskHandler)
+	taskGroup.Post("/:name/run", cron.RunTaskHandler)
 }
@@ -1,6 +1,10 @@
 package server
 
 import (
+	"github.com/Kyz7/cms/internal/audit"
+	"github.com/Kyz7/cms/internal/feed"
+	"github.com/Kyz7/cms/internal/notification"
+	"github.com/Kyz7/cms/internal/webhook"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
@@ -24,6 +28,10 @@ func New(db *gorm.DB) *fiber.App {
 	//     Expiration:     1 * time.Hour,
 	// }))
 
+	webhook.Subscribe()
+	audit.Subscribe()
+	feed.Subscribe()
+	notification.Subscribe()
 	SetupRoutes(app)
 
 	return app
@@ -0,0 +1,159 @@
+package space
+
+import (
+	"errors"
+
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type memberInput struct {
+	RoleID uint `json:"role_id"`
+}
+
+func ListSpacesHandler(c *fiber.Ctx) error {
+	spaces, err := ListSpaces()
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch spaces")
+	}
+	return response.Success(c, spaces, "Spaces retrieved successfully")
+}
+
+func MySpacesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	spaces, err := ListUserSpaces(userID)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch spaces")
+	}
+	return response.Success(c, spaces, "Spaces retrieved successfully")
+}
+
+func GetSpaceHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid space ID", nil)
+	}
+
+	space, err := GetSpace(uint(id))
+	if err != nil {
+		return response.NotFound(c, "Space")
+	}
+	return response.Success(c, space, "Space retrieved successfully")
+}
+
+func CreateSpaceHandler(c *fiber.Ctx) error {
+	var body SpaceInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	space, err := CreateSpace(body)
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	return response.Created(c, space, "Space created successfully")
+}
+
+func UpdateSpaceHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid space ID", nil)
+	}
+
+	var body SpaceInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	space, err := UpdateSpace(uint(id), body)
+	if errors.Is(err, ErrSpaceNotFound) {
+		return response.NotFound(c, "Space")
+	}
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	return response.Success(c, space, "Space updated successfully")
+}
+
+func DeleteSpaceHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid space ID", nil)
+	}
+
+	if err := DeleteSpace(uint(id)); err != nil {
+		switch {
+		case errors.Is(err, ErrSpaceNotFound):
+			return response.NotFound(c, "Space")
+		case errors.Is(err, ErrDefaultSpace), errors.Is(err, ErrSpaceNotEmpty):
+			return response.Conflict(c, err.Error())
+		}
+		return response.InternalError(c, "Failed to delete space")
+	}
+	return response.NoContent(c)
+}
+
+func ListMembersHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid space ID", nil)
+	}
+
+	if _, err := GetSpace(uint(id)); err != nil {
+		return response.NotFound(c, "Space")
+	}
+
+	members, err := ListMembers(uint(id))
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch members")
+	}
+	return response.Success(c, members, "Members retrieved successfully")
+}
+
+func SetMemberHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid space ID", nil)
+	}
+	userID, err := c.ParamsInt("user_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID", nil)
+	}
+
+	var body memberInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+	if body.RoleID == 0 {
+		return response.ValidationError(c, map[string]string{"role_id": "role_id is required"})
+	}
+
+	membership, err := SetMember(uint(id), uint(userID), body.RoleID)
+	if errors.Is(err, ErrSpaceNotFound) {
+		return response.NotFound(c, "Space")
+	}
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	return response.Success(c, membership, "Member saved successfully")
+}
+
+func RemoveMemberHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid space ID", nil)
+	}
+	userID, err := c.ParamsInt("user_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID", nil)
+	}
+
+	if err := RemoveMember(uint(id), uint(userID)); err != nil {
+		if errors.Is(err, ErrMembershipNotFound) {
+			return response.NotFound(c, "Membership")
+		}
+		return response.InternalError(c, "Failed to remove member")
+	}
+	return response.NoContent(c)
+}
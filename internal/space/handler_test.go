@@ -0,0 +1,289 @@
+package space_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/space"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func inSpace(ref string) map[string]string {
+	return map[string]string{space.Header: ref}
+}
+
+func TestSpaces(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_space@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_space@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	var acme, beta models.Space
+	var defaultType, acmeType models.ContentType
+
+	t.Run("Admin - Create spaces", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", "/spaces/", map[string]interface{}{
+			"name": "Acme", "slug": "acme",
+		}, adminToken)
+		assert.Equal(t, 201, resp.Code)
+		var result struct {
+			Data models.Space `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &result)
+		acme = result.Data
+
+		resp, _ = testutils.MakeRequest(app, "POST", "/spaces/", map[string]interface{}{
+			"name": "Beta", "slug": "beta",
+		}, adminToken)
+		assert.Equal(t, 201, resp.Code)
+		testutils.ParseResponse(t, resp, &result)
+		beta = result.Data
+
+		for _, slug := range []string{"acme", "42", "Not A Slug"} {
+			resp, _ = testutils.MakeRequest(app, "POST", "/spaces/", map[string]interface{}{
+				"name": "Bad", "slug": slug,
+			}, adminToken)
+			assert.Equal(t, 400, resp.Code, slug)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/spaces/", nil, adminToken)
+		var list struct {
+			Data []models.Space `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &list)
+		if assert.Len(t, list.Data, 3) {
+			assert.Equal(t, "default", list.Data[0].Slug)
+		}
+	})
+
+	t.Run("Success - Content types are isolated per space", func(t *testing.T) {
+		body := map[string]interface{}{"name": "Article", "slug": "article"}
+		var result struct {
+			Data models.ContentType `json:"data"`
+		}
+
+		resp, _ := testutils.MakeRequest(app, "POST", "/content/types", body, adminToken)
+		assert.Equal(t, 201, resp.Code)
+		testutils.ParseResponse(t, resp, &result)
+		defaultType = result.Data
+		assert.Equal(t, models.DefaultSpaceID, defaultType.SpaceID)
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "POST", "/content/types", body, adminToken, inSpace("acme"))
+		assert.Equal(t, 201, resp.Code, "slugs only need to be unique within a space")
+		testutils.ParseResponse(t, resp, &result)
+		acmeType = result.Data
+		assert.Equal(t, acme.ID, acmeType.SpaceID)
+
+		var list struct {
+			Data []models.ContentType `json:"data"`
+		}
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/content/types", nil, adminToken, inSpace(fmt.Sprint(acme.ID)))
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &list)
+		if assert.Len(t, list.Data, 1) {
+			assert.Equal(t, acmeType.ID, list.Data[0].ID)
+		}
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", fmt.Sprintf("/content/types/%d", defaultType.ID), nil, adminToken, inSpace("acme"))
+		assert.Equal(t, 404, resp.Code)
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "POST", fmt.Sprintf("/content/types/%d/fields", defaultType.ID),
+			map[string]interface{}{"name": "title", "type": "text"}, adminToken, inSpace("acme"))
+		assert.Equal(t, 404, resp.Code, "fields cannot be added to another space's type")
+	})
+
+	t.Run("Success - Entries and media are isolated per space", func(t *testing.T) {
+		acmeCtx := database.WithSpace(context.Background(), acme.ID)
+		acmeEntry, err := content.CreateContentEntry(acmeCtx, acmeType.ID, admin.ID, map[string]interface{}{})
+		assert.NoError(t, err)
+		assert.Equal(t, acme.ID, acmeEntry.SpaceID)
+
+		_, err = content.CreateContentEntry(acmeCtx, defaultType.ID, admin.ID, map[string]interface{}{})
+		assert.Error(t, err, "content type of another space is not found")
+
+		resp, _ := testutils.MakeRequestWithHeaders(app, "GET", fmt.Sprintf("/content/entries/%d", acmeEntry.ID), nil, adminToken, inSpace("acme"))
+		assert.Equal(t, 200, resp.Code)
+		resp, _ = testutils.MakeRequest(app, "GET", fmt.Sprintf("/content/entries/%d", acmeEntry.ID), nil, adminToken)
+		assert.Equal(t, 404, resp.Code)
+		resp, _ = testutils.MakeRequest(app, "GET", fmt.Sprintf("/workflow/entries/%d/history", acmeEntry.ID), nil, adminToken)
+		assert.Equal(t, 404, resp.Code, "workflow history of another space's entry")
+		resp, _ = testutils.MakeRequest(app, "POST", fmt.Sprintf("/workflow/entries/%d/assign", acmeEntry.ID),
+			map[string]interface{}{"assigned_to": editor.ID}, adminToken)
+		assert.Equal(t, 404, resp.Code, "another space's entry cannot be assigned")
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", fmt.Sprintf("/workflow/entries/%d/history", acmeEntry.ID), nil, adminToken, inSpace("acme"))
+		assert.Equal(t, 200, resp.Code)
+
+		database.DB.Create(&models.MediaFile{SpaceID: acme.ID, FileName: "acme.png", URL: "/uploads/acme.png", Type: "image/png", UploadedBy: admin.ID})
+		database.DB.Create(&models.MediaFile{FileName: "default.png", URL: "/uploads/default.png", Type: "image/png", UploadedBy: admin.ID})
+
+		var media struct {
+			Data []models.MediaFile `json:"data"`
+		}
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/media/", nil, adminToken, inSpace("acme"))
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &media)
+		if assert.Len(t, media.Data, 1) {
+			assert.Equal(t, "acme.png", media.Data[0].FileName)
+		}
+	})
+
+	t.Run("Error - Non-member is forbidden", func(t *testing.T) {
+		resp, _ := testutils.MakeRequestWithHeaders(app, "GET", "/content/types", nil, editorToken, inSpace("acme"))
+		assert.Equal(t, 403, resp.Code)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/content/types", nil, editorToken)
+		assert.Equal(t, 200, resp.Code, "everyone works in the default space")
+	})
+
+	t.Run("Error - Unknown space", func(t *testing.T) {
+		resp, _ := testutils.MakeRequestWithHeaders(app, "GET", "/content/types", nil, adminToken, inSpace("nope"))
+		assert.Equal(t, 404, resp.Code)
+	})
+
+	var readerRole models.Role
+	t.Run("Success - Members use their role in the space", func(t *testing.T) {
+		resp, _ := testutils.MakeRequestWithHeaders(app, "POST", "/roles/", map[string]interface{}{
+			"name": "editor",
+			"permissions": []map[string]interface{}{
+				{"module": "ContentEntry", "action": "read", "field_scope": "all"},
+			},
+		}, adminToken, inSpace("acme"))
+		assert.Equal(t, 201, resp.Code, "role names only need to be unique within a space")
+		var role struct {
+			Data models.Role `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &role)
+		readerRole = role.Data
+		assert.Equal(t, acme.ID, readerRole.SpaceID)
+
+		var roles struct {
+			Data []models.Role `json:"data"`
+		}
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/roles/", nil, adminToken, inSpace("acme"))
+		testutils.ParseResponse(t, resp, &roles)
+		assert.Len(t, roles.Data, 1)
+
+		resp, _ = testutils.MakeRequest(app, "PUT", fmt.Sprintf("/spaces/%d/members/%d", acme.ID, editor.ID),
+			map[string]interface{}{"role_id": readerRole.ID}, adminToken)
+		assert.Equal(t, 200, resp.Code)
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/content/types", nil, editorToken, inSpace("acme"))
+		assert.Equal(t, 200, resp.Code)
+
+		body := map[string]interface{}{"name": "Page", "slug": "page"}
+		resp, _ = testutils.MakeRequestWithHeaders(app, "POST", "/content/types", body, editorToken, inSpace("acme"))
+		assert.Equal(t, 403, resp.Code, "the acme role only reads")
+		resp, _ = testutils.MakeRequest(app, "POST", "/content/types", body, editorToken)
+		assert.Equal(t, 201, resp.Code, "the account role still applies in the default space")
+
+		resp, _ = testutils.MakeRequest(app, "PUT", fmt.Sprintf("/spaces/%d/members/%d", beta.ID, editor.ID),
+			map[string]interface{}{"role_id": readerRole.ID}, adminToken)
+		assert.Equal(t, 400, resp.Code, "roles of another space cannot be used")
+
+		var mine struct {
+			Data []models.Space `json:"data"`
+		}
+		resp, _ = testutils.MakeRequest(app, "GET", "/spaces/mine", nil, editorToken)
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &mine)
+		if assert.Len(t, mine.Data, 2) {
+			assert.Equal(t, "acme", mine.Data[1].Slug)
+		}
+
+		var members struct {
+			Data []models.SpaceMembership `json:"data"`
+		}
+		resp, _ = testutils.MakeRequest(app, "GET", fmt.Sprintf("/spaces/%d/members", acme.ID), nil, adminToken)
+		testutils.ParseResponse(t, resp, &members)
+		if assert.Len(t, members.Data, 1) {
+			assert.Equal(t, editor.ID, members.Data[0].UserID)
+		}
+	})
+
+	t.Run("Success - Assigning a role in a space sets the membership", func(t *testing.T) {
+		author := testutils.CreateTestUser(t, database.DB, "author_space@test.com", "password", "editor")
+
+		resp, _ := testutils.MakeRequestWithHeaders(app, "POST", "/roles/assign", map[string]interface{}{
+			"user_id": author.ID, "role_id": readerRole.ID,
+		}, adminToken, inSpace("acme"))
+		assert.Equal(t, 200, resp.Code)
+
+		var membership models.SpaceMembership
+		assert.NoError(t, database.DB.Where("space_id = ? AND user_id = ?", acme.ID, author.ID).First(&membership).Error)
+		assert.Equal(t, readerRole.ID, membership.RoleID)
+
+		var user models.User
+		database.DB.First(&user, author.ID)
+		assert.Equal(t, author.RoleID, user.RoleID, "the account role is untouched")
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "POST", "/roles/assign", map[string]interface{}{
+			"user_id": author.ID, "role_id": readerRole.ID,
+		}, adminToken, inSpace("beta"))
+		assert.Equal(t, 400, resp.Code, "roles of another space cannot be assigned")
+
+		database.DB.Where("space_id = ? AND user_id = ?", acme.ID, author.ID).Delete(&models.SpaceMembership{})
+	})
+
+	t.Run("Success - Subdomain selects the space", func(t *testing.T) {
+		var list struct {
+			Data []models.ContentType `json:"data"`
+		}
+		resp, _ := testutils.MakeRequest(app, "GET", "http://acme.cms.example.com/content/types", nil, adminToken)
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &list)
+		if assert.Len(t, list.Data, 1) {
+			assert.Equal(t, acmeType.ID, list.Data[0].ID)
+		}
+
+		resp, _ = testutils.MakeRequest(app, "GET", "http://www.cms.example.com/content/types", nil, adminToken)
+		testutils.ParseResponse(t, resp, &list)
+		assert.Len(t, list.Data, 2, "unknown subdomains use the default space")
+	})
+
+	t.Run("Admin - Delete spaces and members", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "DELETE", fmt.Sprintf("/spaces/%d", acme.ID), nil, adminToken)
+		assert.Equal(t, 409, resp.Code, "space still has content types")
+
+		resp, _ = testutils.MakeRequest(app, "DELETE", fmt.Sprintf("/spaces/%d", models.DefaultSpaceID), nil, adminToken)
+		assert.Equal(t, 409, resp.Code)
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "POST", "/roles/", map[string]interface{}{
+			"name": "reviewer",
+		}, adminToken, inSpace("beta"))
+		assert.Equal(t, 201, resp.Code)
+		webhook := models.Webhook{SpaceID: beta.ID, Name: "Beta hook", URL: "http://localhost/hook", Active: true}
+		database.DB.Create(&webhook)
+
+		resp, _ = testutils.MakeRequest(app, "DELETE", fmt.Sprintf("/spaces/%d", beta.ID), nil, adminToken)
+		assert.Equal(t, 409, resp.Code, "space still has a webhook")
+
+		database.DB.Delete(&webhook)
+		resp, _ = testutils.MakeRequest(app, "DELETE", fmt.Sprintf("/spaces/%d", beta.ID), nil, adminToken)
+		assert.Equal(t, 204, resp.Code)
+
+		var roles int64
+		database.DB.Unscoped().Model(&models.Role{}).Where("space_id = ?", beta.ID).Count(&roles)
+		assert.Zero(t, roles, "the space's roles are deleted with it")
+
+		resp, _ = testutils.MakeRequest(app, "DELETE", fmt.Sprintf("/spaces/%d/members/%d", acme.ID, editor.ID), nil, adminToken)
+		assert.Equal(t, 204, resp.Code)
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/content/types", nil, editorToken, inSpace("acme"))
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Error - Non-admin cannot manage spaces", func(t *testing.T) {
+		resp, _ := testutils.MakeRequest(app, "POST", "/spaces/", map[string]interface{}{
+			"name": "Gamma", "slug": "gamma",
+		}, editorToken)
+		assert.Equal(t, 403, resp.Code)
+	})
+}
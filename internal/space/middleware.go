@@ -0,0 +1,51 @@
+package space
+
+import (
+	"strings"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Header selects the space a request works in, by ID or slug.
+const Header = "X-Space"
+
+// Resolve picks the space for the request from the X-Space header or, failing
+// that, from a subdomain matching a space slug, and binds it to the request's
+// user context so queries made with it are scoped to the space. Requests that
+// pick neither use the default space.
+func Resolve() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		spaceID := models.DefaultSpaceID
+
+		if ref := c.Get(Header); ref != "" {
+			space, err := FindSpace(ref)
+			if err != nil {
+				return response.NotFound(c, "Space")
+			}
+			spaceID = space.ID
+		} else if sub := subdomain(c.Hostname()); sub != "" {
+			var space models.Space
+			if database.DB.Where("slug = ?", sub).First(&space).Error == nil {
+				spaceID = space.ID
+			}
+		}
+
+		c.Locals("space_id", spaceID)
+		c.SetUserContext(database.WithSpace(c.UserContext(), spaceID))
+		return c.Next()
+	}
+}
+
+func subdomain(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return ""
+	}
+	return strings.ToLower(labels[0])
+}
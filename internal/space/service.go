@@ -0,0 +1,263 @@
+package space
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+var (
+	ErrSpaceNotFound      = errors.New("space not found")
+	ErrMembershipNotFound = errors.New("membership not found")
+	ErrDefaultSpace       = errors.New("the default space cannot be deleted")
+	ErrSpaceNotEmpty      = errors.New("space is not empty")
+)
+
+type SpaceInput struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+}
+
+func validateInput(input SpaceInput, id uint) error {
+	if input.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !slugPattern.MatchString(input.Slug) {
+		return fmt.Errorf("slug must be lowercase letters, numbers and hyphens")
+	}
+	// Requests pick a space by ID or slug, so a numeric slug would be
+	// ambiguous.
+	if _, err := strconv.ParseUint(input.Slug, 10, 64); err == nil {
+		return fmt.Errorf("slug must not be a number")
+	}
+
+	var count int64
+	database.DB.Model(&models.Space{}).Where("slug = ? AND id <> ?", input.Slug, id).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("slug %s is already taken", input.Slug)
+	}
+	return nil
+}
+
+func CreateSpace(input SpaceInput) (*models.Space, error) {
+	if err := validateInput(input, 0); err != nil {
+		return nil, err
+	}
+
+	space := models.Space{Name: input.Name, Slug: input.Slug, Description: input.Description}
+	if err := database.DB.Create(&space).Error; err != nil {
+		return nil, err
+	}
+	return &space, nil
+}
+
+func GetSpace(id uint) (*models.Space, error) {
+	var space models.Space
+	if err := database.DB.First(&space, id).Error; err != nil {
+		return nil, ErrSpaceNotFound
+	}
+	return &space, nil
+}
+
+// FindSpace looks a space up by ID or slug.
+func FindSpace(ref string) (*models.Space, error) {
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return GetSpace(uint(id))
+	}
+
+	var space models.Space
+	if err := database.DB.Where("slug = ?", ref).First(&space).Error; err != nil {
+		return nil, ErrSpaceNotFound
+	}
+	return &space, nil
+}
+
+func ListSpaces() ([]models.Space, error) {
+	var spaces []models.Space
+	err := database.DB.Order("id ASC").Find(&spaces).Error
+	return spaces, err
+}
+
+// ListUserSpaces returns the spaces the user can work in: the default space,
+// every space they are a member of, and every space for admins.
+func ListUserSpaces(userID uint) ([]models.Space, error) {
+	var user models.User
+	if err := database.DB.Preload("Role").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.Role != nil && user.Role.Name == "admin" {
+		return ListSpaces()
+	}
+
+	var spaces []models.Space
+	err := database.DB.
+		Where("id = ? OR id IN (?)", models.DefaultSpaceID,
+			database.DB.Model(&models.SpaceMembership{}).Select("space_id").Where("user_id = ?", userID)).
+		Order("id ASC").
+		Find(&spaces).Error
+	return spaces, err
+}
+
+func UpdateSpace(id uint, input SpaceInput) (*models.Space, error) {
+	space, err := GetSpace(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateInput(input, id); err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.Model(space).Updates(map[string]interface{}{
+		"name":        input.Name,
+		"slug":        input.Slug,
+		"description": input.Description,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return GetSpace(id)
+}
+
+// spaceContent is what has to be removed from a space before it can be
+// deleted, named as reported to the caller.
+var spaceContent = []struct {
+	name  string
+	model interface{}
+}{
+	{"content types", &models.ContentType{}},
+	{"entries", &models.ContentEntry{}},
+	{"media", &models.MediaFile{}},
+	{"media folders", &models.MediaFolder{}},
+	{"workflows", &models.WorkflowDefinition{}},
+	{"releases", &models.Release{}},
+	{"webhooks", &models.Webhook{}},
+}
+
+// DeleteSpace removes a space once its content, media, workflows, releases
+// and webhooks are gone. Its memberships, roles and environments are deleted
+// with it.
+func DeleteSpace(id uint) error {
+	if id == models.DefaultSpaceID {
+		return ErrDefaultSpace
+	}
+	space, err := GetSpace(id)
+	if err != nil {
+		return err
+	}
+
+	var remaining []string
+	for _, content := range spaceContent {
+		var count int64
+		if err := database.DB.Model(content.model).Where("space_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			remaining = append(remaining, content.name)
+		}
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%w: %s", ErrSpaceNotEmpty, strings.Join(remaining, ", "))
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("space_id = ?", id).Delete(&models.SpaceMembership{}).Error; err != nil {
+			return err
+		}
+		roles := tx.Model(&models.Role{}).Select("id").Where("space_id = ?", id)
+		if err := tx.Unscoped().Where("role_id IN (?)", roles).Delete(&models.Permission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("space_id = ?", id).Delete(&models.Role{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("space_id = ?", id).Delete(&models.Environment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(space).Error
+	})
+}
+
+func ListMembers(spaceID uint) ([]models.SpaceMembership, error) {
+	var members []models.SpaceMembership
+	err := database.DB.
+		Preload("User").
+		Preload("Role").
+		Where("space_id = ?", spaceID).
+		Order("id ASC").
+		Find(&members).Error
+	return members, err
+}
+
+// SetMember adds the user to the space, or changes their role there. The role
+// must belong to the space or to the default space.
+func SetMember(spaceID, userID, roleID uint) (*models.SpaceMembership, error) {
+	if _, err := GetSpace(spaceID); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	var role models.Role
+	if err := database.DB.
+		Where("space_id IN ?", []uint{spaceID, models.DefaultSpaceID}).
+		First(&role, roleID).Error; err != nil {
+		return nil, fmt.Errorf("role not found in this space")
+	}
+
+	var membership models.SpaceMembership
+	err := database.DB.Where("space_id = ? AND user_id = ?", spaceID, userID).First(&membership).Error
+	if err == nil {
+		err = database.DB.Model(&membership).Update("role_id", roleID).Error
+	} else {
+		membership = models.SpaceMembership{SpaceID: spaceID, UserID: userID, RoleID: roleID}
+		err = database.DB.Create(&membership).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	database.DB.Preload("User").Preload("Role").First(&membership, membership.ID)
+	return &membership, nil
+}
+
+func RemoveMember(spaceID, userID uint) error {
+	result := database.DB.Where("space_id = ? AND user_id = ?", spaceID, userID).Delete(&models.SpaceMembership{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMembershipNotFound
+	}
+	return nil
+}
+
+// CanEnter reports whether the user may work in the space: everyone may work
+// in the default space, members in theirs, and admins anywhere.
+func CanEnter(spaceID, userID uint) bool {
+	if spaceID == models.DefaultSpaceID {
+		return true
+	}
+
+	var count int64
+	database.DB.Model(&models.SpaceMembership{}).Where("space_id = ? AND user_id = ?", spaceID, userID).Count(&count)
+	if count > 0 {
+		return true
+	}
+
+	var user models.User
+	if err := database.DB.Preload("Role").First(&user, userID).Error; err != nil {
+		return false
+	}
+	return user.Role != nil && user.Role.Name == "admin"
+}
@@ -24,6 +24,9 @@ func TestDB(t *testing.T) *gorm.DB {
 
 	err = db.AutoMigrate(
 		&models.User{},
+		&models.Space{},
+		&models.SpaceMembership{},
+		&models.Environment{},
 		&models.Role{},
 		&models.Permission{},
 		&models.ContentType{},
@@ -32,14 +35,34 @@ func TestDB(t *testing.T) *gorm.DB {
 		&models.ContentRelation{},
 		&models.ResetToken{},
 		&models.RefreshToken{},
+		&models.WorkflowDefinition{},
 		&models.WorkflowTransition{},
+		&models.ApprovalStage{},
+		&models.TransitionGuard{},
 		&models.WorkflowHistory{},
 		&models.WorkflowComment{},
+		&models.CommentMention{},
 		&models.WorkflowAssignment{},
+		&models.Release{},
+		&models.ReleaseItem{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.AuditLog{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.FeedEvent{},
+		&models.StreamTicket{},
+		&models.Job{},
+		&models.Export{},
+		&models.ScheduledTask{},
 		&models.MediaFile{},
 		&models.MediaFolder{},
+		&models.EntryLock{},
+		&models.EntryPresence{},
 	)
 	assert.NoError(t, err, "Failed to migrate test database")
+	assert.NoError(t, database.EnsureDefaultSpace(db), "Failed to create default space")
+	assert.NoError(t, database.RegisterSpaceScope(db), "Failed to register space scope")
 
 	return db
 }
@@ -172,6 +195,10 @@ func GetAuthToken(t *testing.T, userID uint, roleName string) string {
 }
 
 func MakeRequest(app *fiber.App, method, url string, body interface{}, token string) (*httptest.ResponseRecorder, error) {
+	return MakeRequestWithHeaders(app, method, url, body, token, nil)
+}
+
+func MakeRequestWithHeaders(app *fiber.App, method, url string, body interface{}, token string, headers map[string]string) (*httptest.ResponseRecorder, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		jsonBody, _ := json.Marshal(body)
@@ -185,6 +212,10 @@ func MakeRequest(app *fiber.App, method, url string, body interface{}, token str
 		req.Header.Set("Authorization", "Bearer "+token)
 	}
 
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
 	rec := httptest.NewRecorder()
 
 	resp, err := app.Test(req, -1)
@@ -194,6 +225,12 @@ func MakeRequest(app *fiber.App, method, url string, body interface{}, token str
 
 	rec.Code = resp.StatusCode
 
+	for k, v := range resp.Header {
+		for _, val := range v {
+			rec.Header().Add(k, val)
+		}
+	}
+
 	io.Copy(rec.Body, resp.Body)
 	resp.Body.Close()
 
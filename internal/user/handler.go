@@ -1,13 +1,44 @@
 package user
 
 import (
+	"log"
+
+	"github.com/Kyz7/cms/internal/audit"
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/mail"
 	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// sendInvite tells a user created by an administrator that their account
+// exists.
+func sendInvite(c *fiber.Ctx, user *models.User) {
+	inviterName := "An administrator"
+	if inviterID, ok := c.Locals("user_id").(uint); ok {
+		var inviter models.User
+		if err := database.DB.First(&inviter, inviterID).Error; err == nil {
+			inviterName = inviter.Name
+		}
+	}
+
+	roleName := ""
+	if user.Role != nil {
+		roleName = user.Role.Name
+	}
+
+	err := mail.Send(user.Email, mail.TemplateInvite, map[string]interface{}{
+		"Name":        user.Name,
+		"InviterName": inviterName,
+		"RoleName":    roleName,
+		"AcceptURL":   mail.Link("login"),
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to send invite to %s: %v", user.Email, err)
+	}
+}
+
 func CreateUserHandler(c *fiber.Ctx) error {
 	var body struct {
 		Email    string `json:"email"`
@@ -22,7 +53,7 @@ func CreateUserHandler(c *fiber.Ctx) error {
 
 	if body.RoleID != 0 {
 		var role models.Role
-		if err := database.DB.First(&role, body.RoleID).Error; err != nil {
+		if err := database.DB.Where("space_id = ?", models.DefaultSpaceID).First(&role, body.RoleID).Error; err != nil {
 			return response.NotFound(c, "Role")
 		}
 	}
@@ -57,6 +88,8 @@ func CreateUserHandler(c *fiber.Ctx) error {
 
 	database.DB.Preload("Role.Permissions").First(&user, user.ID)
 	user.Password = ""
+	audit.Record(c, "user.create", "user", user.ID, nil, user)
+	sendInvite(c, &user)
 
 	return response.Created(c, user, "User created successfully")
 }
@@ -111,6 +144,7 @@ func UpdateUserHandler(c *fiber.Ctx) error {
 	if err := database.DB.First(&user, id).Error; err != nil {
 		return response.NotFound(c, "User")
 	}
+	before := user
 
 	if body.Email != "" && body.Email != user.Email {
 		var existing models.User
@@ -126,7 +160,7 @@ func UpdateUserHandler(c *fiber.Ctx) error {
 
 	if body.RoleID != 0 {
 		var role models.Role
-		if err := database.DB.First(&role, body.RoleID).Error; err != nil {
+		if err := database.DB.Where("space_id = ?", models.DefaultSpaceID).First(&role, body.RoleID).Error; err != nil {
 			return response.NotFound(c, "Role")
 		}
 		user.RoleID = body.RoleID
@@ -138,6 +172,7 @@ func UpdateUserHandler(c *fiber.Ctx) error {
 
 	database.DB.Preload("Role.Permissions").First(&user, user.ID)
 	user.Password = ""
+	audit.Record(c, "user.update", "user", user.ID, before, user)
 
 	return response.Success(c, user, "User updated successfully")
 }
@@ -161,6 +196,7 @@ func DeleteUserHandler(c *fiber.Ctx) error {
 	if err := database.DB.Delete(&user).Error; err != nil {
 		return response.InternalError(c, "Failed to delete user")
 	}
+	audit.Record(c, "user.delete", "user", user.ID, user, nil)
 
 	return response.NoContent(c)
 }
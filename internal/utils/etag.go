@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// VersionField is the reserved body key carrying the expected entry version
+// when a client cannot send If-Match. The underscore keeps it clear of field
+// names, so a content field called "version" is stored like any other.
+const VersionField = "_version"
+
+var ErrVersionRequired = errors.New("If-Match header or _version field is required")
+
+func FormatETag(version uint) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ParseETag accepts strong, weak (W/"3") and bare (3) entity tags.
+func ParseETag(value string) (uint, error) {
+	tag := strings.TrimSpace(value)
+	tag = strings.TrimPrefix(tag, "W/")
+	tag = strings.Trim(tag, `"`)
+
+	version, err := strconv.ParseUint(tag, 10, 32)
+	if err != nil || version == 0 {
+		return 0, fmt.Errorf("invalid entity tag: %s", value)
+	}
+	return uint(version), nil
+}
+
+// EntryVersionFromRequest reads the version a client expects to overwrite,
+// preferring the If-Match header over a "_version" field in the request body.
+func EntryVersionFromRequest(c *fiber.Ctx) (uint, error) {
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" {
+		return ParseETag(ifMatch)
+	}
+
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if value := c.FormValue(VersionField); value != "" {
+			return ParseETag(value)
+		}
+		return 0, ErrVersionRequired
+	}
+
+	var body struct {
+		Version json.Number `json:"_version"`
+	}
+	if len(c.Body()) == 0 || json.Unmarshal(c.Body(), &body) != nil || body.Version == "" {
+		return 0, ErrVersionRequired
+	}
+	return ParseETag(body.Version.String())
+}
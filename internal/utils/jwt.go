@@ -79,7 +79,7 @@ func ParseJWT(tokenStr string) (uint, error) {
 
 func GetDefaultViewerRoleID() (uint, error) {
 	var role models.Role
-	if err := database.DB.Where("name = ?", "viewer").First(&role).Error; err != nil {
+	if err := database.DB.Where("name = ? AND space_id = ?", "viewer", models.DefaultSpaceID).First(&role).Error; err != nil {
 		return 0, err
 	}
 	if role.ID == 0 {
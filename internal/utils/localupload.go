@@ -20,6 +20,10 @@ const (
 	OthersPath     = "./uploads/others"
 )
 
+// PrivateBasePath holds local files that are only served through the API.
+// Unlike UploadBasePath it is not exposed as a static directory.
+var PrivateBasePath = "./private"
+
 func InitLocalStorage() error {
 	directories := []string{
 		UploadBasePath,
@@ -134,3 +138,56 @@ func FileExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	return !os.IsNotExist(err)
 }
+
+func privateLocalPath(key string) (string, error) {
+	baseAbs, err := filepath.Abs(PrivateBasePath)
+	if err != nil {
+		return "", fmt.Errorf("invalid base path: %v", err)
+	}
+	absPath := filepath.Join(baseAbs, filepath.FromSlash(key))
+	if !strings.HasPrefix(absPath, baseAbs+string(filepath.Separator)) {
+		return "", fmt.Errorf("file path outside private directory")
+	}
+	return absPath, nil
+}
+
+func SavePrivateToLocal(key string, body io.Reader) error {
+	path, err := privateLocalPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, body); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to save file: %v", err)
+	}
+	return nil
+}
+
+func OpenPrivateFromLocal(key string) (io.ReadCloser, error) {
+	path, err := privateLocalPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func DeletePrivateFromLocal(key string) error {
+	path, err := privateLocalPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Ranks are fractional indexes: strings that sort byte by byte, where a new
+// rank can always be made between any two others, so moving an item never
+// renumbers its neighbours. A rank is an integer part, whose first character
+// gives its length (a-z for positive, A-Z for negative), followed by an
+// optional fraction that never ends in the zero digit.
+const rankDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	rankZero     = "a0"
+	rankSmallest = "A00000000000000000000000000"
+)
+
+// RankBetween returns a rank sorting after a and before b. An empty a means
+// before everything, an empty b after everything.
+func RankBetween(a, b string) (string, error) {
+	for _, rank := range []string{a, b} {
+		if rank != "" {
+			if err := validateRank(rank); err != nil {
+				return "", err
+			}
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", fmt.Errorf("rank %s does not sort before %s", a, b)
+	}
+
+	switch {
+	case a == "" && b == "":
+		return rankZero, nil
+
+	case a == "":
+		ib, _ := rankInteger(b)
+		fb := b[len(ib):]
+		if ib == rankSmallest {
+			return ib + rankMidpoint("", fb), nil
+		}
+		if ib < b {
+			return ib, nil
+		}
+		if i, ok := decrementRankInteger(ib); ok {
+			return i, nil
+		}
+		return "", fmt.Errorf("no rank sorts before %s", b)
+
+	case b == "":
+		ia, _ := rankInteger(a)
+		if i, ok := incrementRankInteger(ia); ok {
+			return i, nil
+		}
+		return ia + rankMidpoint(a[len(ia):], ""), nil
+	}
+
+	ia, _ := rankInteger(a)
+	ib, _ := rankInteger(b)
+	if ia == ib {
+		return ia + rankMidpoint(a[len(ia):], b[len(ib):]), nil
+	}
+	i, ok := incrementRankInteger(ia)
+	if !ok {
+		return "", fmt.Errorf("no rank sorts after %s", a)
+	}
+	if i < b {
+		return i, nil
+	}
+	return ia + rankMidpoint(a[len(ia):], ""), nil
+}
+
+// RankColumn is the rank column compared byte by byte, the order ranks are
+// made in. Postgres would otherwise compare with the locale's collation.
+func RankColumn(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return `rank COLLATE "C"`
+	}
+	return "rank"
+}
+
+func rankIntegerLength(head byte) (int, error) {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2, nil
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2, nil
+	default:
+		return 0, fmt.Errorf("invalid rank head %q", head)
+	}
+}
+
+func rankInteger(rank string) (string, error) {
+	length, err := rankIntegerLength(rank[0])
+	if err != nil {
+		return "", err
+	}
+	if length > len(rank) {
+		return "", fmt.Errorf("invalid rank %s", rank)
+	}
+	return rank[:length], nil
+}
+
+func validateRank(rank string) error {
+	if rank == rankSmallest {
+		return fmt.Errorf("invalid rank %s", rank)
+	}
+	integer, err := rankInteger(rank)
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(rank); i++ {
+		if strings.IndexByte(rankDigits, rank[i]) < 0 {
+			return fmt.Errorf("invalid rank %s", rank)
+		}
+	}
+	if len(rank) > len(integer) && rank[len(rank)-1] == rankDigits[0] {
+		return fmt.Errorf("invalid rank %s", rank)
+	}
+	return nil
+}
+
+// rankMidpoint returns a fraction between a and b, b empty meaning 1.
+func rankMidpoint(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + rankMidpoint(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(rankDigits, a[0])
+	}
+	digitB := len(rankDigits)
+	if b != "" {
+		digitB = strings.IndexByte(rankDigits, b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(rankDigits[(digitA+digitB+1)/2])
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if a != "" {
+		rest = a[1:]
+	}
+	return string(rankDigits[digitA]) + rankMidpoint(rest, "")
+}
+
+func rankDigitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return rankDigits[0]
+}
+
+func incrementRankInteger(integer string) (string, bool) {
+	head, digits := integer[0], []byte(integer[1:])
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := strings.IndexByte(rankDigits, digits[i]) + 1
+		if d < len(rankDigits) {
+			digits[i] = rankDigits[d]
+			return string(head) + string(digits), true
+		}
+		digits[i] = rankDigits[0]
+	}
+
+	switch head {
+	case 'Z':
+		return rankZero, true
+	case 'z':
+		return "", false
+	}
+	head++
+	if head > 'a' {
+		digits = append(digits, rankDigits[0])
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits), true
+}
+
+func decrementRankInteger(integer string) (string, bool) {
+	last := rankDigits[len(rankDigits)-1]
+	head, digits := integer[0], []byte(integer[1:])
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := strings.IndexByte(rankDigits, digits[i]) - 1
+		if d >= 0 {
+			digits[i] = rankDigits[d]
+			return string(head) + string(digits), true
+		}
+		digits[i] = last
+	}
+
+	switch head {
+	case 'a':
+		return "Z" + string(last), true
+	case 'A':
+		return "", false
+	}
+	head--
+	if head < 'Z' {
+		digits = append(digits, last)
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits), true
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	"mime/multipart"
 	"path/filepath"
 	"time"
@@ -108,6 +109,79 @@ func DeleteFromS3(url string) error {
 	return err
 }
 
+// SavePrivateFile stores a file under key without making it public. Private
+// files are read back through OpenPrivateFile and served by the API.
+func SavePrivateFile(key string, body io.ReadSeeker, contentType string) error {
+	if UseLocalStorage {
+		return SavePrivateToLocal(key, body)
+	}
+	return SavePrivateToS3(key, body, contentType)
+}
+
+func OpenPrivateFile(key string) (io.ReadCloser, error) {
+	if UseLocalStorage {
+		return OpenPrivateFromLocal(key)
+	}
+	return OpenPrivateFromS3(key)
+}
+
+func DeletePrivateFile(key string) error {
+	if UseLocalStorage {
+		return DeletePrivateFromLocal(key)
+	}
+	return DeletePrivateFromS3(key)
+}
+
+func SavePrivateToS3(key string, body io.ReadSeeker, contentType string) error {
+	if S3Session == nil {
+		return fmt.Errorf("S3 not initialized")
+	}
+
+	svc := s3.New(S3Session)
+
+	_, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(S3Bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+
+	return err
+}
+
+func OpenPrivateFromS3(key string) (io.ReadCloser, error) {
+	if S3Session == nil {
+		return nil, fmt.Errorf("S3 not initialized")
+	}
+
+	svc := s3.New(S3Session)
+
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
+
+func DeletePrivateFromS3(key string) error {
+	if S3Session == nil {
+		return fmt.Errorf("S3 not initialized")
+	}
+
+	svc := s3.New(S3Session)
+
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
 func extractKeyFromURL(url string) string {
 	// TODO: Implement based on your URL structure
 	// Example: https://bucket.s3.region.amazonaws.com/2024/01/uuid.jpg
@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+const (
+	HeaderEvent     = "X-CMS-Event"
+	HeaderDelivery  = "X-CMS-Delivery"
+	HeaderSignature = "X-CMS-Signature"
+
+	// JobDeliver is the job type that sends one delivery.
+	JobDeliver = "webhook.deliver"
+	// Queue is the job queue webhooks are delivered from, so a slow receiver
+	// only holds up other deliveries.
+	Queue = "webhook"
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	// and its job dead-lettered.
+	MaxAttempts = 6
+
+	maxResponseBody = 2048
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+type deliveryPayload struct {
+	DeliveryID uint `json:"delivery_id"`
+}
+
+func init() {
+	jobs.Register(JobDeliver, func(p deliveryPayload) error {
+		return Deliver(p.DeliveryID)
+	})
+}
+
+// Sign returns the X-CMS-Signature value for body: "sha256=" followed by the
+// hex HMAC-SHA256 of the raw body keyed with the webhook's secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queueDelivery stores delivery and queues the job that sends it.
+func queueDelivery(delivery *models.WebhookDelivery) error {
+	if err := database.DB.Create(delivery).Error; err != nil {
+		return err
+	}
+
+	job, err := jobs.Enqueue(JobDeliver, deliveryPayload{DeliveryID: delivery.ID}, jobs.Options{Queue: Queue, MaxAttempts: MaxAttempts})
+	if err != nil {
+		database.DB.Delete(&models.WebhookDelivery{}, delivery.ID)
+		return err
+	}
+
+	delivery.JobID = &job.ID
+	return database.DB.Model(delivery).Update("job_id", job.ID).Error
+}
+
+// Deliver posts a pending delivery once and records the outcome. A failed
+// attempt is returned so the job retries it; the attempt that uses up
+// MaxAttempts marks the delivery failed.
+func Deliver(deliveryID uint) error {
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, deliveryID).Error; err != nil {
+		return err
+	}
+	if delivery.Status != models.DeliveryPending {
+		return nil
+	}
+
+	var hook models.Webhook
+	if err := database.DB.First(&hook, delivery.WebhookID).Error; err != nil || !hook.Active {
+		return database.DB.Model(&delivery).Updates(map[string]interface{}{
+			"status": models.DeliveryFailed,
+			"error":  "webhook was deleted or disabled",
+		}).Error
+	}
+
+	code, body, duration, err := send(&hook, &delivery)
+	attempts := delivery.Attempts + 1
+	now := time.Now()
+
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"last_attempt_at": now,
+		"response_code":   code,
+		"response_body":   body,
+		"duration_ms":     duration.Milliseconds(),
+		"error":           "",
+	}
+
+	if err == nil && (code < 200 || code >= 300) {
+		err = fmt.Errorf("receiver responded with status %d", code)
+	}
+	switch {
+	case err == nil:
+		updates["status"] = models.DeliverySuccess
+		updates["delivered_at"] = now
+	case attempts >= MaxAttempts:
+		updates["status"] = models.DeliveryFailed
+	}
+	if err != nil {
+		updates["error"] = err.Error()
+	}
+
+	if dbErr := database.DB.Model(&delivery).Updates(updates).Error; dbErr != nil {
+		log.Printf("⚠️  Failed to record webhook delivery %d: %v", delivery.ID, dbErr)
+	}
+	return err
+}
+
+func send(hook *models.Webhook, delivery *models.WebhookDelivery) (int, string, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CMS-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, delivery.Payload))
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	duration := time.Since(start)
+	if err != nil {
+		return 0, "", duration, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, string(body), duration, nil
+}
+
+// Redeliver queues a past delivery's payload again as a new delivery, which
+// is retried like any other.
+func Redeliver(ctx context.Context, deliveryID uint) (*models.WebhookDelivery, error) {
+	original, err := GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := models.WebhookDelivery{
+		WebhookID:    original.WebhookID,
+		Event:        original.Event,
+		Payload:      original.Payload,
+		Status:       models.DeliveryPending,
+		RedeliveryOf: &original.ID,
+	}
+	if err := queueDelivery(&delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"sync"
+
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+var subscribeOnce sync.Once
+
+// dispatchEntry dispatches an event about entry, unless the entry is a copy in
+// another environment than main.
+func dispatchEntry(event string, entry models.ContentEntry, data interface{}) {
+	if !entry.InMainEnvironment() {
+		return
+	}
+	Dispatch(event, entry.SpaceID, &entry.ContentTypeID, data)
+}
+
+// Subscribe forwards domain events to webhook subscribers. It is safe to call
+// more than once.
+func Subscribe() {
+	subscribeOnce.Do(func() {
+		events.After(func(e events.EntryCreated) {
+			dispatchEntry(EventEntryCreated, e.Entry, e.Entry)
+		})
+		events.After(func(e events.EntryUpdated) {
+			dispatchEntry(EventEntryUpdated, e.Entry, e.Entry)
+		})
+		events.After(func(e events.EntryDeleted) {
+			dispatchEntry(EventEntryDeleted, e.Entry, map[string]interface{}{
+				"id":              e.Entry.ID,
+				"content_type_id": e.Entry.ContentTypeID,
+				"version":         e.Entry.Version,
+			})
+		})
+		events.After(func(e events.StatusChanged) {
+			dispatchEntry(EventEntryStatusChanged, e.Entry, map[string]interface{}{
+				"entry_id":        e.Entry.ID,
+				"content_type_id": e.Entry.ContentTypeID,
+				"from_status":     e.From,
+				"to_status":       e.To,
+				"version":         e.Entry.Version,
+				"changed_by":      e.UserID,
+				"entry":           e.Entry,
+			})
+		})
+		events.After(func(e events.MediaUploaded) {
+			Dispatch(EventMediaUploaded, e.Media.SpaceID, nil, e.Media)
+		})
+	})
+}
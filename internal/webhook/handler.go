@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"errors"
+
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func withoutSecret(hook models.Webhook) models.Webhook {
+	hook.Secret = ""
+	return hook
+}
+
+func ListWebhooksHandler(c *fiber.Ctx) error {
+	hooks, err := ListWebhooks(c.UserContext())
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch webhooks")
+	}
+
+	for i := range hooks {
+		hooks[i] = withoutSecret(hooks[i])
+	}
+	return response.Success(c, hooks, "Webhooks retrieved successfully")
+}
+
+func GetWebhookHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid webhook ID", nil)
+	}
+
+	hook, err := GetWebhook(c.UserContext(), uint(id))
+	if err != nil {
+		return response.NotFound(c, "Webhook")
+	}
+	return response.Success(c, withoutSecret(*hook), "Webhook retrieved successfully")
+}
+
+func CreateWebhookHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var body WebhookInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	hook, err := CreateWebhook(c.UserContext(), body, userID)
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+
+	// The secret is only ever shown here.
+	return response.Created(c, hook, "Webhook created successfully")
+}
+
+func UpdateWebhookHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid webhook ID", nil)
+	}
+
+	var body WebhookInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	hook, err := UpdateWebhook(c.UserContext(), uint(id), body)
+	if errors.Is(err, ErrWebhookNotFound) {
+		return response.NotFound(c, "Webhook")
+	}
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+	return response.Success(c, withoutSecret(*hook), "Webhook updated successfully")
+}
+
+func DeleteWebhookHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid webhook ID", nil)
+	}
+
+	if err := DeleteWebhook(c.UserContext(), uint(id)); err != nil {
+		if errors.Is(err, ErrWebhookNotFound) {
+			return response.NotFound(c, "Webhook")
+		}
+		return response.InternalError(c, "Failed to delete webhook")
+	}
+	return response.NoContent(c)
+}
+
+func ListDeliveriesHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid webhook ID", nil)
+	}
+
+	if _, err := GetWebhook(c.UserContext(), uint(id)); err != nil {
+		return response.NotFound(c, "Webhook")
+	}
+
+	deliveries, err := ListDeliveries(uint(id), c.Query("status"))
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch deliveries")
+	}
+	return response.Success(c, deliveries, "Deliveries retrieved successfully")
+}
+
+func GetDeliveryHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("delivery_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid delivery ID", nil)
+	}
+
+	delivery, err := GetDelivery(c.UserContext(), uint(id))
+	if err != nil {
+		return response.NotFound(c, "Delivery")
+	}
+	return response.Success(c, delivery, "Delivery retrieved successfully")
+}
+
+func RedeliverHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("delivery_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid delivery ID", nil)
+	}
+
+	delivery, err := Redeliver(c.UserContext(), uint(id))
+	if errors.Is(err, ErrDeliveryNotFound) {
+		return response.NotFound(c, "Delivery")
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to redeliver")
+	}
+	return response.Created(c, delivery, "Delivery queued again")
+}
+
+func ListEventsHandler(c *fiber.Ctx) error {
+	return response.Success(c, Events, "Webhook events retrieved successfully")
+}
@@ -0,0 +1,309 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/jobs"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/testutils"
+	"github.com/Kyz7/cms/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+type receivedRequest struct {
+	Event     string
+	Signature string
+	Body      []byte
+}
+
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []receivedRequest
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, receivedRequest{
+		Event:     req.Header.Get(webhook.HeaderEvent),
+		Signature: req.Header.Get(webhook.HeaderSignature),
+		Body:      body,
+	})
+	w.WriteHeader(r.status)
+	w.Write([]byte("ok"))
+}
+
+func (r *receiver) respondWith(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+// deliver runs every delivery job due at now and returns how many ran.
+func deliver(now time.Time) int {
+	cfg := jobs.Config{
+		Lease: time.Minute,
+		Retry: jobs.RetryPolicy{BaseDelay: time.Minute, MaxDelay: time.Hour},
+	}
+
+	runs := 0
+	for {
+		ran, _ := jobs.RunNext(webhook.Queue, now, cfg)
+		if !ran {
+			return runs
+		}
+		runs++
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	app := testutils.SetupTestApp(t)
+
+	admin := testutils.CreateTestUser(t, database.DB, "admin_webhooks@test.com", "password", "admin")
+	adminToken := testutils.GetAuthToken(t, admin.ID, admin.Role.Name)
+
+	editor := testutils.CreateTestUser(t, database.DB, "editor_webhooks@test.com", "password", "editor")
+	editorToken := testutils.GetAuthToken(t, editor.ID, editor.Role.Name)
+
+	ct := &models.ContentType{Name: "Post", Slug: "post"}
+	database.DB.Create(ct)
+	database.DB.Create(&models.ContentField{ContentTypeID: ct.ID, Name: "title", Type: "string"})
+
+	other := &models.ContentType{Name: "Page", Slug: "page"}
+	database.DB.Create(other)
+	database.DB.Create(&models.ContentField{ContentTypeID: other.ID, Name: "title", Type: "string"})
+
+	rec := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	const secret = "receiver-secret"
+
+	var hookID string
+
+	t.Run("Error - Only admins manage webhooks", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "GET", "/webhooks", nil, editorToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 403, resp.Code)
+	})
+
+	t.Run("Error - Unknown event is rejected", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/webhooks", map[string]interface{}{
+			"url":    server.URL,
+			"events": []string{"entry.exploded"},
+		}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("Success - Create subscription", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "POST", "/webhooks", map[string]interface{}{
+			"name":            "Site builder",
+			"url":             server.URL,
+			"secret":          secret,
+			"events":          []string{webhook.EventEntryCreated, webhook.EventMediaUploaded},
+			"content_type_id": ct.ID,
+		}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+		assert.Equal(t, secret, data["secret"])
+		hookID = fmt.Sprint(data["id"])
+
+		resp, err = testutils.MakeRequest(app, "GET", "/webhooks/"+hookID, nil, adminToken)
+		assert.NoError(t, err)
+		testutils.ParseResponse(t, resp, &result)
+		assert.Nil(t, result.Data.(map[string]interface{})["secret"])
+	})
+
+	t.Run("Success - Signed delivery for subscribed events only", func(t *testing.T) {
+		_, err := content.CreateContentEntry(context.Background(), other.ID, editor.ID, map[string]interface{}{"title": "Elsewhere"})
+		assert.NoError(t, err)
+		entry, err := content.CreateContentEntry(context.Background(), ct.ID, editor.ID, map[string]interface{}{"title": "Hello"})
+		assert.NoError(t, err)
+		webhook.Dispatch(webhook.EventMediaUploaded, models.DefaultSpaceID, nil, map[string]interface{}{"id": 1})
+
+		assert.Equal(t, 1, deliver(time.Now()))
+
+		requests := rec.received()
+		if assert.Len(t, requests, 1) {
+			assert.Equal(t, webhook.EventEntryCreated, requests[0].Event)
+			assert.Equal(t, webhook.Sign(secret, requests[0].Body), requests[0].Signature)
+
+			var payload webhook.Payload
+			assert.NoError(t, json.Unmarshal(requests[0].Body, &payload))
+			assert.Equal(t, webhook.EventEntryCreated, payload.Event)
+			assert.Equal(t, float64(entry.ID), payload.Data.(map[string]interface{})["id"])
+		}
+
+		var delivery models.WebhookDelivery
+		database.DB.Last(&delivery)
+		assert.Equal(t, models.DeliverySuccess, delivery.Status)
+		assert.Equal(t, 200, delivery.ResponseCode)
+		assert.Equal(t, 1, delivery.Attempts)
+		if assert.NotNil(t, delivery.JobID) {
+			var job models.Job
+			database.DB.First(&job, *delivery.JobID)
+			assert.Equal(t, models.JobSucceeded, job.Status)
+		}
+	})
+
+	t.Run("Success - Failed delivery backs off and gives up", func(t *testing.T) {
+		rec.respondWith(http.StatusInternalServerError)
+		defer rec.respondWith(http.StatusOK)
+
+		_, err := content.CreateContentEntry(context.Background(), ct.ID, editor.ID, map[string]interface{}{"title": "Retry me"})
+		assert.NoError(t, err)
+
+		now := time.Now()
+		assert.Equal(t, 1, deliver(now))
+
+		var delivery models.WebhookDelivery
+		database.DB.Last(&delivery)
+		assert.Equal(t, models.DeliveryPending, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, 500, delivery.ResponseCode)
+
+		before := len(rec.received())
+		deliver(now.Add(30 * time.Second))
+		assert.Len(t, rec.received(), before, "retry must wait for the backoff")
+
+		for i := 1; i < webhook.MaxAttempts; i++ {
+			deliver(now.Add(time.Duration(i) * 2 * time.Hour))
+		}
+		var failed models.WebhookDelivery
+		database.DB.First(&failed, delivery.ID)
+		assert.Equal(t, models.DeliveryFailed, failed.Status)
+		assert.Equal(t, webhook.MaxAttempts, failed.Attempts)
+
+		var job models.Job
+		database.DB.First(&job, *failed.JobID)
+		assert.Equal(t, models.JobDead, job.Status)
+	})
+
+	t.Run("Success - Redeliver and delivery log", func(t *testing.T) {
+		var failed models.WebhookDelivery
+		database.DB.Where("status = ?", models.DeliveryFailed).First(&failed)
+
+		resp, err := testutils.MakeRequest(app, "POST", fmt.Sprintf("/webhooks/deliveries/%d/redeliver", failed.ID), nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+
+		var result testutils.StandardResponse
+		testutils.ParseResponse(t, resp, &result)
+		data := result.Data.(map[string]interface{})
+		assert.Equal(t, models.DeliveryPending, data["status"])
+		assert.Equal(t, float64(failed.ID), data["redelivery_of"])
+
+		assert.Equal(t, 1, deliver(time.Now()))
+		var redelivered models.WebhookDelivery
+		database.DB.First(&redelivered, data["id"])
+		assert.Equal(t, models.DeliverySuccess, redelivered.Status)
+
+		resp, err = testutils.MakeRequest(app, "GET", "/webhooks/"+hookID+"/deliveries", nil, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+		testutils.ParseResponse(t, resp, &result)
+		assert.Len(t, result.Data.([]interface{}), 3)
+	})
+
+	t.Run("Success - Changes in other environments are not sent", func(t *testing.T) {
+		before := len(rec.received())
+		events.Publish(events.EntryCreated{Entry: models.ContentEntry{
+			ID: 999, SpaceID: models.DefaultSpaceID, EnvironmentID: 3, ContentTypeID: ct.ID,
+		}, UserID: editor.ID})
+		assert.Equal(t, 0, deliver(time.Now()))
+		assert.Len(t, rec.received(), before)
+	})
+
+	t.Run("Success - Disabled webhook receives nothing", func(t *testing.T) {
+		resp, err := testutils.MakeRequest(app, "PUT", "/webhooks/"+hookID, map[string]interface{}{
+			"url":             server.URL,
+			"events":          []string{webhook.EventAll},
+			"content_type_id": ct.ID,
+			"active":          false,
+		}, adminToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.Code)
+
+		before := len(rec.received())
+		_, err = content.CreateContentEntry(context.Background(), ct.ID, editor.ID, map[string]interface{}{"title": "Quiet"})
+		assert.NoError(t, err)
+		deliver(time.Now())
+		assert.Len(t, rec.received(), before)
+	})
+
+	t.Run("Success - Webhooks belong to a space", func(t *testing.T) {
+		acme := models.Space{Name: "Acme", Slug: "acme"}
+		database.DB.Create(&acme)
+		inAcme := map[string]string{"X-Space": "acme"}
+
+		resp, err := testutils.MakeRequestWithHeaders(app, "POST", "/webhooks", map[string]interface{}{
+			"url":    server.URL,
+			"events": []string{webhook.EventAll},
+		}, adminToken, inAcme)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.Code)
+		var created struct {
+			Data models.Webhook `json:"data"`
+		}
+		testutils.ParseResponse(t, resp, &created)
+		assert.Equal(t, acme.ID, created.Data.SpaceID)
+		acmeHookID := fmt.Sprint(created.Data.ID)
+
+		resp, _ = testutils.MakeRequest(app, "GET", "/webhooks/"+acmeHookID, nil, adminToken)
+		assert.Equal(t, 404, resp.Code, "hidden from the default space")
+		resp, _ = testutils.MakeRequest(app, "DELETE", "/webhooks/"+acmeHookID, nil, adminToken)
+		assert.Equal(t, 404, resp.Code)
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/webhooks/"+hookID, nil, adminToken, inAcme)
+		assert.Equal(t, 404, resp.Code)
+
+		var list struct {
+			Data []models.Webhook `json:"data"`
+		}
+		resp, _ = testutils.MakeRequestWithHeaders(app, "GET", "/webhooks", nil, adminToken, inAcme)
+		testutils.ParseResponse(t, resp, &list)
+		if assert.Len(t, list.Data, 1) {
+			assert.Equal(t, created.Data.ID, list.Data[0].ID)
+		}
+
+		resp, _ = testutils.MakeRequestWithHeaders(app, "POST", "/webhooks", map[string]interface{}{
+			"url":             server.URL,
+			"events":          []string{webhook.EventAll},
+			"content_type_id": ct.ID,
+		}, adminToken, inAcme)
+		assert.Equal(t, 400, resp.Code, "content types of another space cannot be subscribed to")
+
+		before := len(rec.received())
+		webhook.Dispatch(webhook.EventMediaUploaded, models.DefaultSpaceID, nil, map[string]interface{}{"id": 2})
+		deliver(time.Now())
+		assert.Len(t, rec.received(), before, "events of other spaces are not sent")
+
+		webhook.Dispatch(webhook.EventMediaUploaded, acme.ID, nil, map[string]interface{}{"id": 3})
+		deliver(time.Now())
+		assert.Len(t, rec.received(), before+1)
+	})
+}
@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"github.com/Kyz7/cms/internal/utils"
+	"gorm.io/datatypes"
+)
+
+const (
+	EventEntryCreated       = "entry.created"
+	EventEntryUpdated       = "entry.updated"
+	EventEntryDeleted       = "entry.deleted"
+	EventEntryStatusChanged = "entry.status_changed"
+	EventMediaUploaded      = "media.uploaded"
+	EventAll                = "*"
+)
+
+const secretLength = 40
+
+var Events = []string{
+	EventEntryCreated,
+	EventEntryUpdated,
+	EventEntryDeleted,
+	EventEntryStatusChanged,
+	EventMediaUploaded,
+}
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// Payload is the JSON body posted to subscribers.
+type Payload struct {
+	Event         string      `json:"event"`
+	OccurredAt    time.Time   `json:"occurred_at"`
+	ContentTypeID *uint       `json:"content_type_id,omitempty"`
+	Data          interface{} `json:"data"`
+}
+
+type WebhookInput struct {
+	Name          string   `json:"name"`
+	URL           string   `json:"url"`
+	Secret        string   `json:"secret"`
+	Events        []string `json:"events"`
+	ContentTypeID *uint    `json:"content_type_id"`
+	Active        *bool    `json:"active"`
+}
+
+func isKnownEvent(event string) bool {
+	if event == EventAll {
+		return true
+	}
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func validateInput(ctx context.Context, input WebhookInput) error {
+	parsed, err := url.Parse(input.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(input.Events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	for _, event := range input.Events {
+		if !isKnownEvent(event) {
+			return fmt.Errorf("unknown event %s", event)
+		}
+	}
+	if input.ContentTypeID != nil {
+		var count int64
+		database.DB.WithContext(ctx).Model(&models.ContentType{}).Where("id = ?", *input.ContentTypeID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("content type not found")
+		}
+	}
+	return nil
+}
+
+// CreateWebhook stores a subscription in the space ctx is bound to. A secret
+// is generated when none is given; it is only returned here, so callers must
+// keep it.
+func CreateWebhook(ctx context.Context, input WebhookInput, userID uint) (*models.Webhook, error) {
+	if err := validateInput(ctx, input); err != nil {
+		return nil, err
+	}
+
+	events, _ := json.Marshal(input.Events)
+	hook := models.Webhook{
+		Name:          input.Name,
+		URL:           input.URL,
+		Secret:        input.Secret,
+		Events:        datatypes.JSON(events),
+		ContentTypeID: input.ContentTypeID,
+		Active:        input.Active == nil || *input.Active,
+		CreatedBy:     userID,
+	}
+	if hook.Secret == "" {
+		hook.Secret = utils.RandomString(secretLength)
+	}
+
+	if err := database.DB.WithContext(ctx).Create(&hook).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func GetWebhook(ctx context.Context, id uint) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := database.DB.WithContext(ctx).First(&hook, id).Error; err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	return &hook, nil
+}
+
+func ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	err := database.DB.WithContext(ctx).Order("id ASC").Find(&hooks).Error
+	return hooks, err
+}
+
+// UpdateWebhook replaces the subscription's settings. An empty secret keeps
+// the current one.
+func UpdateWebhook(ctx context.Context, id uint, input WebhookInput) (*models.Webhook, error) {
+	hook, err := GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateInput(ctx, input); err != nil {
+		return nil, err
+	}
+
+	events, _ := json.Marshal(input.Events)
+	updates := map[string]interface{}{
+		"name":            input.Name,
+		"url":             input.URL,
+		"events":          datatypes.JSON(events),
+		"content_type_id": input.ContentTypeID,
+	}
+	if input.Secret != "" {
+		updates["secret"] = input.Secret
+	}
+	if input.Active != nil {
+		updates["active"] = *input.Active
+	}
+
+	if err := database.DB.WithContext(ctx).Model(hook).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return GetWebhook(ctx, id)
+}
+
+func DeleteWebhook(ctx context.Context, id uint) error {
+	hook, err := GetWebhook(ctx, id)
+	if err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Delete(hook).Error
+}
+
+func subscribes(hook models.Webhook, event string, contentTypeID *uint) bool {
+	if hook.ContentTypeID != nil && (contentTypeID == nil || *hook.ContentTypeID != *contentTypeID) {
+		return false
+	}
+
+	var events []string
+	json.Unmarshal(hook.Events, &events)
+	for _, e := range events {
+		if e == event || e == EventAll {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch queues event for every active webhook of spaceID subscribed to it.
+// Delivery happens in the background, so a failing receiver never fails the
+// request that caused the event.
+func Dispatch(event string, spaceID uint, contentTypeID *uint, data interface{}) {
+	var hooks []models.Webhook
+	if err := database.DB.Where("active = ? AND space_id = ?", true, spaceID).Find(&hooks).Error; err != nil {
+		log.Printf("⚠️  Failed to load webhooks for %s: %v", event, err)
+		return
+	}
+
+	var payload []byte
+	now := time.Now()
+	for _, hook := range hooks {
+		if !subscribes(hook, event, contentTypeID) {
+			continue
+		}
+
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(Payload{
+				Event:         event,
+				OccurredAt:    now.UTC(),
+				ContentTypeID: contentTypeID,
+				Data:          data,
+			})
+			if err != nil {
+				log.Printf("⚠️  Failed to encode %s webhook payload: %v", event, err)
+				return
+			}
+		}
+
+		delivery := models.WebhookDelivery{
+			WebhookID: hook.ID,
+			Event:     event,
+			Payload:   datatypes.JSON(payload),
+			Status:    models.DeliveryPending,
+		}
+		if err := queueDelivery(&delivery); err != nil {
+			log.Printf("⚠️  Failed to queue %s for webhook %d: %v", event, hook.ID, err)
+		}
+	}
+}
+
+func ListDeliveries(webhookID uint, status string) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	query := database.DB.Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at DESC").Limit(200).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// GetDelivery returns a delivery of one of the webhooks in the space ctx is
+// bound to.
+func GetDelivery(ctx context.Context, id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, id).Error; err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+	if _, err := GetWebhook(ctx, delivery.WebhookID); err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,368 @@
+package workflow
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+type AnalyticsFilter struct {
+	ContentTypeID uint
+	From          time.Time
+	To            time.Time
+}
+
+type DurationStats struct {
+	Count    int     `json:"count"`
+	AvgHours float64 `json:"avg_hours"`
+	P90Hours float64 `json:"p90_hours"`
+}
+
+type WeeklyDuration struct {
+	Week string `json:"week"`
+	DurationStats
+}
+
+type StatusDuration struct {
+	Status models.WorkflowStatus `json:"status"`
+	DurationStats
+	ByWeek []WeeklyDuration `json:"by_week"`
+}
+
+type CycleTime struct {
+	DurationStats
+	ByWeek []WeeklyDuration `json:"by_week"`
+}
+
+type WeeklyRejections struct {
+	Week     string  `json:"week"`
+	Approved int     `json:"approved"`
+	Rejected int     `json:"rejected"`
+	Rate     float64 `json:"rate"`
+}
+
+type AuthorRejectionRate struct {
+	UserID   uint               `json:"user_id"`
+	Name     string             `json:"name"`
+	Approved int                `json:"approved"`
+	Rejected int                `json:"rejected"`
+	Rate     float64            `json:"rate"`
+	ByWeek   []WeeklyRejections `json:"by_week"`
+}
+
+type WeeklyCount struct {
+	Week  string `json:"week"`
+	Count int    `json:"count"`
+}
+
+type ReviewerApprovals struct {
+	UserID    uint          `json:"user_id"`
+	Name      string        `json:"name"`
+	Approvals int           `json:"approvals"`
+	ByWeek    []WeeklyCount `json:"by_week"`
+}
+
+type WorkflowAnalytics struct {
+	ContentTypeID     uint                  `json:"content_type_id,omitempty"`
+	From              time.Time             `json:"from"`
+	To                time.Time             `json:"to"`
+	TimeInStatus      []StatusDuration      `json:"time_in_status"`
+	CycleTime         CycleTime             `json:"cycle_time"`
+	RejectionRates    []AuthorRejectionRate `json:"rejection_rate_by_author"`
+	ReviewerApprovals []ReviewerApprovals   `json:"approvals_by_reviewer"`
+}
+
+// weekOf returns the Monday (UTC) starting the week t falls in.
+func weekOf(t time.Time) string {
+	t = t.UTC()
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -offset).Format("2006-01-02")
+}
+
+func durationStats(samples []time.Duration) DurationStats {
+	if len(samples) == 0 {
+		return DurationStats{}
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	// Nearest-rank percentile.
+	rank := int(math.Ceil(0.9*float64(len(sorted)))) - 1
+
+	return DurationStats{
+		Count:    len(sorted),
+		AvgHours: roundHours(total / time.Duration(len(sorted))),
+		P90Hours: roundHours(sorted[rank]),
+	}
+}
+
+func roundHours(d time.Duration) float64 {
+	return math.Round(d.Hours()*100) / 100
+}
+
+type durationSamples struct {
+	all    []time.Duration
+	byWeek map[string][]time.Duration
+}
+
+func (s *durationSamples) add(at time.Time, d time.Duration) {
+	if s.byWeek == nil {
+		s.byWeek = make(map[string][]time.Duration)
+	}
+	s.all = append(s.all, d)
+	week := weekOf(at)
+	s.byWeek[week] = append(s.byWeek[week], d)
+}
+
+func (s *durationSamples) weekly() []WeeklyDuration {
+	weeks := make([]WeeklyDuration, 0, len(s.byWeek))
+	for week, samples := range s.byWeek {
+		weeks = append(weeks, WeeklyDuration{Week: week, DurationStats: durationStats(samples)})
+	}
+	sort.Slice(weeks, func(i, j int) bool { return weeks[i].Week < weeks[j].Week })
+	return weeks
+}
+
+func rate(rejected, approved int) float64 {
+	if rejected+approved == 0 {
+		return 0
+	}
+	return math.Round(float64(rejected)/float64(rejected+approved)*10000) / 10000
+}
+
+func userNames(ctx context.Context, ids map[uint]bool) map[uint]string {
+	names := make(map[uint]string)
+	if len(ids) == 0 {
+		return names
+	}
+
+	keys := make([]uint, 0, len(ids))
+	for id := range ids {
+		keys = append(keys, id)
+	}
+
+	var users []models.User
+	database.DB.WithContext(ctx).Select("id", "name").Where("id IN ?", keys).Find(&users)
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+	return names
+}
+
+// GetWorkflowAnalytics derives throughput and bottleneck metrics from
+// WorkflowHistory. A stay in a status, a cycle, a review decision or an
+// approval counts towards the range and week in which it ended.
+func GetWorkflowAnalytics(ctx context.Context, filter AnalyticsFilter) (*WorkflowAnalytics, error) {
+	active := database.DB.WithContext(ctx).Model(&models.WorkflowHistory{}).
+		Select("entry_id").
+		Where("created_at >= ? AND created_at <= ?", filter.From, filter.To)
+
+	entryQuery := database.DB.WithContext(ctx).Where("id IN (?)", active)
+	if filter.ContentTypeID != 0 {
+		entryQuery = entryQuery.Where("content_type_id = ?", filter.ContentTypeID)
+	}
+
+	var entries []models.ContentEntry
+	if err := entryQuery.Select("id", "created_by", "created_at").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := &WorkflowAnalytics{
+		ContentTypeID:     filter.ContentTypeID,
+		From:              filter.From,
+		To:                filter.To,
+		TimeInStatus:      []StatusDuration{},
+		RejectionRates:    []AuthorRejectionRate{},
+		ReviewerApprovals: []ReviewerApprovals{},
+		CycleTime:         CycleTime{ByWeek: []WeeklyDuration{}},
+	}
+	if len(entries) == 0 {
+		return result, nil
+	}
+
+	entryByID := make(map[uint]models.ContentEntry, len(entries))
+	ids := make([]uint, 0, len(entries))
+	for _, e := range entries {
+		entryByID[e.ID] = e
+		ids = append(ids, e.ID)
+	}
+
+	// Earlier rows are needed to know when the first in-range stay began.
+	var history []models.WorkflowHistory
+	if err := database.DB.WithContext(ctx).
+		Where("entry_id IN ? AND created_at <= ?", ids, filter.To).
+		Order("entry_id ASC, created_at ASC, id ASC").
+		Find(&history).Error; err != nil {
+		return nil, err
+	}
+
+	inRange := func(t time.Time) bool {
+		return !t.Before(filter.From) && !t.After(filter.To)
+	}
+
+	statusSamples := make(map[models.WorkflowStatus]*durationSamples)
+	var cycles durationSamples
+
+	type decisionCounts struct{ approved, rejected int }
+	authorTotals := make(map[uint]*decisionCounts)
+	authorWeeks := make(map[uint]map[string]*decisionCounts)
+	approvals := make(map[uint]map[string]int)
+	voted := make(map[[3]uint]bool)
+
+	for _, h := range history {
+		if h.Decision == DecisionApproved {
+			voted[[3]uint{h.EntryID, h.ChangedBy, h.EntryVersion}] = true
+		}
+	}
+
+	countApproval := func(userID uint, at time.Time) {
+		if approvals[userID] == nil {
+			approvals[userID] = make(map[string]int)
+		}
+		approvals[userID][weekOf(at)]++
+	}
+
+	var (
+		currentEntry uint
+		enteredAt    time.Time
+		draftSince   time.Time
+	)
+	for _, h := range history {
+		entry := entryByID[h.EntryID]
+		if h.EntryID != currentEntry {
+			currentEntry = h.EntryID
+			enteredAt = entry.CreatedAt
+			draftSince = entry.CreatedAt
+		}
+
+		// Stage votes leave the status unchanged.
+		if h.FromStatus == h.ToStatus {
+			if h.Decision == DecisionApproved && inRange(h.CreatedAt) {
+				countApproval(h.ChangedBy, h.CreatedAt)
+			}
+			continue
+		}
+
+		if inRange(h.CreatedAt) {
+			samples := statusSamples[h.FromStatus]
+			if samples == nil {
+				samples = &durationSamples{}
+				statusSamples[h.FromStatus] = samples
+			}
+			samples.add(h.CreatedAt, h.CreatedAt.Sub(enteredAt))
+
+			if h.ToStatus == models.StatusPublished {
+				cycles.add(h.CreatedAt, h.CreatedAt.Sub(draftSince))
+			}
+
+			if h.ToStatus == models.StatusApproved || h.ToStatus == models.StatusRejected {
+				week := weekOf(h.CreatedAt)
+				if authorTotals[entry.CreatedBy] == nil {
+					authorTotals[entry.CreatedBy] = &decisionCounts{}
+					authorWeeks[entry.CreatedBy] = make(map[string]*decisionCounts)
+				}
+				if authorWeeks[entry.CreatedBy][week] == nil {
+					authorWeeks[entry.CreatedBy][week] = &decisionCounts{}
+				}
+				if h.ToStatus == models.StatusApproved {
+					authorTotals[entry.CreatedBy].approved++
+					authorWeeks[entry.CreatedBy][week].approved++
+				} else {
+					authorTotals[entry.CreatedBy].rejected++
+					authorWeeks[entry.CreatedBy][week].rejected++
+				}
+			}
+
+			// The final stage voter also applies the transition; count them once.
+			if h.ToStatus == models.StatusApproved && !voted[[3]uint{h.EntryID, h.ChangedBy, h.EntryVersion}] {
+				countApproval(h.ChangedBy, h.CreatedAt)
+			}
+		}
+
+		enteredAt = h.CreatedAt
+		if h.ToStatus == models.StatusDraft {
+			draftSince = h.CreatedAt
+		}
+	}
+
+	for _, status := range models.WorkflowStatuses {
+		samples, ok := statusSamples[status]
+		if !ok {
+			continue
+		}
+		result.TimeInStatus = append(result.TimeInStatus, StatusDuration{
+			Status:        status,
+			DurationStats: durationStats(samples.all),
+			ByWeek:        samples.weekly(),
+		})
+	}
+
+	result.CycleTime.DurationStats = durationStats(cycles.all)
+	result.CycleTime.ByWeek = cycles.weekly()
+
+	people := make(map[uint]bool)
+	for id := range authorTotals {
+		people[id] = true
+	}
+	for id := range approvals {
+		people[id] = true
+	}
+	names := userNames(ctx, people)
+
+	for authorID, totals := range authorTotals {
+		author := AuthorRejectionRate{
+			UserID:   authorID,
+			Name:     names[authorID],
+			Approved: totals.approved,
+			Rejected: totals.rejected,
+			Rate:     rate(totals.rejected, totals.approved),
+			ByWeek:   []WeeklyRejections{},
+		}
+		for week, counts := range authorWeeks[authorID] {
+			author.ByWeek = append(author.ByWeek, WeeklyRejections{
+				Week:     week,
+				Approved: counts.approved,
+				Rejected: counts.rejected,
+				Rate:     rate(counts.rejected, counts.approved),
+			})
+		}
+		sort.Slice(author.ByWeek, func(i, j int) bool { return author.ByWeek[i].Week < author.ByWeek[j].Week })
+		result.RejectionRates = append(result.RejectionRates, author)
+	}
+	sort.Slice(result.RejectionRates, func(i, j int) bool {
+		return result.RejectionRates[i].Rate > result.RejectionRates[j].Rate ||
+			(result.RejectionRates[i].Rate == result.RejectionRates[j].Rate &&
+				result.RejectionRates[i].UserID < result.RejectionRates[j].UserID)
+	})
+
+	for reviewerID, weeks := range approvals {
+		reviewer := ReviewerApprovals{
+			UserID: reviewerID,
+			Name:   names[reviewerID],
+			ByWeek: []WeeklyCount{},
+		}
+		for week, count := range weeks {
+			reviewer.Approvals += count
+			reviewer.ByWeek = append(reviewer.ByWeek, WeeklyCount{Week: week, Count: count})
+		}
+		sort.Slice(reviewer.ByWeek, func(i, j int) bool { return reviewer.ByWeek[i].Week < reviewer.ByWeek[j].Week })
+		result.ReviewerApprovals = append(result.ReviewerApprovals, reviewer)
+	}
+	sort.Slice(result.ReviewerApprovals, func(i, j int) bool {
+		return result.ReviewerApprovals[i].Approvals > result.ReviewerApprovals[j].Approvals ||
+			(result.ReviewerApprovals[i].Approvals == result.ReviewerApprovals[j].Approvals &&
+				result.ReviewerApprovals[i].UserID < result.ReviewerApprovals[j].UserID)
+	})
+
+	return result, nil
+}
@@ -0,0 +1,281 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+const (
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+)
+
+type StageProgress struct {
+	Stage        models.ApprovalStage `json:"stage"`
+	Approvers    []uint               `json:"approvers"`
+	MissingRoles []string             `json:"missing_roles,omitempty"`
+	Satisfied    bool                 `json:"satisfied"`
+}
+
+func approvalStages(ctx context.Context, contentTypeID uint, fromStatus, toStatus models.WorkflowStatus) ([]models.ApprovalStage, error) {
+	definition, err := WorkflowForContentType(ctx, contentTypeID)
+	if err != nil || definition == nil {
+		return nil, err
+	}
+
+	var stages []models.ApprovalStage
+	err = database.DB.WithContext(ctx).
+		Where("workflow_id = ? AND from_status = ? AND to_status = ?", definition.ID, fromStatus, toStatus).
+		Order("position ASC").
+		Find(&stages).Error
+	return stages, err
+}
+
+func stageRoles(stage models.ApprovalStage) []string {
+	var roles []string
+	if len(stage.RequiredRoles) > 0 {
+		json.Unmarshal(stage.RequiredRoles, &roles)
+	}
+	return roles
+}
+
+// stageProgress counts approvals cast on the entry's current version only, so
+// any edit or transition in between starts the stage over.
+func stageProgress(ctx context.Context, entry *models.ContentEntry, stage models.ApprovalStage) (StageProgress, error) {
+	progress := StageProgress{Stage: stage, Approvers: []uint{}}
+
+	var votes []models.WorkflowHistory
+	if err := database.DB.WithContext(ctx).
+		Preload("User.Role").
+		Where("entry_id = ? AND stage_id = ? AND entry_version = ? AND decision = ?",
+			entry.ID, stage.ID, entry.Version, DecisionApproved).
+		Order("created_at ASC").
+		Find(&votes).Error; err != nil {
+		return progress, err
+	}
+
+	seen := make(map[uint]bool)
+	covered := make(map[string]bool)
+	for _, vote := range votes {
+		if seen[vote.ChangedBy] {
+			continue
+		}
+		seen[vote.ChangedBy] = true
+		progress.Approvers = append(progress.Approvers, vote.ChangedBy)
+		if vote.User != nil && vote.User.Role != nil {
+			covered[vote.User.Role.Name] = true
+		}
+	}
+
+	for _, role := range stageRoles(stage) {
+		if !covered[role] {
+			progress.MissingRoles = append(progress.MissingRoles, role)
+		}
+	}
+
+	minApprovals := stage.MinApprovals
+	if minApprovals < 1 {
+		minApprovals = 1
+	}
+	progress.Satisfied = len(progress.Approvers) >= minApprovals && len(progress.MissingRoles) == 0
+
+	return progress, nil
+}
+
+func entryApprovalProgress(ctx context.Context, entry *models.ContentEntry, stages []models.ApprovalStage) ([]StageProgress, error) {
+	progress := make([]StageProgress, 0, len(stages))
+	for _, stage := range stages {
+		p, err := stageProgress(ctx, entry, stage)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
+
+func currentStage(progress []StageProgress) *StageProgress {
+	for i := range progress {
+		if !progress[i].Satisfied {
+			return &progress[i]
+		}
+	}
+	return nil
+}
+
+// canVote reports whether user may approve or reject at the stage. Stages with
+// required roles accept only those roles; otherwise anyone allowed to make the
+// gated transition may vote.
+func canVote(ctx context.Context, entry *models.ContentEntry, stage models.ApprovalStage, user *models.User) bool {
+	roles := stageRoles(stage)
+	if len(roles) == 0 {
+		return isValidTransition(ctx, entry.ContentTypeID, stage.FromStatus, stage.ToStatus, user)
+	}
+
+	for _, role := range roles {
+		if role == roleName(user) {
+			return true
+		}
+	}
+	return false
+}
+
+func recordStageVote(ctx context.Context, entry *models.ContentEntry, stage models.ApprovalStage, userID uint, decision, comment string) error {
+	vote := models.WorkflowHistory{
+		EntryID:      entry.ID,
+		FromStatus:   entry.Status,
+		ToStatus:     entry.Status,
+		ChangedBy:    userID,
+		Comment:      comment,
+		StageID:      &stage.ID,
+		Decision:     decision,
+		EntryVersion: entry.Version,
+	}
+	return database.DB.WithContext(ctx).Create(&vote).Error
+}
+
+func loadEntryForVote(ctx context.Context, entryID, userID, expectedVersion uint) (*models.ContentEntry, *models.User, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, nil, fmt.Errorf("entry not found")
+	}
+
+	if expectedVersion != 0 && expectedVersion != entry.Version {
+		return nil, nil, &StaleVersionError{CurrentVersion: entry.Version}
+	}
+
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		return nil, nil, fmt.Errorf("user not found")
+	}
+
+	return &entry, &user, nil
+}
+
+// ApproveEntry moves the entry to approved, or, when the workflow gates that
+// transition with approval stages, records the user's vote on the current
+// stage and only transitions once every stage is satisfied.
+func ApproveEntry(ctx context.Context, entryID, userID uint, comment string, expectedVersion uint) (*models.ContentEntry, error) {
+	entry, user, err := loadEntryForVote(ctx, entryID, userID, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, err := approvalStages(ctx, entry.ContentTypeID, entry.Status, models.StatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	if len(stages) == 0 {
+		return ChangeWorkflowStatus(ctx, entryID, userID, string(models.StatusApproved), comment, expectedVersion)
+	}
+
+	progress, err := entryApprovalProgress(ctx, entry, stages)
+	if err != nil {
+		return nil, err
+	}
+
+	if stage := currentStage(progress); stage != nil {
+		if !canVote(ctx, entry, stage.Stage, user) {
+			return nil, fmt.Errorf("you are not an approver for stage %s", stage.Stage.Name)
+		}
+		for _, approver := range stage.Approvers {
+			if approver == userID {
+				return nil, fmt.Errorf("you have already approved stage %s", stage.Stage.Name)
+			}
+		}
+
+		if err := recordStageVote(ctx, entry, stage.Stage, userID, DecisionApproved, comment); err != nil {
+			return nil, err
+		}
+
+		if progress, err = entryApprovalProgress(ctx, entry, stages); err != nil {
+			return nil, err
+		}
+		if currentStage(progress) != nil {
+			return entry, nil
+		}
+	}
+
+	updated, err := applyTransition(ctx, entry, userID, models.StatusApproved, comment)
+	var stale *StaleVersionError
+	if errors.As(err, &stale) {
+		// Another approver completed the last stage at the same moment.
+		if err := database.DB.WithContext(ctx).First(entry, entryID).Error; err != nil {
+			return nil, err
+		}
+		return entry, nil
+	}
+	return updated, err
+}
+
+// RejectEntry moves the entry to rejected. A single rejection from an eligible
+// voter on the current approval stage is enough.
+func RejectEntry(ctx context.Context, entryID, userID uint, comment string, expectedVersion uint) (*models.ContentEntry, error) {
+	entry, user, err := loadEntryForVote(ctx, entryID, userID, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, err := approvalStages(ctx, entry.ContentTypeID, entry.Status, models.StatusApproved)
+	if err != nil {
+		return nil, err
+	}
+
+	progress, err := entryApprovalProgress(ctx, entry, stages)
+	if err != nil {
+		return nil, err
+	}
+
+	stage := currentStage(progress)
+	if stage == nil || !canVote(ctx, entry, stage.Stage, user) {
+		return ChangeWorkflowStatus(ctx, entryID, userID, string(models.StatusRejected), comment, expectedVersion)
+	}
+
+	if !transitionDefined(ctx, entry.ContentTypeID, entry.Status, models.StatusRejected) {
+		return nil, fmt.Errorf("workflow has no transition from %s to %s", entry.Status, models.StatusRejected)
+	}
+
+	if err := recordStageVote(ctx, entry, stage.Stage, userID, DecisionRejected, comment); err != nil {
+		return nil, err
+	}
+
+	return applyTransition(ctx, entry, userID, models.StatusRejected, comment)
+}
+
+func transitionDefined(ctx context.Context, contentTypeID uint, fromStatus, toStatus models.WorkflowStatus) bool {
+	definition, err := WorkflowForContentType(ctx, contentTypeID)
+	if err != nil {
+		return false
+	}
+
+	if definition == nil {
+		_, exists := defaultTransitions[fromStatus][toStatus]
+		return exists
+	}
+
+	for _, t := range definition.Transitions {
+		if t.FromStatus == fromStatus && t.ToStatus == toStatus {
+			return true
+		}
+	}
+	return false
+}
+
+func GetApprovalProgress(ctx context.Context, entryID uint) ([]StageProgress, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, fmt.Errorf("entry not found")
+	}
+
+	stages, err := approvalStages(ctx, entry.ContentTypeID, entry.Status, models.StatusApproved)
+	if err != nil {
+		return nil, err
+	}
+
+	return entryApprovalProgress(ctx, &entry, stages)
+}
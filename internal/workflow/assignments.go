@@ -0,0 +1,322 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+const (
+	AssignmentPending   = "pending"
+	AssignmentCompleted = "completed"
+	AssignmentDeclined  = "declined"
+)
+
+const (
+	AssignmentEventAssigned  = "assigned"
+	AssignmentEventReminder  = "reminder"
+	AssignmentEventOverdue   = "overdue"
+	AssignmentEventEscalated = "escalated"
+	AssignmentEventDeclined  = "declined"
+)
+
+var (
+	ErrAssignmentNotFound   = errors.New("assignment not found")
+	ErrAssignmentNotPending = errors.New("assignment is no longer pending")
+	ErrAssignmentClaimed    = errors.New("assignment was already claimed")
+	ErrNotAssignee          = errors.New("assignment is not assigned to you")
+)
+
+// AssignmentNotifier delivers an assignment event to one recipient.
+type AssignmentNotifier func(event string, assignment *models.WorkflowAssignment, recipient *models.User)
+
+var assignmentNotifier AssignmentNotifier = logAssignmentNotification
+
+// SetAssignmentNotifier replaces how assignment events reach users. The
+// default only logs them.
+func SetAssignmentNotifier(fn AssignmentNotifier) {
+	assignmentNotifier = fn
+}
+
+func logAssignmentNotification(event string, assignment *models.WorkflowAssignment, recipient *models.User) {
+	log.Printf("🔔 Assignment %d (entry %d): %s -> %s", assignment.ID, assignment.EntryID, event, recipient.Email)
+}
+
+type AssignmentPolicy struct {
+	// ReminderLead is how long before the due date the assignee is reminded.
+	ReminderLead time.Duration
+	// EscalateAfter is how long an assignment stays overdue before escalation.
+	EscalateAfter time.Duration
+	// EscalationRole receives escalations; when empty they go to the assigner.
+	EscalationRole string
+}
+
+var DefaultAssignmentPolicy = AssignmentPolicy{
+	ReminderLead:  24 * time.Hour,
+	EscalateAfter: 24 * time.Hour,
+}
+
+type AssignmentCheckResult struct {
+	Reminded  int `json:"reminded"`
+	Overdue   int `json:"overdue"`
+	Escalated int `json:"escalated"`
+}
+
+func roleExists(ctx context.Context, name string) bool {
+	var count int64
+	database.DB.WithContext(ctx).Model(&models.Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
+
+// usersWithRole returns the users holding role in the space ctx is bound to.
+// Members hold the role of their membership; everyone else holds their own
+// role in the default space, and elsewhere only if they are admins.
+func usersWithRole(ctx context.Context, role string) []models.User {
+	spaceID, ok := database.SpaceFromContext(ctx)
+	if !ok {
+		spaceID = models.DefaultSpaceID
+	}
+
+	members := database.DB.Model(&models.SpaceMembership{}).
+		Select("user_id").
+		Where("space_id = ?", spaceID)
+	byMembership := database.DB.Model(&models.SpaceMembership{}).
+		Select("space_memberships.user_id").
+		Joins("JOIN roles ON roles.id = space_memberships.role_id").
+		Where("space_memberships.space_id = ? AND roles.name = ?", spaceID, role)
+	byOwnRole := database.DB.Model(&models.User{}).
+		Select("users.id").
+		Joins("JOIN roles ON roles.id = users.role_id").
+		Where("roles.name = ? AND users.id NOT IN (?)", role, members)
+	if spaceID != models.DefaultSpaceID {
+		byOwnRole = byOwnRole.Where("roles.name = ?", "admin")
+	}
+
+	var users []models.User
+	database.DB.Where("id IN (?) OR id IN (?)", byMembership, byOwnRole).Find(&users)
+	return users
+}
+
+func notifyUser(event string, assignment *models.WorkflowAssignment, user *models.User) {
+	assignmentNotifier(event, assignment, user)
+	events.Publish(events.AssignmentNotified{Event: event, Assignment: *assignment, Recipient: *user})
+}
+
+// notifyAssignees tells the assignee, or every user of the pool role.
+func notifyAssignees(ctx context.Context, event string, assignment *models.WorkflowAssignment) {
+	if assignment.AssignedTo != nil {
+		var user models.User
+		if err := database.DB.WithContext(ctx).First(&user, *assignment.AssignedTo).Error; err == nil {
+			notifyUser(event, assignment, &user)
+		}
+		return
+	}
+
+	for _, user := range usersWithRole(ctx, assignment.AssignedRole) {
+		notifyUser(event, assignment, &user)
+	}
+}
+
+func notifyAssigner(ctx context.Context, event string, assignment *models.WorkflowAssignment) {
+	var user models.User
+	if err := database.DB.WithContext(ctx).First(&user, assignment.AssignedBy).Error; err == nil {
+		notifyUser(event, assignment, &user)
+	}
+}
+
+// markAssignment sets column to now unless another run already has. Only the
+// caller whose update matched sends the notification, so several instances
+// running the checks at once do not notify twice.
+func markAssignment(ctx context.Context, id uint, column string, now time.Time) bool {
+	result := database.DB.WithContext(ctx).Model(&models.WorkflowAssignment{}).
+		Where("id = ? AND "+column+" IS NULL", id).
+		Update(column, now)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// RunAssignmentChecks reminds assignees of assignments coming due, marks
+// assignments past their due date as overdue, and escalates those that have
+// stayed overdue for longer than the policy allows.
+func RunAssignmentChecks(now time.Time, policy AssignmentPolicy) (AssignmentCheckResult, error) {
+	ctx := context.Background()
+	var result AssignmentCheckResult
+
+	// Assignments of every space are checked; each is handled in its own.
+	inSpace := func(assignment *models.WorkflowAssignment) context.Context {
+		return database.WithSpace(ctx, assignment.SpaceID)
+	}
+
+	var dueSoon []models.WorkflowAssignment
+	if err := database.DB.WithContext(ctx).
+		Where("status = ? AND reminder_sent_at IS NULL AND due_date > ? AND due_date <= ?",
+			AssignmentPending, now, now.Add(policy.ReminderLead)).
+		Find(&dueSoon).Error; err != nil {
+		return result, err
+	}
+	for i := range dueSoon {
+		spaceCtx := inSpace(&dueSoon[i])
+		if markAssignment(spaceCtx, dueSoon[i].ID, "reminder_sent_at", now) {
+			notifyAssignees(spaceCtx, AssignmentEventReminder, &dueSoon[i])
+			result.Reminded++
+		}
+	}
+
+	var overdue []models.WorkflowAssignment
+	if err := database.DB.WithContext(ctx).
+		Where("status = ? AND overdue_at IS NULL AND due_date <= ?", AssignmentPending, now).
+		Find(&overdue).Error; err != nil {
+		return result, err
+	}
+	for i := range overdue {
+		spaceCtx := inSpace(&overdue[i])
+		if markAssignment(spaceCtx, overdue[i].ID, "overdue_at", now) {
+			notifyAssignees(spaceCtx, AssignmentEventOverdue, &overdue[i])
+			result.Overdue++
+		}
+	}
+
+	var stale []models.WorkflowAssignment
+	if err := database.DB.WithContext(ctx).
+		Where("status = ? AND escalated_at IS NULL AND overdue_at <= ?", AssignmentPending, now.Add(-policy.EscalateAfter)).
+		Find(&stale).Error; err != nil {
+		return result, err
+	}
+	for i := range stale {
+		spaceCtx := inSpace(&stale[i])
+		if !markAssignment(spaceCtx, stale[i].ID, "escalated_at", now) {
+			continue
+		}
+		if policy.EscalationRole == "" {
+			notifyAssigner(spaceCtx, AssignmentEventEscalated, &stale[i])
+		} else {
+			for _, user := range usersWithRole(spaceCtx, policy.EscalationRole) {
+				notifyUser(AssignmentEventEscalated, &stale[i], &user)
+			}
+		}
+		result.Escalated++
+	}
+
+	return result, nil
+}
+
+func loadPendingAssignment(ctx context.Context, assignmentID uint) (*models.WorkflowAssignment, error) {
+	var assignment models.WorkflowAssignment
+	if err := database.DB.WithContext(ctx).First(&assignment, assignmentID).Error; err != nil {
+		return nil, ErrAssignmentNotFound
+	}
+	if assignment.Status != AssignmentPending {
+		return nil, ErrAssignmentNotPending
+	}
+	return &assignment, nil
+}
+
+func reloadAssignment(ctx context.Context, assignmentID uint) (*models.WorkflowAssignment, error) {
+	var assignment models.WorkflowAssignment
+	if err := database.DB.WithContext(ctx).Preload("User").Preload("Assigner").First(&assignment, assignmentID).Error; err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// ReassignAssignment hands a pending assignment to someone else. Reminder,
+// overdue and escalation marks are cleared so the new assignee gets their own.
+func ReassignAssignment(ctx context.Context, assignmentID uint, assignedTo *uint, assignedRole string, dueDate *time.Time) (*models.WorkflowAssignment, error) {
+	assignment, err := loadPendingAssignment(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if assignedTo == nil {
+		if !roleExists(ctx, assignedRole) {
+			return nil, fmt.Errorf("role %s not found", assignedRole)
+		}
+	} else {
+		assignedRole = ""
+	}
+
+	updates := map[string]interface{}{
+		"assigned_to":      assignedTo,
+		"assigned_role":    assignedRole,
+		"reminder_sent_at": nil,
+		"overdue_at":       nil,
+		"escalated_at":     nil,
+	}
+	if dueDate != nil {
+		updates["due_date"] = *dueDate
+	}
+
+	if err := database.DB.WithContext(ctx).Model(assignment).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	updated, err := reloadAssignment(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	notifyAssignees(ctx, AssignmentEventAssigned, updated)
+	return updated, nil
+}
+
+// ClaimAssignment takes an unclaimed pool assignment for userID. When two
+// users claim at once only the first update matches.
+func ClaimAssignment(ctx context.Context, assignmentID, userID uint) (*models.WorkflowAssignment, error) {
+	assignment, err := loadPendingAssignment(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if assignment.AssignedTo != nil {
+		return nil, ErrAssignmentClaimed
+	}
+
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role").First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if roleName(&user) != assignment.AssignedRole {
+		return nil, ErrNotAssignee
+	}
+
+	result := database.DB.WithContext(ctx).Model(&models.WorkflowAssignment{}).
+		Where("id = ? AND assigned_to IS NULL AND status = ?", assignmentID, AssignmentPending).
+		Update("assigned_to", userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAssignmentClaimed
+	}
+
+	return reloadAssignment(ctx, assignmentID)
+}
+
+// DeclineAssignment lets the assignee hand an assignment back; the assigner is
+// told so they can reassign it.
+func DeclineAssignment(ctx context.Context, assignmentID, userID uint, reason string) (*models.WorkflowAssignment, error) {
+	assignment, err := loadPendingAssignment(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if assignment.AssignedTo == nil || *assignment.AssignedTo != userID {
+		return nil, ErrNotAssignee
+	}
+
+	if err := database.DB.WithContext(ctx).Model(assignment).Updates(map[string]interface{}{
+		"status":         AssignmentDeclined,
+		"decline_reason": reason,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	updated, err := reloadAssignment(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	notifyAssigner(ctx, AssignmentEventDeclined, updated)
+	return updated, nil
+}
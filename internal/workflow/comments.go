@@ -0,0 +1,154 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+var ErrCommentNotFound = errors.New("comment not found")
+
+// mentionPattern matches "@" followed by a user's email address.
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+// MentionNotifier tells a user they were mentioned in a review comment.
+type MentionNotifier func(comment *models.WorkflowComment, mentioned *models.User)
+
+var mentionNotifier MentionNotifier = logMentionNotification
+
+// SetMentionNotifier replaces how mentions reach users. The default only logs
+// them.
+func SetMentionNotifier(fn MentionNotifier) {
+	mentionNotifier = fn
+}
+
+func logMentionNotification(comment *models.WorkflowComment, mentioned *models.User) {
+	log.Printf("💬 Comment %d on entry %d mentions %s", comment.ID, comment.EntryID, mentioned.Email)
+}
+
+type CommentInput struct {
+	ParentID   *uint  `json:"parent_id"`
+	Comment    string `json:"comment"`
+	IsPrivate  bool   `json:"is_private"`
+	FieldName  string `json:"field_name"`
+	RangeStart *int   `json:"range_start"`
+	RangeEnd   *int   `json:"range_end"`
+}
+
+type CommentFilter struct {
+	IncludePrivate bool
+	FieldName      string
+	Resolved       *bool
+}
+
+// parseMentions returns the users whose email is @mentioned in text, skipping
+// the author and unknown addresses.
+func parseMentions(ctx context.Context, text string, authorID uint) []models.User {
+	seen := make(map[string]bool)
+	var emails []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		email := strings.ToLower(strings.TrimRight(match[1], "."))
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	var users []models.User
+	database.DB.WithContext(ctx).Where("LOWER(email) IN ? AND id <> ?", emails, authorID).Find(&users)
+	return users
+}
+
+func validateCommentAnchor(ctx context.Context, entry *models.ContentEntry, input CommentInput) error {
+	if input.FieldName != "" {
+		var count int64
+		database.DB.WithContext(ctx).Model(&models.ContentField{}).
+			Where("content_type_id = ? AND name = ?", entry.ContentTypeID, input.FieldName).
+			Count(&count)
+		if count == 0 {
+			return fmt.Errorf("field %s does not exist on this content type", input.FieldName)
+		}
+	}
+
+	if (input.RangeStart == nil) != (input.RangeEnd == nil) {
+		return fmt.Errorf("range_start and range_end must be given together")
+	}
+	if input.RangeStart != nil {
+		if input.FieldName == "" {
+			return fmt.Errorf("a text range requires field_name")
+		}
+		if *input.RangeStart < 0 || *input.RangeEnd < *input.RangeStart {
+			return fmt.Errorf("invalid text range")
+		}
+	}
+
+	return nil
+}
+
+func threadRoot(ctx context.Context, commentID uint) (*models.WorkflowComment, error) {
+	var comment models.WorkflowComment
+	if err := database.DB.WithContext(ctx).First(&comment, commentID).Error; err != nil {
+		return nil, ErrCommentNotFound
+	}
+	if comment.ParentID != nil {
+		if err := database.DB.WithContext(ctx).First(&comment, *comment.ParentID).Error; err != nil {
+			return nil, ErrCommentNotFound
+		}
+	}
+	return &comment, nil
+}
+
+// SetThreadResolved resolves or reopens the thread commentID belongs to.
+func SetThreadResolved(ctx context.Context, commentID, userID uint, resolved bool) (*models.WorkflowComment, error) {
+	root, err := threadRoot(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"resolved":    resolved,
+		"resolved_by": nil,
+		"resolved_at": nil,
+	}
+	if resolved {
+		updates["resolved_by"] = userID
+		updates["resolved_at"] = time.Now()
+	}
+
+	if err := database.DB.WithContext(ctx).Model(root).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	database.DB.WithContext(ctx).Preload("User").Preload("Replies.User").First(root, root.ID)
+	return root, nil
+}
+
+func countOpenThreads(ctx context.Context, entryID uint) int64 {
+	var count int64
+	database.DB.WithContext(ctx).Model(&models.WorkflowComment{}).
+		Where("entry_id = ? AND parent_id IS NULL AND resolved = ?", entryID, false).
+		Count(&count)
+	return count
+}
+
+func GetMyMentions(ctx context.Context, userID uint) ([]models.WorkflowComment, error) {
+	var comments []models.WorkflowComment
+	err := database.DB.WithContext(ctx).
+		Where("id IN (?)", database.DB.WithContext(ctx).Model(&models.CommentMention{}).Select("comment_id").Where("user_id = ?", userID)).
+		Preload("User").
+		Preload("Entry").
+		Order("created_at DESC").
+		Find(&comments).Error
+
+	return comments, err
+}
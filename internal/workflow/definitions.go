@@ -0,0 +1,581 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	permissionEdit    = "ContentEntry:update"
+	permissionApprove = "ContentEntry:approve"
+)
+
+// defaultTransitions is the built-in flow: the permission each transition
+// requires, used when no workflow definition applies.
+var defaultTransitions = map[models.WorkflowStatus]map[models.WorkflowStatus]string{
+	models.StatusDraft: {
+		models.StatusInReview: permissionEdit,
+	},
+	models.StatusInReview: {
+		models.StatusReadyForApproval: permissionEdit,
+		models.StatusRejected:         permissionEdit,
+		models.StatusDraft:            permissionEdit,
+	},
+	models.StatusReadyForApproval: {
+		models.StatusApproved: permissionApprove,
+		models.StatusRejected: permissionApprove,
+	},
+	models.StatusApproved: {
+		models.StatusPublished: permissionApprove,
+	},
+	models.StatusPublished: {
+		models.StatusDraft:    permissionApprove,
+		models.StatusArchived: permissionApprove,
+	},
+	models.StatusRejected: {
+		models.StatusDraft:    permissionEdit,
+		models.StatusArchived: permissionApprove,
+	},
+	models.StatusArchived: {
+		models.StatusDraft: permissionApprove,
+	},
+}
+
+var (
+	ErrWorkflowInUse     = errors.New("workflow is assigned to one or more content types")
+	ErrWorkflowNameTaken = errors.New("workflow with this name already exists")
+	ErrDefaultWorkflow   = errors.New("the default workflow cannot be deleted; make another workflow the default first")
+)
+
+type StrandedEntriesError struct {
+	Count int64
+}
+
+func (e *StrandedEntriesError) Error() string {
+	return fmt.Sprintf("%d entries are in states the workflow does not define", e.Count)
+}
+
+type WorkflowTransitionInput struct {
+	FromStatus         string `json:"from_status"`
+	ToStatus           string `json:"to_status"`
+	RequiredRole       string `json:"required_role"`
+	RequiredPermission string `json:"required_permission"`
+}
+
+type ApprovalStageInput struct {
+	FromStatus    string   `json:"from_status"`
+	ToStatus      string   `json:"to_status"`
+	Name          string   `json:"name"`
+	MinApprovals  int      `json:"min_approvals"`
+	RequiredRoles []string `json:"required_roles"`
+}
+
+type TransitionGuardInput struct {
+	FromStatus string   `json:"from_status"`
+	ToStatus   string   `json:"to_status"`
+	Type       string   `json:"type"`
+	Fields     []string `json:"fields"`
+	Name       string   `json:"name"`
+}
+
+type WorkflowDefinitionInput struct {
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	States      []string                  `json:"states"`
+	IsDefault   bool                      `json:"is_default"`
+	Transitions []WorkflowTransitionInput `json:"transitions"`
+	Stages      []ApprovalStageInput      `json:"stages"`
+	Guards      []TransitionGuardInput    `json:"guards"`
+}
+
+func isValidTransition(ctx context.Context, contentTypeID uint, fromStatus, toStatus models.WorkflowStatus, user *models.User) bool {
+	definition, err := WorkflowForContentType(ctx, contentTypeID)
+	if err != nil {
+		return false
+	}
+
+	if definition == nil {
+		permission, exists := defaultTransitions[fromStatus][toStatus]
+		return exists && userHasPermission(user, permission, contentTypeID)
+	}
+
+	for _, t := range definition.Transitions {
+		if t.FromStatus == fromStatus && t.ToStatus == toStatus && transitionAllows(t, user, contentTypeID) {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionAllows grants the transition to holders of its permission.
+// RequiredRole is still honoured for definitions written before transitions
+// were expressed as permissions.
+func transitionAllows(t models.WorkflowTransition, user *models.User, contentTypeID uint) bool {
+	if t.RequiredPermission != "" && userHasPermission(user, t.RequiredPermission, contentTypeID) {
+		return true
+	}
+	if t.RequiredRole != "" && t.RequiredRole == roleName(user) {
+		return true
+	}
+	return false
+}
+
+// userHasPermission checks a "Module:action" permission, skipping grants whose
+// ContentTypeIDs leave out contentTypeID.
+func userHasPermission(user *models.User, permission string, contentTypeID uint) bool {
+	if user.Role == nil {
+		return false
+	}
+
+	module, action, ok := strings.Cut(permission, ":")
+	if !ok {
+		return false
+	}
+
+	for _, perm := range user.Role.Permissions {
+		if perm.Module == module && perm.Action == action && perm.AppliesToContentType(contentTypeID) {
+			return true
+		}
+	}
+	return false
+}
+
+func roleName(user *models.User) string {
+	if user.Role == nil {
+		return ""
+	}
+	return user.Role.Name
+}
+
+// WorkflowForContentType returns the workflow assigned to the content type,
+// falling back to the definition flagged as default. A nil definition means
+// the built-in flow applies.
+func WorkflowForContentType(ctx context.Context, contentTypeID uint) (*models.WorkflowDefinition, error) {
+	var ct models.ContentType
+	if err := database.DB.WithContext(ctx).Select("id", "workflow_id").First(&ct, contentTypeID).Error; err == nil && ct.WorkflowID != nil {
+		var definition models.WorkflowDefinition
+		if err := database.DB.WithContext(ctx).Preload("Transitions").First(&definition, *ct.WorkflowID).Error; err != nil {
+			return nil, err
+		}
+		return &definition, nil
+	}
+
+	return defaultWorkflow(ctx)
+}
+
+func defaultWorkflow(ctx context.Context) (*models.WorkflowDefinition, error) {
+	var definition models.WorkflowDefinition
+	err := database.DB.WithContext(ctx).Preload("Transitions").Where("is_default = ?", true).First(&definition).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+func builtinWorkflow() models.WorkflowDefinition {
+	states, _ := json.Marshal(models.WorkflowStatuses)
+	definition := models.WorkflowDefinition{
+		Name:   "built-in",
+		States: datatypes.JSON(states),
+	}
+
+	for _, from := range models.WorkflowStatuses {
+		for _, to := range models.WorkflowStatuses {
+			if permission, exists := defaultTransitions[from][to]; exists {
+				definition.Transitions = append(definition.Transitions, models.WorkflowTransition{
+					FromStatus:         from,
+					ToStatus:           to,
+					RequiredPermission: permission,
+				})
+			}
+		}
+	}
+	definition.Guards = defaultGuards
+
+	return definition
+}
+
+func validateWorkflowDefinition(input WorkflowDefinitionInput) map[string]string {
+	errs := make(map[string]string)
+
+	if strings.TrimSpace(input.Name) == "" {
+		errs["name"] = "name is required"
+	}
+
+	states := make(map[string]bool)
+	for _, state := range input.States {
+		if !models.WorkflowStatus(state).IsValid() {
+			errs["states"] = fmt.Sprintf("unknown state: %s", state)
+			break
+		}
+		states[state] = true
+	}
+	if len(input.States) == 0 {
+		errs["states"] = "states are required"
+	} else if _, ok := errs["states"]; !ok && !states[string(models.StatusDraft)] {
+		errs["states"] = "states must include draft"
+	}
+
+	defined := make(map[string]bool)
+	for _, t := range input.Transitions {
+		defined[t.FromStatus+">"+t.ToStatus] = true
+	}
+
+	for i, stage := range input.Stages {
+		key := fmt.Sprintf("stages[%d]", i)
+		switch {
+		case strings.TrimSpace(stage.Name) == "":
+			errs[key] = "name is required"
+		case stage.ToStatus != string(models.StatusApproved):
+			errs[key] = "approval stages can only gate transitions to approved"
+		case !defined[stage.FromStatus+">"+stage.ToStatus]:
+			errs[key] = "stage must gate a transition defined in transitions"
+		case stage.MinApprovals < 0:
+			errs[key] = "min_approvals cannot be negative"
+		}
+	}
+
+	for i, guard := range input.Guards {
+		key := fmt.Sprintf("guards[%d]", i)
+		switch {
+		case !states[guard.ToStatus]:
+			errs[key] = "to_status must be listed in states"
+		case guard.FromStatus != "" && !states[guard.FromStatus]:
+			errs[key] = "from_status must be empty or listed in states"
+		case !isValidGuardType(guard.Type):
+			errs[key] = fmt.Sprintf("unknown guard type: %s", guard.Type)
+		case guard.Type == GuardRequiredFields && len(guard.Fields) == 0:
+			errs[key] = "fields are required for required_fields guards"
+		case guard.Type == GuardCustom:
+			if _, ok := registeredGuard(guard.Name); !ok {
+				errs[key] = fmt.Sprintf("custom guard '%s' is not registered", guard.Name)
+			}
+		}
+	}
+
+	for i, t := range input.Transitions {
+		key := fmt.Sprintf("transitions[%d]", i)
+		switch {
+		case !states[t.FromStatus] || !states[t.ToStatus]:
+			errs[key] = "from_status and to_status must be listed in states"
+		case t.FromStatus == t.ToStatus:
+			errs[key] = "from_status and to_status must differ"
+		case t.RequiredRole == "" && t.RequiredPermission == "":
+			errs[key] = "required_role or required_permission is required"
+		case t.RequiredPermission != "" && !strings.Contains(t.RequiredPermission, ":"):
+			errs[key] = "required_permission must look like Module:action"
+		}
+	}
+
+	return errs
+}
+
+func buildStages(input []ApprovalStageInput) []models.ApprovalStage {
+	stages := make([]models.ApprovalStage, 0, len(input))
+	for i, s := range input {
+		stage := models.ApprovalStage{
+			FromStatus:   models.WorkflowStatus(s.FromStatus),
+			ToStatus:     models.WorkflowStatus(s.ToStatus),
+			Name:         s.Name,
+			Position:     i + 1,
+			MinApprovals: s.MinApprovals,
+		}
+		if stage.MinApprovals == 0 {
+			stage.MinApprovals = 1
+		}
+		if len(s.RequiredRoles) > 0 {
+			roles, _ := json.Marshal(s.RequiredRoles)
+			stage.RequiredRoles = datatypes.JSON(roles)
+		}
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+func buildGuards(input []TransitionGuardInput) []models.TransitionGuard {
+	guards := make([]models.TransitionGuard, 0, len(input))
+	for _, g := range input {
+		guard := models.TransitionGuard{
+			FromStatus: g.FromStatus,
+			ToStatus:   models.WorkflowStatus(g.ToStatus),
+			Type:       g.Type,
+			Name:       g.Name,
+		}
+		if len(g.Fields) > 0 {
+			fields, _ := json.Marshal(g.Fields)
+			guard.Fields = datatypes.JSON(fields)
+		}
+		guards = append(guards, guard)
+	}
+	return guards
+}
+
+func buildTransitions(input []WorkflowTransitionInput) []models.WorkflowTransition {
+	transitions := make([]models.WorkflowTransition, 0, len(input))
+	for _, t := range input {
+		transitions = append(transitions, models.WorkflowTransition{
+			FromStatus:         models.WorkflowStatus(t.FromStatus),
+			ToStatus:           models.WorkflowStatus(t.ToStatus),
+			RequiredRole:       t.RequiredRole,
+			RequiredPermission: t.RequiredPermission,
+		})
+	}
+	return transitions
+}
+
+// countStrandedEntries counts entries of the given content types whose status
+// is not one of states; switching them to such a workflow would leave those
+// entries with no way forward.
+func countStrandedEntries(tx *gorm.DB, contentTypes *gorm.DB, states []string) (int64, error) {
+	var count int64
+	err := tx.Model(&models.ContentEntry{}).
+		Where("content_type_id IN (?)", contentTypes).
+		Where("status NOT IN ?", states).
+		Count(&count).Error
+	return count, err
+}
+
+func workflowNameTaken(tx *gorm.DB, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.WorkflowDefinition{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+func definitionStates(definition *models.WorkflowDefinition) []string {
+	var states []string
+	json.Unmarshal(definition.States, &states)
+	return states
+}
+
+func ListWorkflowDefinitions(ctx context.Context) ([]models.WorkflowDefinition, error) {
+	var definitions []models.WorkflowDefinition
+	err := database.DB.WithContext(ctx).Preload("Transitions").Preload("Stages").Preload("Guards").Order("name ASC").Find(&definitions).Error
+	return definitions, err
+}
+
+func GetWorkflowDefinition(ctx context.Context, id uint) (*models.WorkflowDefinition, error) {
+	var definition models.WorkflowDefinition
+	if err := database.DB.WithContext(ctx).Preload("Transitions").Preload("Stages").Preload("Guards").First(&definition, id).Error; err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+func CreateWorkflowDefinition(ctx context.Context, input WorkflowDefinitionInput) (*models.WorkflowDefinition, error) {
+	states, _ := json.Marshal(input.States)
+	definition := models.WorkflowDefinition{
+		Name:        input.Name,
+		Description: input.Description,
+		States:      datatypes.JSON(states),
+		IsDefault:   input.IsDefault,
+		Transitions: buildTransitions(input.Transitions),
+		Stages:      buildStages(input.Stages),
+		Guards:      buildGuards(input.Guards),
+	}
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		taken, err := workflowNameTaken(tx, input.Name, 0)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrWorkflowNameTaken
+		}
+
+		if input.IsDefault {
+			unassigned := tx.Model(&models.ContentType{}).Select("id").Where("workflow_id IS NULL")
+			stranded, err := countStrandedEntries(tx, unassigned, input.States)
+			if err != nil {
+				return err
+			}
+			if stranded > 0 {
+				return &StrandedEntriesError{Count: stranded}
+			}
+
+			if err := tx.Model(&models.WorkflowDefinition{}).
+				Where("is_default = ?", true).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&definition).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetWorkflowDefinition(ctx, definition.ID)
+}
+
+func UpdateWorkflowDefinition(ctx context.Context, id uint, input WorkflowDefinitionInput) (*models.WorkflowDefinition, error) {
+	var definition models.WorkflowDefinition
+	if err := database.DB.WithContext(ctx).First(&definition, id).Error; err != nil {
+		return nil, err
+	}
+
+	states, _ := json.Marshal(input.States)
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		taken, err := workflowNameTaken(tx, input.Name, id)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrWorkflowNameTaken
+		}
+
+		contentTypes := tx.Model(&models.ContentType{}).Select("id").Where("workflow_id = ?", id)
+		if input.IsDefault || definition.IsDefault {
+			contentTypes = tx.Model(&models.ContentType{}).Select("id").
+				Where("workflow_id = ? OR workflow_id IS NULL", id)
+		}
+
+		stranded, err := countStrandedEntries(tx, contentTypes, input.States)
+		if err != nil {
+			return err
+		}
+		if stranded > 0 {
+			return &StrandedEntriesError{Count: stranded}
+		}
+
+		if input.IsDefault {
+			if err := tx.Model(&models.WorkflowDefinition{}).
+				Where("is_default = ? AND id <> ?", true, id).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&definition).Updates(map[string]interface{}{
+			"name":        input.Name,
+			"description": input.Description,
+			"states":      datatypes.JSON(states),
+			"is_default":  input.IsDefault,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("workflow_id = ?", id).Delete(&models.WorkflowTransition{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("workflow_id = ?", id).Delete(&models.ApprovalStage{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("workflow_id = ?", id).Delete(&models.TransitionGuard{}).Error; err != nil {
+			return err
+		}
+
+		transitions := buildTransitions(input.Transitions)
+		for i := range transitions {
+			transitions[i].WorkflowID = &definition.ID
+		}
+		if len(transitions) > 0 {
+			if err := tx.Create(&transitions).Error; err != nil {
+				return err
+			}
+		}
+
+		stages := buildStages(input.Stages)
+		for i := range stages {
+			stages[i].WorkflowID = definition.ID
+		}
+		if len(stages) > 0 {
+			if err := tx.Create(&stages).Error; err != nil {
+				return err
+			}
+		}
+
+		guards := buildGuards(input.Guards)
+		for i := range guards {
+			guards[i].WorkflowID = definition.ID
+		}
+		if len(guards) > 0 {
+			return tx.Create(&guards).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetWorkflowDefinition(ctx, id)
+}
+
+func DeleteWorkflowDefinition(ctx context.Context, id uint) error {
+	var definition models.WorkflowDefinition
+	if err := database.DB.WithContext(ctx).First(&definition, id).Error; err != nil {
+		return err
+	}
+
+	if definition.IsDefault {
+		return ErrDefaultWorkflow
+	}
+
+	var assigned int64
+	database.DB.WithContext(ctx).Model(&models.ContentType{}).Where("workflow_id = ?", id).Count(&assigned)
+	if assigned > 0 {
+		return ErrWorkflowInUse
+	}
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workflow_id = ?", id).Delete(&models.WorkflowTransition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("workflow_id = ?", id).Delete(&models.ApprovalStage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("workflow_id = ?", id).Delete(&models.TransitionGuard{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&definition).Error
+	})
+}
+
+func AssignContentTypeWorkflow(ctx context.Context, contentTypeID uint, workflowID *uint) (*models.ContentType, error) {
+	var ct models.ContentType
+	if err := database.DB.WithContext(ctx).First(&ct, contentTypeID).Error; err != nil {
+		return nil, err
+	}
+
+	var target *models.WorkflowDefinition
+	var err error
+	if workflowID != nil {
+		target, err = GetWorkflowDefinition(ctx, *workflowID)
+	} else {
+		target, err = defaultWorkflow(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if target != nil {
+		contentTypes := database.DB.WithContext(ctx).Model(&models.ContentType{}).Select("id").Where("id = ?", ct.ID)
+		stranded, err := countStrandedEntries(database.DB.WithContext(ctx), contentTypes, definitionStates(target))
+		if err != nil {
+			return nil, err
+		}
+		if stranded > 0 {
+			return nil, &StrandedEntriesError{Count: stranded}
+		}
+	}
+
+	if err := database.DB.WithContext(ctx).Model(&ct).Update("workflow_id", workflowID).Error; err != nil {
+		return nil, err
+	}
+
+	ct.WorkflowID = workflowID
+	return &ct, nil
+}
@@ -0,0 +1,274 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Kyz7/cms/internal/content"
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+const (
+	GuardSchema             = "schema"
+	GuardRequiredFields     = "required_fields"
+	GuardSEOFields          = "seo_fields"
+	GuardMediaExists        = "media_exists"
+	GuardRelationsPublished = "relations_published"
+	GuardThreadsResolved    = "threads_resolved"
+	GuardCustom             = "custom"
+)
+
+// defaultGuards apply when no workflow definition exists for the content type.
+// The SEO, media and relation checks are opt-in: a definition lists them in
+// its guards.
+var defaultGuards = []models.TransitionGuard{
+	{ToStatus: models.StatusPublished, Type: GuardSchema},
+}
+
+// GuardFunc inspects an entry about to transition and returns an error
+// describing why it may not.
+type GuardFunc func(entry *models.ContentEntry, toStatus models.WorkflowStatus) error
+
+var (
+	customGuardsMu sync.RWMutex
+	customGuards   = make(map[string]GuardFunc)
+)
+
+// RegisterGuard makes a Go check available to workflow definitions as a
+// "custom" guard under name.
+func RegisterGuard(name string, fn GuardFunc) {
+	customGuardsMu.Lock()
+	defer customGuardsMu.Unlock()
+	customGuards[name] = fn
+}
+
+func registeredGuard(name string) (GuardFunc, bool) {
+	customGuardsMu.RLock()
+	defer customGuardsMu.RUnlock()
+	fn, ok := customGuards[name]
+	return fn, ok
+}
+
+type GuardFailure struct {
+	Guard   string `json:"guard"`
+	Message string `json:"message"`
+}
+
+type GuardError struct {
+	ToStatus models.WorkflowStatus
+	Failures []GuardFailure
+}
+
+func (e *GuardError) Error() string {
+	return fmt.Sprintf("transition to %s blocked by %d failed checks", e.ToStatus, len(e.Failures))
+}
+
+func isValidGuardType(guardType string) bool {
+	switch guardType {
+	case GuardSchema, GuardRequiredFields, GuardSEOFields, GuardMediaExists, GuardRelationsPublished, GuardThreadsResolved, GuardCustom:
+		return true
+	}
+	return false
+}
+
+func transitionGuards(ctx context.Context, contentTypeID uint, fromStatus, toStatus models.WorkflowStatus) ([]models.TransitionGuard, error) {
+	definition, err := WorkflowForContentType(ctx, contentTypeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if definition == nil {
+		var guards []models.TransitionGuard
+		for _, g := range defaultGuards {
+			if g.ToStatus == toStatus && (g.FromStatus == "" || g.FromStatus == string(fromStatus)) {
+				guards = append(guards, g)
+			}
+		}
+		return guards, nil
+	}
+
+	var guards []models.TransitionGuard
+	err = database.DB.WithContext(ctx).
+		Where("workflow_id = ? AND to_status = ?", definition.ID, toStatus).
+		Where("from_status = '' OR from_status IS NULL OR from_status = ?", fromStatus).
+		Order("id ASC").
+		Find(&guards).Error
+	return guards, err
+}
+
+// CheckTransitionGuards runs every guard on the transition and returns all
+// failures rather than stopping at the first.
+func CheckTransitionGuards(ctx context.Context, entry *models.ContentEntry, toStatus models.WorkflowStatus) ([]GuardFailure, error) {
+	guards, err := transitionGuards(ctx, entry.ContentTypeID, entry.Status, toStatus)
+	if err != nil || len(guards) == 0 {
+		return nil, err
+	}
+
+	var ct models.ContentType
+	if err := database.DB.WithContext(ctx).Preload("Fields").First(&ct, entry.ContentTypeID).Error; err != nil {
+		return nil, fmt.Errorf("content type not found")
+	}
+
+	data := make(map[string]interface{})
+	if len(entry.Data) > 0 {
+		json.Unmarshal(entry.Data, &data)
+	}
+
+	failures := []GuardFailure{}
+	for _, guard := range guards {
+		name := guard.Type
+		if guard.Type == GuardCustom {
+			name = guard.Name
+		}
+		for _, message := range runGuard(ctx, guard, entry, ct, data, toStatus) {
+			failures = append(failures, GuardFailure{Guard: name, Message: message})
+		}
+	}
+
+	return failures, nil
+}
+
+func runGuard(ctx context.Context, guard models.TransitionGuard, entry *models.ContentEntry, ct models.ContentType, data map[string]interface{}, toStatus models.WorkflowStatus) []string {
+	switch guard.Type {
+	case GuardSchema:
+		return content.ValidateEntrySchema(ctx, ct, data, entry.ID)
+
+	case GuardRequiredFields:
+		var fields []string
+		json.Unmarshal(guard.Fields, &fields)
+		return emptyFields(data, fields)
+
+	case GuardSEOFields:
+		if !ct.EnableSEO {
+			return nil
+		}
+		var fields []string
+		for _, field := range ct.Fields {
+			if field.IsSEO {
+				fields = append(fields, field.Name)
+			}
+		}
+		return emptyFields(data, fields)
+
+	case GuardMediaExists:
+		return missingMedia(ctx, ct, data)
+
+	case GuardRelationsPublished:
+		return unpublishedRelations(ctx, entry.ID)
+
+	case GuardThreadsResolved:
+		if open := countOpenThreads(ctx, entry.ID); open > 0 {
+			return []string{fmt.Sprintf("%d review threads are still open", open)}
+		}
+
+	case GuardCustom:
+		fn, ok := registeredGuard(guard.Name)
+		if !ok {
+			return []string{fmt.Sprintf("check '%s' is not registered", guard.Name)}
+		}
+		if err := fn(entry, toStatus); err != nil {
+			return []string{err.Error()}
+		}
+	}
+
+	return nil
+}
+
+func emptyFields(data map[string]interface{}, fields []string) []string {
+	var messages []string
+	for _, name := range fields {
+		value, exists := data[name]
+		if str, ok := value.(string); !exists || value == nil || (ok && strings.TrimSpace(str) == "") {
+			messages = append(messages, fmt.Sprintf("field '%s' must not be empty", name))
+		}
+	}
+	return messages
+}
+
+func missingMedia(ctx context.Context, ct models.ContentType, data map[string]interface{}) []string {
+	var messages []string
+	for _, field := range ct.Fields {
+		if field.Type != "media" {
+			continue
+		}
+
+		mediaID, ok := data[field.Name+"_media_id"].(float64)
+		if !ok {
+			continue
+		}
+
+		var count int64
+		database.DB.WithContext(ctx).Model(&models.MediaFile{}).Where("id = ?", uint(mediaID)).Count(&count)
+		if count == 0 {
+			messages = append(messages, fmt.Sprintf("media %d referenced by field '%s' no longer exists", uint(mediaID), field.Name))
+		}
+	}
+	return messages
+}
+
+func unpublishedRelations(ctx context.Context, entryID uint) []string {
+	var relations []models.ContentRelation
+	database.DB.WithContext(ctx).Where("from_content_id = ?", entryID).Order("id ASC").Find(&relations)
+
+	var messages []string
+	for _, relation := range relations {
+		var related models.ContentEntry
+		if err := database.DB.WithContext(ctx).Select("id", "status").First(&related, relation.ToContentID).Error; err != nil {
+			messages = append(messages, fmt.Sprintf("related entry %d (%s) no longer exists", relation.ToContentID, relation.RelationType))
+			continue
+		}
+		status := pendingStatus(ctx, &related)
+		if status != models.StatusPublished && !relatesBack(ctx, related.ID, entryID) {
+			messages = append(messages, fmt.Sprintf("related entry %d (%s) is %s, not published", related.ID, relation.RelationType, status))
+		}
+	}
+	return messages
+}
+
+type pendingStatusesKey struct{}
+
+// withPendingStatuses records the statuses a batch of entries is about to move
+// to together, so relation checks judge each entry by where its related
+// entries will be rather than where they are now.
+func withPendingStatuses(ctx context.Context, statuses map[uint]models.WorkflowStatus) context.Context {
+	return context.WithValue(ctx, pendingStatusesKey{}, statuses)
+}
+
+func pendingStatus(ctx context.Context, entry *models.ContentEntry) models.WorkflowStatus {
+	if statuses, ok := ctx.Value(pendingStatusesKey{}).(map[uint]models.WorkflowStatus); ok {
+		if status, ok := statuses[entry.ID]; ok {
+			return status
+		}
+	}
+	return entry.Status
+}
+
+// relatesBack reports whether start leads back to target through relations.
+// Entries in such a cycle could never be published one after the other, so
+// relations_published does not hold them to each other.
+func relatesBack(ctx context.Context, start, target uint) bool {
+	seen := map[uint]bool{start: true}
+	queue := []uint{start}
+	for len(queue) > 0 {
+		var next []uint
+		database.DB.WithContext(ctx).Model(&models.ContentRelation{}).
+			Where("from_content_id IN ?", queue).
+			Pluck("to_content_id", &next)
+
+		queue = nil
+		for _, id := range next {
+			if id == target {
+				return true
+			}
+			if !seen[id] {
+				seen[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+	return false
+}
@@ -1,10 +1,17 @@
 package workflow
 
 import (
+	"errors"
+	"strings"
 	"time"
 
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
 	"github.com/Kyz7/cms/internal/response"
+	"github.com/Kyz7/cms/internal/utils"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type ChangeStatusRequest struct {
@@ -18,11 +25,35 @@ type AddCommentRequest struct {
 }
 
 type AssignEntryRequest struct {
-	AssignedTo uint       `json:"assigned_to"`
-	DueDate    *time.Time `json:"due_date,omitempty"`
+	AssignedTo   *uint      `json:"assigned_to"`
+	AssignedRole string     `json:"assigned_role"`
+	DueDate      *time.Time `json:"due_date,omitempty"`
+}
+
+func workflowErrorResponse(c *fiber.Ctx, err error) error {
+	var stale *StaleVersionError
+	var guard *GuardError
+	var veto *events.VetoError
+	switch {
+	case errors.As(err, &guard):
+		return response.Error(c, fiber.StatusUnprocessableEntity, "TRANSITION_CHECKS_FAILED", err.Error(), fiber.Map{
+			"failed_checks": guard.Failures,
+		})
+	case errors.As(err, &veto):
+		return response.Error(c, fiber.StatusUnprocessableEntity, "OPERATION_VETOED", err.Error(), nil)
+	case errors.Is(err, utils.ErrVersionRequired):
+		return response.PreconditionRequired(c, err.Error())
+	case errors.As(err, &stale):
+		c.Set(fiber.HeaderETag, utils.FormatETag(stale.CurrentVersion))
+		return response.PreconditionFailed(c, err.Error(), fiber.Map{
+			"current_version": stale.CurrentVersion,
+		})
+	}
+	return response.BadRequest(c, err.Error(), nil)
 }
 
 func ChangeStatusHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -45,15 +76,22 @@ func ChangeStatusHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	entry, err := ChangeWorkflowStatus(uint(entryID), userID, body.Status, body.Comment)
+	version, err := utils.EntryVersionFromRequest(c)
 	if err != nil {
-		return response.BadRequest(c, err.Error(), nil)
+		return workflowErrorResponse(c, err)
+	}
+
+	entry, err := ChangeWorkflowStatus(ctx, uint(entryID), userID, body.Status, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
 	}
 
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return response.Success(c, entry, "Status changed successfully")
 }
 
 func RequestReviewHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -66,15 +104,22 @@ func RequestReviewHandler(c *fiber.Ctx) error {
 	}
 	c.BodyParser(&body)
 
-	entry, err := RequestReview(uint(entryID), userID, body.Comment)
+	version, err := utils.EntryVersionFromRequest(c)
 	if err != nil {
-		return response.BadRequest(c, err.Error(), nil)
+		return workflowErrorResponse(c, err)
 	}
 
+	entry, err := RequestReview(ctx, uint(entryID), userID, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return response.Success(c, entry, "Entry sent for review")
 }
 
 func ApproveEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -87,15 +132,25 @@ func ApproveEntryHandler(c *fiber.Ctx) error {
 	}
 	c.BodyParser(&body)
 
-	entry, err := ApproveEntry(uint(entryID), userID, body.Comment)
+	version, err := utils.EntryVersionFromRequest(c)
 	if err != nil {
-		return response.BadRequest(c, err.Error(), nil)
+		return workflowErrorResponse(c, err)
 	}
 
+	entry, err := ApproveEntry(ctx, uint(entryID), userID, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
+	if entry.Status != models.StatusApproved {
+		return response.Success(c, entry, "Approval recorded, waiting for remaining approvers")
+	}
 	return response.Success(c, entry, "Entry approved successfully")
 }
 
 func RejectEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -116,15 +171,22 @@ func RejectEntryHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	entry, err := RejectEntry(uint(entryID), userID, body.Comment)
+	version, err := utils.EntryVersionFromRequest(c)
 	if err != nil {
-		return response.BadRequest(c, err.Error(), nil)
+		return workflowErrorResponse(c, err)
+	}
+
+	entry, err := RejectEntry(ctx, uint(entryID), userID, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
 	}
 
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return response.Success(c, entry, "Entry rejected")
 }
 
 func PublishEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -137,21 +199,115 @@ func PublishEntryHandler(c *fiber.Ctx) error {
 	}
 	c.BodyParser(&body)
 
-	entry, err := PublishEntry(uint(entryID), userID, body.Comment)
+	version, err := utils.EntryVersionFromRequest(c)
 	if err != nil {
-		return response.BadRequest(c, err.Error(), nil)
+		return workflowErrorResponse(c, err)
 	}
 
+	entry, err := PublishEntry(ctx, uint(entryID), userID, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
 	return response.Success(c, entry, "Entry published successfully")
 }
 
+func UnpublishEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	c.BodyParser(&body)
+
+	version, err := utils.EntryVersionFromRequest(c)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	entry, err := UnpublishEntry(ctx, uint(entryID), userID, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
+	return response.Success(c, entry, "Entry unpublished successfully")
+}
+
+func ArchiveEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	c.BodyParser(&body)
+
+	version, err := utils.EntryVersionFromRequest(c)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	entry, err := ArchiveEntry(ctx, uint(entryID), userID, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
+	return response.Success(c, entry, "Entry archived successfully")
+}
+
+func RestoreEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	c.BodyParser(&body)
+
+	version, err := utils.EntryVersionFromRequest(c)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	entry, err := RestoreEntry(ctx, uint(entryID), userID, body.Comment, version)
+	if err != nil {
+		return workflowErrorResponse(c, err)
+	}
+
+	c.Set(fiber.HeaderETag, utils.FormatETag(entry.Version))
+	return response.Success(c, entry, "Entry restored to draft")
+}
+
 func GetHistoryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
 	}
 
-	history, err := GetWorkflowHistory(uint(entryID))
+	history, err := GetWorkflowHistory(ctx, uint(entryID))
+	if errors.Is(err, ErrEntryNotFound) {
+		return response.NotFound(c, "Entry")
+	}
 	if err != nil {
 		return response.InternalError(c, "Failed to fetch workflow history")
 	}
@@ -160,6 +316,7 @@ func GetHistoryHandler(c *fiber.Ctx) error {
 }
 
 func AddCommentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -167,10 +324,7 @@ func AddCommentHandler(c *fiber.Ctx) error {
 
 	userID := c.Locals("user_id").(uint)
 
-	var body struct {
-		Comment   string `json:"comment"`
-		IsPrivate bool   `json:"is_private"`
-	}
+	var body CommentInput
 	if err := c.BodyParser(&body); err != nil {
 		return response.BadRequest(c, "Invalid request body", err.Error())
 	}
@@ -181,23 +335,31 @@ func AddCommentHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	comment, err := AddWorkflowComment(uint(entryID), userID, body.Comment, body.IsPrivate)
+	comment, err := AddWorkflowComment(ctx, uint(entryID), userID, body)
 	if err != nil {
-		return response.InternalError(c, "Failed to add comment")
+		return response.BadRequest(c, err.Error(), nil)
 	}
 
 	return response.Created(c, comment, "Comment added successfully")
 }
 
 func GetCommentsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
 	}
 
-	includePrivate := c.Query("include_private") == "true"
+	filter := CommentFilter{
+		IncludePrivate: c.Query("include_private") == "true",
+		FieldName:      c.Query("field"),
+	}
+	if resolved := c.Query("resolved"); resolved != "" {
+		value := resolved == "true"
+		filter.Resolved = &value
+	}
 
-	comments, err := GetWorkflowComments(uint(entryID), includePrivate)
+	comments, err := GetWorkflowComments(ctx, uint(entryID), filter)
 	if err != nil {
 		return response.InternalError(c, "Failed to fetch comments")
 	}
@@ -206,6 +368,7 @@ func GetCommentsHandler(c *fiber.Ctx) error {
 }
 
 func AssignEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	entryID, err := c.ParamsInt("entry_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid entry ID", nil)
@@ -213,33 +376,43 @@ func AssignEntryHandler(c *fiber.Ctx) error {
 
 	userID := c.Locals("user_id").(uint)
 
-	var body struct {
-		AssignedTo uint       `json:"assigned_to"`
-		DueDate    *time.Time `json:"due_date,omitempty"`
-	}
+	var body AssignEntryRequest
 	if err := c.BodyParser(&body); err != nil {
 		return response.BadRequest(c, "Invalid request body", err.Error())
 	}
 
-	if body.AssignedTo == 0 {
+	if (body.AssignedTo == nil || *body.AssignedTo == 0) && body.AssignedRole == "" {
 		return response.ValidationError(c, map[string]string{
-			"assigned_to": "assigned_to is required",
+			"assigned_to": "assigned_to or assigned_role is required",
 		})
 	}
 
-	assignment, err := AssignEntry(uint(entryID), body.AssignedTo, userID, body.DueDate)
+	assignment, err := AssignEntry(ctx, uint(entryID), body.AssignedTo, body.AssignedRole, userID, body.DueDate)
+	if errors.Is(err, ErrEntryNotFound) {
+		return response.NotFound(c, "Entry")
+	}
 	if err != nil {
-		return response.InternalError(c, "Failed to assign entry")
+		return response.BadRequest(c, err.Error(), nil)
 	}
 
 	return response.Created(c, assignment, "Entry assigned successfully")
 }
 
 func GetMyAssignmentsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	userID := c.Locals("user_id").(uint)
 	status := c.Query("status")
+	due := c.Query("due")
+	if due != "" && due != "overdue" && due != "due_soon" {
+		return response.BadRequest(c, "due must be overdue or due_soon", nil)
+	}
+
+	window, err := time.ParseDuration(c.Query("within", "24h"))
+	if err != nil || window <= 0 {
+		return response.BadRequest(c, "Invalid within duration", nil)
+	}
 
-	assignments, err := GetMyAssignments(userID, status)
+	assignments, err := GetMyAssignments(ctx, userID, status, due, window)
 	if err != nil {
 		return response.InternalError(c, "Failed to fetch assignments")
 	}
@@ -248,12 +421,13 @@ func GetMyAssignmentsHandler(c *fiber.Ctx) error {
 }
 
 func CompleteAssignmentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	assignmentID, err := c.ParamsInt("assignment_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid assignment ID", nil)
 	}
 
-	if err := CompleteAssignment(uint(assignmentID)); err != nil {
+	if err := CompleteAssignment(ctx, uint(assignmentID)); err != nil {
 		return response.InternalError(c, "Failed to complete assignment")
 	}
 
@@ -261,6 +435,7 @@ func CompleteAssignmentHandler(c *fiber.Ctx) error {
 }
 
 func GetEntriesByStatusHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, err := c.ParamsInt("content_type_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid content type ID", nil)
@@ -268,7 +443,7 @@ func GetEntriesByStatusHandler(c *fiber.Ctx) error {
 
 	status := c.Query("status")
 
-	entries, err := GetEntriesByStatus(uint(contentTypeID), status)
+	entries, err := GetEntriesByStatus(ctx, uint(contentTypeID), status)
 	if err != nil {
 		return response.InternalError(c, "Failed to fetch entries")
 	}
@@ -277,15 +452,661 @@ func GetEntriesByStatusHandler(c *fiber.Ctx) error {
 }
 
 func GetWorkflowStatsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 	contentTypeID, err := c.ParamsInt("content_type_id")
 	if err != nil {
 		return response.BadRequest(c, "Invalid content type ID", nil)
 	}
 
-	stats, err := GetWorkflowStatistics(uint(contentTypeID))
+	stats, err := GetWorkflowStatistics(ctx, uint(contentTypeID))
 	if err != nil {
 		return response.InternalError(c, "Failed to fetch statistics")
 	}
 
 	return response.Success(c, stats, "Workflow statistics retrieved successfully")
 }
+
+func ScheduleEntryHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	var body struct {
+		PublishAt   *time.Time `json:"publish_at,omitempty"`
+		UnpublishAt *time.Time `json:"unpublish_at,omitempty"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	entry, err := ScheduleEntry(ctx, uint(entryID), userID, body.PublishAt, body.UnpublishAt)
+	if err != nil {
+		return response.BadRequest(c, err.Error(), nil)
+	}
+
+	return response.Success(c, entry, "Entry scheduled successfully")
+}
+
+func CancelScheduleHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	entry, err := CancelSchedule(ctx, uint(entryID))
+	if err != nil {
+		return response.NotFound(c, "Entry")
+	}
+
+	return response.Success(c, entry, "Schedule cancelled successfully")
+}
+
+func GetScheduledEntriesHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entries, err := GetScheduledEntries(ctx)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch scheduled entries")
+	}
+
+	return response.Success(c, entries, "Scheduled entries retrieved successfully")
+}
+
+func resolveThreadHandler(c *fiber.Ctx, resolved bool) error {
+	ctx := c.UserContext()
+	commentID, err := c.ParamsInt("comment_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid comment ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	comment, err := SetThreadResolved(ctx, uint(commentID), userID, resolved)
+	if errors.Is(err, ErrCommentNotFound) {
+		return response.NotFound(c, "Comment")
+	}
+	if err != nil {
+		return response.InternalError(c, "Failed to update thread")
+	}
+
+	if resolved {
+		return response.Success(c, comment, "Thread resolved")
+	}
+	return response.Success(c, comment, "Thread reopened")
+}
+
+func ResolveThreadHandler(c *fiber.Ctx) error {
+	return resolveThreadHandler(c, true)
+}
+
+func ReopenThreadHandler(c *fiber.Ctx) error {
+	return resolveThreadHandler(c, false)
+}
+
+func GetMyMentionsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	userID := c.Locals("user_id").(uint)
+
+	comments, err := GetMyMentions(ctx, userID)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch mentions")
+	}
+
+	return response.Success(c, comments, "Mentions retrieved successfully")
+}
+
+func GetApprovalProgressHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	progress, err := GetApprovalProgress(ctx, uint(entryID))
+	if err != nil {
+		return response.NotFound(c, "Entry")
+	}
+
+	return response.Success(c, progress, "Approval progress retrieved successfully")
+}
+
+func assignmentErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrAssignmentNotFound):
+		return response.NotFound(c, "Assignment")
+	case errors.Is(err, ErrNotAssignee):
+		return response.Forbidden(c, err.Error())
+	case errors.Is(err, ErrAssignmentNotPending), errors.Is(err, ErrAssignmentClaimed):
+		return response.Conflict(c, err.Error())
+	default:
+		return response.BadRequest(c, err.Error(), nil)
+	}
+}
+
+func ReassignAssignmentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	assignmentID, err := c.ParamsInt("assignment_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid assignment ID", nil)
+	}
+
+	var body struct {
+		AssignedTo   *uint      `json:"assigned_to"`
+		AssignedRole string     `json:"assigned_role"`
+		DueDate      *time.Time `json:"due_date,omitempty"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	if body.AssignedTo == nil && body.AssignedRole == "" {
+		return response.ValidationError(c, map[string]string{
+			"assigned_to": "assigned_to or assigned_role is required",
+		})
+	}
+
+	assignment, err := ReassignAssignment(ctx, uint(assignmentID), body.AssignedTo, body.AssignedRole, body.DueDate)
+	if err != nil {
+		return assignmentErrorResponse(c, err)
+	}
+
+	return response.Success(c, assignment, "Assignment reassigned successfully")
+}
+
+func ClaimAssignmentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	assignmentID, err := c.ParamsInt("assignment_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid assignment ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	assignment, err := ClaimAssignment(ctx, uint(assignmentID), userID)
+	if err != nil {
+		return assignmentErrorResponse(c, err)
+	}
+
+	return response.Success(c, assignment, "Assignment claimed successfully")
+}
+
+func DeclineAssignmentHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	assignmentID, err := c.ParamsInt("assignment_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid assignment ID", nil)
+	}
+
+	userID := c.Locals("user_id").(uint)
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&body)
+
+	assignment, err := DeclineAssignment(ctx, uint(assignmentID), userID, body.Reason)
+	if err != nil {
+		return assignmentErrorResponse(c, err)
+	}
+
+	return response.Success(c, assignment, "Assignment declined")
+}
+
+func CheckTransitionHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	toStatus := models.WorkflowStatus(c.Query("to", string(models.StatusPublished)))
+	if !toStatus.IsValid() {
+		return response.BadRequest(c, "Invalid target status", nil)
+	}
+
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return response.NotFound(c, "Entry")
+	}
+
+	failures, err := CheckTransitionGuards(ctx, &entry, toStatus)
+	if err != nil {
+		return response.InternalError(c, "Failed to run checks")
+	}
+	if failures == nil {
+		failures = []GuardFailure{}
+	}
+
+	return response.Success(c, fiber.Map{
+		"to_status":     toStatus,
+		"passed":        len(failures) == 0,
+		"failed_checks": failures,
+	}, "Checks completed")
+}
+
+func workflowDefinitionErrorResponse(c *fiber.Ctx, err error) error {
+	var stranded *StrandedEntriesError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return response.NotFound(c, "Workflow")
+	case errors.Is(err, ErrWorkflowInUse), errors.Is(err, ErrWorkflowNameTaken), errors.Is(err, ErrDefaultWorkflow):
+		return response.Conflict(c, err.Error())
+	case errors.As(err, &stranded):
+		return response.Conflict(c, err.Error())
+	}
+	return response.InternalError(c, "Failed to save workflow")
+}
+
+func ListWorkflowDefinitionsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	definitions, err := ListWorkflowDefinitions(ctx)
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch workflows")
+	}
+
+	return response.Success(c, definitions, "Workflows retrieved successfully")
+}
+
+func GetWorkflowDefinitionHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("workflow_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid workflow ID", nil)
+	}
+
+	definition, err := GetWorkflowDefinition(ctx, uint(id))
+	if err != nil {
+		return response.NotFound(c, "Workflow")
+	}
+
+	return response.Success(c, definition, "Workflow retrieved successfully")
+}
+
+func CreateWorkflowDefinitionHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	var body WorkflowDefinitionInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	if errs := validateWorkflowDefinition(body); len(errs) > 0 {
+		return response.ValidationError(c, errs)
+	}
+
+	definition, err := CreateWorkflowDefinition(ctx, body)
+	if err != nil {
+		return workflowDefinitionErrorResponse(c, err)
+	}
+
+	return response.Created(c, definition, "Workflow created successfully")
+}
+
+func UpdateWorkflowDefinitionHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("workflow_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid workflow ID", nil)
+	}
+
+	var body WorkflowDefinitionInput
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	if errs := validateWorkflowDefinition(body); len(errs) > 0 {
+		return response.ValidationError(c, errs)
+	}
+
+	definition, err := UpdateWorkflowDefinition(ctx, uint(id), body)
+	if err != nil {
+		return workflowDefinitionErrorResponse(c, err)
+	}
+
+	return response.Success(c, definition, "Workflow updated successfully")
+}
+
+func DeleteWorkflowDefinitionHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("workflow_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid workflow ID", nil)
+	}
+
+	if err := DeleteWorkflowDefinition(ctx, uint(id)); err != nil {
+		return workflowDefinitionErrorResponse(c, err)
+	}
+
+	return response.NoContent(c)
+}
+
+func AssignContentTypeWorkflowHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	contentTypeID, err := c.ParamsInt("content_type_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid content type ID", nil)
+	}
+
+	var body struct {
+		WorkflowID *uint `json:"workflow_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+
+	ct, err := AssignContentTypeWorkflow(ctx, uint(contentTypeID), body.WorkflowID)
+	if err != nil {
+		return workflowDefinitionErrorResponse(c, err)
+	}
+
+	return response.Success(c, ct, "Workflow assigned successfully")
+}
+
+func GetContentTypeWorkflowHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	contentTypeID, err := c.ParamsInt("content_type_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid content type ID", nil)
+	}
+
+	definition, err := WorkflowForContentType(ctx, uint(contentTypeID))
+	if err != nil {
+		return response.InternalError(c, "Failed to resolve workflow")
+	}
+
+	if definition == nil {
+		builtin := builtinWorkflow()
+		definition = &builtin
+	}
+
+	return response.Success(c, definition, "Workflow retrieved successfully")
+}
+
+func releaseErrorResponse(c *fiber.Ctx, err error) error {
+	var invalid *ReleaseValidationError
+	var stale *StaleVersionError
+	switch {
+	case errors.Is(err, ErrReleaseNotFound):
+		return response.NotFound(c, "Release")
+	case errors.Is(err, ErrReleaseNotEditable), errors.Is(err, ErrReleaseNotReleased), errors.As(err, &stale):
+		return response.Conflict(c, err.Error())
+	case errors.As(err, &invalid):
+		return response.Error(c, fiber.StatusUnprocessableEntity, "RELEASE_INVALID", err.Error(), fiber.Map{
+			"problems": invalid.Problems,
+		})
+	default:
+		return response.BadRequest(c, err.Error(), nil)
+	}
+}
+
+func ListReleasesHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	releases, err := ListReleases(ctx, c.Query("status"))
+	if err != nil {
+		return response.InternalError(c, "Failed to fetch releases")
+	}
+	return response.Success(c, releases, "Releases retrieved successfully")
+}
+
+func GetReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+
+	release, err := loadRelease(ctx, uint(id))
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Release retrieved successfully")
+}
+
+type releaseRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func CreateReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	userID := c.Locals("user_id").(uint)
+
+	var body releaseRequest
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return response.ValidationError(c, map[string]string{"name": "name is required"})
+	}
+
+	release, err := CreateRelease(ctx, body.Name, body.Description, userID)
+	if err != nil {
+		return response.InternalError(c, "Failed to create release")
+	}
+	return response.Created(c, release, "Release created successfully")
+}
+
+func UpdateReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+
+	var body releaseRequest
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return response.ValidationError(c, map[string]string{"name": "name is required"})
+	}
+
+	release, err := UpdateRelease(ctx, uint(id), body.Name, body.Description)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Release updated successfully")
+}
+
+func DeleteReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+
+	if err := DeleteRelease(ctx, uint(id)); err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.NoContent(c)
+}
+
+func AddReleaseItemHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+
+	var body struct {
+		EntryID uint   `json:"entry_id"`
+		Action  string `json:"action"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+	if body.EntryID == 0 {
+		return response.ValidationError(c, map[string]string{"entry_id": "entry_id is required"})
+	}
+	if body.Action == "" {
+		body.Action = models.ReleaseActionPublish
+	}
+
+	release, err := AddReleaseItem(ctx, uint(id), body.EntryID, body.Action)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Entry added to release")
+}
+
+func RemoveReleaseItemHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+	entryID, err := c.ParamsInt("entry_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid entry ID", nil)
+	}
+
+	release, err := RemoveReleaseItem(ctx, uint(id), uint(entryID))
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Entry removed from release")
+}
+
+func ValidateReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+	userID := c.Locals("user_id").(uint)
+
+	release, err := loadRelease(ctx, uint(id))
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+
+	problems, err := ValidateRelease(ctx, release, userID)
+	if err != nil {
+		return response.InternalError(c, "Failed to validate release")
+	}
+
+	return response.Success(c, fiber.Map{
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	}, "Release validated")
+}
+
+func RunReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+	userID := c.Locals("user_id").(uint)
+
+	release, err := RunRelease(ctx, uint(id), userID)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Release published successfully")
+}
+
+func ScheduleReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+	userID := c.Locals("user_id").(uint)
+
+	var body struct {
+		ScheduledAt *time.Time `json:"scheduled_at"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return response.BadRequest(c, "Invalid request body", err.Error())
+	}
+	if body.ScheduledAt == nil {
+		return response.ValidationError(c, map[string]string{"scheduled_at": "scheduled_at is required"})
+	}
+
+	release, err := ScheduleRelease(ctx, uint(id), userID, *body.ScheduledAt)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Release scheduled successfully")
+}
+
+func CancelReleaseScheduleHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+
+	release, err := CancelReleaseSchedule(ctx, uint(id))
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Release schedule cancelled")
+}
+
+func RollbackReleaseHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := c.ParamsInt("release_id")
+	if err != nil {
+		return response.BadRequest(c, "Invalid release ID", nil)
+	}
+	userID := c.Locals("user_id").(uint)
+
+	release, err := RollbackRelease(ctx, uint(id), userID)
+	if err != nil {
+		return releaseErrorResponse(c, err)
+	}
+	return response.Success(c, release, "Release rolled back successfully")
+}
+
+// parseAnalyticsTime accepts RFC 3339 timestamps or plain dates.
+func parseAnalyticsTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func GetWorkflowAnalyticsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	filter := AnalyticsFilter{
+		ContentTypeID: uint(c.QueryInt("content_type_id", 0)),
+		To:            time.Now(),
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, err := parseAnalyticsTime(to)
+		if err != nil {
+			return response.BadRequest(c, "Invalid to date", nil)
+		}
+		if len(to) == len("2006-01-02") {
+			// A plain date includes the whole day.
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		filter.To = t
+	}
+
+	filter.From = filter.To.AddDate(0, 0, -90)
+	if from := c.Query("from"); from != "" {
+		t, err := parseAnalyticsTime(from)
+		if err != nil {
+			return response.BadRequest(c, "Invalid from date", nil)
+		}
+		filter.From = t
+	}
+
+	if filter.From.After(filter.To) {
+		return response.BadRequest(c, "from must be before to", nil)
+	}
+
+	analytics, err := GetWorkflowAnalytics(ctx, filter)
+	if err != nil {
+		return response.InternalError(c, "Failed to compute workflow analytics")
+	}
+
+	return response.Success(c, analytics, "Workflow analytics retrieved successfully")
+}
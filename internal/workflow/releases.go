@@ -0,0 +1,506 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
+	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReleaseNotFound    = errors.New("release not found")
+	ErrReleaseNotEditable = errors.New("release has already run and can no longer be changed")
+	ErrReleaseNotReleased = errors.New("only released releases can be rolled back")
+)
+
+type ReleaseProblem struct {
+	EntryID uint   `json:"entry_id,omitempty"`
+	Message string `json:"message"`
+}
+
+// ReleaseValidationError lists every reason a release cannot run; nothing is
+// applied while any remain.
+type ReleaseValidationError struct {
+	Problems []ReleaseProblem
+}
+
+func (e *ReleaseValidationError) Error() string {
+	return fmt.Sprintf("release cannot run: %d problems found", len(e.Problems))
+}
+
+func releaseTarget(action string) (from, to models.WorkflowStatus) {
+	if action == models.ReleaseActionUnpublish {
+		return models.StatusPublished, models.StatusDraft
+	}
+	return models.StatusApproved, models.StatusPublished
+}
+
+// rollbackTarget is the status that undoes a release action: published
+// entries are unpublished and unpublished entries are published again.
+func rollbackTarget(action string) models.WorkflowStatus {
+	if action == models.ReleaseActionUnpublish {
+		return models.StatusPublished
+	}
+	return models.StatusDraft
+}
+
+func releaseEditable(release *models.Release) bool {
+	switch release.Status {
+	case models.ReleaseDraft, models.ReleaseScheduled, models.ReleaseFailed:
+		return true
+	}
+	return false
+}
+
+func loadRelease(ctx context.Context, id uint) (*models.Release, error) {
+	var release models.Release
+	if err := database.DB.WithContext(ctx).
+		Preload("Creator").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Preload("Items.Entry").
+		First(&release, id).Error; err != nil {
+		return nil, ErrReleaseNotFound
+	}
+	return &release, nil
+}
+
+func CreateRelease(ctx context.Context, name, description string, userID uint) (*models.Release, error) {
+	release := models.Release{
+		Name:        name,
+		Description: description,
+		Status:      models.ReleaseDraft,
+		CreatedBy:   userID,
+	}
+	if err := database.DB.WithContext(ctx).Create(&release).Error; err != nil {
+		return nil, err
+	}
+	return loadRelease(ctx, release.ID)
+}
+
+func ListReleases(ctx context.Context, status string) ([]models.Release, error) {
+	var releases []models.Release
+	query := database.DB.WithContext(ctx).Preload("Items")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at DESC").Find(&releases).Error
+	return releases, err
+}
+
+func UpdateRelease(ctx context.Context, id uint, name, description string) (*models.Release, error) {
+	release, err := loadRelease(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !releaseEditable(release) {
+		return nil, ErrReleaseNotEditable
+	}
+
+	if err := database.DB.WithContext(ctx).Model(release).Updates(map[string]interface{}{
+		"name":        name,
+		"description": description,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return loadRelease(ctx, id)
+}
+
+func DeleteRelease(ctx context.Context, id uint) error {
+	release, err := loadRelease(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !releaseEditable(release) {
+		return ErrReleaseNotEditable
+	}
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("release_id = ?", id).Delete(&models.ReleaseItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(release).Error
+	})
+}
+
+func AddReleaseItem(ctx context.Context, releaseID, entryID uint, action string) (*models.Release, error) {
+	if action != models.ReleaseActionPublish && action != models.ReleaseActionUnpublish {
+		return nil, fmt.Errorf("action must be publish or unpublish")
+	}
+
+	release, err := loadRelease(ctx, releaseID)
+	if err != nil {
+		return nil, err
+	}
+	if !releaseEditable(release) {
+		return nil, ErrReleaseNotEditable
+	}
+
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, fmt.Errorf("entry not found")
+	}
+
+	for _, item := range release.Items {
+		if item.EntryID == entryID {
+			return nil, fmt.Errorf("entry %d is already in this release", entryID)
+		}
+	}
+
+	item := models.ReleaseItem{ReleaseID: releaseID, EntryID: entryID, Action: action}
+	if err := database.DB.WithContext(ctx).Create(&item).Error; err != nil {
+		return nil, err
+	}
+	return loadRelease(ctx, releaseID)
+}
+
+func RemoveReleaseItem(ctx context.Context, releaseID, entryID uint) (*models.Release, error) {
+	release, err := loadRelease(ctx, releaseID)
+	if err != nil {
+		return nil, err
+	}
+	if !releaseEditable(release) {
+		return nil, ErrReleaseNotEditable
+	}
+
+	result := database.DB.WithContext(ctx).Where("release_id = ? AND entry_id = ?", releaseID, entryID).Delete(&models.ReleaseItem{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("entry %d is not in this release", entryID)
+	}
+	return loadRelease(ctx, releaseID)
+}
+
+// transitionProblems reports, without changing anything, why user may not
+// move entry from its current status to to.
+func transitionProblems(ctx context.Context, entry *models.ContentEntry, user *models.User, to models.WorkflowStatus) ([]string, error) {
+	if !isValidTransition(ctx, entry.ContentTypeID, entry.Status, to, user) {
+		return []string{fmt.Sprintf("you are not allowed to move this entry from %s to %s", entry.Status, to)}, nil
+	}
+
+	failures, err := CheckTransitionGuards(ctx, entry, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, failure := range failures {
+		messages = append(messages, failure.Message)
+	}
+	return messages, nil
+}
+
+// ValidateRelease checks, without changing anything, that every item can make
+// its transition now: publish items must be approved, unpublish items must be
+// published, userID must be allowed to move each entry, and publish items must
+// pass their transition guards. Guards see the other items at the status the
+// release gives them, so entries published together may relate to each other.
+func ValidateRelease(ctx context.Context, release *models.Release, userID uint) ([]ReleaseProblem, error) {
+	problems := []ReleaseProblem{}
+	if len(release.Items) == 0 {
+		return append(problems, ReleaseProblem{Message: "release has no entries"}), nil
+	}
+
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	pending := make(map[uint]models.WorkflowStatus, len(release.Items))
+	for _, item := range release.Items {
+		_, pending[item.EntryID] = releaseTarget(item.Action)
+	}
+	ctx = withPendingStatuses(ctx, pending)
+
+	for _, item := range release.Items {
+		if item.Entry == nil {
+			problems = append(problems, ReleaseProblem{EntryID: item.EntryID, Message: "entry no longer exists"})
+			continue
+		}
+
+		from, to := releaseTarget(item.Action)
+		if item.Entry.Status != from {
+			problems = append(problems, ReleaseProblem{
+				EntryID: item.EntryID,
+				Message: fmt.Sprintf("entry must be %s to %s, current status: %s", from, item.Action, item.Entry.Status),
+			})
+			continue
+		}
+
+		messages, err := transitionProblems(ctx, item.Entry, &user, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			problems = append(problems, ReleaseProblem{EntryID: item.EntryID, Message: message})
+		}
+
+		before := events.BeforeStatusChange{Entry: item.Entry, From: from, To: to, UserID: userID, Comment: "Release: " + release.Name}
+		if err := events.RunBefore(&before); err != nil {
+			problems = append(problems, ReleaseProblem{EntryID: item.EntryID, Message: err.Error()})
+		}
+	}
+
+	return problems, nil
+}
+
+// RunRelease validates the release and then applies every item in a single
+// transaction, so either all entries change status or none do. The release is
+// claimed first so two runners (e.g. the scheduler on several instances)
+// cannot both apply it.
+func RunRelease(ctx context.Context, id, userID uint) (*models.Release, error) {
+	release, err := loadRelease(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !releaseEditable(release) {
+		return nil, ErrReleaseNotEditable
+	}
+
+	claimed := database.DB.WithContext(ctx).Model(&models.Release{}).
+		Where("id = ? AND status = ?", id, release.Status).
+		Update("status", models.ReleaseRunning)
+	if claimed.Error != nil {
+		return nil, claimed.Error
+	}
+	if claimed.RowsAffected == 0 {
+		return nil, ErrReleaseNotEditable
+	}
+
+	problems, err := ValidateRelease(ctx, release, userID)
+	if err == nil && len(problems) > 0 {
+		err = &ReleaseValidationError{Problems: problems}
+	}
+	if err == nil {
+		err = applyRelease(ctx, release, userID)
+	}
+	if err != nil {
+		database.DB.WithContext(ctx).Model(&models.Release{}).Where("id = ?", id).Update("status", release.Status)
+		return nil, err
+	}
+
+	released, err := loadRelease(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range released.Items {
+		StatusChanged(item.Entry, item.PreviousStatus, userID, "Release: "+released.Name)
+	}
+	return released, nil
+}
+
+func applyRelease(ctx context.Context, release *models.Release, userID uint) error {
+	comment := "Release: " + release.Name
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, item := range release.Items {
+			entry := *item.Entry
+			_, to := releaseTarget(item.Action)
+
+			if err := applyTransitionTx(tx, &entry, userID, to, comment); err != nil {
+				return fmt.Errorf("entry %d: %w", item.EntryID, err)
+			}
+
+			if err := tx.Model(&models.ReleaseItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+				"previous_status": entry.Status,
+				"result_version":  entry.Version + 1,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.Release{}).Where("id = ?", release.ID).Updates(map[string]interface{}{
+			"status":         models.ReleaseReleased,
+			"released_at":    time.Now(),
+			"released_by":    userID,
+			"scheduled_at":   nil,
+			"failure_reason": "",
+		}).Error
+	})
+}
+
+// RollbackRelease reverts a released release: entries it published are
+// unpublished and entries it unpublished are published again. Each entry goes
+// through ChangeWorkflowStatus, so permissions, guards and hooks apply as for
+// any other transition. Every item is checked first, and nothing changes if an
+// entry has been edited or moved since the release ran or may not be reverted.
+func RollbackRelease(ctx context.Context, id, userID uint) (*models.Release, error) {
+	release, err := loadRelease(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != models.ReleaseReleased {
+		return nil, ErrReleaseNotReleased
+	}
+
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	pending := make(map[uint]models.WorkflowStatus, len(release.Items))
+	for _, item := range release.Items {
+		pending[item.EntryID] = rollbackTarget(item.Action)
+	}
+	ctx = withPendingStatuses(ctx, pending)
+
+	problems := []ReleaseProblem{}
+	for _, item := range release.Items {
+		_, released := releaseTarget(item.Action)
+		if item.Entry == nil || item.Entry.Status != released || item.Entry.Version != item.ResultVersion {
+			problems = append(problems, ReleaseProblem{
+				EntryID: item.EntryID,
+				Message: "entry has changed since the release ran",
+			})
+			continue
+		}
+
+		messages, err := transitionProblems(ctx, item.Entry, &user, rollbackTarget(item.Action))
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			problems = append(problems, ReleaseProblem{EntryID: item.EntryID, Message: message})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &ReleaseValidationError{Problems: problems}
+	}
+
+	claimed := database.DB.WithContext(ctx).Model(&models.Release{}).
+		Where("id = ? AND status = ?", id, models.ReleaseReleased).
+		Update("status", models.ReleaseRunning)
+	if claimed.Error != nil {
+		return nil, claimed.Error
+	}
+	if claimed.RowsAffected == 0 {
+		return nil, ErrReleaseNotReleased
+	}
+
+	comment := "Rollback of release: " + release.Name
+	for _, item := range release.Items {
+		target := rollbackTarget(item.Action)
+		if _, err := ChangeWorkflowStatus(ctx, item.EntryID, userID, string(target), comment, item.ResultVersion); err != nil {
+			database.DB.WithContext(ctx).Model(&models.Release{}).Where("id = ?", id).Update("status", models.ReleaseReleased)
+			return nil, fmt.Errorf("entry %d: %w", item.EntryID, err)
+		}
+	}
+
+	if err := database.DB.WithContext(ctx).Model(&models.Release{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":         models.ReleaseRolledBack,
+		"rolled_back_at": time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return loadRelease(ctx, id)
+}
+
+func ScheduleRelease(ctx context.Context, id, userID uint, at time.Time) (*models.Release, error) {
+	if !at.After(time.Now()) {
+		return nil, fmt.Errorf("scheduled_at must be in the future")
+	}
+
+	release, err := loadRelease(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !releaseEditable(release) {
+		return nil, ErrReleaseNotEditable
+	}
+
+	if err := database.DB.WithContext(ctx).Model(release).Updates(map[string]interface{}{
+		"status":       models.ReleaseScheduled,
+		"scheduled_at": at,
+		"scheduled_by": userID,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return loadRelease(ctx, id)
+}
+
+func CancelReleaseSchedule(ctx context.Context, id uint) (*models.Release, error) {
+	release, err := loadRelease(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != models.ReleaseScheduled {
+		return nil, fmt.Errorf("release is not scheduled")
+	}
+
+	if err := database.DB.WithContext(ctx).Model(release).Updates(map[string]interface{}{
+		"status":       models.ReleaseDraft,
+		"scheduled_at": nil,
+		"scheduled_by": nil,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return loadRelease(ctx, id)
+}
+
+// RunScheduledReleases runs every release due at now as the user who scheduled
+// it. A release that cannot run is marked failed with the reason rather than
+// retried every tick.
+func RunScheduledReleases(now time.Time) (int, error) {
+	var due []models.Release
+	if err := database.DB.
+		Where("status = ? AND scheduled_at <= ?", models.ReleaseScheduled, now).
+		Order("scheduled_at ASC").
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, release := range due {
+		var userID uint
+		if release.ScheduledBy != nil {
+			userID = *release.ScheduledBy
+		}
+
+		ctx := database.WithSpace(context.Background(), release.SpaceID)
+		_, err := RunRelease(ctx, release.ID, userID)
+		if err == nil {
+			applied++
+			continue
+		}
+		if errors.Is(err, ErrReleaseNotEditable) {
+			// Another instance picked it up.
+			continue
+		}
+
+		log.Printf("Scheduled release %d failed: %v", release.ID, err)
+		database.DB.WithContext(ctx).Model(&models.Release{}).
+			Where("id = ? AND status = ?", release.ID, models.ReleaseScheduled).
+			Updates(map[string]interface{}{
+				"status":         models.ReleaseFailed,
+				"failure_reason": releaseFailureReason(err),
+			})
+	}
+
+	return applied, nil
+}
+
+func releaseFailureReason(err error) string {
+	var invalid *ReleaseValidationError
+	if !errors.As(err, &invalid) {
+		return err.Error()
+	}
+
+	messages := make([]string, 0, len(invalid.Problems))
+	for _, p := range invalid.Problems {
+		if p.EntryID != 0 {
+			messages = append(messages, fmt.Sprintf("entry %d: %s", p.EntryID, p.Message))
+		} else {
+			messages = append(messages, p.Message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,179 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/models"
+)
+
+type scheduledTransition struct {
+	column   string
+	toStatus models.WorkflowStatus
+	comment  string
+}
+
+// Publishing runs first so an entry whose publish and unpublish times both
+// fall inside one tick still goes up before it comes down.
+var scheduledTransitions = []scheduledTransition{
+	{column: "publish_at", toStatus: models.StatusPublished, comment: "Scheduled publish"},
+	{column: "unpublish_at", toStatus: models.StatusDraft, comment: "Scheduled unpublish"},
+}
+
+func ScheduleEntry(ctx context.Context, entryID, userID uint, publishAt, unpublishAt *time.Time) (*models.ContentEntry, error) {
+	if publishAt == nil && unpublishAt == nil {
+		return nil, fmt.Errorf("publish_at or unpublish_at is required")
+	}
+
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, fmt.Errorf("entry not found")
+	}
+
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"scheduled_by": userID,
+	}
+
+	if publishAt != nil {
+		if !publishAt.After(now) {
+			return nil, fmt.Errorf("publish_at must be in the future")
+		}
+		if entry.Status != models.StatusApproved {
+			return nil, fmt.Errorf("only approved entries can be scheduled for publishing, current status: %s", entry.Status)
+		}
+		if !isValidTransition(ctx, entry.ContentTypeID, models.StatusApproved, models.StatusPublished, &user) {
+			return nil, fmt.Errorf("role %s cannot publish entries", roleName(&user))
+		}
+		updates["publish_at"] = *publishAt
+	}
+
+	if unpublishAt != nil {
+		if !unpublishAt.After(now) {
+			return nil, fmt.Errorf("unpublish_at must be in the future")
+		}
+
+		goLive := publishAt
+		if goLive == nil {
+			goLive = entry.PublishAt
+		}
+		if goLive == nil && entry.Status != models.StatusPublished {
+			return nil, fmt.Errorf("entry must be published or scheduled for publishing before it can be scheduled to unpublish")
+		}
+		if goLive != nil && !unpublishAt.After(*goLive) {
+			return nil, fmt.Errorf("unpublish_at must be after publish_at")
+		}
+		if !isValidTransition(ctx, entry.ContentTypeID, models.StatusPublished, models.StatusDraft, &user) {
+			return nil, fmt.Errorf("role %s cannot unpublish entries", roleName(&user))
+		}
+		updates["unpublish_at"] = *unpublishAt
+	}
+
+	if err := database.DB.WithContext(ctx).Model(&entry).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func CancelSchedule(ctx context.Context, entryID uint) (*models.ContentEntry, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, fmt.Errorf("entry not found")
+	}
+
+	if err := database.DB.WithContext(ctx).Model(&entry).Updates(map[string]interface{}{
+		"publish_at":   nil,
+		"unpublish_at": nil,
+		"scheduled_by": nil,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func GetScheduledEntries(ctx context.Context) ([]models.ContentEntry, error) {
+	var entries []models.ContentEntry
+	err := database.DB.WithContext(ctx).
+		Where("publish_at IS NOT NULL OR unpublish_at IS NOT NULL").
+		Order("COALESCE(publish_at, unpublish_at) ASC").
+		Find(&entries).Error
+
+	return entries, err
+}
+
+// RunScheduledTransitions applies every publish/unpublish that is due at now
+// and returns how many entries changed status. Each transition goes through
+// ChangeWorkflowStatus with the version read here, so when several instances
+// race on the same entry only one update matches and the rest see a stale
+// version and skip it.
+func RunScheduledTransitions(now time.Time) (int, error) {
+	applied := 0
+
+	for _, st := range scheduledTransitions {
+		var due []models.ContentEntry
+		if err := database.DB.
+			Where(st.column+" <= ?", now).
+			Order(st.column + " ASC").
+			Find(&due).Error; err != nil {
+			return applied, err
+		}
+
+		for _, entry := range due {
+			ctx := database.WithSpace(context.Background(), entry.SpaceID)
+			ok, err := runScheduledTransition(ctx, entry, st)
+			if err != nil {
+				log.Printf("Scheduled %s of entry %d failed: %v", st.toStatus, entry.ID, err)
+				continue
+			}
+			if ok {
+				applied++
+			}
+		}
+	}
+
+	return applied, nil
+}
+
+func runScheduledTransition(ctx context.Context, entry models.ContentEntry, st scheduledTransition) (bool, error) {
+	var userID uint
+	if entry.ScheduledBy != nil {
+		userID = *entry.ScheduledBy
+	}
+
+	_, err := ChangeWorkflowStatus(ctx, entry.ID, userID, string(st.toStatus), st.comment, entry.Version)
+	if err == nil {
+		return true, nil
+	}
+
+	var stale *StaleVersionError
+	if errors.As(err, &stale) {
+		return false, nil
+	}
+
+	// The transition can no longer happen (e.g. the entry was edited back to
+	// draft), so drop the schedule rather than retrying it every tick.
+	database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
+		Where("id = ? AND version = ?", entry.ID, entry.Version).
+		Update(st.column, nil)
+
+	return false, err
+}
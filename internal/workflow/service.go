@@ -1,160 +1,357 @@
 package workflow
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Kyz7/cms/internal/database"
+	"github.com/Kyz7/cms/internal/events"
 	"github.com/Kyz7/cms/internal/models"
+	"gorm.io/gorm"
 )
 
-func ChangeWorkflowStatus(entryID, userID uint, toStatus string, comment string) (*models.ContentEntry, error) {
+var ErrEntryNotFound = errors.New("entry not found")
+
+type StaleVersionError struct {
+	CurrentVersion uint
+}
+
+func (e *StaleVersionError) Error() string {
+	return fmt.Sprintf("entry was modified by someone else, current version is %d", e.CurrentVersion)
+}
+
+// ChangeWorkflowStatus moves an entry to toStatus. A non-zero expectedVersion
+// must match the entry's current version; system callers may pass 0.
+func ChangeWorkflowStatus(ctx context.Context, entryID, userID uint, toStatus string, comment string, expectedVersion uint) (*models.ContentEntry, error) {
 	var entry models.ContentEntry
-	if err := database.DB.First(&entry, entryID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
 		return nil, fmt.Errorf("entry not found")
 	}
 
+	if expectedVersion != 0 && expectedVersion != entry.Version {
+		return nil, &StaleVersionError{CurrentVersion: entry.Version}
+	}
+
 	var user models.User
-	if err := database.DB.Preload("Role").First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
 
 	targetStatus := models.WorkflowStatus(toStatus)
 
-	if !isValidTransition(entry.Status, targetStatus, user.Role.Name) {
+	if !isValidTransition(ctx, entry.ContentTypeID, entry.Status, targetStatus, &user) {
 		return nil, fmt.Errorf("invalid status transition from %s to %s for role %s",
-			entry.Status, targetStatus, user.Role.Name)
+			entry.Status, targetStatus, roleName(&user))
 	}
 
-	fromStatus := entry.Status
-	entry.Status = targetStatus
+	stages, err := approvalStages(ctx, entry.ContentTypeID, entry.Status, targetStatus)
+	if err != nil {
+		return nil, err
+	}
+	if len(stages) > 0 {
+		return nil, fmt.Errorf("transition from %s to %s requires stage approvals, use the approve endpoint",
+			entry.Status, targetStatus)
+	}
 
-	if targetStatus == models.StatusPublished {
-		now := time.Now()
-		entry.PublishedAt = &now
+	return applyTransition(ctx, &entry, userID, targetStatus, comment)
+}
+
+// applyTransition runs the transition's guards, then writes the status change
+// and its history row. Callers are responsible for checking that userID may
+// perform it.
+func applyTransition(ctx context.Context, entry *models.ContentEntry, userID uint, targetStatus models.WorkflowStatus, comment string) (*models.ContentEntry, error) {
+	failures, err := CheckTransitionGuards(ctx, entry, targetStatus)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return nil, &GuardError{ToStatus: targetStatus, Failures: failures}
 	}
 
-	if err := database.DB.Save(&entry).Error; err != nil {
+	before := events.BeforeStatusChange{Entry: entry, From: entry.Status, To: targetStatus, UserID: userID, Comment: comment}
+	if err := events.RunBefore(&before); err != nil {
 		return nil, err
 	}
+	comment = before.Comment
 
-	history := models.WorkflowHistory{
-		EntryID:    entryID,
-		FromStatus: fromStatus,
-		ToStatus:   targetStatus,
-		ChangedBy:  userID,
-		Comment:    comment,
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return applyTransitionTx(tx, entry, userID, targetStatus, comment)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := database.DB.Create(&history).Error; err != nil {
+
+	var updated models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&updated, entry.ID).Error; err != nil {
 		return nil, err
 	}
 
-	return &entry, nil
+	StatusChanged(&updated, entry.Status, userID, comment)
+
+	return &updated, nil
+}
+
+// StatusChanged announces a committed transition of entry from fromStatus to
+// its current status.
+func StatusChanged(entry *models.ContentEntry, fromStatus models.WorkflowStatus, userID uint, comment string) {
+	events.Publish(events.StatusChanged{
+		Entry:   *entry,
+		From:    fromStatus,
+		To:      entry.Status,
+		UserID:  userID,
+		Comment: comment,
+	})
+}
+
+// TransitionTx moves entry to targetStatus inside tx, for writes that change
+// an entry's status along with other rows, such as an environment promotion.
+// Before hooks run and the history row is written as for any transition; the
+// caller checks the move with CheckTransition and announces it with
+// StatusChanged once tx commits.
+func TransitionTx(tx *gorm.DB, entry *models.ContentEntry, userID uint, targetStatus models.WorkflowStatus, comment string) error {
+	before := events.BeforeStatusChange{Entry: entry, From: entry.Status, To: targetStatus, UserID: userID, Comment: comment}
+	if err := events.RunBefore(&before); err != nil {
+		return err
+	}
+	return applyTransitionTx(tx, entry, userID, targetStatus, before.Comment)
+}
+
+// CheckTransition reports, without changing anything, why userID may not move
+// entry from its status to targetStatus directly: the workflow has to allow
+// the move and userID to make it, the move can't need stage approvals, and
+// its guards have to pass. Callers of TransitionTx use it before they open tx.
+func CheckTransition(ctx context.Context, entry *models.ContentEntry, userID uint, targetStatus models.WorkflowStatus) ([]string, error) {
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	messages, err := transitionProblems(ctx, entry, &user, targetStatus)
+	if err != nil || len(messages) > 0 {
+		return messages, err
+	}
+
+	stages, err := approvalStages(ctx, entry.ContentTypeID, entry.Status, targetStatus)
+	if err != nil {
+		return nil, err
+	}
+	if len(stages) > 0 {
+		return []string{fmt.Sprintf("moving this entry from %s to %s requires stage approvals", entry.Status, targetStatus)}, nil
+	}
+	return nil, nil
 }
 
-func isValidTransition(fromStatus, toStatus models.WorkflowStatus, userRole string) bool {
-	transitions := map[models.WorkflowStatus]map[models.WorkflowStatus][]string{
-		models.StatusDraft: {
-			models.StatusInReview: {"editor", "admin"},
-		},
-		models.StatusInReview: {
-			models.StatusReadyForApproval: {"editor", "admin"},
-			models.StatusRejected:         {"editor", "admin"},
-			models.StatusDraft:            {"editor", "admin"},
-		},
-		models.StatusReadyForApproval: {
-			models.StatusApproved: {"manager", "admin"},
-			models.StatusRejected: {"manager", "admin"},
-		},
-		models.StatusApproved: {
-			models.StatusPublished: {"manager", "admin"},
-		},
-		models.StatusRejected: {
-			models.StatusDraft: {"editor", "admin"},
-		},
+// applyTransitionTx writes the status change and its history row inside tx,
+// failing with a StaleVersionError if the entry moved on since it was read.
+func applyTransitionTx(tx *gorm.DB, entry *models.ContentEntry, userID uint, targetStatus models.WorkflowStatus, comment string) error {
+	fromStatus := entry.Status
+	updates := map[string]interface{}{
+		"status":  targetStatus,
+		"version": gorm.Expr("version + 1"),
+	}
+
+	if targetStatus == models.StatusPublished {
+		updates["published_at"] = time.Now()
+		updates["publish_at"] = nil
+	}
+	if fromStatus == models.StatusPublished {
+		updates["published_at"] = nil
+		updates["unpublish_at"] = nil
 	}
 
-	allowedRoles, exists := transitions[fromStatus][toStatus]
-	if !exists {
-		return false
+	result := tx.Model(&models.ContentEntry{}).
+		Where("id = ? AND version = ?", entry.ID, entry.Version).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var current models.ContentEntry
+		tx.Select("version").First(&current, entry.ID)
+		return &StaleVersionError{CurrentVersion: current.Version}
 	}
 
-	for _, role := range allowedRoles {
-		if role == userRole {
-			return true
-		}
+	history := models.WorkflowHistory{
+		EntryID:      entry.ID,
+		FromStatus:   fromStatus,
+		ToStatus:     targetStatus,
+		ChangedBy:    userID,
+		Comment:      comment,
+		EntryVersion: entry.Version,
 	}
-	return false
+	return tx.Create(&history).Error
 }
 
-func GetWorkflowHistory(entryID uint) ([]models.WorkflowHistory, error) {
+func GetWorkflowHistory(ctx context.Context, entryID uint) ([]models.WorkflowHistory, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, ErrEntryNotFound
+	}
+
 	var history []models.WorkflowHistory
-	err := database.DB.
+	err := database.DB.WithContext(ctx).
 		Where("entry_id = ?", entryID).
 		Preload("User").
+		Preload("Stage").
 		Order("created_at DESC").
 		Find(&history).Error
 
 	return history, err
 }
 
-func AddWorkflowComment(entryID, userID uint, comment string, isPrivate bool) (*models.WorkflowComment, error) {
+// AddWorkflowComment starts a thread, or replies to one when ParentID is set.
+// Replies to a reply join the same thread, and take their privacy from it.
+func AddWorkflowComment(ctx context.Context, entryID, userID uint, input CommentInput) (*models.WorkflowComment, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, fmt.Errorf("entry not found")
+	}
+
 	wfComment := models.WorkflowComment{
 		EntryID:   entryID,
 		UserID:    userID,
-		Comment:   comment,
-		IsPrivate: isPrivate,
+		Comment:   input.Comment,
+		IsPrivate: input.IsPrivate,
 	}
 
-	if err := database.DB.Create(&wfComment).Error; err != nil {
+	if input.ParentID != nil {
+		var parent models.WorkflowComment
+		if err := database.DB.WithContext(ctx).Where("entry_id = ?", entryID).First(&parent, *input.ParentID).Error; err != nil {
+			return nil, fmt.Errorf("parent comment not found on this entry")
+		}
+		if input.FieldName != "" || input.RangeStart != nil {
+			return nil, fmt.Errorf("replies cannot be anchored, the thread's anchor applies")
+		}
+
+		rootID := parent.ID
+		if parent.ParentID != nil {
+			rootID = *parent.ParentID
+			database.DB.WithContext(ctx).First(&parent, rootID)
+		}
+		wfComment.ParentID = &rootID
+		wfComment.IsPrivate = parent.IsPrivate
+	} else {
+		if err := validateCommentAnchor(ctx, &entry, input); err != nil {
+			return nil, err
+		}
+		wfComment.FieldName = input.FieldName
+		wfComment.RangeStart = input.RangeStart
+		wfComment.RangeEnd = input.RangeEnd
+	}
+
+	mentioned := parseMentions(ctx, input.Comment, userID)
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&wfComment).Error; err != nil {
+			return err
+		}
+		for _, user := range mentioned {
+			if err := tx.Create(&models.CommentMention{CommentID: wfComment.ID, UserID: user.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	database.DB.Preload("User").First(&wfComment, wfComment.ID)
+	database.DB.WithContext(ctx).Preload("User").Preload("Mentions.User").First(&wfComment, wfComment.ID)
+	for i := range mentioned {
+		mentionNotifier(&wfComment, &mentioned[i])
+	}
+	events.Publish(events.CommentAdded{Comment: wfComment, Entry: entry, Mentioned: mentioned})
+
 	return &wfComment, nil
 }
 
-func GetWorkflowComments(entryID uint, includePrivate bool) ([]models.WorkflowComment, error) {
+// GetWorkflowComments returns the entry's threads, newest first, each with its
+// replies in the order they were written.
+func GetWorkflowComments(ctx context.Context, entryID uint, filter CommentFilter) ([]models.WorkflowComment, error) {
 	var comments []models.WorkflowComment
-	query := database.DB.Where("entry_id = ?", entryID)
+	query := database.DB.WithContext(ctx).Where("entry_id = ? AND parent_id IS NULL", entryID)
 
-	if !includePrivate {
+	if !filter.IncludePrivate {
 		query = query.Where("is_private = ?", false)
 	}
+	if filter.FieldName != "" {
+		query = query.Where("field_name = ?", filter.FieldName)
+	}
+	if filter.Resolved != nil {
+		query = query.Where("resolved = ?", *filter.Resolved)
+	}
 
 	err := query.
 		Preload("User").
+		Preload("Mentions.User").
+		Preload("Replies", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC")
+		}).
+		Preload("Replies.User").
+		Preload("Replies.Mentions.User").
 		Order("created_at DESC").
 		Find(&comments).Error
 
 	return comments, err
 }
 
-func AssignEntry(entryID, assignedTo, assignedBy uint, dueDate *time.Time) (*models.WorkflowAssignment, error) {
+// AssignEntry gives the entry to assignedTo or, when that is nil, to the pool
+// of users with assignedRole.
+func AssignEntry(ctx context.Context, entryID uint, assignedTo *uint, assignedRole string, assignedBy uint, dueDate *time.Time) (*models.WorkflowAssignment, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, ErrEntryNotFound
+	}
+	if assignedTo == nil && !roleExists(ctx, assignedRole) {
+		return nil, fmt.Errorf("role %s not found", assignedRole)
+	}
+
 	assignment := models.WorkflowAssignment{
 		EntryID:    entryID,
 		AssignedTo: assignedTo,
 		AssignedBy: assignedBy,
-		Status:     "pending",
+		Status:     AssignmentPending,
 		DueDate:    dueDate,
 	}
+	if assignedTo == nil {
+		assignment.AssignedRole = assignedRole
+	}
 
-	if err := database.DB.Create(&assignment).Error; err != nil {
+	if err := database.DB.WithContext(ctx).Create(&assignment).Error; err != nil {
 		return nil, err
 	}
 
-	database.DB.Preload("User").Preload("Assigner").First(&assignment, assignment.ID)
+	database.DB.WithContext(ctx).Preload("User").Preload("Assigner").First(&assignment, assignment.ID)
+	notifyAssignees(ctx, AssignmentEventAssigned, &assignment)
 	return &assignment, nil
 }
 
-func GetMyAssignments(userID uint, status string) ([]models.WorkflowAssignment, error) {
+// GetMyAssignments lists the user's assignments together with unclaimed ones
+// for their role. due narrows the list to "overdue" or "due_soon" pending
+// assignments, the latter meaning due within the next window.
+func GetMyAssignments(ctx context.Context, userID uint, status, due string, window time.Duration) ([]models.WorkflowAssignment, error) {
+	var user models.User
+	if err := database.DB.WithContext(ctx).Preload("Role").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
 	var assignments []models.WorkflowAssignment
-	query := database.DB.Where("assigned_to = ?", userID)
+	query := database.DB.WithContext(ctx).Where("assigned_to = ? OR (assigned_to IS NULL AND assigned_role = ?)", userID, roleName(&user))
 
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
 
+	now := time.Now()
+	switch due {
+	case "overdue":
+		query = query.Where("status = ? AND due_date < ?", AssignmentPending, now)
+	case "due_soon":
+		query = query.Where("status = ? AND due_date >= ? AND due_date <= ?", AssignmentPending, now, now.Add(window))
+	}
+
 	err := query.
 		Preload("Entry").
 		Preload("Assigner").
@@ -164,15 +361,15 @@ func GetMyAssignments(userID uint, status string) ([]models.WorkflowAssignment,
 	return assignments, err
 }
 
-func CompleteAssignment(assignmentID uint) error {
-	return database.DB.Model(&models.WorkflowAssignment{}).
+func CompleteAssignment(ctx context.Context, assignmentID uint) error {
+	return database.DB.WithContext(ctx).Model(&models.WorkflowAssignment{}).
 		Where("id = ?", assignmentID).
-		Update("status", "completed").Error
+		Update("status", AssignmentCompleted).Error
 }
 
-func GetEntriesByStatus(contentTypeID uint, status string) ([]models.ContentEntry, error) {
+func GetEntriesByStatus(ctx context.Context, contentTypeID uint, status string) ([]models.ContentEntry, error) {
 	var entries []models.ContentEntry
-	query := database.DB.Where("content_type_id = ?", contentTypeID)
+	query := database.DB.WithContext(ctx).Where("content_type_id = ?", contentTypeID)
 
 	if status != "" {
 		query = query.Where("status = ?", status)
@@ -182,9 +379,9 @@ func GetEntriesByStatus(contentTypeID uint, status string) ([]models.ContentEntr
 	return entries, err
 }
 
-func RequestReview(entryID, userID uint, comment string) (*models.ContentEntry, error) {
+func RequestReview(ctx context.Context, entryID, userID uint, comment string, expectedVersion uint) (*models.ContentEntry, error) {
 	var entry models.ContentEntry
-	if err := database.DB.First(&entry, entryID).Error; err != nil {
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
 		return nil, fmt.Errorf("entry not found")
 	}
 
@@ -192,62 +389,67 @@ func RequestReview(entryID, userID uint, comment string) (*models.ContentEntry,
 		return nil, fmt.Errorf("can only request review from draft status, current status: %s", entry.Status)
 	}
 
-	return ChangeWorkflowStatus(entryID, userID, string(models.StatusInReview), comment)
+	return ChangeWorkflowStatus(ctx, entryID, userID, string(models.StatusInReview), comment, expectedVersion)
 }
 
-func ApproveEntry(entryID, userID uint, comment string) (*models.ContentEntry, error) {
-	return ChangeWorkflowStatus(entryID, userID, string(models.StatusApproved), comment)
+func PublishEntry(ctx context.Context, entryID, userID uint, comment string, expectedVersion uint) (*models.ContentEntry, error) {
+	return ChangeWorkflowStatus(ctx, entryID, userID, string(models.StatusPublished), comment, expectedVersion)
 }
 
-func RejectEntry(entryID, userID uint, comment string) (*models.ContentEntry, error) {
-	return ChangeWorkflowStatus(entryID, userID, string(models.StatusRejected), comment)
-}
-
-func PublishEntry(entryID, userID uint, comment string) (*models.ContentEntry, error) {
-	return ChangeWorkflowStatus(entryID, userID, string(models.StatusPublished), comment)
-}
-
-func GetWorkflowStatistics(contentTypeID uint) (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
+func UnpublishEntry(ctx context.Context, entryID, userID uint, comment string, expectedVersion uint) (*models.ContentEntry, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, fmt.Errorf("entry not found")
+	}
 
-	var total int64
-	database.DB.Model(&models.ContentEntry{}).
-		Where("content_type_id = ?", contentTypeID).
-		Count(&total)
+	if entry.Status != models.StatusPublished {
+		return nil, fmt.Errorf("can only unpublish published entries, current status: %s", entry.Status)
+	}
 
-	var draft, inReview, readyForApproval, approved, published, rejected int64
+	return ChangeWorkflowStatus(ctx, entryID, userID, string(models.StatusDraft), comment, expectedVersion)
+}
 
-	database.DB.Model(&models.ContentEntry{}).
-		Where("content_type_id = ? AND status = ?", contentTypeID, models.StatusDraft).
-		Count(&draft)
+func ArchiveEntry(ctx context.Context, entryID, userID uint, comment string, expectedVersion uint) (*models.ContentEntry, error) {
+	return ChangeWorkflowStatus(ctx, entryID, userID, string(models.StatusArchived), comment, expectedVersion)
+}
 
-	database.DB.Model(&models.ContentEntry{}).
-		Where("content_type_id = ? AND status = ?", contentTypeID, models.StatusInReview).
-		Count(&inReview)
+func RestoreEntry(ctx context.Context, entryID, userID uint, comment string, expectedVersion uint) (*models.ContentEntry, error) {
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).First(&entry, entryID).Error; err != nil {
+		return nil, fmt.Errorf("entry not found")
+	}
 
-	database.DB.Model(&models.ContentEntry{}).
-		Where("content_type_id = ? AND status = ?", contentTypeID, models.StatusReadyForApproval).
-		Count(&readyForApproval)
+	if entry.Status != models.StatusArchived {
+		return nil, fmt.Errorf("can only restore archived entries, current status: %s", entry.Status)
+	}
 
-	database.DB.Model(&models.ContentEntry{}).
-		Where("content_type_id = ? AND status = ?", contentTypeID, models.StatusApproved).
-		Count(&approved)
+	return ChangeWorkflowStatus(ctx, entryID, userID, string(models.StatusDraft), comment, expectedVersion)
+}
 
-	database.DB.Model(&models.ContentEntry{}).
-		Where("content_type_id = ? AND status = ?", contentTypeID, models.StatusPublished).
-		Count(&published)
+func GetWorkflowStatistics(ctx context.Context, contentTypeID uint) (map[string]interface{}, error) {
+	var rows []struct {
+		Status models.WorkflowStatus
+		Count  int64
+	}
+	if err := database.DB.WithContext(ctx).Model(&models.ContentEntry{}).
+		Select("status, COUNT(*) AS count").
+		Where("content_type_id = ?", contentTypeID).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
 
-	database.DB.Model(&models.ContentEntry{}).
-		Where("content_type_id = ? AND status = ?", contentTypeID, models.StatusRejected).
-		Count(&rejected)
+	stats := make(map[string]interface{})
+	for _, status := range models.WorkflowStatuses {
+		stats[string(status)] = int64(0)
+	}
 
+	var total int64
+	for _, row := range rows {
+		stats[string(row.Status)] = row.Count
+		total += row.Count
+	}
 	stats["total"] = total
-	stats["draft"] = draft
-	stats["in_review"] = inReview
-	stats["ready_for_approval"] = readyForApproval
-	stats["approved"] = approved
-	stats["published"] = published
-	stats["rejected"] = rejected
 
 	return stats, nil
 }